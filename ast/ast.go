@@ -42,13 +42,17 @@ func (pgr *RootStatement) String() string {
 }
 
 type LetStatement struct {
-	Token token.Token // the token.LET token
+	Token token.Token // the token.LET or token.CONST token
 	Name  *Identifier
 	Value Expression
 }
 
 func (ls *LetStatement) statementNode() {}
 
+// IsConstant reports whether the statement is a `const`, whose binding cannot
+// be assigned to.
+func (ls *LetStatement) IsConstant() bool { return ls.Token.Type == token.CONST }
+
 func (ls *LetStatement) TokenLiteral() string { return ls.Token.Literal }
 
 func (ls *LetStatement) String() string {
@@ -65,6 +69,77 @@ func (ls *LetStatement) String() string {
 	return out.String()
 }
 
+// MultiLetStatement binds each of Names to the value at the same position in
+// Values. All values are evaluated before any name is bound, so that
+// `let a, b = b, a` swaps a and b.
+type MultiLetStatement struct {
+	Token  token.Token // the token.LET token
+	Names  []*Identifier
+	Values []Expression
+}
+
+func (ms *MultiLetStatement) statementNode() {}
+
+func (ms *MultiLetStatement) TokenLiteral() string { return ms.Token.Literal }
+
+func (ms *MultiLetStatement) String() string {
+	var (
+		names  = make([]string, len(ms.Names))
+		values = make([]string, len(ms.Values))
+	)
+	for i, name := range ms.Names {
+		names[i] = name.String()
+	}
+	for i, value := range ms.Values {
+		values[i] = value.String()
+	}
+	return ms.TokenLiteral() + " " + strings.Join(names, ", ") + " = " + strings.Join(values, ", ") + ";"
+}
+
+// ArrayLetStatement binds Names to the elements of an array by position, and
+// Rest, if any, to an array of the elements after them.
+type ArrayLetStatement struct {
+	Token token.Token // the token.LET token
+	Names []*Identifier
+	Rest  *Identifier
+	Value Expression
+}
+
+func (as *ArrayLetStatement) statementNode() {}
+
+func (as *ArrayLetStatement) TokenLiteral() string { return as.Token.Literal }
+
+func (as *ArrayLetStatement) String() string {
+	names := make([]string, 0, len(as.Names)+1)
+	for _, name := range as.Names {
+		names = append(names, name.String())
+	}
+	if as.Rest != nil {
+		names = append(names, "..."+as.Rest.String())
+	}
+	return as.TokenLiteral() + " [" + strings.Join(names, ", ") + "] = " + as.Value.String() + ";"
+}
+
+// HashLetStatement binds each of Names to the value under the string key of
+// the same name in a hash.
+type HashLetStatement struct {
+	Token token.Token // the token.LET token
+	Names []*Identifier
+	Value Expression
+}
+
+func (hs *HashLetStatement) statementNode() {}
+
+func (hs *HashLetStatement) TokenLiteral() string { return hs.Token.Literal }
+
+func (hs *HashLetStatement) String() string {
+	names := make([]string, len(hs.Names))
+	for i, name := range hs.Names {
+		names[i] = name.String()
+	}
+	return hs.TokenLiteral() + " {" + strings.Join(names, ", ") + "} = " + hs.Value.String() + ";"
+}
+
 type ReturnStatement struct {
 	Token       token.Token // the token.RETURN token
 	ReturnValue Expression
@@ -85,6 +160,106 @@ func (rs *ReturnStatement) String() string {
 	return out.String()
 }
 
+type AssignStatement struct {
+	Token token.Token // the token.ASSIGN token
+	Name  *Identifier
+	Value Expression
+}
+
+func (as *AssignStatement) statementNode() {}
+
+func (as *AssignStatement) TokenLiteral() string { return as.Token.Literal }
+
+func (as *AssignStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(as.Name.String())
+	out.WriteString(" = ")
+
+	if as.Value != nil {
+		out.WriteString(as.Value.String())
+	}
+	out.WriteString(";")
+	return out.String()
+}
+
+// ForStatement is a C-style loop. Init, Condition and Post are all optional;
+// a missing Condition loops forever.
+type ForStatement struct {
+	Token     token.Token // the token.FOR token
+	Init      Statement
+	Condition Expression
+	Post      Statement
+	Body      *BlockStatement
+}
+
+func (fs *ForStatement) statementNode() {}
+
+func (fs *ForStatement) TokenLiteral() string { return fs.Token.Literal }
+
+func (fs *ForStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("for (")
+	if fs.Init != nil {
+		out.WriteString(strings.TrimSuffix(fs.Init.String(), ";"))
+	}
+	out.WriteString("; ")
+	if fs.Condition != nil {
+		out.WriteString(fs.Condition.String())
+	}
+	out.WriteString("; ")
+	if fs.Post != nil {
+		out.WriteString(strings.TrimSuffix(fs.Post.String(), ";"))
+	}
+	out.WriteString(") ")
+	out.WriteString(fs.Body.String())
+	return out.String()
+}
+
+// DoWhileStatement is a loop whose condition is checked after the body, so
+// that the body runs at least once.
+type DoWhileStatement struct {
+	Token     token.Token // the token.DO token
+	Body      *BlockStatement
+	Condition Expression
+}
+
+func (ds *DoWhileStatement) statementNode() {}
+
+func (ds *DoWhileStatement) TokenLiteral() string { return ds.Token.Literal }
+
+func (ds *DoWhileStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("do ")
+	out.WriteString(ds.Body.String())
+	out.WriteString(" while (")
+	out.WriteString(ds.Condition.String())
+	out.WriteString(");")
+	return out.String()
+}
+
+type BreakStatement struct {
+	Token token.Token // the token.BREAK token
+}
+
+func (bs *BreakStatement) statementNode() {}
+
+func (bs *BreakStatement) TokenLiteral() string { return bs.Token.Literal }
+
+func (bs *BreakStatement) String() string { return bs.TokenLiteral() + ";" }
+
+type ContinueStatement struct {
+	Token token.Token // the token.CONTINUE token
+}
+
+func (cs *ContinueStatement) statementNode() {}
+
+func (cs *ContinueStatement) TokenLiteral() string { return cs.Token.Literal }
+
+func (cs *ContinueStatement) String() string { return cs.TokenLiteral() + ";" }
+
 type Identifier struct {
 	Token token.Token // the token.IDENT token
 	Value string
@@ -152,6 +327,21 @@ func (sl *StringLiteral) TokenLiteral() string { return sl.Token.Literal }
 
 func (sl *StringLiteral) String() string { return sl.Token.Literal }
 
+// InterpolatedString is a string literal with `${...}` interpolations. Its
+// parts are the StringLiterals of the text between the interpolations and the
+// interpolated expressions, in order; the value is their concatenation, with
+// every part that is not a string converted as by `str`.
+type InterpolatedString struct {
+	Token token.Token // the TEMPLATE token
+	Parts []Expression
+}
+
+func (is *InterpolatedString) expressionNode() {}
+
+func (is *InterpolatedString) TokenLiteral() string { return is.Token.Literal }
+
+func (is *InterpolatedString) String() string { return is.Token.Literal }
+
 type PrefixExpression struct {
 	Token    token.Token // the prefix token eg. '!'
 	Operator string
@@ -207,6 +397,16 @@ func (bl *Boolean) TokenLiteral() string { return bl.Token.Literal }
 
 func (bl *Boolean) String() string { return bl.Token.Literal }
 
+type NullLiteral struct {
+	Token token.Token // the token.NULL token
+}
+
+func (nl *NullLiteral) expressionNode() {}
+
+func (nl *NullLiteral) TokenLiteral() string { return nl.Token.Literal }
+
+func (nl *NullLiteral) String() string { return nl.Token.Literal }
+
 type IfExpression struct {
 	Token       token.Token
 	Condition   Expression
@@ -233,9 +433,53 @@ func (ie *IfExpression) String() string {
 	return out.String()
 }
 
+// SwitchExpression compares Subject, evaluated once, with the value of each
+// case in turn and results in the body of the first that is equal, or else in
+// the Default body. There is no fallthrough. Without a match or a default,
+// the result is null.
+type SwitchExpression struct {
+	Token   token.Token // the token.SWITCH token
+	Subject Expression
+	Cases   []*SwitchCase
+	Default *BlockStatement // nil if there is no default case
+}
+
+func (se *SwitchExpression) expressionNode() {}
+
+func (se *SwitchExpression) TokenLiteral() string { return se.Token.Literal }
+
+func (se *SwitchExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("switch (")
+	out.WriteString(se.Subject.String())
+	out.WriteString(") {")
+	for _, sc := range se.Cases {
+		out.WriteString(" case ")
+		out.WriteString(sc.Value.String())
+		out.WriteString(": ")
+		out.WriteString(sc.Body.String())
+	}
+	if se.Default != nil {
+		out.WriteString(" default: ")
+		out.WriteString(se.Default.String())
+	}
+	out.WriteString(" }")
+	return out.String()
+}
+
+// SwitchCase is one `case value: body` of a switch.
+type SwitchCase struct {
+	Token token.Token // the token.CASE token
+	Value Expression
+	Body  *BlockStatement
+}
+
 type FunctionLiteral struct {
 	Token      token.Token // the 'fn' token
 	Parameters []*Identifier
+	Defaults   []Expression // default value of each parameter, nil where there is none
+	Variadic   bool         // the last parameter collects the remaining arguments
 	Body       *BlockStatement
 }
 
@@ -247,9 +491,16 @@ func (fl *FunctionLiteral) String() string {
 	var out bytes.Buffer
 	var params []string
 
-	for _, prm := range fl.Parameters {
+	for i, prm := range fl.Parameters {
+		if i < len(fl.Defaults) && fl.Defaults[i] != nil {
+			params = append(params, prm.String()+" = "+fl.Defaults[i].String())
+			continue
+		}
 		params = append(params, prm.String())
 	}
+	if fl.Variadic {
+		params[len(params)-1] = "..." + params[len(params)-1]
+	}
 	out.WriteString(fl.TokenLiteral())
 	out.WriteString("(")
 	out.WriteString(strings.Join(params, ", "))
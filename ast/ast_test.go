@@ -25,3 +25,77 @@ func TestString(t *testing.T) {
 		t.Errorf("root.String() wrong. got=%q", root.String())
 	}
 }
+
+func TestToJSON(t *testing.T) {
+	// let x = 1 + 2;
+	root := &RootStatement{
+		Statements: []Statement{
+			&LetStatement{
+				Token: token.Token{Type: token.LET, Literal: "let"},
+				Name: &Identifier{
+					Token: token.Token{Type: token.IDENT, Literal: "x"},
+					Value: "x",
+				},
+				Value: &InfixExpression{
+					Token:    token.Token{Type: token.PLUS, Literal: "+"},
+					Left:     &IntegerLiteral{Token: token.Token{Type: token.INT, Literal: "1"}, Value: 1},
+					Operator: "+",
+					Right:    &IntegerLiteral{Token: token.Token{Type: token.INT, Literal: "2"}, Value: 2},
+				},
+			},
+		},
+	}
+	expected := `{"statements":[{"name":{"type":"Identifier","value":"x"},"type":"LetStatement",` +
+		`"value":{"left":{"type":"IntegerLiteral","value":1},"operator":"+",` +
+		`"right":{"type":"IntegerLiteral","value":2},"type":"InfixExpression"}}],"type":"RootStatement"}`
+
+	output, err := ToJSON(root)
+	if err != nil {
+		t.Fatalf("ToJSON error: %s", err)
+	}
+	if string(output) != expected {
+		t.Errorf("ToJSON wrong.\nwant=%s\ngot= %s", expected, output)
+	}
+}
+
+func TestToJSONOrdersHashPairs(t *testing.T) {
+	str := func(s string) Expression {
+		return &StringLiteral{Token: token.Token{Type: token.STRING, Literal: s}, Value: s}
+	}
+	hash := &HashLiteral{Pairs: map[Expression]Expression{}}
+	for _, key := range []string{"c", "a", "d", "b"} {
+		hash.Pairs[str(key)] = &Boolean{Value: true}
+	}
+	expected := `{"pairs":[` +
+		`{"key":{"type":"StringLiteral","value":"a"},"value":{"type":"Boolean","value":true}},` +
+		`{"key":{"type":"StringLiteral","value":"b"},"value":{"type":"Boolean","value":true}},` +
+		`{"key":{"type":"StringLiteral","value":"c"},"value":{"type":"Boolean","value":true}},` +
+		`{"key":{"type":"StringLiteral","value":"d"},"value":{"type":"Boolean","value":true}}` +
+		`],"type":"HashLiteral"}`
+
+	for i := 0; i < 10; i++ {
+		output, err := ToJSON(hash)
+		if err != nil {
+			t.Fatalf("ToJSON error: %s", err)
+		}
+		if string(output) != expected {
+			t.Fatalf("ToJSON wrong.\nwant=%s\ngot= %s", expected, output)
+		}
+	}
+}
+
+func TestToJSONMissingChildren(t *testing.T) {
+	ifExpr := &IfExpression{
+		Condition:   &Boolean{Value: true},
+		Consequence: &BlockStatement{},
+	}
+	output, err := ToJSON(ifExpr)
+	if err != nil {
+		t.Fatalf("ToJSON error: %s", err)
+	}
+	expected := `{"alternative":null,"condition":{"type":"Boolean","value":true},` +
+		`"consequence":{"statements":[],"type":"BlockStatement"},"type":"IfExpression"}`
+	if string(output) != expected {
+		t.Errorf("ToJSON wrong.\nwant=%s\ngot= %s", expected, output)
+	}
+}
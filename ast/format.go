@@ -0,0 +1,387 @@
+package ast
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"comp/token"
+)
+
+// DefaultIndent is the indentation Format uses for every level of nesting.
+const DefaultIndent = "    "
+
+// infixPrecedence mirrors the operator precedences of the parser. The
+// formatter only puts parentheses around an operand where leaving them out
+// would make it parse differently.
+var infixPrecedence = map[string]int{
+	"||": 1,
+	"&&": 2,
+	"|":  3,
+	"&":  4,
+	"==": 5,
+	"!=": 5,
+	"<":  6,
+	">":  6,
+	"<=": 6,
+	">=": 6,
+	"+":  7,
+	"-":  7,
+	"*":  8,
+	"/":  8,
+	"**": 9,
+}
+
+// Format renders root as canonical source: one statement per line, bodies of
+// functions, conditionals and loops indented, hash literals spread over one
+// line per pair with their values aligned. Parsing the output yields a tree
+// equal to root, so formatting the result again changes nothing.
+func Format(root *RootStatement) string {
+	return FormatIndent(root, DefaultIndent)
+}
+
+// FormatIndent is like Format but indents every level of nesting with indent,
+// such as a tab or a number of spaces.
+func FormatIndent(root *RootStatement, indent string) string {
+	var out strings.Builder
+	fmtr := &formatter{indentUnit: indent}
+	for i, stmt := range root.Statements {
+		out.WriteString(fmtr.statement(stmt, nextStatement(root.Statements, i)))
+		out.WriteString("\n")
+	}
+	return out.String()
+}
+
+type formatter struct {
+	indentUnit string
+	depth      int
+}
+
+func nextStatement(statements []Statement, i int) Statement {
+	if i+1 < len(statements) {
+		return statements[i+1]
+	}
+	return nil
+}
+
+func (fmtr *formatter) indent() string {
+	return strings.Repeat(fmtr.indentUnit, fmtr.depth)
+}
+
+// statement formats stmt without indenting its first line. The statement
+// following it decides whether a conditional needs a terminating semicolon.
+func (fmtr *formatter) statement(stmt, next Statement) string {
+	switch stmt := stmt.(type) {
+	case *LetStatement:
+		return stmt.TokenLiteral() + " " + stmt.Name.Value + " = " + fmtr.expression(stmt.Value) + ";"
+	case *MultiLetStatement:
+		names := make([]string, len(stmt.Names))
+		for i, name := range stmt.Names {
+			names[i] = name.Value
+		}
+		return "let " + strings.Join(names, ", ") + " = " + fmtr.expressionList(stmt.Values) + ";"
+	case *ArrayLetStatement:
+		names := make([]string, 0, len(stmt.Names)+1)
+		for _, name := range stmt.Names {
+			names = append(names, name.Value)
+		}
+		if stmt.Rest != nil {
+			names = append(names, "..."+stmt.Rest.Value)
+		}
+		return "let [" + strings.Join(names, ", ") + "] = " + fmtr.expression(stmt.Value) + ";"
+	case *HashLetStatement:
+		names := make([]string, len(stmt.Names))
+		for i, name := range stmt.Names {
+			names[i] = name.Value
+		}
+		return "let {" + strings.Join(names, ", ") + "} = " + fmtr.expression(stmt.Value) + ";"
+	case *AssignStatement:
+		return stmt.Name.Value + " = " + fmtr.expression(stmt.Value) + ";"
+	case *ReturnStatement:
+		return "return " + fmtr.expression(stmt.ReturnValue) + ";"
+	case *BreakStatement:
+		return "break;"
+	case *ContinueStatement:
+		return "continue;"
+	case *ForStatement:
+		return fmtr.forStatement(stmt)
+	case *DoWhileStatement:
+		return "do " + fmtr.block(stmt.Body) + " while (" + fmtr.expression(stmt.Condition) + ");"
+	case *ExpressionStatement:
+		expr := fmtr.expression(stmt.Expression)
+		switch stmt.Expression.(type) {
+		case *IfExpression, *SwitchExpression:
+			if !continuesExpression(fmtr, next) {
+				return expr
+			}
+		}
+		return expr + ";"
+	}
+	return stmt.String()
+}
+
+// continuesExpression reports whether next would be parsed as part of the
+// expression before it if the two were not separated by a semicolon, as in
+// `if (a) { b } -1`.
+func continuesExpression(fmtr *formatter, next Statement) bool {
+	stmt, ok := next.(*ExpressionStatement)
+	if !ok {
+		return false
+	}
+	expr := fmtr.expression(stmt.Expression)
+	return expr != "" && strings.ContainsAny(expr[:1], "([-")
+}
+
+func (fmtr *formatter) forStatement(stmt *ForStatement) string {
+	var out strings.Builder
+
+	out.WriteString("for (")
+	if stmt.Init != nil {
+		out.WriteString(strings.TrimSuffix(fmtr.statement(stmt.Init, nil), ";"))
+	}
+	out.WriteString(";")
+	if stmt.Condition != nil {
+		out.WriteString(" " + fmtr.expression(stmt.Condition))
+	}
+	out.WriteString(";")
+	if stmt.Post != nil {
+		out.WriteString(" " + strings.TrimSuffix(fmtr.statement(stmt.Post, nil), ";"))
+	}
+	out.WriteString(") ")
+	out.WriteString(fmtr.block(stmt.Body))
+	return out.String()
+}
+
+// block formats the braces and the indented statements of a block.
+func (fmtr *formatter) block(block *BlockStatement) string {
+	if block == nil || len(block.Statements) == 0 {
+		return "{}"
+	}
+	var out strings.Builder
+
+	out.WriteString("{\n")
+	fmtr.depth++
+	for i, stmt := range block.Statements {
+		out.WriteString(fmtr.indent())
+		out.WriteString(fmtr.statement(stmt, nextStatement(block.Statements, i)))
+		out.WriteString("\n")
+	}
+	fmtr.depth--
+	out.WriteString(fmtr.indent() + "}")
+	return out.String()
+}
+
+func (fmtr *formatter) expression(expr Expression) string {
+	switch expr := expr.(type) {
+	case nil:
+		return ""
+	case *Identifier:
+		return expr.Value
+	case *IntegerLiteral:
+		return strconv.FormatInt(expr.Value, 10)
+	case *StringLiteral:
+		return `"` + escapeInterpolation(expr.Value) + `"`
+	case *InterpolatedString:
+		return fmtr.interpolatedString(expr)
+	case *Boolean:
+		return strconv.FormatBool(expr.Value)
+	case *NullLiteral:
+		return "null"
+	case *PrefixExpression:
+		right := fmtr.expression(expr.Right)
+		if _, ok := expr.Right.(*InfixExpression); ok {
+			right = "(" + right + ")"
+		}
+		return expr.Operator + right
+	case *InfixExpression:
+		return fmtr.infixExpression(expr)
+	case *IfExpression:
+		return fmtr.ifExpression(expr)
+	case *SwitchExpression:
+		return fmtr.switchExpression(expr)
+	case *FunctionLiteral:
+		return fmtr.functionLiteral(expr)
+	case *CallExpression:
+		return fmtr.operand(expr.Function) + "(" + fmtr.expressionList(expr.Arguments) + ")"
+	case *ArrayLiteral:
+		return "[" + fmtr.expressionList(expr.Elements) + "]"
+	case *IndexExpression:
+		return fmtr.operand(expr.Left) + "[" + fmtr.expression(expr.Index) + "]"
+	case *HashLiteral:
+		return fmtr.hashLiteral(expr)
+	}
+	return expr.String()
+}
+
+// interpolatedString formats the text of expr as is and its interpolations
+// as `${expression}`.
+func (fmtr *formatter) interpolatedString(expr *InterpolatedString) string {
+	var out strings.Builder
+
+	out.WriteString(`"`)
+	for _, part := range expr.Parts {
+		if text, ok := part.(*StringLiteral); ok {
+			out.WriteString(escapeInterpolation(text.Value))
+			continue
+		}
+		out.WriteString("${" + fmtr.expression(part) + "}")
+	}
+	out.WriteString(`"`)
+	return out.String()
+}
+
+// escapeInterpolation escapes every `${` in the text of a string literal, so
+// that it is not read back as an interpolation.
+func escapeInterpolation(text string) string {
+	return strings.ReplaceAll(text, "${", `\${`)
+}
+
+// operand formats the callee of a call or the left side of an index
+// expression, which binds tighter than any prefix or infix operator.
+func (fmtr *formatter) operand(expr Expression) string {
+	switch expr.(type) {
+	case *PrefixExpression, *InfixExpression:
+		return "(" + fmtr.expression(expr) + ")"
+	}
+	return fmtr.expression(expr)
+}
+
+// infixExpression parenthesizes an operand only if its operator binds less
+// tightly than expr's. All operators but `**` are left-associative, so on the
+// right side the same precedence needs parentheses too; for `**` it is the
+// left side.
+func (fmtr *formatter) infixExpression(expr *InfixExpression) string {
+	var (
+		precedence = infixPrecedence[expr.Operator]
+		leftMin    = precedence
+		rightMin   = precedence + 1
+	)
+	if expr.Operator == "**" {
+		leftMin, rightMin = precedence+1, precedence
+	}
+	left := fmtr.expression(expr.Left)
+	if inner, ok := expr.Left.(*InfixExpression); ok && infixPrecedence[inner.Operator] < leftMin {
+		left = "(" + left + ")"
+	}
+	right := fmtr.expression(expr.Right)
+	if inner, ok := expr.Right.(*InfixExpression); ok && infixPrecedence[inner.Operator] < rightMin {
+		right = "(" + right + ")"
+	}
+	return left + " " + expr.Operator + " " + right
+}
+
+func (fmtr *formatter) ifExpression(expr *IfExpression) string {
+	out := "if (" + fmtr.expression(expr.Condition) + ") " + fmtr.block(expr.Consequence)
+	if expr.Alternative == nil {
+		return out
+	}
+	if elseIf, ok := elseIfExpression(expr.Alternative); ok {
+		return out + " else " + fmtr.ifExpression(elseIf)
+	}
+	return out + " else " + fmtr.block(expr.Alternative)
+}
+
+// elseIfExpression returns the conditional the parser wrapped in a block of
+// its own for an `else if`.
+func elseIfExpression(block *BlockStatement) (*IfExpression, bool) {
+	if block.Token.Type != token.IF || len(block.Statements) != 1 {
+		return nil, false
+	}
+	stmt, ok := block.Statements[0].(*ExpressionStatement)
+	if !ok {
+		return nil, false
+	}
+	ifExpr, ok := stmt.Expression.(*IfExpression)
+	return ifExpr, ok
+}
+
+// switchExpression puts every case on a line of its own, at the indentation
+// of the switch, with the statements of its body indented below it.
+func (fmtr *formatter) switchExpression(expr *SwitchExpression) string {
+	head := "switch (" + fmtr.expression(expr.Subject) + ") {"
+	if len(expr.Cases) == 0 && expr.Default == nil {
+		return head + "}"
+	}
+	var out strings.Builder
+
+	out.WriteString(head + "\n")
+	for _, sc := range expr.Cases {
+		out.WriteString(fmtr.indent() + "case " + fmtr.expression(sc.Value) + ":\n")
+		out.WriteString(fmtr.caseBody(sc.Body))
+	}
+	if expr.Default != nil {
+		out.WriteString(fmtr.indent() + "default:\n")
+		out.WriteString(fmtr.caseBody(expr.Default))
+	}
+	out.WriteString(fmtr.indent() + "}")
+	return out.String()
+}
+
+// caseBody formats the statements of a case one level deeper than the case,
+// each on a line of its own.
+func (fmtr *formatter) caseBody(body *BlockStatement) string {
+	var out strings.Builder
+
+	fmtr.depth++
+	for i, stmt := range body.Statements {
+		out.WriteString(fmtr.indent())
+		out.WriteString(fmtr.statement(stmt, nextStatement(body.Statements, i)))
+		out.WriteString("\n")
+	}
+	fmtr.depth--
+	return out.String()
+}
+
+func (fmtr *formatter) functionLiteral(fn *FunctionLiteral) string {
+	params := make([]string, len(fn.Parameters))
+	for i, param := range fn.Parameters {
+		params[i] = param.Value
+		if i < len(fn.Defaults) && fn.Defaults[i] != nil {
+			params[i] += " = " + fmtr.expression(fn.Defaults[i])
+		}
+	}
+	if fn.Variadic {
+		params[len(params)-1] = "..." + params[len(params)-1]
+	}
+	return "func(" + strings.Join(params, ", ") + ") " + fmtr.block(fn.Body)
+}
+
+func (fmtr *formatter) expressionList(list []Expression) string {
+	values := make([]string, len(list))
+	for i, expr := range list {
+		values[i] = fmtr.expression(expr)
+	}
+	return strings.Join(values, ", ")
+}
+
+// hashLiteral puts every pair on a line of its own, sorted by key, and pads
+// the keys so that all values start in the same column.
+func (fmtr *formatter) hashLiteral(hash *HashLiteral) string {
+	if len(hash.Pairs) == 0 {
+		return "{}"
+	}
+	type pair struct{ key, value string }
+
+	fmtr.depth++
+	var (
+		pairs = make([]pair, 0, len(hash.Pairs))
+		width int
+	)
+	for key, value := range hash.Pairs {
+		p := pair{fmtr.expression(key), fmtr.expression(value)}
+		pairs = append(pairs, p)
+		width = max(width, len(p.key))
+	}
+	sort.Slice(pairs, func(i, j int) bool { return pairs[i].key < pairs[j].key })
+
+	var out strings.Builder
+	out.WriteString("{\n")
+	for _, p := range pairs {
+		out.WriteString(fmtr.indent())
+		out.WriteString(p.key + ":" + strings.Repeat(" ", width-len(p.key)+1))
+		out.WriteString(p.value + ",\n")
+	}
+	fmtr.depth--
+	out.WriteString(fmtr.indent() + "}")
+	return out.String()
+}
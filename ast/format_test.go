@@ -0,0 +1,166 @@
+package ast_test
+
+import (
+	"testing"
+
+	"comp/ast"
+	"comp/lexer"
+	"comp/parser"
+)
+
+func TestFormat(t *testing.T) {
+	input := `let counter=func(start,step=1,...rest){let n=start;let add=func(x){if(x>0){n=n+x*step}else if(x==0){n}else{return -(x+1)};};for(let i=0;i<len(rest);i=i+1){add(rest[i])}
+{"total":n,"b":[1,2],"count":len(rest)}};counter(1)["total"]`
+
+	expected := `let counter = func(start, step = 1, ...rest) {
+    let n = start;
+    let add = func(x) {
+        if (x > 0) {
+            n = n + x * step;
+        } else if (x == 0) {
+            n;
+        } else {
+            return -(x + 1);
+        }
+    };
+    for (let i = 0; i < len(rest); i = i + 1) {
+        add(rest[i]);
+    }
+    {
+        "b":     [1, 2],
+        "count": len(rest),
+        "total": n,
+    };
+};
+counter(1)["total"];
+`
+	formatted := ast.Format(parse(t, input))
+	if formatted != expected {
+		t.Fatalf("Format wrong.\nwant:\n%s\ngot:\n%s", expected, formatted)
+	}
+	if again := ast.Format(parse(t, formatted)); again != formatted {
+		t.Errorf("formatting is not stable.\nfirst:\n%s\nsecond:\n%s", formatted, again)
+	}
+}
+
+func TestFormatIndent(t *testing.T) {
+	input := `let f = func(a, b = {"x": 1}) { if (a) { {"key": func() { b }, "k": [1]} } else { for (;;) { break; } } };`
+
+	tests := []struct {
+		indent   string
+		expected string
+	}{
+		{
+			"\t",
+			"let f = func(a, b = {\n" +
+				"\t\"x\": 1,\n" +
+				"}) {\n" +
+				"\tif (a) {\n" +
+				"\t\t{\n" +
+				"\t\t\t\"k\":   [1],\n" +
+				"\t\t\t\"key\": func() {\n" +
+				"\t\t\t\tb;\n" +
+				"\t\t\t},\n" +
+				"\t\t};\n" +
+				"\t} else {\n" +
+				"\t\tfor (;;) {\n" +
+				"\t\t\tbreak;\n" +
+				"\t\t}\n" +
+				"\t}\n" +
+				"};\n",
+		},
+		{
+			"  ",
+			`let f = func(a, b = {
+  "x": 1,
+}) {
+  if (a) {
+    {
+      "k":   [1],
+      "key": func() {
+        b;
+      },
+    };
+  } else {
+    for (;;) {
+      break;
+    }
+  }
+};
+`,
+		},
+	}
+	for _, tt := range tests {
+		formatted := ast.FormatIndent(parse(t, input), tt.indent)
+		if formatted != tt.expected {
+			t.Errorf("indent %q: wrong output.\nwant:\n%s\ngot:\n%s", tt.indent, tt.expected, formatted)
+		}
+		if again := ast.FormatIndent(parse(t, formatted), tt.indent); again != formatted {
+			t.Errorf("indent %q: formatting is not stable.\nfirst:\n%s\nsecond:\n%s", tt.indent, formatted, again)
+		}
+	}
+}
+
+func TestFormatPreservesTheTree(t *testing.T) {
+	tests := []string{
+		"(a + b) * c - d / (e - f)",
+		"a - (b - c) - d",
+		"2 ** 3 ** 2 * (2 ** 3) ** 2",
+		"-(a ** b) ** -c",
+		"-(a + b) * -c",
+		"(-a)[0] + (a + b)(c)",
+		"a || b && c | d & e == f < g",
+		"(a || b) && (c | d) & (e == f)",
+		"!(a == b) != !c",
+		"for (;;) { break; } for (; i < 3;) { continue; }",
+		"do { x = x + 1; } while (x < 3); do {} while (f())",
+		"let a, b = b, [a, 1]",
+		"const pi = 3; let a = pi",
+		"let [a, b, ...c] = [1][0]; let [...d] = d",
+		"let {a, b} = {\"a\": 1}; let {c} = f(a)",
+		"switch (a) { case 1: b; c case 2: default: d } -1",
+		"let x = switch (f(a)) { case [1]: if (b) { 2 } default: switch (b) {} }",
+		"if (a) { 1 } -1",
+		"if (a) { 1 } [1]",
+		"if (a) { 1 } let b = 2; if (b) { if (c) { 3 } else { if (d) { 4 } } }",
+		"each(items) { |x, y = (1 | 2)| puts(x) }",
+		"f() { || 7 }",
+		`{}; {"a": {1: [], 22: {}}}; []`,
+		"let f = func() {}; f()",
+		`"a=${a}, sum=${a + b * 2} \${x} ${ {"k": "${v}"}["k"] }"`,
+		`"\${literal}"`,
+	}
+	for _, input := range tests {
+		original := parse(t, input)
+		formatted := ast.Format(original)
+		reparsed := parse(t, formatted)
+
+		// the JSON encoding compares the trees with hash pairs in a fixed order
+		want, err := ast.ToJSON(original)
+		if err != nil {
+			t.Fatalf("ToJSON error: %s", err)
+		}
+		got, err := ast.ToJSON(reparsed)
+		if err != nil {
+			t.Fatalf("ToJSON error: %s", err)
+		}
+		if string(got) != string(want) {
+			t.Errorf("%s: the formatted source parses differently.\nwant=%s\ngot= %s\nformatted:\n%s",
+				input, want, got, formatted)
+		}
+		if again := ast.Format(reparsed); again != formatted {
+			t.Errorf("%s: formatting is not stable.\nfirst:\n%s\nsecond:\n%s", input, formatted, again)
+		}
+	}
+}
+
+func parse(t *testing.T, input string) *ast.RootStatement {
+	t.Helper()
+
+	psr := parser.NewParser(lexer.NewLexer(input))
+	root := psr.ParseRootStatement()
+	if errs := psr.Errors(); len(errs) > 0 {
+		t.Fatalf("parser errors for %q: %v", input, errs)
+	}
+	return root
+}
@@ -0,0 +1,288 @@
+package ast
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// ToJSON encodes node and all of its children as JSON for use by external
+// tools. Every node becomes an object whose "type" field names the node type,
+// next to one field per child. The output is stable: object keys are sorted
+// and the pairs of a hash literal are ordered by their key's source form.
+func ToJSON(node Node) ([]byte, error) {
+	value, err := jsonValue(node)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(value)
+}
+
+type jsonObject map[string]any
+
+func jsonValue(node Node) (any, error) {
+	switch node := node.(type) {
+	case *RootStatement:
+		statements, err := jsonStatements(node.Statements)
+		if err != nil {
+			return nil, err
+		}
+		return jsonObject{"type": "RootStatement", "statements": statements}, nil
+
+	case *LetStatement:
+		obj, err := jsonNode("LetStatement", jsonFields{"name": node.Name, "value": node.Value})
+		if err == nil && node.IsConstant() {
+			obj["constant"] = true
+		}
+		return obj, err
+	case *MultiLetStatement:
+		names := make([]any, len(node.Names))
+		for i, name := range node.Names {
+			names[i] = name.Value
+		}
+		values, err := jsonExpressions(node.Values)
+		if err != nil {
+			return nil, err
+		}
+		return jsonObject{"type": "MultiLetStatement", "names": names, "values": values}, nil
+	case *ArrayLetStatement:
+		names := make([]any, len(node.Names))
+		for i, name := range node.Names {
+			names[i] = name.Value
+		}
+		obj, err := jsonNode("ArrayLetStatement", jsonFields{"value": node.Value})
+		if err != nil {
+			return nil, err
+		}
+		obj["names"] = names
+		obj["rest"] = nil
+		if node.Rest != nil {
+			obj["rest"] = node.Rest.Value
+		}
+		return obj, nil
+	case *HashLetStatement:
+		names := make([]any, len(node.Names))
+		for i, name := range node.Names {
+			names[i] = name.Value
+		}
+		obj, err := jsonNode("HashLetStatement", jsonFields{"value": node.Value})
+		if err != nil {
+			return nil, err
+		}
+		obj["names"] = names
+		return obj, nil
+	case *AssignStatement:
+		return jsonNode("AssignStatement", jsonFields{"name": node.Name, "value": node.Value})
+	case *ReturnStatement:
+		return jsonNode("ReturnStatement", jsonFields{"returnValue": node.ReturnValue})
+	case *ExpressionStatement:
+		return jsonNode("ExpressionStatement", jsonFields{"expression": node.Expression})
+	case *ForStatement:
+		return jsonNode("ForStatement", jsonFields{
+			"init":      node.Init,
+			"condition": node.Condition,
+			"post":      node.Post,
+			"body":      node.Body,
+		})
+	case *DoWhileStatement:
+		return jsonNode("DoWhileStatement", jsonFields{
+			"body":      node.Body,
+			"condition": node.Condition,
+		})
+	case *BreakStatement:
+		return jsonObject{"type": "BreakStatement"}, nil
+	case *ContinueStatement:
+		return jsonObject{"type": "ContinueStatement"}, nil
+	case *BlockStatement:
+		statements, err := jsonStatements(node.Statements)
+		if err != nil {
+			return nil, err
+		}
+		return jsonObject{"type": "BlockStatement", "statements": statements}, nil
+
+	case *Identifier:
+		return jsonObject{"type": "Identifier", "value": node.Value}, nil
+	case *IntegerLiteral:
+		return jsonObject{"type": "IntegerLiteral", "value": node.Value}, nil
+	case *StringLiteral:
+		return jsonObject{"type": "StringLiteral", "value": node.Value}, nil
+	case *InterpolatedString:
+		parts, err := jsonExpressions(node.Parts)
+		if err != nil {
+			return nil, err
+		}
+		return jsonObject{"type": "InterpolatedString", "parts": parts}, nil
+	case *Boolean:
+		return jsonObject{"type": "Boolean", "value": node.Value}, nil
+	case *NullLiteral:
+		return jsonObject{"type": "NullLiteral"}, nil
+	case *PrefixExpression:
+		obj, err := jsonNode("PrefixExpression", jsonFields{"right": node.Right})
+		if err != nil {
+			return nil, err
+		}
+		obj["operator"] = node.Operator
+		return obj, nil
+	case *InfixExpression:
+		obj, err := jsonNode("InfixExpression", jsonFields{"left": node.Left, "right": node.Right})
+		if err != nil {
+			return nil, err
+		}
+		obj["operator"] = node.Operator
+		return obj, nil
+	case *IfExpression:
+		return jsonNode("IfExpression", jsonFields{
+			"condition":   node.Condition,
+			"consequence": node.Consequence,
+			"alternative": node.Alternative,
+		})
+	case *SwitchExpression:
+		return jsonSwitchExpression(node)
+	case *FunctionLiteral:
+		return jsonFunctionLiteral(node)
+	case *CallExpression:
+		obj, err := jsonNode("CallExpression", jsonFields{"function": node.Function})
+		if err != nil {
+			return nil, err
+		}
+		if obj["arguments"], err = jsonExpressions(node.Arguments); err != nil {
+			return nil, err
+		}
+		return obj, nil
+	case *ArrayLiteral:
+		elements, err := jsonExpressions(node.Elements)
+		if err != nil {
+			return nil, err
+		}
+		return jsonObject{"type": "ArrayLiteral", "elements": elements}, nil
+	case *IndexExpression:
+		return jsonNode("IndexExpression", jsonFields{"left": node.Left, "index": node.Index})
+	case *HashLiteral:
+		return jsonHashLiteral(node)
+	}
+	return nil, fmt.Errorf("cannot encode node of type %T as JSON", node)
+}
+
+// jsonFields maps the field names of a node to its children, any of which may
+// be nil.
+type jsonFields map[string]Node
+
+func jsonNode(typ string, fields jsonFields) (jsonObject, error) {
+	obj := jsonObject{"type": typ}
+	for name, child := range fields {
+		value, err := jsonChild(child)
+		if err != nil {
+			return nil, err
+		}
+		obj[name] = value
+	}
+	return obj, nil
+}
+
+// jsonChild encodes an optional child node, which is null when missing. The
+// check has to see through the interface, since a missing child is often a
+// typed nil pointer.
+func jsonChild(node Node) (any, error) {
+	switch node := node.(type) {
+	case nil:
+		return nil, nil
+	case *Identifier:
+		if node == nil {
+			return nil, nil
+		}
+	case *BlockStatement:
+		if node == nil {
+			return nil, nil
+		}
+	}
+	return jsonValue(node)
+}
+
+func jsonStatements(statements []Statement) ([]any, error) {
+	values := make([]any, len(statements))
+	for i, stmt := range statements {
+		value, err := jsonValue(stmt)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = value
+	}
+	return values, nil
+}
+
+func jsonExpressions(expressions []Expression) ([]any, error) {
+	values := make([]any, len(expressions))
+	for i, expr := range expressions {
+		value, err := jsonChild(expr)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = value
+	}
+	return values, nil
+}
+
+func jsonSwitchExpression(expr *SwitchExpression) (any, error) {
+	obj, err := jsonNode("SwitchExpression", jsonFields{
+		"subject": expr.Subject,
+		"default": expr.Default,
+	})
+	if err != nil {
+		return nil, err
+	}
+	cases := make([]any, len(expr.Cases))
+	for i, sc := range expr.Cases {
+		if cases[i], err = jsonNode("SwitchCase", jsonFields{"value": sc.Value, "body": sc.Body}); err != nil {
+			return nil, err
+		}
+	}
+	obj["cases"] = cases
+	return obj, nil
+}
+
+func jsonFunctionLiteral(fn *FunctionLiteral) (any, error) {
+	params := make([]any, len(fn.Parameters))
+	for i, param := range fn.Parameters {
+		var def Node
+		if i < len(fn.Defaults) && fn.Defaults[i] != nil {
+			def = fn.Defaults[i]
+		}
+		value, err := jsonChild(def)
+		if err != nil {
+			return nil, err
+		}
+		params[i] = jsonObject{"name": param.Value, "default": value}
+	}
+	body, err := jsonChild(fn.Body)
+	if err != nil {
+		return nil, err
+	}
+	return jsonObject{
+		"type":       "FunctionLiteral",
+		"parameters": params,
+		"variadic":   fn.Variadic,
+		"body":       body,
+	}, nil
+}
+
+func jsonHashLiteral(hash *HashLiteral) (any, error) {
+	keys := make([]Expression, 0, len(hash.Pairs))
+	for key := range hash.Pairs {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+
+	pairs := make([]any, len(keys))
+	for i, key := range keys {
+		k, err := jsonValue(key)
+		if err != nil {
+			return nil, err
+		}
+		v, err := jsonValue(hash.Pairs[key])
+		if err != nil {
+			return nil, err
+		}
+		pairs[i] = jsonObject{"key": k, "value": v}
+	}
+	return jsonObject{"type": "HashLiteral", "pairs": pairs}, nil
+}
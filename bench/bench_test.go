@@ -0,0 +1,81 @@
+// Package bench compares the speed of the tree-walking evaluator with that of
+// the compiler and VM on the same programs. Run it with
+//
+//	go test ./bench -bench .
+package bench
+
+import (
+	"testing"
+
+	"comp/ast"
+	"comp/compiler"
+	"comp/evaluator"
+	"comp/lexer"
+	"comp/object"
+	"comp/parser"
+	"comp/vm"
+)
+
+// fibProgram computes the 20th Fibonacci number recursively, which spends
+// nearly all of its time in function calls and integer arithmetic.
+const fibProgram = `
+let fibonacci = func(x) {
+	if (x < 2) {
+		x
+	} else {
+		fibonacci(x - 1) + fibonacci(x - 2)
+	}
+};
+fibonacci(20);
+`
+
+const fibResult = 6765
+
+// BenchmarkFib runs fibProgram on both engines. Parsing and compiling happen
+// once up front, so the numbers only compare the execution.
+func BenchmarkFib(b *testing.B) {
+	program := parse(b, fibProgram)
+
+	b.Run("evaluator", func(b *testing.B) {
+		for b.Loop() {
+			result := evaluator.Evaluate(program, object.NewEnvironment())
+			checkResult(b, result)
+		}
+	})
+
+	b.Run("vm", func(b *testing.B) {
+		comp := compiler.NewCompiler()
+		if err := comp.Compile(program); err != nil {
+			b.Fatalf("compiler error: %s", err)
+		}
+		bytecode := comp.ByteCode()
+
+		for b.Loop() {
+			machine := vm.NewVM(bytecode)
+			if err := machine.RunVM(); err != nil {
+				b.Fatalf("vm error: %s", err)
+			}
+			checkResult(b, machine.LastPoppedStackElement())
+		}
+	})
+}
+
+func parse(b *testing.B, input string) *ast.RootStatement {
+	b.Helper()
+
+	psr := parser.NewParser(lexer.NewLexer(input))
+	program := psr.ParseRootStatement()
+	if errs := psr.Errors(); len(errs) > 0 {
+		b.Fatalf("parser errors: %v", errs)
+	}
+	return program
+}
+
+func checkResult(b *testing.B, result object.Object) {
+	b.Helper()
+
+	integer, ok := result.(*object.Integer)
+	if !ok || integer.Value != fibResult {
+		b.Fatalf("wrong result. want=%d, got=%v", fibResult, result)
+	}
+}
@@ -0,0 +1,73 @@
+package code
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Assemble is the inverse of Instructions.String. It parses a textual listing
+// with one instruction per line, e.g.
+//
+//	OpConstant 2
+//	OpAdd
+//
+// into Instructions, encoding the operands according to the opcode's defined
+// widths. A leading offset as printed by the disassembler ("0003 OpAdd") is
+// accepted and ignored; blank lines are skipped.
+//
+// Returns an error naming the offending line for unknown opcodes, a wrong
+// number of operands, or operands that do not fit their width.
+func Assemble(text string) (Instructions, error) {
+	var ins Instructions
+
+	for i, line := range strings.Split(text, "\n") {
+		lineNum := i + 1
+
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if _, err := strconv.Atoi(fields[0]); err == nil {
+			fields = fields[1:]
+		}
+		if len(fields) == 0 {
+			return nil, fmt.Errorf("line %d: missing opcode", lineNum)
+		}
+		op, def, ok := lookupByName(fields[0])
+		if !ok {
+			return nil, fmt.Errorf("line %d: unknown opcode %q", lineNum, fields[0])
+		}
+		args := fields[1:]
+		if len(args) != len(def.OperandWidth) {
+			return nil, fmt.Errorf("line %d: %s expects %d operands, got %d",
+				lineNum, def.Name, len(def.OperandWidth), len(args))
+		}
+		operands := make([]int, len(args))
+		for j, arg := range args {
+			operand, err := strconv.Atoi(arg)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid operand %q", lineNum, arg)
+			}
+			maxVal := 1<<(8*def.OperandWidth[j]) - 1
+			if operand < 0 || operand > maxVal {
+				return nil, fmt.Errorf("line %d: operand %d out of range for %s",
+					lineNum, operand, def.Name)
+			}
+			operands[j] = operand
+		}
+		ins = append(ins, MakeInstruction(op, operands...)...)
+	}
+	return ins, nil
+}
+
+// lookupByName returns the Opcode and its Definition for the given opcode
+// name, e.g. "OpAdd".
+func lookupByName(name string) (Opcode, *Definition, bool) {
+	for op, def := range definitions {
+		if def.Name == name {
+			return op, def, true
+		}
+	}
+	return 0, nil, false
+}
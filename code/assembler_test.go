@@ -0,0 +1,95 @@
+package code
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAssemble(t *testing.T) {
+	input := `
+OpConstant 2
+OpConstant 65535
+OpAdd
+
+OpGetLocal 1
+OpPop
+`
+	expected := concat(
+		MakeInstruction(OpConstant, 2),
+		MakeInstruction(OpConstant, 65535),
+		MakeInstruction(OpAdd),
+		MakeInstruction(OpGetLocal, 1),
+		MakeInstruction(OpPop),
+	)
+	ins, err := Assemble(input)
+	if err != nil {
+		t.Fatalf("assemble error: %s", err)
+	}
+	if string(ins) != string(expected) {
+		t.Errorf("wrong instructions.\nwant=%v\ngot=%v", expected, ins)
+	}
+}
+
+func TestAssembleRoundTrip(t *testing.T) {
+	listings := []string{
+		"OpConstant 2\nOpAdd",
+		"OpTrue\nOpJumpNotTruthy 10\nOpConstant 0\nOpJump 11\nOpNull\nOpPop",
+		"OpGetGlobal 0\nOpGetLocal 255\nOpCall 2\nOpReturnValue",
+	}
+	for _, listing := range listings {
+		ins, err := Assemble(listing)
+		if err != nil {
+			t.Fatalf("assemble error: %s", err)
+		}
+		disassembled := ins.String()
+
+		var names []string
+		for _, line := range strings.Split(strings.TrimSpace(disassembled), "\n") {
+			names = append(names, strings.SplitN(line, " ", 2)[1])
+		}
+		if strings.Join(names, "\n") != listing {
+			t.Errorf("round trip mismatch.\nwant=%q\ngot=%q", listing, disassembled)
+		}
+		// the disassembler's output, offsets included, must assemble back
+		// into the very same bytes.
+		again, err := Assemble(disassembled)
+		if err != nil {
+			t.Fatalf("assemble error: %s", err)
+		}
+		if string(again) != string(ins) {
+			t.Errorf("reassembled bytes differ.\nwant=%v\ngot=%v", ins, again)
+		}
+	}
+}
+
+func TestAssembleErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"OpAdd\nOpFoo", `line 2: unknown opcode "OpFoo"`},
+		{"OpConstant", "line 1: OpConstant expects 1 operands, got 0"},
+		{"OpPop\n\nOpAdd 1", "line 3: OpAdd expects 0 operands, got 1"},
+		{"OpConstant x", `line 1: invalid operand "x"`},
+		{"OpGetLocal 256", "line 1: operand 256 out of range for OpGetLocal"},
+		{"0000", "line 1: missing opcode"},
+	}
+	for _, tt := range tests {
+		_, err := Assemble(tt.input)
+		if err == nil {
+			t.Errorf("expected error for %q, got none", tt.input)
+			continue
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("wrong error. want=%q, got=%q", tt.expected, err.Error())
+		}
+	}
+}
+
+func concat(ins ...[]byte) Instructions {
+	var out Instructions
+	for _, in := range ins {
+		out = append(out, in...)
+	}
+	return out
+}
@@ -11,6 +11,9 @@ func TestMake(t *testing.T) {
 		{OpConstant, []int{65534}, []byte{byte(OpConstant), 255, 254}},
 		{OpAdd, []int{}, []byte{byte(OpAdd)}},
 		{OpGetLocal, []int{255}, []byte{byte(OpGetLocal), 255}},
+		{OpUnpackArray, []int{258, 1}, []byte{byte(OpUnpackArray), 1, 2, 1}},
+		{OpUnpackHash, []int{258}, []byte{byte(OpUnpackHash), 1, 2}},
+		{OpClosure, []int{65534, 255}, []byte{byte(OpClosure), 255, 254, 255}},
 	}
 	for _, tt := range tests {
 		instruction := MakeInstruction(tt.op, tt.operands...)
@@ -33,11 +36,13 @@ func TestInstructionsString(t *testing.T) {
 		MakeInstruction(OpGetLocal, 1),
 		MakeInstruction(OpConstant, 2),
 		MakeInstruction(OpConstant, 65535),
+		MakeInstruction(OpUnpackArray, 3, 1),
 	}
 	expected := `0000 OpAdd
 0001 OpGetLocal 1
 0003 OpConstant 2
 0006 OpConstant 65535
+0009 OpUnpackArray 3 1
 `
 	var concat Instructions
 	for _, ins := range instructions {
@@ -57,6 +62,8 @@ func TestReadOperands(t *testing.T) {
 	}{
 		{OpConstant, []int{65535}, 2},
 		{OpGetLocal, []int{255}, 1},
+		{OpUnpackArray, []int{65535, 1}, 3},
+		{OpClosure, []int{65535, 255}, 3},
 	}
 	for _, tt := range tests {
 		instruction := MakeInstruction(tt.op, tt.operands...)
@@ -27,6 +27,25 @@ const (
 	OpReturn
 	OpGetLocal
 	OpSetLocal
+	OpGetBuiltin
+	OpExtend
+	OpBitNot
+	OpPopN
+	OpBitAnd
+	OpBitOr
+	OpPow
+	OpGreaterEqual
+	OpDup
+	OpUnpackArray
+	OpUnpackHash
+	OpClosure
+	OpGetFree
+	OpCell
+	OpDeref
+	OpSetCell
+	OpLessThan
+	OpLessEqual
+	OpEmptyCell
 )
 
 type Instructions []byte
@@ -67,4 +86,23 @@ var definitions = map[Opcode]*Definition{
 	OpReturn:        {"OpReturn", byte0},
 	OpGetLocal:      {"OpGetLocal", []int{1}},
 	OpSetLocal:      {"OpSetLocal", []int{1}},
+	OpGetBuiltin:    {"OpGetBuiltin", []int{1}},
+	OpExtend:        {"OpExtend", []int{2}},
+	OpBitNot:        {"OpBitNot", byte0},
+	OpPopN:          {"OpPopN", []int{2}},
+	OpBitAnd:        {"OpBitAnd", byte0},
+	OpBitOr:         {"OpBitOr", byte0},
+	OpPow:           {"OpPow", byte0},
+	OpGreaterEqual:  {"OpGreaterEqual", byte0},
+	OpDup:           {"OpDup", byte0},
+	OpUnpackArray:   {"OpUnpackArray", []int{2, 1}},
+	OpUnpackHash:    {"OpUnpackHash", []int{2}},
+	OpClosure:       {"OpClosure", []int{2, 1}},
+	OpGetFree:       {"OpGetFree", []int{1}},
+	OpCell:          {"OpCell", byte0},
+	OpDeref:         {"OpDeref", byte0},
+	OpSetCell:       {"OpSetCell", byte0},
+	OpLessThan:      {"OpLessThan", byte0},
+	OpLessEqual:     {"OpLessEqual", byte0},
+	OpEmptyCell:     {"OpEmptyCell", byte0},
 }
@@ -0,0 +1,209 @@
+package compiler
+
+import (
+	"comp/ast"
+	"comp/code"
+)
+
+// sharedVariables returns the names in fn that are both assigned somewhere in
+// its body, or bound to a function by a let directly in it, and referred to by
+// a function nested in it. A local of fn under such a name lives in a cell,
+// which fn and its closures share, so that an assignment on either side is
+// seen by the other. Shadowing is not taken into account: a name may get a
+// cell it does not strictly need.
+func sharedVariables(fn *ast.FunctionLiteral) map[string]bool {
+	var (
+		assigned = make(map[string]bool)
+		captured = make(map[string]bool)
+	)
+	for _, name := range localFunctions(fn) {
+		assigned[name] = true
+	}
+	var walk func(node ast.Node, nested bool)
+	walkAll := func(nodes []ast.Expression, nested bool) {
+		for _, node := range nodes {
+			walk(node, nested)
+		}
+	}
+	walk = func(node ast.Node, nested bool) {
+		switch node := node.(type) {
+		case *ast.Identifier:
+			if nested {
+				captured[node.Value] = true
+			}
+		case *ast.BlockStatement:
+			for _, stmt := range node.Statements {
+				walk(stmt, nested)
+			}
+		case *ast.LetStatement:
+			walk(node.Value, nested)
+		case *ast.MultiLetStatement:
+			walkAll(node.Values, nested)
+		case *ast.ArrayLetStatement:
+			walk(node.Value, nested)
+		case *ast.HashLetStatement:
+			walk(node.Value, nested)
+		case *ast.AssignStatement:
+			assigned[node.Name.Value] = true
+			walk(node.Name, nested)
+			walk(node.Value, nested)
+		case *ast.ForStatement:
+			if node.Init != nil {
+				walk(node.Init, nested)
+			}
+			if node.Condition != nil {
+				walk(node.Condition, nested)
+			}
+			if node.Post != nil {
+				walk(node.Post, nested)
+			}
+			walk(node.Body, nested)
+		case *ast.DoWhileStatement:
+			walk(node.Body, nested)
+			walk(node.Condition, nested)
+		case *ast.ReturnStatement:
+			walk(node.ReturnValue, nested)
+		case *ast.ExpressionStatement:
+			walk(node.Expression, nested)
+		case *ast.PrefixExpression:
+			walk(node.Right, nested)
+		case *ast.InfixExpression:
+			walk(node.Left, nested)
+			walk(node.Right, nested)
+		case *ast.SwitchExpression:
+			walk(node.Subject, nested)
+			for _, sc := range node.Cases {
+				walk(sc.Value, nested)
+				walk(sc.Body, nested)
+			}
+			if node.Default != nil {
+				walk(node.Default, nested)
+			}
+		case *ast.IfExpression:
+			walk(node.Condition, nested)
+			walk(node.Consequence, nested)
+			if node.Alternative != nil {
+				walk(node.Alternative, nested)
+			}
+		case *ast.FunctionLiteral:
+			for _, def := range node.Defaults {
+				if def != nil {
+					walk(def, true)
+				}
+			}
+			walk(node.Body, true)
+		case *ast.CallExpression:
+			walk(node.Function, nested)
+			walkAll(node.Arguments, nested)
+		case *ast.ArrayLiteral:
+			walkAll(node.Elements, nested)
+		case *ast.InterpolatedString:
+			walkAll(node.Parts, nested)
+		case *ast.IndexExpression:
+			walk(node.Left, nested)
+			walk(node.Index, nested)
+		case *ast.HashLiteral:
+			for key, value := range node.Pairs {
+				walk(key, nested)
+				walk(value, nested)
+			}
+		}
+	}
+	for _, def := range fn.Defaults {
+		if def != nil {
+			walk(def, false)
+		}
+	}
+	walk(fn.Body, false)
+
+	shared := make(map[string]bool)
+	for name := range assigned {
+		if captured[name] {
+			shared[name] = true
+		}
+	}
+	return shared
+}
+
+// localFunctions returns the names bound to a function literal by a let
+// directly in the body of fn, in order and without repetition.
+func localFunctions(fn *ast.FunctionLiteral) []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, stmt := range fn.Body.Statements {
+		let, ok := stmt.(*ast.LetStatement)
+		if !ok || seen[let.Name.Value] {
+			continue
+		}
+		if _, ok := let.Value.(*ast.FunctionLiteral); ok {
+			names = append(names, let.Name.Value)
+			seen[let.Name.Value] = true
+		}
+	}
+	return names
+}
+
+// hoistFunctions defines, ahead of the body of fn, the locals that lets in it
+// bind to functions referred to by nested functions, each holding an empty
+// cell its let fills later. The functions can then call themselves and each
+// other, as top-level ones can through resolveForward.
+func (c *Compiler) hoistFunctions(fn *ast.FunctionLiteral) {
+	scope := &c.scopes[c.scopeIndex]
+	for _, name := range localFunctions(fn) {
+		if !scope.shared[name] {
+			continue
+		}
+		symbol := c.symbolTable.Define(name)
+		c.symbolTable.markCell(name)
+		c.recordSlot(symbol)
+		c.emit(code.OpEmptyCell)
+		c.emit(code.OpSetLocal, symbol.Index)
+		if scope.hoisted == nil {
+			scope.hoisted = make(map[string]Symbol)
+		}
+		scope.hoisted[name] = symbol
+	}
+}
+
+// defineCell marks symbol, a local just defined in the current function, as
+// living in a cell if the function shares its name with its closures.
+func (c *Compiler) defineCell(symbol Symbol) Symbol {
+	if symbol.Scope == LocalScope && c.scopes[c.scopeIndex].shared[symbol.Name] {
+		c.symbolTable.markCell(symbol.Name)
+	}
+	return symbol
+}
+
+// boxParameters moves the parameters of fn living in cells into them, once
+// the defaults have been set.
+func (c *Compiler) boxParameters(fn *ast.FunctionLiteral) {
+	for i, param := range fn.Parameters {
+		c.defineCell(Symbol{Name: param.Value, Scope: LocalScope, Index: i})
+		if !c.symbolTable.cells[param.Value] {
+			continue
+		}
+		c.emit(code.OpGetLocal, i)
+		c.emit(code.OpCell)
+		c.emit(code.OpSetLocal, i)
+	}
+}
+
+// loadCell emits the instruction pushing the cell of symbol itself rather
+// than the value in it, for a closure to capture it or for an assignment.
+func (c *Compiler) loadCell(symbol Symbol) {
+	if symbol.Scope == FreeScope {
+		c.emit(code.OpGetFree, symbol.Index)
+	} else {
+		c.emit(code.OpGetLocal, symbol.Index)
+	}
+}
+
+// emitSetCell emits the instructions storing the value on top of the stack in
+// the cell of symbol.
+func (c *Compiler) emitSetCell(symbol Symbol) {
+	c.loadCell(symbol)
+	pos := c.emit(code.OpSetCell)
+	if debug := c.scopes[c.scopeIndex].debug; debug != nil {
+		debug.Names[pos] = symbol.Name
+	}
+}
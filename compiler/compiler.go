@@ -7,6 +7,13 @@ import (
 	"fmt"
 )
 
+// literalChunkSize is the largest number of elements an array or hash literal
+// pushes onto the VM stack before collecting them into the literal.
+const literalChunkSize = 256
+
+// maxPopN is the largest count a single OpPopN can carry.
+const maxPopN = 1<<16 - 1
+
 type EmittedInstruction struct {
 	OpCode   code.Opcode
 	Position int
@@ -16,6 +23,33 @@ type CompilationScope struct {
 	instructions    code.Instructions
 	lastInstruction EmittedInstruction
 	prevInstruction EmittedInstruction
+	// jumpTarget is the most recent position a forward jump was patched
+	// to land on.
+	jumpTarget int
+	// loops holds the loops enclosing the code being compiled, innermost
+	// last.
+	loops []*loopJumps
+	// depth is the number of values the enclosing expressions have pushed
+	// and wait on while the code being compiled runs.
+	depth int
+	// shared holds the names of the function's variables that live in cells,
+	// see sharedVariables.
+	shared map[string]bool
+	// hoisted holds the locals defined by hoistFunctions whose let has not
+	// been compiled yet.
+	hoisted map[string]Symbol
+	// debug collects the debug info of the scope, nil unless enabled.
+	debug *DebugInfo
+}
+
+// loopJumps collects the positions of the jumps emitted for the break and
+// continue statements of a loop, to be patched once their targets are known.
+type loopJumps struct {
+	breaks    []int
+	continues []int
+	// depth is the depth of the scope at the loop, the values above which a
+	// break or continue pops before jumping.
+	depth int
 }
 
 // Compiler transforms an Abstract Syntax Tree (AST) into bytecode instructions
@@ -31,8 +65,38 @@ type Compiler struct {
 	symbolTable *SymbolTable
 	scopes      []CompilationScope
 	scopeIndex  int
+
+	foldConstants      bool
+	propagateConstants bool
+	immutableLets      map[*ast.LetStatement]bool
+	propagated         map[string]object.Object
+
+	// hoistable holds the top-level function names that may still be
+	// referred to ahead of their let, hoisted the symbols defined for such
+	// references whose let has not been compiled yet.
+	hoistable map[string]bool
+	hoisted   map[string]Symbol
+
+	// smallIntegers maps the small integers in the constant pool to their
+	// index, so that each of them is added only once.
+	smallIntegers map[int64]int
+
+	// debugInfo is set by EnableDebugInfo. position is that of the node
+	// being compiled, functionDebugInfo the debug info of the compiled
+	// functions by constant index.
+	debugInfo         bool
+	position          SourcePosition
+	functionDebugInfo map[int]*DebugInfo
 }
 
+// smallIntegerMin and smallIntegerMax bound the integer constants that are
+// shared by every use instead of getting a pool slot each. These are the
+// values, like loop counters' 0 and 1, that programs repeat the most.
+const (
+	smallIntegerMin = -1
+	smallIntegerMax = 10
+)
+
 // NewWithState creates a new Compiler instance initialized with the existing state.
 // This is useful for resuming compilation or reusing the compiler state across
 // multiple compilation passes.
@@ -54,22 +118,58 @@ func NewCompiler() *Compiler {
 		lastInstruction: EmittedInstruction{},
 		prevInstruction: EmittedInstruction{},
 	}
+	symbolTable := NewSymbolTable()
+	for i, def := range object.Builtins {
+		symbolTable.DefineBuiltin(i, def.Name)
+	}
 	return &Compiler{
 		constants:   []object.Object{},
-		symbolTable: NewSymbolTable(),
+		symbolTable: symbolTable,
 		scopes:      []CompilationScope{mainScope},
 		scopeIndex:  0,
 	}
 }
 
+// Reset discards the instructions compiled so far while keeping the symbol
+// table and the constant pool, so that one Compiler can compile program after
+// program, like the lines of a REPL session, with later ones referring to the
+// globals of earlier ones. ByteCode returned before the reset is unaffected.
+func (c *Compiler) Reset() {
+	// a failed compilation may have stopped inside a function
+	for c.symbolTable.Outer != nil {
+		c.symbolTable = c.symbolTable.Outer
+	}
+	c.scopes = []CompilationScope{{instructions: code.Instructions{}}}
+	c.scopeIndex = 0
+	if c.debugInfo {
+		c.EnableDebugInfo()
+	}
+}
+
+// DeclareGlobal defines name as a global that the program can refer to
+// without binding it itself. The host supplies its value through the VM's
+// SetGlobal before running the bytecode. Must be called before Compile.
+func (c *Compiler) DeclareGlobal(name string) Symbol {
+	return c.symbolTable.Define(name)
+}
+
 // TODO: improve error handling everywhere in the codebase.
 
 // Compile walks the AST recursively until it encounters a node that can be compiled/evaluated.
 //
 // Works similar to the Evaluate function
 func (c *Compiler) Compile(node ast.Node) error {
+	if c.debugInfo {
+		defer c.enterNode(node)()
+	}
 	switch node := node.(type) {
 	case *ast.RootStatement:
+		c.hoistable = hoistableFunctions(node)
+		c.hoisted = make(map[string]Symbol)
+		if c.propagateConstants {
+			c.immutableLets = immutableLets(node)
+			c.propagated = make(map[string]object.Object)
+		}
 		for _, stmt := range node.Statements {
 			if err := c.Compile(stmt); err != nil {
 				return err
@@ -79,39 +179,112 @@ func (c *Compiler) Compile(node ast.Node) error {
 		if err := c.Compile(node.Value); err != nil {
 			return err
 		}
-		symbol := c.symbolTable.Define(node.Name.Value)
-		if symbol.Scope == GlobalScope {
-			c.emit(code.OpSetGlobal, symbol.Index)
+		_, hoisted := c.scopes[c.scopeIndex].hoisted[node.Name.Value]
+		symbol, err := c.defineLet(node.Name.Value)
+		if err != nil {
+			return err
+		}
+		if node.IsConstant() {
+			c.symbolTable.markConstant(node.Name.Value)
+		}
+		if hoisted {
+			c.emitSetCell(symbol)
+		} else {
+			c.emitSet(symbol)
+		}
+		if c.propagateConstants {
+			c.recordLetConstant(node)
+		}
+	case *ast.MultiLetStatement:
+		if err := c.compileMultiLetStatement(node); err != nil {
+			return err
+		}
+	case *ast.ArrayLetStatement:
+		if err := c.compileArrayLetStatement(node); err != nil {
+			return err
+		}
+	case *ast.HashLetStatement:
+		if err := c.compileHashLetStatement(node); err != nil {
+			return err
+		}
+	case *ast.AssignStatement:
+		symbol, ok := c.symbolTable.Resolve(node.Name.Value)
+		if !ok {
+			return fmt.Errorf("undefined variable: %s", node.Name.Value)
+		}
+		if symbol.Scope == BuiltinScope {
+			return fmt.Errorf("cannot assign to builtin: %s", node.Name.Value)
+		}
+		if c.symbolTable.IsConstant(node.Name.Value) {
+			return fmt.Errorf("cannot assign to constant: %s", node.Name.Value)
+		}
+		isCell := c.symbolTable.isCell(node.Name.Value)
+		if symbol.Scope == FreeScope && !isCell {
+			// a closure holds a copy of the variable, assigning it would not
+			// change the enclosing function's
+			return fmt.Errorf("cannot assign to captured variable: %s", node.Name.Value)
+		}
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+		if isCell {
+			c.emitSetCell(symbol)
 		} else {
-			c.emit(code.OpSetLocal, symbol.Index)
+			c.emitSet(symbol)
+		}
+	case *ast.ForStatement:
+		if err := c.compileForStatement(node); err != nil {
+			return err
+		}
+	case *ast.DoWhileStatement:
+		if err := c.compileDoWhileStatement(node); err != nil {
+			return err
 		}
+	case *ast.BreakStatement:
+		loop := c.currentLoop()
+		if loop == nil {
+			return fmt.Errorf("break outside of loop")
+		}
+		c.popToLoopDepth(loop)
+		loop.breaks = append(loop.breaks, c.emit(code.OpJump, 9999))
+	case *ast.ContinueStatement:
+		loop := c.currentLoop()
+		if loop == nil {
+			return fmt.Errorf("continue outside of loop")
+		}
+		c.popToLoopDepth(loop)
+		loop.continues = append(loop.continues, c.emit(code.OpJump, 9999))
 	case *ast.Identifier:
 		symbol, ok := c.symbolTable.Resolve(node.Value)
 		if !ok {
-			return fmt.Errorf("undefined variable: %s", node.Value)
+			symbol, ok = c.resolveForward(node.Value)
 		}
-		if symbol.Scope == GlobalScope {
-			c.emit(code.OpGetGlobal, symbol.Index)
-		} else {
-			c.emit(code.OpGetLocal, symbol.Index)
+		if !ok {
+			return fmt.Errorf("undefined variable: %s", node.Value)
 		}
+		c.loadSymbol(symbol)
 	case *ast.ExpressionStatement:
 		if err := c.Compile(node.Expression); err != nil {
 			return err
 		}
-		c.emit(code.OpPop)
+		c.emitPop()
 	case *ast.BlockStatement:
-		for _, stmt := range node.Statements {
-			if err := c.Compile(stmt); err != nil {
-				return err
-			}
+		c.symbolTable = NewBlockSymbolTable(c.symbolTable)
+		err := c.compileStatements(node.Statements)
+		c.symbolTable = c.symbolTable.Outer
+		if err != nil {
+			return err
 		}
 	case *ast.FunctionLiteral:
 		c.enterScope()
-		for _, param := range node.Parameters {
-			c.symbolTable.Define(param.Value)
+		c.scopes[c.scopeIndex].shared = sharedVariables(node)
+		entries, err := c.compileParameters(node)
+		if err != nil {
+			return err
 		}
-		if err := c.Compile(node.Body); err != nil {
+		c.hoistFunctions(node)
+		// the function's symbol table already scopes the body
+		if err := c.compileStatements(node.Body.Statements); err != nil {
 			return err
 		}
 		if c.lastInstructionIs(code.OpPop) {
@@ -121,30 +294,60 @@ func (c *Compiler) Compile(node ast.Node) error {
 			c.emit(code.OpReturn)
 		}
 		numLocals := c.symbolTable.defCount
+		freeSymbols := c.symbolTable.FreeSymbols
+		debug := c.scopes[c.scopeIndex].debug
 
 		instructions := c.leaveScope()
 		compiledFunc := &object.CompiledFunction{
 			Instructions:  instructions,
 			NumLocals:     numLocals,
 			NumParameters: len(node.Parameters),
+			Variadic:      node.Variadic,
+		}
+		if len(entries) > 1 {
+			compiledFunc.NumDefaults = len(entries) - 1
+			compiledFunc.Entries = entries
+		}
+		constIndex := c.addConstant(compiledFunc)
+		if debug != nil {
+			c.functionDebugInfo[constIndex] = debug
+		}
+		if len(freeSymbols) == 0 {
+			c.emit(code.OpConstant, constIndex)
+			return nil
 		}
-		c.emit(code.OpConstant, c.addConstant(compiledFunc))
+		for _, symbol := range freeSymbols {
+			// a variable living in a cell is captured as the cell itself
+			if c.symbolTable.isCell(symbol.Name) {
+				c.loadCell(symbol)
+			} else {
+				c.loadSymbol(symbol)
+			}
+		}
+		c.emit(code.OpClosure, constIndex, len(freeSymbols))
 	case *ast.ReturnStatement:
 		if err := c.Compile(node.ReturnValue); err != nil {
 			return err
 		}
 		c.emit(code.OpReturnValue)
 	case *ast.CallExpression:
+		if c.compileFolded(node) {
+			return nil
+		}
 		if err := c.Compile(node.Function); err != nil {
 			return err
 		}
-		for _, arg := range node.Arguments {
-			if err := c.Compile(arg); err != nil {
+		for i, arg := range node.Arguments {
+			// the callee and the arguments before arg wait under it
+			if err := c.compileAbove(1+i, arg); err != nil {
 				return err
 			}
 		}
 		c.emit(code.OpCall, len(node.Arguments))
 	case *ast.PrefixExpression:
+		if c.compileFolded(node) {
+			return nil
+		}
 		if err := c.Compile(node.Right); err != nil {
 			return err
 		}
@@ -153,10 +356,15 @@ func (c *Compiler) Compile(node ast.Node) error {
 			c.emit(code.OpMinus)
 		case "!":
 			c.emit(code.OpBang)
+		case "~":
+			c.emit(code.OpBitNot)
 		default:
 			return fmt.Errorf("invalid operation: %s", node.Operator)
 		}
 	case *ast.InfixExpression:
+		if c.compileFolded(node) {
+			return nil
+		}
 		if err := c.compileInfix(node); err != nil {
 			return err
 		}
@@ -166,19 +374,20 @@ func (c *Compiler) Compile(node ast.Node) error {
 		}
 		posJumpNotTruthy := c.emit(code.OpJumpNotTruthy, 1000)
 
-		if err := c.Compile(node.Consequence); err != nil {
+		if err := c.compileBranch(node.Consequence); err != nil {
 			return err
 		}
-		if c.lastInstructionIs(code.OpPop) {
-			c.removeLastPop()
-		}
 		return c.handleJump(node, posJumpNotTruthy)
+	case *ast.SwitchExpression:
+		return c.compileSwitchExpression(node)
 	case *ast.Boolean:
 		if !node.Value {
 			c.emit(code.OpFalse)
 		} else {
 			c.emit(code.OpTrue)
 		}
+	case *ast.NullLiteral:
+		c.emit(code.OpNull)
 	case *ast.IntegerLiteral:
 		integer := &object.Integer{Value: node.Value}
 		c.emit(code.OpConstant, c.addConstant(integer))
@@ -187,22 +396,30 @@ func (c *Compiler) Compile(node ast.Node) error {
 		str := &object.String{Value: node.Value}
 		c.emit(code.OpConstant, c.addConstant(str))
 
+	case *ast.InterpolatedString:
+		if c.compileFolded(node) {
+			return nil
+		}
+		if err := c.compileInterpolatedString(node); err != nil {
+			return err
+		}
+
 	case *ast.HashLiteral:
 		if err := c.compileHashLiteral(node); err != nil {
 			return err
 		}
 	case *ast.ArrayLiteral:
-		for _, elem := range node.Elements {
-			if err := c.Compile(elem); err != nil {
-				return err
-			}
+		if err := c.compileArrayLiteral(node); err != nil {
+			return err
 		}
-		c.emit(code.OpArray, len(node.Elements))
 	case *ast.IndexExpression:
+		if c.compileFolded(node) {
+			return nil
+		}
 		if err := c.Compile(node.Left); err != nil {
 			return err
 		}
-		if err := c.Compile(node.Index); err != nil {
+		if err := c.compileAbove(1, node.Index); err != nil {
 			return err
 		}
 		c.emit(code.OpIndex)
@@ -210,6 +427,26 @@ func (c *Compiler) Compile(node ast.Node) error {
 	return nil
 }
 
+// loadSymbol emits the instruction that pushes the value bound to symbol,
+// depending on the scope it was defined in.
+func (c *Compiler) loadSymbol(symbol Symbol) {
+	if c.symbolTable.isCell(symbol.Name) {
+		c.loadCell(symbol)
+		c.emit(code.OpDeref)
+		return
+	}
+	switch symbol.Scope {
+	case GlobalScope:
+		c.emit(code.OpGetGlobal, symbol.Index)
+	case LocalScope:
+		c.emit(code.OpGetLocal, symbol.Index)
+	case BuiltinScope:
+		c.emit(code.OpGetBuiltin, symbol.Index)
+	case FreeScope:
+		c.emit(code.OpGetFree, symbol.Index)
+	}
+}
+
 // enterScope creates a new empty compilation scope and makes it the current scope.
 // This is used when entering nested contexts like function bodies.
 func (c *Compiler) enterScope() {
@@ -217,6 +454,9 @@ func (c *Compiler) enterScope() {
 		lastInstruction: EmittedInstruction{},
 		prevInstruction: EmittedInstruction{},
 	}
+	if c.debugInfo {
+		scope.debug = newDebugInfo()
+	}
 	c.scopes = append(c.scopes, scope)
 	c.scopeIndex++
 	c.symbolTable = NewEnclosedSymbolTable(c.symbolTable)
@@ -232,27 +472,94 @@ func (c *Compiler) leaveScope() code.Instructions {
 	return instructions
 }
 
+// compileArrayLiteral builds the array in chunks of at most literalChunkSize
+// elements: the first chunk is turned into the array by OpArray, every other
+// chunk is appended to it by OpExtend. This keeps the VM stack from having to
+// hold all elements of a large literal at once.
+func (c *Compiler) compileArrayLiteral(node *ast.ArrayLiteral) error {
+	op := code.OpArray
+	for start := 0; start == 0 || start < len(node.Elements); start += literalChunkSize {
+		end := min(start+literalChunkSize, len(node.Elements))
+		for i, elem := range node.Elements[start:end] {
+			if err := c.compileAbove(chunkBase(start)+i, elem); err != nil {
+				return err
+			}
+		}
+		c.emit(op, end-start)
+		op = code.OpExtend
+	}
+	return nil
+}
+
+// compileInterpolatedString concatenates the parts of node with OpAdd,
+// passing every interpolated expression through the `str` builtin first. The
+// builtin is loaded by its index, so a binding shadowing `str` has no effect.
+func (c *Compiler) compileInterpolatedString(node *ast.InterpolatedString) error {
+	for i, part := range node.Parts {
+		if _, ok := part.(*ast.StringLiteral); ok {
+			if err := c.Compile(part); err != nil {
+				return err
+			}
+		} else {
+			c.emit(code.OpGetBuiltin, object.BuiltinIndex("str"))
+			if err := c.compileAbove(min(i, 1)+1, part); err != nil {
+				return err
+			}
+			c.emit(code.OpCall, 1)
+		}
+		if i > 0 {
+			c.emit(code.OpAdd)
+		}
+	}
+	return nil
+}
+
+// compileHashLiteral compiles the pairs of a hash literal, building the hash
+// in chunks the same way as compileArrayLiteral and counting a pair as two
+// elements. A key may appear only once in a literal: duplicates among
+// constant keys are reported here, and the VM reports those only known at
+// runtime.
 func (c *Compiler) compileHashLiteral(node *ast.HashLiteral) error {
 	keys := make([]ast.Expression, 0, len(node.Pairs))
+	seen := make(map[object.HashKey]bool, len(node.Pairs))
 
 	for key := range node.Pairs {
 		keys = append(keys, key)
+
+		value, ok := c.constantValue(key)
+		if !ok {
+			continue
+		}
+		if hashable, ok := value.(object.Hashable); ok {
+			if seen[hashable.HashKey()] {
+				return fmt.Errorf("duplicate key in hash literal: %s", value.Inspect())
+			}
+			seen[hashable.HashKey()] = true
+		}
 	}
 	// ordering necessary for testing
 	// slices.SortFunc(keys, func(a, b ast.Expression) int {
 	// 	return strings.Compare(a.String(), b.String())
 	// })
-	for _, key := range keys {
-		err := c.Compile(key)
-		if err != nil {
-			return err
-		}
-		err = c.Compile(node.Pairs[key])
-		if err != nil {
-			return err
+	const pairsPerChunk = literalChunkSize / 2
+
+	op := code.OpHash
+	for start := 0; start == 0 || start < len(keys); start += pairsPerChunk {
+		end := min(start+pairsPerChunk, len(keys))
+		for i, key := range keys[start:end] {
+			below := chunkBase(start) + 2*i
+			err := c.compileAbove(below, key)
+			if err != nil {
+				return err
+			}
+			err = c.compileAbove(below+1, node.Pairs[key])
+			if err != nil {
+				return err
+			}
 		}
+		c.emit(op, (end-start)*2)
+		op = code.OpExtend
 	}
-	c.emit(code.OpHash, len(node.Pairs)*2)
 	return nil
 }
 
@@ -287,38 +594,364 @@ func (c *Compiler) replaceLastPopWithReturn() {
 	c.scopes[c.scopeIndex].lastInstruction.OpCode = code.OpReturnValue
 }
 
+// compileParameters defines the parameters of node as locals and emits the
+// code setting the ones with a default value, which comes before the body.
+// Each default is compiled with only the parameters before it in scope. It
+// returns the offset at which the code for each default starts, followed by
+// the offset of the body.
+func (c *Compiler) compileParameters(node *ast.FunctionLiteral) ([]int, error) {
+	var entries []int
+	for i, param := range node.Parameters {
+		if i < len(node.Defaults) && node.Defaults[i] != nil {
+			entries = append(entries, len(c.currentInstructions()))
+			if err := c.Compile(node.Defaults[i]); err != nil {
+				return nil, err
+			}
+			c.emitSet(Symbol{Name: param.Value, Scope: LocalScope, Index: i})
+		}
+		c.recordSlot(c.symbolTable.Define(param.Value))
+	}
+	if entries != nil {
+		entries = append(entries, len(c.currentInstructions()))
+	}
+	c.boxParameters(node)
+	return entries, nil
+}
+
 // handleJump handles jump operations over conditionals depending on resulting
 // truthy value or lack thereof.
 func (c *Compiler) handleJump(node *ast.IfExpression, posJumpNotTruthy int) error {
 	posJump := c.emit(code.OpJump, 1000)
 
-	posAfterConsequence := len(c.currentInstructions())
-	c.changeOperand(posJumpNotTruthy, posAfterConsequence)
+	c.patchJump(posJumpNotTruthy)
 
 	if node.Alternative == nil {
 		c.emit(code.OpNull)
 	} else {
-		err := c.Compile(node.Alternative)
+		err := c.compileBranch(node.Alternative)
 		if err != nil {
 			return err
 		}
-		if c.lastInstructionIs(code.OpPop) {
-			c.removeLastPop()
+	}
+	c.patchJump(posJump)
+	return nil
+}
+
+// compileForStatement lays the loop out as init, condition check, body, post
+// and a jump back to the condition. The loop leaves nothing on the stack. A
+// break jumps past the loop, a continue to its post statement.
+// A variable defined by init is scoped to the loop, like one defined in a
+// block.
+func (c *Compiler) compileForStatement(node *ast.ForStatement) error {
+	c.symbolTable = NewBlockSymbolTable(c.symbolTable)
+	defer func() { c.symbolTable = c.symbolTable.Outer }()
+
+	if node.Init != nil {
+		if err := c.Compile(node.Init); err != nil {
+			return err
+		}
+	}
+	posCondition := len(c.currentInstructions())
+
+	posJumpNotTruthy := -1
+	if node.Condition != nil {
+		if err := c.Compile(node.Condition); err != nil {
+			return err
+		}
+		posJumpNotTruthy = c.emit(code.OpJumpNotTruthy, 1000)
+	}
+	loop := &loopJumps{depth: c.scopes[c.scopeIndex].depth}
+	c.scopes[c.scopeIndex].loops = append(c.scopes[c.scopeIndex].loops, loop)
+
+	if err := c.Compile(node.Body); err != nil {
+		return err
+	}
+	for _, pos := range loop.continues {
+		c.patchJump(pos)
+	}
+	if node.Post != nil {
+		if err := c.Compile(node.Post); err != nil {
+			return err
+		}
+	}
+	c.emit(code.OpJump, posCondition)
+
+	// the body may have entered and left function scopes, so the current
+	// scope has to be looked up again.
+	loops := c.scopes[c.scopeIndex].loops
+	c.scopes[c.scopeIndex].loops = loops[:len(loops)-1]
+
+	if posJumpNotTruthy != -1 {
+		c.patchJump(posJumpNotTruthy)
+	}
+	for _, pos := range loop.breaks {
+		c.patchJump(pos)
+	}
+	c.emitLoopEnd()
+	return nil
+}
+
+// compileMultiLetStatement pushes all values before binding any name, then
+// pops them into the names from the last to the first.
+func (c *Compiler) compileMultiLetStatement(node *ast.MultiLetStatement) error {
+	if len(node.Names) != len(node.Values) {
+		return fmt.Errorf("let binds %d names to %d values", len(node.Names), len(node.Values))
+	}
+	for i, value := range node.Values {
+		if err := c.compileAbove(i, value); err != nil {
+			return err
+		}
+	}
+	symbols := make([]Symbol, len(node.Names))
+	for i, name := range node.Names {
+		symbol, err := c.defineLet(name.Value)
+		if err != nil {
+			return err
+		}
+		symbols[i] = symbol
+	}
+	for i := len(symbols) - 1; i >= 0; i-- {
+		c.emitSet(symbols[i])
+	}
+	return nil
+}
+
+// compileArrayLetStatement unpacks the array onto the stack with
+// OpUnpackArray, then pops the elements into the names from the last to the
+// first.
+func (c *Compiler) compileArrayLetStatement(node *ast.ArrayLetStatement) error {
+	if err := c.Compile(node.Value); err != nil {
+		return err
+	}
+	names := node.Names
+	rest := 0
+	if node.Rest != nil {
+		names = append(names[:len(names):len(names)], node.Rest)
+		rest = 1
+	}
+	c.emit(code.OpUnpackArray, len(node.Names), rest)
+
+	symbols := make([]Symbol, len(names))
+	for i, name := range names {
+		symbol, err := c.defineLet(name.Value)
+		if err != nil {
+			return err
+		}
+		symbols[i] = symbol
+	}
+	for i := len(symbols) - 1; i >= 0; i-- {
+		c.emitSet(symbols[i])
+	}
+	return nil
+}
+
+// compileHashLetStatement pushes the names as string keys above the hash and
+// replaces them with the values under them using OpUnpackHash, then pops the
+// values into the names from the last to the first.
+func (c *Compiler) compileHashLetStatement(node *ast.HashLetStatement) error {
+	if err := c.Compile(node.Value); err != nil {
+		return err
+	}
+	for _, name := range node.Names {
+		c.emit(code.OpConstant, c.addConstant(&object.String{Value: name.Value}))
+	}
+	c.emit(code.OpUnpackHash, len(node.Names))
+
+	symbols := make([]Symbol, len(node.Names))
+	for i, name := range node.Names {
+		symbol, err := c.defineLet(name.Value)
+		if err != nil {
+			return err
 		}
+		symbols[i] = symbol
+	}
+	for i := len(symbols) - 1; i >= 0; i-- {
+		c.emitSet(symbols[i])
 	}
-	posAfterAlternative := len(c.currentInstructions())
-	c.changeOperand(posJump, posAfterAlternative)
 	return nil
 }
 
+// compileSwitchExpression keeps the subject on the stack while it is compared
+// with the value of each case in turn, duplicating it for every comparison.
+// The matching case, or else the default, pops the subject before leaving the
+// value of its body, and jumps past the remaining cases.
+func (c *Compiler) compileSwitchExpression(node *ast.SwitchExpression) error {
+	if err := c.Compile(node.Subject); err != nil {
+		return err
+	}
+	var endJumps []int
+	for _, sc := range node.Cases {
+		c.emit(code.OpDup)
+		// the subject and its duplicate wait under the value
+		if err := c.compileAbove(2, sc.Value); err != nil {
+			return err
+		}
+		c.emit(code.OpEqual)
+		posNextCase := c.emit(code.OpJumpNotTruthy, 1000)
+
+		c.emit(code.OpPop)
+		if err := c.compileBranch(sc.Body); err != nil {
+			return err
+		}
+		endJumps = append(endJumps, c.emit(code.OpJump, 1000))
+		c.patchJump(posNextCase)
+	}
+	c.emit(code.OpPop)
+	if node.Default != nil {
+		if err := c.compileBranch(node.Default); err != nil {
+			return err
+		}
+	} else {
+		c.emit(code.OpNull)
+	}
+	for _, pos := range endJumps {
+		c.patchJump(pos)
+	}
+	return nil
+}
+
+// compileDoWhileStatement lays the loop out as body, condition check and a
+// jump back to the body, so that the body runs before the condition is first
+// checked. The loop leaves nothing on the stack. A break jumps past the loop,
+// a continue to its condition.
+func (c *Compiler) compileDoWhileStatement(node *ast.DoWhileStatement) error {
+	posBody := len(c.currentInstructions())
+
+	loop := &loopJumps{depth: c.scopes[c.scopeIndex].depth}
+	c.scopes[c.scopeIndex].loops = append(c.scopes[c.scopeIndex].loops, loop)
+
+	if err := c.Compile(node.Body); err != nil {
+		return err
+	}
+	loops := c.scopes[c.scopeIndex].loops
+	c.scopes[c.scopeIndex].loops = loops[:len(loops)-1]
+
+	for _, pos := range loop.continues {
+		c.patchJump(pos)
+	}
+	if err := c.Compile(node.Condition); err != nil {
+		return err
+	}
+	posJumpNotTruthy := c.emit(code.OpJumpNotTruthy, 1000)
+	c.emit(code.OpJump, posBody)
+
+	c.patchJump(posJumpNotTruthy)
+	for _, pos := range loop.breaks {
+		c.patchJump(pos)
+	}
+	c.emitLoopEnd()
+	return nil
+}
+
+// emitLoopEnd leaves Null as the last popped element once a loop is done, as
+// a loop results in no value, instead of the condition that ended it.
+func (c *Compiler) emitLoopEnd() {
+	c.emit(code.OpNull)
+	c.emit(code.OpPop)
+}
+
+// popToLoopDepth emits the pops of the values the expressions enclosing a
+// break or continue have pushed inside loop, which the jump out of them would
+// otherwise leave on the stack.
+func (c *Compiler) popToLoopDepth(loop *loopJumps) {
+	if n := c.scopes[c.scopeIndex].depth - loop.depth; n > 0 {
+		c.emit(code.OpPopN, n)
+	}
+}
+
+// compileAbove compiles node while n values of the enclosing expression wait
+// under it on the stack.
+func (c *Compiler) compileAbove(n int, node ast.Node) error {
+	c.scopes[c.scopeIndex].depth += n
+	defer func() { c.scopes[c.scopeIndex].depth -= n }()
+	return c.Compile(node)
+}
+
+// chunkBase returns the number of values waiting under the elements of the
+// chunk of a literal starting at start: the collection built from the chunks
+// before it, if any.
+func chunkBase(start int) int {
+	return min(start, 1)
+}
+
+// currentLoop returns the innermost loop of the current scope, or nil if the
+// code being compiled is not inside one.
+func (c *Compiler) currentLoop() *loopJumps {
+	loops := c.scopes[c.scopeIndex].loops
+	if len(loops) == 0 {
+		return nil
+	}
+	return loops[len(loops)-1]
+}
+
+func (c *Compiler) compileStatements(statements []ast.Statement) error {
+	for _, stmt := range statements {
+		if err := c.Compile(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compileBranch compiles one branch of an if expression so that it leaves
+// exactly one value on the stack: the value of its last expression statement,
+// or null if the branch is empty or ends in any other statement. A branch
+// ending in a return leaves the frame before the null is reached.
+func (c *Compiler) compileBranch(block *ast.BlockStatement) error {
+	if err := c.Compile(block); err != nil {
+		return err
+	}
+	if endsInExpression(block) {
+		c.removeLastPop()
+	} else {
+		c.emit(code.OpNull)
+	}
+	return nil
+}
+
+func endsInExpression(block *ast.BlockStatement) bool {
+	if len(block.Statements) == 0 {
+		return false
+	}
+	_, ok := block.Statements[len(block.Statements)-1].(*ast.ExpressionStatement)
+	return ok
+}
+
 // addConstant appends ob to the compiler's constant slice.
 //
 // Returns the index of the constant in the constant pool as its very own identifier
 func (c *Compiler) addConstant(ob object.Object) int {
+	integer, ok := ob.(*object.Integer)
+	if !ok || integer.Value < smallIntegerMin || integer.Value > smallIntegerMax {
+		c.constants = append(c.constants, ob)
+		return len(c.constants) - 1
+	}
+	if c.smallIntegers == nil {
+		c.indexSmallIntegers()
+	}
+	if index, ok := c.smallIntegers[integer.Value]; ok {
+		return index
+	}
 	c.constants = append(c.constants, ob)
+	c.smallIntegers[integer.Value] = len(c.constants) - 1
 	return len(c.constants) - 1
 }
 
+// indexSmallIntegers collects the small integers already in the constant
+// pool, which is not empty when the compiler was created with NewWithState.
+func (c *Compiler) indexSmallIntegers() {
+	c.smallIntegers = make(map[int64]int)
+	for i, ob := range c.constants {
+		integer, ok := ob.(*object.Integer)
+		if !ok || integer.Value < smallIntegerMin || integer.Value > smallIntegerMax {
+			continue
+		}
+		if _, seen := c.smallIntegers[integer.Value]; !seen {
+			c.smallIntegers[integer.Value] = i
+		}
+	}
+}
+
 // emit generates an instruction and adds it to a collection in memory.
 //
 // Returns the starting position of the just emitted(added to memory) instruction.
@@ -326,9 +959,45 @@ func (c *Compiler) emit(op code.Opcode, operands ...int) int {
 	ins := code.MakeInstruction(op, operands...)
 	pos := c.addInstruction(ins)
 	c.setLastInstruction(op, pos)
+	c.recordPosition(pos)
 	return pos
 }
 
+// patchJump points the jump instruction at opPos to the position the next
+// instruction will be emitted at.
+func (c *Compiler) patchJump(opPos int) {
+	target := len(c.currentInstructions())
+	c.changeOperand(opPos, target)
+	c.scopes[c.scopeIndex].jumpTarget = target
+}
+
+// emitPop emits an OpPop, folding it into the instruction right before it if
+// that is a pop as well: consecutive pops collapse into a single OpPopN. A pop
+// some jump lands on is never folded, the jump must still find it there.
+//
+// Returns the position of the emitted or extended instruction.
+func (c *Compiler) emitPop() int {
+	var (
+		scope = &c.scopes[c.scopeIndex]
+		last  = scope.lastInstruction
+		count int
+	)
+	switch {
+	case scope.jumpTarget == len(scope.instructions):
+	case c.lastInstructionIs(code.OpPop):
+		count = 1
+	case c.lastInstructionIs(code.OpPopN):
+		count = int(code.ReadUint16(scope.instructions[last.Position+1:]))
+	}
+	if count == 0 || count == maxPopN {
+		return c.emit(code.OpPop)
+	}
+	scope.instructions = scope.instructions[:last.Position]
+	c.addInstruction(code.MakeInstruction(code.OpPopN, count+1))
+	scope.lastInstruction = EmittedInstruction{OpCode: code.OpPopN, Position: last.Position}
+	return last.Position
+}
+
 // sets the given opCode as the lastInstruction and shifts the last
 // last-instruction to prevInstruction.
 func (c *Compiler) setLastInstruction(op code.Opcode, pos int) {
@@ -372,28 +1041,22 @@ func (c *Compiler) removeLastPop() {
 	)
 	c.scopes[c.scopeIndex].instructions = curr
 	c.scopes[c.scopeIndex].lastInstruction = prev
+	if debug := c.scopes[c.scopeIndex].debug; debug != nil {
+		delete(debug.Positions, last.Position)
+	}
 }
 
 // compileInfix performs the same recursive compilation that Compile does.
 func (c *Compiler) compileInfix(node *ast.InfixExpression) error {
 	switch {
-	case node.Operator == "<":
-		err := c.Compile(node.Right)
-		if err != nil {
-			return err
-		}
-		err = c.Compile(node.Left)
-		if err != nil {
-			return err
-		}
-		c.emit(code.OpGreaterThan)
-		return nil
+	case node.Operator == "&&" || node.Operator == "||":
+		return c.compileLogical(node)
 	default:
 		err := c.Compile(node.Left)
 		if err != nil {
 			return err
 		}
-		err = c.Compile(node.Right)
+		err = c.compileAbove(1, node.Right)
 		if err != nil {
 			return err
 		}
@@ -405,6 +1068,41 @@ func (c *Compiler) compileInfix(node *ast.InfixExpression) error {
 	return nil
 }
 
+// compileLogical compiles `&&` and `||`, which short-circuit: the right
+// operand is only evaluated when the left one does not already decide the
+// result. Either way the result is a boolean. `&&` is laid out as
+//
+//	left; OpJumpNotTruthy false; right; OpJumpNotTruthy false; OpTrue; OpJump end
+//	false: OpFalse
+//	end:
+//
+// and `||` the same way with the operands negated and the results swapped.
+// The eager `&` and `|` need no jumps at all, see emitInfixOp.
+func (c *Compiler) compileLogical(node *ast.InfixExpression) error {
+	var shortCircuits []int
+	for _, operand := range []ast.Expression{node.Left, node.Right} {
+		if err := c.Compile(operand); err != nil {
+			return err
+		}
+		if node.Operator == "||" {
+			c.emit(code.OpBang)
+		}
+		shortCircuits = append(shortCircuits, c.emit(code.OpJumpNotTruthy, 1000))
+	}
+	decided, undecided := code.OpFalse, code.OpTrue
+	if node.Operator == "||" {
+		decided, undecided = code.OpTrue, code.OpFalse
+	}
+	c.emit(undecided)
+	posJump := c.emit(code.OpJump, 1000)
+	for _, pos := range shortCircuits {
+		c.patchJump(pos)
+	}
+	c.emit(decided)
+	c.patchJump(posJump)
+	return nil
+}
+
 // emitInfixOp emits the corresponding code.Opcode for each infix operator
 func (c *Compiler) emitInfixOp(infixExpr *ast.InfixExpression) error {
 	switch infixExpr.Operator {
@@ -416,12 +1114,24 @@ func (c *Compiler) emitInfixOp(infixExpr *ast.InfixExpression) error {
 		c.emit(code.OpMul)
 	case "/":
 		c.emit(code.OpDiv)
+	case "**":
+		c.emit(code.OpPow)
 	case "!=":
 		c.emit(code.OpNotEqual)
 	case "==":
 		c.emit(code.OpEqual)
 	case ">":
 		c.emit(code.OpGreaterThan)
+	case ">=":
+		c.emit(code.OpGreaterEqual)
+	case "<":
+		c.emit(code.OpLessThan)
+	case "<=":
+		c.emit(code.OpLessEqual)
+	case "&":
+		c.emit(code.OpBitAnd)
+	case "|":
+		c.emit(code.OpBitOr)
 	default:
 		return fmt.Errorf("unknown operator %s", infixExpr.Operator)
 	}
@@ -438,12 +1148,24 @@ func (c *Compiler) emitInfixOp(infixExpr *ast.InfixExpression) error {
 type ByteCode struct {
 	Instructions code.Instructions
 	Constants    []object.Object
+	// GlobalNames maps every global index to the name it was defined
+	// under, for tools inspecting the VM's globals.
+	GlobalNames []string
+	// DebugInfo relates the instructions to the source, nil unless the
+	// compiler's EnableDebugInfo was called.
+	DebugInfo *DebugInfo
 }
 
 // ByteCode returns a pointer to ByteCode struct.
 func (c *Compiler) ByteCode() *ByteCode {
-	return &ByteCode{
+	bytecode := &ByteCode{
 		Instructions: c.currentInstructions(),
 		Constants:    c.constants,
+		GlobalNames:  c.symbolTable.GlobalNames(),
+	}
+	if debug := c.scopes[c.scopeIndex].debug; debug != nil {
+		debug.Functions = c.functionDebugInfo
+		bytecode.DebugInfo = debug
 	}
+	return bytecode
 }
@@ -7,6 +7,7 @@ import (
 	"comp/object"
 	"comp/parser"
 	"fmt"
+	"strings"
 	"testing"
 )
 
@@ -28,6 +29,16 @@ func TestIntegerArithmetic(t *testing.T) {
 				code.MakeInstruction(code.OpPop),
 			},
 		},
+		{
+			input:             "2 ** 3",
+			expectedConstants: []interface{}{2, 3},
+			expectedInstructions: []code.Instructions{
+				code.MakeInstruction(code.OpConstant, 0),
+				code.MakeInstruction(code.OpConstant, 1),
+				code.MakeInstruction(code.OpPow),
+				code.MakeInstruction(code.OpPop),
+			},
+		},
 		{
 			input:             "1; 2",
 			expectedConstants: []interface{}{1, 2},
@@ -75,6 +86,15 @@ func TestIntegerArithmetic(t *testing.T) {
 				code.MakeInstruction(code.OpPop),
 			},
 		},
+		{
+			input:             "~1",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.MakeInstruction(code.OpConstant, 0),
+				code.MakeInstruction(code.OpBitNot),
+				code.MakeInstruction(code.OpPop),
+			},
+		},
 	}
 	runCompilerTests(t, tests)
 }
@@ -121,7 +141,25 @@ func TestBooleanExpressions(t *testing.T) {
 			expectedInstructions: []code.Instructions{
 				code.MakeInstruction(code.OpConstant, 0),
 				code.MakeInstruction(code.OpConstant, 1),
-				code.MakeInstruction(code.OpGreaterThan),
+				code.MakeInstruction(code.OpLessThan),
+				code.MakeInstruction(code.OpPop),
+			},
+		}, {
+			input:             "1 >= 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.MakeInstruction(code.OpConstant, 0),
+				code.MakeInstruction(code.OpConstant, 1),
+				code.MakeInstruction(code.OpGreaterEqual),
+				code.MakeInstruction(code.OpPop),
+			},
+		}, {
+			input:             "1 <= 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.MakeInstruction(code.OpConstant, 0),
+				code.MakeInstruction(code.OpConstant, 1),
+				code.MakeInstruction(code.OpLessEqual),
 				code.MakeInstruction(code.OpPop),
 			},
 		}, {
@@ -167,6 +205,107 @@ func TestBooleanExpressions(t *testing.T) {
 	runCompilerTests(t, tests)
 }
 
+func TestNullLiteral(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "null",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.MakeInstruction(code.OpNull),
+				code.MakeInstruction(code.OpPop),
+			},
+		},
+		{
+			input:             "let x = null; x == null",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.MakeInstruction(code.OpNull),
+				code.MakeInstruction(code.OpSetGlobal, 0),
+				code.MakeInstruction(code.OpGetGlobal, 0),
+				code.MakeInstruction(code.OpNull),
+				code.MakeInstruction(code.OpEqual),
+				code.MakeInstruction(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestLogicalOperators(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			// the eager operators need no jumps
+			input:             "true & false",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.MakeInstruction(code.OpTrue),
+				code.MakeInstruction(code.OpFalse),
+				code.MakeInstruction(code.OpBitAnd),
+				code.MakeInstruction(code.OpPop),
+			},
+		},
+		{
+			input:             "1 | 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.MakeInstruction(code.OpConstant, 0),
+				code.MakeInstruction(code.OpConstant, 1),
+				code.MakeInstruction(code.OpBitOr),
+				code.MakeInstruction(code.OpPop),
+			},
+		},
+		{
+			input:             "true && false",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.MakeInstruction(code.OpTrue),
+				// 0001
+				code.MakeInstruction(code.OpJumpNotTruthy, 12),
+				// 0004
+				code.MakeInstruction(code.OpFalse),
+				// 0005
+				code.MakeInstruction(code.OpJumpNotTruthy, 12),
+				// 0008
+				code.MakeInstruction(code.OpTrue),
+				// 0009
+				code.MakeInstruction(code.OpJump, 13),
+				// 0012
+				code.MakeInstruction(code.OpFalse),
+				// 0013
+				code.MakeInstruction(code.OpPop),
+			},
+		},
+		{
+			input:             "true || false",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.MakeInstruction(code.OpTrue),
+				// 0001
+				code.MakeInstruction(code.OpBang),
+				// 0002
+				code.MakeInstruction(code.OpJumpNotTruthy, 14),
+				// 0005
+				code.MakeInstruction(code.OpFalse),
+				// 0006
+				code.MakeInstruction(code.OpBang),
+				// 0007
+				code.MakeInstruction(code.OpJumpNotTruthy, 14),
+				// 0010
+				code.MakeInstruction(code.OpFalse),
+				// 0011
+				code.MakeInstruction(code.OpJump, 15),
+				// 0014
+				code.MakeInstruction(code.OpTrue),
+				// 0015
+				code.MakeInstruction(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
 func TestConditionals(t *testing.T) {
 	tests := []compilerTestCase{
 		{
@@ -193,7 +332,7 @@ func TestConditionals(t *testing.T) {
 				code.MakeInstruction(code.OpPop),
 			},
 		},
-		/*	{
+		{
 			input: `
 			if (true) { 10 } else { 20 }; 3333;
 			`,
@@ -216,7 +355,63 @@ func TestConditionals(t *testing.T) {
 				// 0017
 				code.MakeInstruction(code.OpPop),
 			},
-		},*/
+		},
+		{
+			input: `
+			if (true) { 1 } else { "two" }; [3];
+			`,
+			expectedConstants: []interface{}{1, "two", 3},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.MakeInstruction(code.OpTrue),
+				// 0001
+				code.MakeInstruction(code.OpJumpNotTruthy, 10),
+				// 0004
+				code.MakeInstruction(code.OpConstant, 0),
+				// 0007
+				code.MakeInstruction(code.OpJump, 13),
+				// 0010
+				code.MakeInstruction(code.OpConstant, 1),
+				// 0013
+				code.MakeInstruction(code.OpPop),
+				// 0014
+				code.MakeInstruction(code.OpConstant, 2),
+				// 0017
+				code.MakeInstruction(code.OpArray, 1),
+				// 0020
+				code.MakeInstruction(code.OpPop),
+			},
+		},
+		{
+			input: `
+			if (false) { [1] } else { if (true) { "a" } else { 2 } };
+			`,
+			expectedConstants: []interface{}{1, "a", 2},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.MakeInstruction(code.OpFalse),
+				// 0001
+				code.MakeInstruction(code.OpJumpNotTruthy, 13),
+				// 0004
+				code.MakeInstruction(code.OpConstant, 0),
+				// 0007
+				code.MakeInstruction(code.OpArray, 1),
+				// 0010
+				code.MakeInstruction(code.OpJump, 26),
+				// 0013
+				code.MakeInstruction(code.OpTrue),
+				// 0014
+				code.MakeInstruction(code.OpJumpNotTruthy, 23),
+				// 0017
+				code.MakeInstruction(code.OpConstant, 1),
+				// 0020
+				code.MakeInstruction(code.OpJump, 26),
+				// 0023
+				code.MakeInstruction(code.OpConstant, 2),
+				// 0026
+				code.MakeInstruction(code.OpPop),
+			},
+		},
 	}
 	runCompilerTests(t, tests)
 }
@@ -265,69 +460,110 @@ func TestGlobalLetStatements(t *testing.T) {
 				code.MakeInstruction(code.OpPop),
 			},
 		},
-	}
-	runCompilerTests(t, tests)
-}
-
-func TestStringExpressions(t *testing.T) {
-	tests := []compilerTestCase{
 		{
-			input:             `"monkey"`,
-			expectedConstants: []interface{}{"monkey"},
+			input:             `let [a, ...b] = [1, 2];`,
+			expectedConstants: []interface{}{1, 2},
 			expectedInstructions: []code.Instructions{
 				code.MakeInstruction(code.OpConstant, 0),
-				code.MakeInstruction(code.OpPop),
+				code.MakeInstruction(code.OpConstant, 1),
+				code.MakeInstruction(code.OpArray, 2),
+				code.MakeInstruction(code.OpUnpackArray, 1, 1),
+				code.MakeInstruction(code.OpSetGlobal, 1),
+				code.MakeInstruction(code.OpSetGlobal, 0),
 			},
 		},
 		{
-			input:             `"mon" + "key"`,
-			expectedConstants: []interface{}{"mon", "key"},
+			input:             `let {a, b} = {};`,
+			expectedConstants: []interface{}{"a", "b"},
 			expectedInstructions: []code.Instructions{
+				code.MakeInstruction(code.OpHash, 0),
 				code.MakeInstruction(code.OpConstant, 0),
 				code.MakeInstruction(code.OpConstant, 1),
-				code.MakeInstruction(code.OpAdd),
-				code.MakeInstruction(code.OpPop),
+				code.MakeInstruction(code.OpUnpackHash, 2),
+				code.MakeInstruction(code.OpSetGlobal, 1),
+				code.MakeInstruction(code.OpSetGlobal, 0),
+			},
+		},
+		{
+			input:             `let a, b = 1, 2; let a, b = b, a;`,
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.MakeInstruction(code.OpConstant, 0),
+				code.MakeInstruction(code.OpConstant, 1),
+				code.MakeInstruction(code.OpSetGlobal, 1),
+				code.MakeInstruction(code.OpSetGlobal, 0),
+				code.MakeInstruction(code.OpGetGlobal, 1),
+				code.MakeInstruction(code.OpGetGlobal, 0),
+				code.MakeInstruction(code.OpSetGlobal, 3),
+				code.MakeInstruction(code.OpSetGlobal, 2),
 			},
 		},
 	}
 	runCompilerTests(t, tests)
 }
 
-func TestArrayLiterals(t *testing.T) {
+func TestForStatements(t *testing.T) {
 	tests := []compilerTestCase{
 		{
-			input:             "[]",
-			expectedConstants: []interface{}{},
-			expectedInstructions: []code.Instructions{
-				code.MakeInstruction(code.OpArray, 0),
-				code.MakeInstruction(code.OpPop),
-			},
-		},
-		{
-			input:             "[1, 2, 3]",
-			expectedConstants: []interface{}{1, 2, 3},
+			input: `
+			let sum = 0;
+			for (let i = 1; i < 6; i = i + 1) { sum = sum + i; }
+			`,
+			expectedConstants: []interface{}{0, 1, 6},
 			expectedInstructions: []code.Instructions{
+				// 0000
 				code.MakeInstruction(code.OpConstant, 0),
+				// 0003
+				code.MakeInstruction(code.OpSetGlobal, 0),
+				// 0006
 				code.MakeInstruction(code.OpConstant, 1),
+				// 0009
+				code.MakeInstruction(code.OpSetGlobal, 1),
+				// 0012
+				code.MakeInstruction(code.OpGetGlobal, 1),
+				// 0015
 				code.MakeInstruction(code.OpConstant, 2),
-				code.MakeInstruction(code.OpArray, 3),
+				// 0018
+				code.MakeInstruction(code.OpLessThan),
+				// 0019
+				code.MakeInstruction(code.OpJumpNotTruthy, 45),
+				// 0022
+				code.MakeInstruction(code.OpGetGlobal, 0),
+				// 0025
+				code.MakeInstruction(code.OpGetGlobal, 1),
+				// 0028
+				code.MakeInstruction(code.OpAdd),
+				// 0029
+				code.MakeInstruction(code.OpSetGlobal, 0),
+				// 0032
+				code.MakeInstruction(code.OpGetGlobal, 1),
+				// 0035
+				code.MakeInstruction(code.OpConstant, 1),
+				// 0038
+				code.MakeInstruction(code.OpAdd),
+				// 0039
+				code.MakeInstruction(code.OpSetGlobal, 1),
+				// 0042
+				code.MakeInstruction(code.OpJump, 12),
+				// 0045
+				code.MakeInstruction(code.OpNull),
+				// 0046
 				code.MakeInstruction(code.OpPop),
 			},
 		},
 		{
-			input:             "[1 + 2, 3 - 4, 5 * 6]",
-			expectedConstants: []interface{}{1, 2, 3, 4, 5, 6},
+			input:             `for (;;) { 1 }`,
+			expectedConstants: []interface{}{1},
 			expectedInstructions: []code.Instructions{
+				// 0000
 				code.MakeInstruction(code.OpConstant, 0),
-				code.MakeInstruction(code.OpConstant, 1),
-				code.MakeInstruction(code.OpAdd),
-				code.MakeInstruction(code.OpConstant, 2),
-				code.MakeInstruction(code.OpConstant, 3),
-				code.MakeInstruction(code.OpSub),
-				code.MakeInstruction(code.OpConstant, 4),
-				code.MakeInstruction(code.OpConstant, 5),
-				code.MakeInstruction(code.OpMul),
-				code.MakeInstruction(code.OpArray, 3),
+				// 0003
+				code.MakeInstruction(code.OpPop),
+				// 0004
+				code.MakeInstruction(code.OpJump, 0),
+				// 0007
+				code.MakeInstruction(code.OpNull),
+				// 0008
 				code.MakeInstruction(code.OpPop),
 			},
 		},
@@ -335,35 +571,465 @@ func TestArrayLiterals(t *testing.T) {
 	runCompilerTests(t, tests)
 }
 
-func TestHashLiterals(t *testing.T) {
+func TestSwitchExpressions(t *testing.T) {
 	tests := []compilerTestCase{
 		{
-			input:             "{}",
-			expectedConstants: []interface{}{},
-			expectedInstructions: []code.Instructions{
-				code.MakeInstruction(code.OpHash, 0),
-				code.MakeInstruction(code.OpPop),
-			},
-		},
-		{
-			input:             "{1: 2, 3: 4, 5: 6}",
-			expectedConstants: []interface{}{1, 2, 3, 4, 5, 6},
+			input:             `switch (1) { case 2: 3 default: 4 }; 5`,
+			expectedConstants: []interface{}{1, 2, 3, 4, 5},
 			expectedInstructions: []code.Instructions{
+				// 0000
 				code.MakeInstruction(code.OpConstant, 0),
+				// 0003
+				code.MakeInstruction(code.OpDup),
+				// 0004
 				code.MakeInstruction(code.OpConstant, 1),
+				// 0007
+				code.MakeInstruction(code.OpEqual),
+				// 0008
+				code.MakeInstruction(code.OpJumpNotTruthy, 18),
+				// 0011
+				code.MakeInstruction(code.OpPop),
+				// 0012
 				code.MakeInstruction(code.OpConstant, 2),
+				// 0015
+				code.MakeInstruction(code.OpJump, 22),
+				// 0018
+				code.MakeInstruction(code.OpPop),
+				// 0019
 				code.MakeInstruction(code.OpConstant, 3),
+				// 0022
+				code.MakeInstruction(code.OpPop),
+				// 0023
 				code.MakeInstruction(code.OpConstant, 4),
-				code.MakeInstruction(code.OpConstant, 5),
-				code.MakeInstruction(code.OpHash, 6),
+				// 0026
 				code.MakeInstruction(code.OpPop),
 			},
 		},
 		{
-			input:             "{1: 2 + 3, 4: 5 * 6}",
-			expectedConstants: []interface{}{1, 2, 3, 4, 5, 6},
+			input:             `switch (true) { }`,
+			expectedConstants: []interface{}{},
 			expectedInstructions: []code.Instructions{
-				code.MakeInstruction(code.OpConstant, 0),
+				code.MakeInstruction(code.OpTrue),
+				code.MakeInstruction(code.OpPop),
+				code.MakeInstruction(code.OpNull),
+				code.MakeInstruction(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestDoWhileStatements(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `do { 1 } while (false)`,
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.MakeInstruction(code.OpConstant, 0),
+				// 0003
+				code.MakeInstruction(code.OpPop),
+				// 0004
+				code.MakeInstruction(code.OpFalse),
+				// 0005
+				code.MakeInstruction(code.OpJumpNotTruthy, 11),
+				// 0008
+				code.MakeInstruction(code.OpJump, 0),
+				// 0011
+				code.MakeInstruction(code.OpNull),
+				// 0012
+				code.MakeInstruction(code.OpPop),
+			},
+		},
+		{
+			input:             `do { if (true) { break; } continue; } while (true)`,
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.MakeInstruction(code.OpTrue),
+				// 0001
+				code.MakeInstruction(code.OpJumpNotTruthy, 11),
+				// 0004
+				code.MakeInstruction(code.OpJump, 23),
+				// 0007
+				code.MakeInstruction(code.OpNull),
+				// 0008
+				code.MakeInstruction(code.OpJump, 12),
+				// 0011
+				code.MakeInstruction(code.OpNull),
+				// 0012
+				code.MakeInstruction(code.OpPop),
+				// 0013
+				code.MakeInstruction(code.OpJump, 16),
+				// 0016
+				code.MakeInstruction(code.OpTrue),
+				// 0017
+				code.MakeInstruction(code.OpJumpNotTruthy, 23),
+				// 0020
+				code.MakeInstruction(code.OpJump, 0),
+				// 0023
+				code.MakeInstruction(code.OpNull),
+				// 0024
+				code.MakeInstruction(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestBreakAndContinue(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			// the continue pops the left operand of + before jumping
+			input:             `for (;;) { 1 + if (true) { continue } else { 2 } }`,
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.MakeInstruction(code.OpConstant, 0),
+				// 0003
+				code.MakeInstruction(code.OpTrue),
+				// 0004
+				code.MakeInstruction(code.OpJumpNotTruthy, 17),
+				// 0007
+				code.MakeInstruction(code.OpPopN, 1),
+				// 0010 continue
+				code.MakeInstruction(code.OpJump, 22),
+				// 0013
+				code.MakeInstruction(code.OpNull),
+				// 0014
+				code.MakeInstruction(code.OpJump, 20),
+				// 0017
+				code.MakeInstruction(code.OpConstant, 1),
+				// 0020
+				code.MakeInstruction(code.OpAdd),
+				// 0021
+				code.MakeInstruction(code.OpPop),
+				// 0022
+				code.MakeInstruction(code.OpJump, 0),
+				// 0025
+				code.MakeInstruction(code.OpNull),
+				// 0026
+				code.MakeInstruction(code.OpPop),
+			},
+		},
+		{
+			input:             `for (let i = 0; true; i = i + 1) { if (i) { break; } continue; }`,
+			expectedConstants: []interface{}{0, 1},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.MakeInstruction(code.OpConstant, 0),
+				// 0003
+				code.MakeInstruction(code.OpSetGlobal, 0),
+				// 0006
+				code.MakeInstruction(code.OpTrue),
+				// 0007
+				code.MakeInstruction(code.OpJumpNotTruthy, 41),
+				// 0010
+				code.MakeInstruction(code.OpGetGlobal, 0),
+				// 0013
+				code.MakeInstruction(code.OpJumpNotTruthy, 23),
+				// 0016 break
+				code.MakeInstruction(code.OpJump, 41),
+				// 0019
+				code.MakeInstruction(code.OpNull),
+				// 0020
+				code.MakeInstruction(code.OpJump, 24),
+				// 0023
+				code.MakeInstruction(code.OpNull),
+				// 0024
+				code.MakeInstruction(code.OpPop),
+				// 0025 continue
+				code.MakeInstruction(code.OpJump, 28),
+				// 0028
+				code.MakeInstruction(code.OpGetGlobal, 0),
+				// 0031
+				code.MakeInstruction(code.OpConstant, 1),
+				// 0034
+				code.MakeInstruction(code.OpAdd),
+				// 0035
+				code.MakeInstruction(code.OpSetGlobal, 0),
+				// 0038
+				code.MakeInstruction(code.OpJump, 6),
+				// 0041
+				code.MakeInstruction(code.OpNull),
+				// 0042
+				code.MakeInstruction(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestBreakAndContinueOutsideOfLoops(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"break", "break outside of loop"},
+		{"if (true) { continue; }", "continue outside of loop"},
+		{"for (;;) { let f = func() { break; }; }", "break outside of loop"},
+	}
+	for _, tt := range tests {
+		err := NewCompiler().Compile(parse(tt.input))
+		if err == nil {
+			t.Fatalf("expected compiler error for %q, got none", tt.input)
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("wrong error. want=%q, got=%q", tt.expected, err.Error())
+		}
+	}
+}
+
+func TestAssignmentErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"x = 1", "undefined variable: x"},
+		{"len = 1", "cannot assign to builtin: len"},
+		{"let a, b = 1", "let binds 2 names to 1 values"},
+		{"let a = 1, 2", "let binds 1 names to 2 values"},
+		{"const pi = 3; pi = 4", "cannot assign to constant: pi"},
+		{"const a = 1; let f = func() { a = 2 }", "cannot assign to constant: a"},
+		{"let f = func() { const a = 1; if (true) { a = 2 } }", "cannot assign to constant: a"},
+		{"const pi = 3; let pi = 4; pi = 5", "cannot redefine constant: pi"},
+		{"const pi = 3; const pi = 4", "cannot redefine constant: pi"},
+		{"let f = func() { const a = 1; let a, b = 2, 3 }", "cannot redefine constant: a"},
+		{"const a = 1; let [a] = [2]", "cannot redefine constant: a"},
+		// a default is compiled before its parameters move into cells
+		{"let f = func(a, g = func() { a = 2 }) { a }", "cannot assign to captured variable: a"},
+	}
+	for _, tt := range tests {
+		err := NewCompiler().Compile(parse(tt.input))
+		if err == nil {
+			t.Fatalf("expected compiler error for %q, got none", tt.input)
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("wrong error. want=%q, got=%q", tt.expected, err.Error())
+		}
+	}
+}
+
+func TestStringExpressions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `"monkey"`,
+			expectedConstants: []interface{}{"monkey"},
+			expectedInstructions: []code.Instructions{
+				code.MakeInstruction(code.OpConstant, 0),
+				code.MakeInstruction(code.OpPop),
+			},
+		},
+		{
+			input:             `"mon" + "key"`,
+			expectedConstants: []interface{}{"mon", "key"},
+			expectedInstructions: []code.Instructions{
+				code.MakeInstruction(code.OpConstant, 0),
+				code.MakeInstruction(code.OpConstant, 1),
+				code.MakeInstruction(code.OpAdd),
+				code.MakeInstruction(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestInterpolatedStrings(t *testing.T) {
+	str := object.BuiltinIndex("str")
+	tests := []compilerTestCase{
+		{
+			input:             `let a = 2; "a=${a}"`,
+			expectedConstants: []interface{}{2, "a="},
+			expectedInstructions: []code.Instructions{
+				code.MakeInstruction(code.OpConstant, 0),
+				code.MakeInstruction(code.OpSetGlobal, 0),
+				code.MakeInstruction(code.OpConstant, 1),
+				code.MakeInstruction(code.OpGetBuiltin, str),
+				code.MakeInstruction(code.OpGetGlobal, 0),
+				code.MakeInstruction(code.OpCall, 1),
+				code.MakeInstruction(code.OpAdd),
+				code.MakeInstruction(code.OpPop),
+			},
+		},
+		{
+			// a binding named str does not replace the builtin
+			input:             `let str = 1; "${str + 1}!"`,
+			expectedConstants: []interface{}{1, "!"},
+			expectedInstructions: []code.Instructions{
+				code.MakeInstruction(code.OpConstant, 0),
+				code.MakeInstruction(code.OpSetGlobal, 0),
+				code.MakeInstruction(code.OpGetBuiltin, str),
+				code.MakeInstruction(code.OpGetGlobal, 0),
+				code.MakeInstruction(code.OpConstant, 0),
+				code.MakeInstruction(code.OpAdd),
+				code.MakeInstruction(code.OpCall, 1),
+				code.MakeInstruction(code.OpConstant, 1),
+				code.MakeInstruction(code.OpAdd),
+				code.MakeInstruction(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestSmallIntegerConstantsAreShared(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: "1; 1 + 1; func() { 1 }",
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					code.MakeInstruction(code.OpConstant, 0),
+					code.MakeInstruction(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.MakeInstruction(code.OpConstant, 0),
+				code.MakeInstruction(code.OpPop),
+				code.MakeInstruction(code.OpConstant, 0),
+				code.MakeInstruction(code.OpConstant, 0),
+				code.MakeInstruction(code.OpAdd),
+				code.MakeInstruction(code.OpPop),
+				code.MakeInstruction(code.OpConstant, 1),
+				code.MakeInstruction(code.OpPop),
+			},
+		},
+		{
+			// larger integers get a constant for every use
+			input:             "11; 11",
+			expectedConstants: []interface{}{11, 11},
+			expectedInstructions: []code.Instructions{
+				code.MakeInstruction(code.OpConstant, 0),
+				code.MakeInstruction(code.OpPop),
+				code.MakeInstruction(code.OpConstant, 1),
+				code.MakeInstruction(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+
+	// a compiler resuming from an existing pool reuses its small integers
+	constants := []object.Object{&object.String{Value: "one"}, &object.Integer{Value: 1}}
+	compiler := NewWithState(NewSymbolTable(), constants)
+	if err := compiler.Compile(parse("1 + 2 + 1")); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	bytecode := compiler.ByteCode()
+	if len(bytecode.Constants) != 3 {
+		t.Fatalf("wrong number of constants. want=3, got=%d", len(bytecode.Constants))
+	}
+	expected := []code.Instructions{
+		code.MakeInstruction(code.OpConstant, 1),
+		code.MakeInstruction(code.OpConstant, 2),
+		code.MakeInstruction(code.OpAdd),
+		code.MakeInstruction(code.OpConstant, 1),
+		code.MakeInstruction(code.OpAdd),
+		code.MakeInstruction(code.OpPop),
+	}
+	if err := testInstructions(expected, bytecode.Instructions); err != nil {
+		t.Errorf("testInstructions failed: %s", err)
+	}
+}
+
+func TestArrayLiterals(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "[]",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.MakeInstruction(code.OpArray, 0),
+				code.MakeInstruction(code.OpPop),
+			},
+		},
+		{
+			input:             "[1, 2, 3]",
+			expectedConstants: []interface{}{1, 2, 3},
+			expectedInstructions: []code.Instructions{
+				code.MakeInstruction(code.OpConstant, 0),
+				code.MakeInstruction(code.OpConstant, 1),
+				code.MakeInstruction(code.OpConstant, 2),
+				code.MakeInstruction(code.OpArray, 3),
+				code.MakeInstruction(code.OpPop),
+			},
+		},
+		{
+			input:             "[1 + 2, 3 - 4, 5 * 6]",
+			expectedConstants: []interface{}{1, 2, 3, 4, 5, 6},
+			expectedInstructions: []code.Instructions{
+				code.MakeInstruction(code.OpConstant, 0),
+				code.MakeInstruction(code.OpConstant, 1),
+				code.MakeInstruction(code.OpAdd),
+				code.MakeInstruction(code.OpConstant, 2),
+				code.MakeInstruction(code.OpConstant, 3),
+				code.MakeInstruction(code.OpSub),
+				code.MakeInstruction(code.OpConstant, 4),
+				code.MakeInstruction(code.OpConstant, 5),
+				code.MakeInstruction(code.OpMul),
+				code.MakeInstruction(code.OpArray, 3),
+				code.MakeInstruction(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestLargeArrayLiteralsAreBuiltInChunks(t *testing.T) {
+	var (
+		elements     = make([]string, literalChunkSize+2)
+		constants    = make([]interface{}, len(elements))
+		instructions []code.Instructions
+	)
+	for i := range elements {
+		elements[i] = fmt.Sprint(i)
+		constants[i] = i
+		instructions = append(instructions, code.MakeInstruction(code.OpConstant, i))
+		if i == literalChunkSize-1 {
+			instructions = append(instructions, code.MakeInstruction(code.OpArray, literalChunkSize))
+		}
+	}
+	instructions = append(instructions,
+		code.MakeInstruction(code.OpExtend, 2),
+		code.MakeInstruction(code.OpPop),
+	)
+	tests := []compilerTestCase{
+		{
+			input:                "[" + strings.Join(elements, ", ") + "]",
+			expectedConstants:    constants,
+			expectedInstructions: instructions,
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestHashLiterals(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "{}",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.MakeInstruction(code.OpHash, 0),
+				code.MakeInstruction(code.OpPop),
+			},
+		},
+		{
+			input:             "{1: 2, 3: 4, 5: 6}",
+			expectedConstants: []interface{}{1, 2, 3, 4, 5, 6},
+			expectedInstructions: []code.Instructions{
+				code.MakeInstruction(code.OpConstant, 0),
+				code.MakeInstruction(code.OpConstant, 1),
+				code.MakeInstruction(code.OpConstant, 2),
+				code.MakeInstruction(code.OpConstant, 3),
+				code.MakeInstruction(code.OpConstant, 4),
+				code.MakeInstruction(code.OpConstant, 5),
+				code.MakeInstruction(code.OpHash, 6),
+				code.MakeInstruction(code.OpPop),
+			},
+		},
+		{
+			input:             "{1: 2 + 3, 4: 5 * 6}",
+			expectedConstants: []interface{}{1, 2, 3, 4, 5, 6},
+			expectedInstructions: []code.Instructions{
+				code.MakeInstruction(code.OpConstant, 0),
 				code.MakeInstruction(code.OpConstant, 1),
 				code.MakeInstruction(code.OpConstant, 2),
 				code.MakeInstruction(code.OpAdd),
@@ -379,18 +1045,47 @@ func TestHashLiterals(t *testing.T) {
 	runCompilerTests(t, tests)
 }
 
+func TestDuplicateHashLiteralKeys(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{"a": 1, "a": 2}`, "duplicate key in hash literal: a"},
+		{`{1: "one", 2: "two", 1: "uno"}`, "duplicate key in hash literal: 1"},
+		{`{true: 1, false: 2, true: 3}`, "duplicate key in hash literal: true"},
+		{`{2: 1, 1 + 1: 2}`, "duplicate key in hash literal: 2"},
+		{`func() { {"x": 1, "x": 1} }`, "duplicate key in hash literal: x"},
+	}
+	for _, tt := range tests {
+		err := NewCompiler().Compile(parse(tt.input))
+		if err == nil {
+			t.Fatalf("expected compiler error for %q, got none", tt.input)
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("wrong error. want=%q, got=%q", tt.expected, err.Error())
+		}
+	}
+
+	// keys that only compare equal at runtime are left for the VM
+	for _, input := range []string{`let k = "a"; {k: 1, "a": 2}`, `{"1": 1, 1: 2}`} {
+		if err := NewCompiler().Compile(parse(input)); err != nil {
+			t.Errorf("unexpected compiler error for %q: %s", input, err)
+		}
+	}
+}
+
 func TestIndexExpressions(t *testing.T) {
 	tests := []compilerTestCase{
 		{
 			input:             "[1, 2, 3][1 + 1]",
-			expectedConstants: []interface{}{1, 2, 3, 1, 1},
+			expectedConstants: []interface{}{1, 2, 3},
 			expectedInstructions: []code.Instructions{
 				code.MakeInstruction(code.OpConstant, 0),
 				code.MakeInstruction(code.OpConstant, 1),
 				code.MakeInstruction(code.OpConstant, 2),
 				code.MakeInstruction(code.OpArray, 3),
-				code.MakeInstruction(code.OpConstant, 3),
-				code.MakeInstruction(code.OpConstant, 4),
+				code.MakeInstruction(code.OpConstant, 0),
+				code.MakeInstruction(code.OpConstant, 0),
 				code.MakeInstruction(code.OpAdd),
 				code.MakeInstruction(code.OpIndex),
 				code.MakeInstruction(code.OpPop),
@@ -398,13 +1093,13 @@ func TestIndexExpressions(t *testing.T) {
 		},
 		{
 			input:             "{1: 2}[2 - 1]",
-			expectedConstants: []interface{}{1, 2, 2, 1},
+			expectedConstants: []interface{}{1, 2},
 			expectedInstructions: []code.Instructions{
 				code.MakeInstruction(code.OpConstant, 0),
 				code.MakeInstruction(code.OpConstant, 1),
 				code.MakeInstruction(code.OpHash, 2),
-				code.MakeInstruction(code.OpConstant, 2),
-				code.MakeInstruction(code.OpConstant, 3),
+				code.MakeInstruction(code.OpConstant, 1),
+				code.MakeInstruction(code.OpConstant, 0),
 				code.MakeInstruction(code.OpSub),
 				code.MakeInstruction(code.OpIndex),
 				code.MakeInstruction(code.OpPop),
@@ -414,6 +1109,131 @@ func TestIndexExpressions(t *testing.T) {
 	runCompilerTests(t, tests)
 }
 
+func TestClosures(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `func(a) { func(b) { a + b } }`,
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.MakeInstruction(code.OpGetFree, 0),
+					code.MakeInstruction(code.OpGetLocal, 0),
+					code.MakeInstruction(code.OpAdd),
+					code.MakeInstruction(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.MakeInstruction(code.OpGetLocal, 0),
+					code.MakeInstruction(code.OpClosure, 0, 1),
+					code.MakeInstruction(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.MakeInstruction(code.OpConstant, 1),
+				code.MakeInstruction(code.OpPop),
+			},
+		},
+		{
+			input: `
+			let g = 1;
+			func(a) {
+				let b = 2;
+				func(c) {
+					func(d) { g + a + b + c + d }
+				}
+			}`,
+			expectedConstants: []interface{}{
+				1,
+				2,
+				[]code.Instructions{
+					code.MakeInstruction(code.OpGetGlobal, 0),
+					code.MakeInstruction(code.OpGetFree, 0),
+					code.MakeInstruction(code.OpAdd),
+					code.MakeInstruction(code.OpGetFree, 1),
+					code.MakeInstruction(code.OpAdd),
+					code.MakeInstruction(code.OpGetFree, 2),
+					code.MakeInstruction(code.OpAdd),
+					code.MakeInstruction(code.OpGetLocal, 0),
+					code.MakeInstruction(code.OpAdd),
+					code.MakeInstruction(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.MakeInstruction(code.OpGetFree, 0),
+					code.MakeInstruction(code.OpGetFree, 1),
+					code.MakeInstruction(code.OpGetLocal, 0),
+					code.MakeInstruction(code.OpClosure, 2, 3),
+					code.MakeInstruction(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.MakeInstruction(code.OpConstant, 1),
+					code.MakeInstruction(code.OpSetLocal, 1),
+					code.MakeInstruction(code.OpGetLocal, 0),
+					code.MakeInstruction(code.OpGetLocal, 1),
+					code.MakeInstruction(code.OpClosure, 3, 2),
+					code.MakeInstruction(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.MakeInstruction(code.OpConstant, 0),
+				code.MakeInstruction(code.OpSetGlobal, 0),
+				code.MakeInstruction(code.OpConstant, 4),
+				code.MakeInstruction(code.OpPop),
+			},
+		},
+		{
+			input: `func() { let r = func() { r() }; }`,
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.MakeInstruction(code.OpGetFree, 0),
+					code.MakeInstruction(code.OpDeref),
+					code.MakeInstruction(code.OpCall, 0),
+					code.MakeInstruction(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.MakeInstruction(code.OpEmptyCell),
+					code.MakeInstruction(code.OpSetLocal, 0),
+					code.MakeInstruction(code.OpGetLocal, 0),
+					code.MakeInstruction(code.OpClosure, 0, 1),
+					code.MakeInstruction(code.OpGetLocal, 0),
+					code.MakeInstruction(code.OpSetCell),
+					code.MakeInstruction(code.OpReturn),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.MakeInstruction(code.OpConstant, 1),
+				code.MakeInstruction(code.OpPop),
+			},
+		},
+		{
+			input: `func() { let n = 0; func() { n = n + 1 } }`,
+			expectedConstants: []interface{}{
+				0,
+				1,
+				[]code.Instructions{
+					code.MakeInstruction(code.OpGetFree, 0),
+					code.MakeInstruction(code.OpDeref),
+					code.MakeInstruction(code.OpConstant, 1),
+					code.MakeInstruction(code.OpAdd),
+					code.MakeInstruction(code.OpGetFree, 0),
+					code.MakeInstruction(code.OpSetCell),
+					code.MakeInstruction(code.OpReturn),
+				},
+				[]code.Instructions{
+					code.MakeInstruction(code.OpConstant, 0),
+					code.MakeInstruction(code.OpCell),
+					code.MakeInstruction(code.OpSetLocal, 0),
+					code.MakeInstruction(code.OpGetLocal, 0),
+					code.MakeInstruction(code.OpClosure, 2, 1),
+					code.MakeInstruction(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.MakeInstruction(code.OpConstant, 3),
+				code.MakeInstruction(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
 func TestFunctions(t *testing.T) {
 	tests := []compilerTestCase{
 		{
@@ -468,7 +1288,54 @@ func TestFunctions(t *testing.T) {
 			},
 		},
 	}
-	runCompilerTests(t, tests)
+	runCompilerTests(t, tests)
+}
+
+func TestConsecutivePopsCollapse(t *testing.T) {
+	compiler := NewCompiler()
+	compiler.emit(code.OpTrue)
+	compiler.emit(code.OpFalse)
+	compiler.emit(code.OpNull)
+	compiler.emitPop()
+	compiler.emitPop()
+	compiler.emitPop()
+
+	expected := []code.Instructions{
+		code.MakeInstruction(code.OpTrue),
+		code.MakeInstruction(code.OpFalse),
+		code.MakeInstruction(code.OpNull),
+		code.MakeInstruction(code.OpPopN, 3),
+	}
+	if err := testInstructions(expected, compiler.currentInstructions()); err != nil {
+		t.Fatalf("testInstructions failed: %s", err)
+	}
+	last := compiler.scopes[compiler.scopeIndex].lastInstruction
+	if last.OpCode != code.OpPopN || last.Position != 3 {
+		t.Errorf("lastInstruction wrong. got=%+v", last)
+	}
+}
+
+func TestPopsAtJumpTargetsDoNotCollapse(t *testing.T) {
+	compiler := NewCompiler()
+	compiler.emit(code.OpTrue)
+	compiler.emit(code.OpTrue)
+	jump := compiler.emit(code.OpJumpNotTruthy, 9999)
+	compiler.emit(code.OpTrue)
+	compiler.emitPop()
+	compiler.patchJump(jump)
+	compiler.emitPop()
+
+	expected := []code.Instructions{
+		code.MakeInstruction(code.OpTrue),
+		code.MakeInstruction(code.OpTrue),
+		code.MakeInstruction(code.OpJumpNotTruthy, 7),
+		code.MakeInstruction(code.OpTrue),
+		code.MakeInstruction(code.OpPop),
+		code.MakeInstruction(code.OpPop),
+	}
+	if err := testInstructions(expected, compiler.currentInstructions()); err != nil {
+		t.Fatalf("testInstructions failed: %s", err)
+	}
 }
 
 func TestCompilerScopes(t *testing.T) {
@@ -525,6 +1392,67 @@ func TestCompilerScopes(t *testing.T) {
 	}
 }
 
+func TestReset(t *testing.T) {
+	compiler := NewCompiler()
+	if err := compiler.Compile(parse("let one = 1; let two = 2;")); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	first := compiler.ByteCode()
+
+	compiler.Reset()
+	if err := compiler.Compile(parse("let three = one + two; three;")); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	second := compiler.ByteCode()
+
+	err := testInstructions([]code.Instructions{
+		code.MakeInstruction(code.OpGetGlobal, 0),
+		code.MakeInstruction(code.OpGetGlobal, 1),
+		code.MakeInstruction(code.OpAdd),
+		code.MakeInstruction(code.OpSetGlobal, 2),
+		code.MakeInstruction(code.OpGetGlobal, 2),
+		code.MakeInstruction(code.OpPop),
+	}, second.Instructions)
+	if err != nil {
+		t.Fatalf("testInstructions failed: %s", err)
+	}
+	if err := testConstants(t, []interface{}{1, 2}, second.Constants); err != nil {
+		t.Fatalf("testConstants failed: %s", err)
+	}
+	if names := second.GlobalNames; len(names) != 3 || names[0] != "one" || names[1] != "two" || names[2] != "three" {
+		t.Errorf("wrong global names. got=%q", names)
+	}
+
+	// the bytecode of the first program is left as it was
+	err = testInstructions([]code.Instructions{
+		code.MakeInstruction(code.OpConstant, 0),
+		code.MakeInstruction(code.OpSetGlobal, 0),
+		code.MakeInstruction(code.OpConstant, 1),
+		code.MakeInstruction(code.OpSetGlobal, 1),
+	}, first.Instructions)
+	if err != nil {
+		t.Fatalf("testInstructions failed: %s", err)
+	}
+}
+
+func TestResetAfterFailedCompilation(t *testing.T) {
+	compiler := NewCompiler()
+	if err := compiler.Compile(parse("let f = func() { missing };")); err == nil {
+		t.Fatalf("expected a compiler error")
+	}
+	compiler.Reset()
+	if compiler.scopeIndex != 0 || compiler.symbolTable.Outer != nil {
+		t.Fatalf("compiler not back in the global scope. scopeIndex=%d", compiler.scopeIndex)
+	}
+	if err := compiler.Compile(parse("let a = 1; a;")); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	symbol, ok := compiler.symbolTable.Resolve("a")
+	if !ok || symbol.Scope != GlobalScope {
+		t.Errorf("a not defined as a global. got=%+v", symbol)
+	}
+}
+
 func TestFunctionsWithoutReturnValue(t *testing.T) {
 	tests := []compilerTestCase{
 		{
@@ -539,10 +1467,84 @@ func TestFunctionsWithoutReturnValue(t *testing.T) {
 				code.MakeInstruction(code.OpPop),
 			},
 		},
+		{
+			input: `func() { let a = 5; }`,
+			expectedConstants: []interface{}{
+				5,
+				[]code.Instructions{
+					code.MakeInstruction(code.OpConstant, 0),
+					code.MakeInstruction(code.OpSetLocal, 0),
+					code.MakeInstruction(code.OpReturn),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.MakeInstruction(code.OpConstant, 1),
+				code.MakeInstruction(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestForwardReferencedFunctions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			// b is defined when a refers to it, a only after its value
+			input: `
+			let a = func() { b() };
+			let b = func() { a() };
+			`,
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.MakeInstruction(code.OpGetGlobal, 0),
+					code.MakeInstruction(code.OpCall, 0),
+					code.MakeInstruction(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.MakeInstruction(code.OpGetGlobal, 1),
+					code.MakeInstruction(code.OpCall, 0),
+					code.MakeInstruction(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.MakeInstruction(code.OpConstant, 0),
+				code.MakeInstruction(code.OpSetGlobal, 1),
+				code.MakeInstruction(code.OpConstant, 1),
+				code.MakeInstruction(code.OpSetGlobal, 0),
+			},
+		},
+		{
+			input: `
+			let f = func() { f };
+			`,
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.MakeInstruction(code.OpGetGlobal, 0),
+					code.MakeInstruction(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.MakeInstruction(code.OpConstant, 0),
+				code.MakeInstruction(code.OpSetGlobal, 0),
+			},
+		},
 	}
 	runCompilerTests(t, tests)
 }
 
+func TestForwardReferencesNeedATopLevelFunction(t *testing.T) {
+	inputs := []string{
+		"let a = func() { b }; let b = 1;",
+		"let a = func() { b }; if (true) { let b = func() { 1 } }",
+	}
+	for _, input := range inputs {
+		err := NewCompiler().Compile(parse(input))
+		if err == nil || err.Error() != "undefined variable: b" {
+			t.Errorf("%s: expected an undefined variable error, got=%v", input, err)
+		}
+	}
+}
+
 func TestFunctionCalls(t *testing.T) {
 	tests := []compilerTestCase{
 		{
@@ -678,6 +1680,150 @@ func TestFunctionCalls(t *testing.T) {
 	runCompilerTests(t, tests)
 }
 
+func TestDefaultParameters(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `func(a, b = a + 1) { b }`,
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					code.MakeInstruction(code.OpGetLocal, 0),
+					code.MakeInstruction(code.OpConstant, 0),
+					code.MakeInstruction(code.OpAdd),
+					code.MakeInstruction(code.OpSetLocal, 1),
+					code.MakeInstruction(code.OpGetLocal, 1),
+					code.MakeInstruction(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.MakeInstruction(code.OpConstant, 1),
+				code.MakeInstruction(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+
+	entryTests := []struct {
+		input       string
+		numDefaults int
+		entries     []int
+	}{
+		{`func(a, b = a + 1) { b }`, 1, []int{0, 8}},
+		{`func(a = 1, b = 2, ...rest) { a }`, 2, []int{0, 5, 10}},
+		{`func(a, b) { a }`, 0, nil},
+	}
+	for _, tt := range entryTests {
+		compiler := NewCompiler()
+		if err := compiler.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		constants := compiler.ByteCode().Constants
+		fn := constants[len(constants)-1].(*object.CompiledFunction)
+
+		if fn.NumDefaults != tt.numDefaults {
+			t.Errorf("%s: wrong NumDefaults. want=%d, got=%d", tt.input, tt.numDefaults, fn.NumDefaults)
+		}
+		if fmt.Sprint(fn.Entries) != fmt.Sprint(tt.entries) {
+			t.Errorf("%s: wrong Entries. want=%v, got=%v", tt.input, tt.entries, fn.Entries)
+		}
+	}
+}
+
+func TestPrefixOperatorsOnCalls(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `
+			let arr = [];
+			let isEmpty = func(a) { a[0] == null };
+			!isEmpty(arr);
+			`,
+			expectedConstants: []interface{}{
+				0,
+				[]code.Instructions{
+					code.MakeInstruction(code.OpGetLocal, 0),
+					code.MakeInstruction(code.OpConstant, 0),
+					code.MakeInstruction(code.OpIndex),
+					code.MakeInstruction(code.OpNull),
+					code.MakeInstruction(code.OpEqual),
+					code.MakeInstruction(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.MakeInstruction(code.OpArray, 0),
+				code.MakeInstruction(code.OpSetGlobal, 0),
+				code.MakeInstruction(code.OpConstant, 1),
+				code.MakeInstruction(code.OpSetGlobal, 1),
+				code.MakeInstruction(code.OpGetGlobal, 1),
+				code.MakeInstruction(code.OpGetGlobal, 0),
+				code.MakeInstruction(code.OpCall, 1),
+				code.MakeInstruction(code.OpBang),
+				code.MakeInstruction(code.OpPop),
+			},
+		},
+		{
+			input: `
+			let compute = func() { 5 };
+			-compute();
+			`,
+			expectedConstants: []interface{}{
+				5,
+				[]code.Instructions{
+					code.MakeInstruction(code.OpConstant, 0),
+					code.MakeInstruction(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.MakeInstruction(code.OpConstant, 1),
+				code.MakeInstruction(code.OpSetGlobal, 0),
+				code.MakeInstruction(code.OpGetGlobal, 0),
+				code.MakeInstruction(code.OpCall, 0),
+				code.MakeInstruction(code.OpMinus),
+				code.MakeInstruction(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestBuiltins(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `
+			len([]);
+			push([], 1);
+			`,
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.MakeInstruction(code.OpGetBuiltin, 0),
+				code.MakeInstruction(code.OpArray, 0),
+				code.MakeInstruction(code.OpCall, 1),
+				code.MakeInstruction(code.OpPop),
+				code.MakeInstruction(code.OpGetBuiltin, 5),
+				code.MakeInstruction(code.OpArray, 0),
+				code.MakeInstruction(code.OpConstant, 0),
+				code.MakeInstruction(code.OpCall, 2),
+				code.MakeInstruction(code.OpPop),
+			},
+		},
+		{
+			input: `func() { len([]) }`,
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.MakeInstruction(code.OpGetBuiltin, 0),
+					code.MakeInstruction(code.OpArray, 0),
+					code.MakeInstruction(code.OpCall, 1),
+					code.MakeInstruction(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.MakeInstruction(code.OpConstant, 0),
+				code.MakeInstruction(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
 func runCompilerTests(t *testing.T, tests []compilerTestCase) {
 	t.Helper()
 
@@ -776,6 +1922,95 @@ func TestLetStatementScopes(t *testing.T) {
 	runCompilerTests(t, tests)
 }
 
+func TestBlockScopedLetStatements(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `
+			if (true) { let a = 1; a };
+			if (true) { let a = 2; a };
+			`,
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.MakeInstruction(code.OpTrue),
+				// 0001
+				code.MakeInstruction(code.OpJumpNotTruthy, 16),
+				// 0004
+				code.MakeInstruction(code.OpConstant, 0),
+				// 0007
+				code.MakeInstruction(code.OpSetGlobal, 0),
+				// 0010
+				code.MakeInstruction(code.OpGetGlobal, 0),
+				// 0013
+				code.MakeInstruction(code.OpJump, 17),
+				// 0016
+				code.MakeInstruction(code.OpNull),
+				// 0017
+				code.MakeInstruction(code.OpPop),
+				// 0018
+				code.MakeInstruction(code.OpTrue),
+				// 0019
+				code.MakeInstruction(code.OpJumpNotTruthy, 34),
+				// 0022
+				code.MakeInstruction(code.OpConstant, 1),
+				// 0025
+				code.MakeInstruction(code.OpSetGlobal, 1),
+				// 0028
+				code.MakeInstruction(code.OpGetGlobal, 1),
+				// 0031
+				code.MakeInstruction(code.OpJump, 35),
+				// 0034
+				code.MakeInstruction(code.OpNull),
+				// 0035
+				code.MakeInstruction(code.OpPop),
+			},
+		},
+		{
+			input: `
+			func(a) { if (a) { let a = 2; a } else { let b = 3; b } }
+			`,
+			expectedConstants: []interface{}{
+				2,
+				3,
+				[]code.Instructions{
+					code.MakeInstruction(code.OpGetLocal, 0),
+					code.MakeInstruction(code.OpJumpNotTruthy, 15),
+					code.MakeInstruction(code.OpConstant, 0),
+					code.MakeInstruction(code.OpSetLocal, 1),
+					code.MakeInstruction(code.OpGetLocal, 1),
+					code.MakeInstruction(code.OpJump, 22),
+					code.MakeInstruction(code.OpConstant, 1),
+					code.MakeInstruction(code.OpSetLocal, 2),
+					code.MakeInstruction(code.OpGetLocal, 2),
+					code.MakeInstruction(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.MakeInstruction(code.OpConstant, 2),
+				code.MakeInstruction(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestBlockScopedLetsAreUndefinedAfterTheBlock(t *testing.T) {
+	tests := []string{
+		"if (true) { let a = 1; }; a",
+		"if (false) { 1 } else { let b = 2; }; b",
+		"for (let i = 0; i < 3; i = i + 1) { }; i",
+		"for (;;) { let c = 1; break; }; c",
+		"func() { if (true) { let d = 1; }; d }",
+	}
+	for _, input := range tests {
+		compiler := NewCompiler()
+		err := compiler.Compile(parse(input))
+		if err == nil || !strings.HasPrefix(err.Error(), "undefined variable: ") {
+			t.Errorf("%s: expected an undefined variable error. got=%v", input, err)
+		}
+	}
+}
+
 /*func TestBuiltins(t *testing.T) {
 	tests := []compilerTestCase{
 		{
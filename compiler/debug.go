@@ -0,0 +1,164 @@
+package compiler
+
+import (
+	"comp/ast"
+	"comp/code"
+	"comp/token"
+)
+
+// SourcePosition is the line and column of a token in the source, both
+// counting from 1.
+type SourcePosition struct {
+	Line   int
+	Column int
+}
+
+// DebugInfo relates the instructions of the program, or of one compiled
+// function, back to the source they were compiled from.
+type DebugInfo struct {
+	// Positions maps the offset of every instruction to the position of the
+	// node it was emitted for.
+	Positions map[int]SourcePosition
+	// Names maps the offset of every OpSetGlobal, OpSetLocal and OpSetCell to
+	// the name of the variable it sets.
+	Names map[int]string
+	// Slots maps the slots to the names of the variables living in them:
+	// the globals for the program, the locals for a function.
+	Slots map[int]string
+	// Functions holds the debug info of every compiled function, by the
+	// index of its constant. It is only set for the program.
+	Functions map[int]*DebugInfo
+}
+
+func newDebugInfo() *DebugInfo {
+	return &DebugInfo{
+		Positions: make(map[int]SourcePosition),
+		Names:     make(map[int]string),
+		Slots:     make(map[int]string),
+	}
+}
+
+// EnableDebugInfo makes the compiler record a DebugInfo for the program and
+// each function it compiles, which ByteCode hands out along with the
+// instructions. Must be called before Compile.
+func (c *Compiler) EnableDebugInfo() {
+	c.debugInfo = true
+	c.functionDebugInfo = make(map[int]*DebugInfo)
+	for i := range c.scopes {
+		c.scopes[i].debug = newDebugInfo()
+	}
+}
+
+// enterNode makes node's position the one recorded for the instructions
+// emitted until the returned function restores the previous one. Nodes
+// without a position of their own, like the text of an interpolated string,
+// keep that of the node around them.
+func (c *Compiler) enterNode(node ast.Node) func() {
+	saved := c.position
+	if tokn, ok := nodeToken(node); ok && tokn.Line > 0 {
+		c.position = SourcePosition{Line: tokn.Line, Column: tokn.Column}
+	}
+	return func() { c.position = saved }
+}
+
+// recordPosition notes the current position for the instruction at pos.
+func (c *Compiler) recordPosition(pos int) {
+	debug := c.scopes[c.scopeIndex].debug
+	if debug == nil || c.position.Line == 0 {
+		return
+	}
+	debug.Positions[pos] = c.position
+}
+
+// recordSlot notes the name of the variable in the slot of symbol, in the
+// debug info of the function or program the slot belongs to.
+func (c *Compiler) recordSlot(symbol Symbol) {
+	debug := c.scopes[c.scopeIndex].debug
+	if symbol.Scope == GlobalScope {
+		debug = c.scopes[0].debug
+	}
+	if debug != nil {
+		debug.Slots[symbol.Index] = symbol.Name
+	}
+}
+
+// emitSet emits the instruction storing the value on top of the stack in the
+// variable of symbol.
+func (c *Compiler) emitSet(symbol Symbol) int {
+	if symbol.Scope == LocalScope && c.symbolTable.cells[symbol.Name] {
+		// a new binding of a variable living in a cell gets a new cell
+		c.emit(code.OpCell)
+	}
+	op := code.OpSetLocal
+	if symbol.Scope == GlobalScope {
+		op = code.OpSetGlobal
+	}
+	pos := c.emit(op, symbol.Index)
+	if debug := c.scopes[c.scopeIndex].debug; debug != nil {
+		debug.Names[pos] = symbol.Name
+		c.recordSlot(symbol)
+	}
+	return pos
+}
+
+// nodeToken returns the token a node starts at, or for operators the token
+// of the operator.
+func nodeToken(node ast.Node) (token.Token, bool) {
+	switch node := node.(type) {
+	case *ast.LetStatement:
+		return node.Token, true
+	case *ast.MultiLetStatement:
+		return node.Token, true
+	case *ast.ArrayLetStatement:
+		return node.Token, true
+	case *ast.HashLetStatement:
+		return node.Token, true
+	case *ast.ReturnStatement:
+		return node.Token, true
+	case *ast.AssignStatement:
+		return node.Token, true
+	case *ast.ForStatement:
+		return node.Token, true
+	case *ast.DoWhileStatement:
+		return node.Token, true
+	case *ast.BreakStatement:
+		return node.Token, true
+	case *ast.ContinueStatement:
+		return node.Token, true
+	case *ast.ExpressionStatement:
+		return node.Token, true
+	case *ast.BlockStatement:
+		return node.Token, true
+	case *ast.Identifier:
+		return node.Token, true
+	case *ast.IntegerLiteral:
+		return node.Token, true
+	case *ast.StringLiteral:
+		return node.Token, true
+	case *ast.InterpolatedString:
+		return node.Token, true
+	case *ast.Boolean:
+		return node.Token, true
+	case *ast.NullLiteral:
+		return node.Token, true
+	case *ast.PrefixExpression:
+		return node.Token, true
+	case *ast.InfixExpression:
+		return node.Token, true
+	case *ast.IfExpression:
+		return node.Token, true
+	case *ast.SwitchExpression:
+		return node.Token, true
+	case *ast.FunctionLiteral:
+		return node.Token, true
+	case *ast.CallExpression:
+		return node.Token, true
+	case *ast.ArrayLiteral:
+		return node.Token, true
+	case *ast.IndexExpression:
+		return node.Token, true
+	case *ast.HashLiteral:
+		return node.Token, true
+	}
+	return token.Token{}, false
+}
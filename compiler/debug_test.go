@@ -0,0 +1,73 @@
+package compiler
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDebugInfo(t *testing.T) {
+	input := `let x = 1;
+let add = func(a, b) {
+  let sum = a + b;
+  sum
+};
+x = add(x, 2);`
+
+	compiler := NewCompiler()
+	compiler.EnableDebugInfo()
+	if err := compiler.Compile(parse(input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	debug := compiler.ByteCode().DebugInfo
+	if debug == nil {
+		t.Fatalf("bytecode has no debug info")
+	}
+
+	expectedSlots := map[int]string{0: "x", 1: "add"}
+	if !reflect.DeepEqual(debug.Slots, expectedSlots) {
+		t.Errorf("wrong global slots. want=%v, got=%v", expectedSlots, debug.Slots)
+	}
+	// OpConstant and OpSetGlobal take 3 bytes, OpCall 2
+	expectedNames := map[int]string{3: "x", 9: "add", 23: "x"}
+	if !reflect.DeepEqual(debug.Names, expectedNames) {
+		t.Errorf("wrong set names. want=%v, got=%v", expectedNames, debug.Names)
+	}
+	expectedLines := map[int]int{0: 1, 3: 1, 6: 2, 9: 2, 12: 6, 15: 6, 18: 6, 21: 6, 23: 6}
+	testDebugLines(t, debug, expectedLines)
+
+	fn, ok := debug.Functions[1]
+	if !ok {
+		t.Fatalf("no debug info for the function. got=%v", debug.Functions)
+	}
+	expectedSlots = map[int]string{0: "a", 1: "b", 2: "sum"}
+	if !reflect.DeepEqual(fn.Slots, expectedSlots) {
+		t.Errorf("wrong local slots. want=%v, got=%v", expectedSlots, fn.Slots)
+	}
+	// OpGetLocal and OpSetLocal take 2 bytes, OpAdd 1
+	expectedNames = map[int]string{5: "sum"}
+	if !reflect.DeepEqual(fn.Names, expectedNames) {
+		t.Errorf("wrong set names. want=%v, got=%v", expectedNames, fn.Names)
+	}
+	testDebugLines(t, fn, map[int]int{0: 3, 2: 3, 4: 3, 5: 3, 7: 4, 9: 4})
+}
+
+func TestDebugInfoIsOffByDefault(t *testing.T) {
+	compiler := NewCompiler()
+	if err := compiler.Compile(parse("let x = 1; x")); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	if debug := compiler.ByteCode().DebugInfo; debug != nil {
+		t.Errorf("expected no debug info, got=%+v", debug)
+	}
+}
+
+func testDebugLines(t *testing.T, debug *DebugInfo, expected map[int]int) {
+	t.Helper()
+	lines := make(map[int]int, len(debug.Positions))
+	for offset, pos := range debug.Positions {
+		lines[offset] = pos.Line
+	}
+	if !reflect.DeepEqual(lines, expected) {
+		t.Errorf("wrong offset lines. want=%v, got=%v", expected, lines)
+	}
+}
@@ -0,0 +1,90 @@
+package compiler
+
+import (
+	"fmt"
+	"strings"
+
+	"comp/code"
+	"comp/object"
+)
+
+// functionIndent prefixes the instructions of a compiled function listed in
+// the constant pool.
+const functionIndent = "    "
+
+// Disassemble renders bytecode as a human readable listing: the constant
+// pool, with the instructions of every compiled function expanded beneath its
+// entry, followed by the main program's instructions.
+func Disassemble(bytecode *ByteCode) string {
+	var out strings.Builder
+
+	out.WriteString(DisassembleConstants(bytecode.Constants))
+	out.WriteString("instructions:\n")
+	out.WriteString(bytecode.Instructions.String())
+	return out.String()
+}
+
+// DisassembleConstants renders the constant pool part of Disassemble, one
+// entry per constant index.
+func DisassembleConstants(constants []object.Object) string {
+	var out strings.Builder
+
+	out.WriteString("constants:\n")
+	for i, constant := range constants {
+		switch constant := constant.(type) {
+		case *object.CompiledFunction:
+			_, _ = fmt.Fprintf(&out, "%04d func params=%d locals=%d", i,
+				constant.NumParameters, constant.NumLocals)
+			if constant.Variadic {
+				out.WriteString(" variadic")
+			}
+			if constant.NumDefaults > 0 {
+				_, _ = fmt.Fprintf(&out, " defaults=%d entries=%v", constant.NumDefaults, constant.Entries)
+			}
+			out.WriteString("\n")
+
+			listing := strings.TrimSuffix(constant.Instructions.String(), "\n")
+			for _, line := range strings.Split(listing, "\n") {
+				out.WriteString(functionIndent + line + "\n")
+			}
+		case *object.String:
+			_, _ = fmt.Fprintf(&out, "%04d %s %q\n", i, constant.Type(), constant.Value)
+		default:
+			_, _ = fmt.Fprintf(&out, "%04d %s %s\n", i, constant.Type(), constant.Inspect())
+		}
+	}
+	return out.String()
+}
+
+// ConstantUsage reports for every entry of the constant pool how many
+// OpConstant and OpClosure instructions refer to it, in the main program
+// compiled last and in the compiled functions of the pool. An entry nothing
+// refers to, such as a constant left over from a program compiled before
+// Reset, counts zero.
+func (c *Compiler) ConstantUsage() []int {
+	usage := make([]int, len(c.constants))
+
+	countConstantReferences(c.scopes[0].instructions, usage)
+	for _, constant := range c.constants {
+		if fn, ok := constant.(*object.CompiledFunction); ok {
+			countConstantReferences(fn.Instructions, usage)
+		}
+	}
+	return usage
+}
+
+func countConstantReferences(ins code.Instructions, usage []int) {
+	for i := 0; i < len(ins); {
+		def, err := code.Lookup(ins[i])
+		if err != nil {
+			i++
+			continue
+		}
+		operands, read := code.ReadOperands(def, ins[i+1:])
+		op := code.Opcode(ins[i])
+		if (op == code.OpConstant || op == code.OpClosure) && operands[0] < len(usage) {
+			usage[operands[0]]++
+		}
+		i += 1 + read
+	}
+}
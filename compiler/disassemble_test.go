@@ -0,0 +1,62 @@
+package compiler
+
+import "testing"
+
+func TestDisassemble(t *testing.T) {
+	compiler := NewCompiler()
+	if err := compiler.Compile(parse(`let f = func(a, b = 2, ...c) { a }; f("x")`)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	expected := `constants:
+0000 INTEGER 2
+0001 func params=3 locals=3 variadic defaults=1 entries=[0 5]
+    0000 OpConstant 0
+    0003 OpSetLocal 1
+    0005 OpGetLocal 0
+    0007 OpReturnValue
+0002 STRING "x"
+instructions:
+0000 OpConstant 1
+0003 OpSetGlobal 0
+0006 OpGetGlobal 0
+0009 OpConstant 2
+0012 OpCall 1
+0014 OpPop
+`
+	if listing := Disassemble(compiler.ByteCode()); listing != expected {
+		t.Errorf("wrong listing.\nwant:\n%s\ngot:\n%s", expected, listing)
+	}
+}
+
+func TestConstantUsage(t *testing.T) {
+	compiler := NewCompiler()
+	if err := compiler.Compile(parse(`let f = func(a = 7) { a + 1 }; f(1) + f(1) + 5`)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	// 0: 7, 1: 1 in the body and both arguments, 2: f, 3: 5. A small
+	// integer is a single constant however often it appears.
+	expected := []int{1, 3, 1, 1}
+	testConstantUsage(t, expected, compiler.ConstantUsage())
+
+	compiler.Reset()
+	if err := compiler.Compile(parse(`let g = func() { 2 }; g() + g()`)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	// the constants of the first program are no longer referred to, except
+	// from within the function that is still in the pool
+	expected = []int{1, 1, 0, 0, 1, 1}
+	testConstantUsage(t, expected, compiler.ConstantUsage())
+}
+
+func testConstantUsage(t *testing.T, expected, actual []int) {
+	t.Helper()
+
+	if len(actual) != len(expected) {
+		t.Fatalf("wrong number of entries. want=%d, got=%d (%v)", len(expected), len(actual), actual)
+	}
+	for i, count := range expected {
+		if actual[i] != count {
+			t.Errorf("wrong usage of constant %d. want=%d, got=%d", i, count, actual[i])
+		}
+	}
+}
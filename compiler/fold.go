@@ -0,0 +1,264 @@
+package compiler
+
+import (
+	"comp/ast"
+	"comp/code"
+	"comp/object"
+	"strings"
+)
+
+// pureBuiltins lists the builtins without side effects. A call to one of them
+// is evaluated at compile time when all of its arguments are constant. Builtins
+// like `puts` must never be added here.
+var pureBuiltins = map[string]bool{
+	"abs":    true,
+	"pow":    true,
+	"len":    true,
+	"min":    true,
+	"max":    true,
+	"clamp":  true,
+	"format": true,
+	"str":    true,
+}
+
+// EnableConstantFolding makes the compiler evaluate constant expressions, such
+// as `2 * 3` or `len("four")`, at compile time and emit their result as a
+// single constant instead of the instructions computing it.
+func (c *Compiler) EnableConstantFolding() {
+	c.foldConstants = true
+}
+
+// compileFolded emits the value of node as a constant if constant folding is
+// enabled and node can be evaluated at compile time. Reports whether it
+// emitted anything.
+func (c *Compiler) compileFolded(node ast.Expression) bool {
+	if !c.foldConstants {
+		return false
+	}
+	value, ok := c.constantValue(node)
+	if !ok {
+		return false
+	}
+	switch value := value.(type) {
+	case *object.Integer, *object.String:
+		c.emit(code.OpConstant, c.addConstant(value))
+	case *object.Boolean:
+		if value.Value {
+			c.emit(code.OpTrue)
+		} else {
+			c.emit(code.OpFalse)
+		}
+	case *object.Null:
+		c.emit(code.OpNull)
+	default:
+		// arrays and hashes are built at runtime, they may be used as
+		// builtin arguments but are never emitted as constants.
+		return false
+	}
+	return true
+}
+
+// constantValue evaluates node at compile time. It reports false if node is
+// not a constant expression, or if evaluating it would fail at runtime; the
+// latter is left to the VM so that the error surfaces as usual.
+func (c *Compiler) constantValue(node ast.Expression) (object.Object, bool) {
+	switch node := node.(type) {
+	case *ast.IntegerLiteral:
+		return &object.Integer{Value: node.Value}, true
+	case *ast.StringLiteral:
+		return &object.String{Value: node.Value}, true
+	case *ast.InterpolatedString:
+		var out strings.Builder
+		for _, part := range node.Parts {
+			value, ok := c.constantValue(part)
+			if !ok {
+				return nil, false
+			}
+			out.WriteString(object.StringOf(value))
+		}
+		return &object.String{Value: out.String()}, true
+	case *ast.Boolean:
+		return &object.Boolean{Value: node.Value}, true
+	case *ast.Identifier:
+		value, ok := c.propagated[node.Value]
+		return value, ok
+	case *ast.ArrayLiteral:
+		elements := make([]object.Object, len(node.Elements))
+		for i, elem := range node.Elements {
+			value, ok := c.constantValue(elem)
+			if !ok {
+				return nil, false
+			}
+			elements[i] = value
+		}
+		return &object.Array{Elements: elements}, true
+	case *ast.PrefixExpression:
+		right, ok := c.constantValue(node.Right)
+		if !ok {
+			return nil, false
+		}
+		return foldPrefix(node.Operator, right)
+	case *ast.InfixExpression:
+		left, ok := c.constantValue(node.Left)
+		if !ok {
+			return nil, false
+		}
+		right, ok := c.constantValue(node.Right)
+		if !ok {
+			return nil, false
+		}
+		return foldInfix(node.Operator, left, right)
+	case *ast.CallExpression:
+		return c.foldBuiltinCall(node)
+	case *ast.IndexExpression:
+		left, ok := c.constantValue(node.Left)
+		if !ok {
+			return nil, false
+		}
+		index, ok := c.constantValue(node.Index)
+		if !ok {
+			return nil, false
+		}
+		return foldIndex(left, index)
+	}
+	return nil, false
+}
+
+// foldBuiltinCall evaluates a call to a pure builtin whose arguments are all
+// constant. The callee has to resolve to the builtin itself, a user definition
+// shadowing it is never folded.
+func (c *Compiler) foldBuiltinCall(node *ast.CallExpression) (object.Object, bool) {
+	ident, ok := node.Function.(*ast.Identifier)
+	if !ok || !pureBuiltins[ident.Value] {
+		return nil, false
+	}
+	symbol, ok := c.symbolTable.Resolve(ident.Value)
+	if !ok || symbol.Scope != BuiltinScope {
+		return nil, false
+	}
+	args := make([]object.Object, len(node.Arguments))
+	for i, arg := range node.Arguments {
+		value, ok := c.constantValue(arg)
+		if !ok {
+			return nil, false
+		}
+		args[i] = value
+	}
+	result := object.Builtins[symbol.Index].BuiltIn.Func(args...)
+	if result == nil || result.Type() == object.ERROR_OBJ {
+		return nil, false
+	}
+	return result, true
+}
+
+// foldIndex indexes a constant array or string with a constant integer. Like
+// in the VM, an index that is negative or past the end results in null.
+func foldIndex(left, index object.Object) (object.Object, bool) {
+	idx, ok := index.(*object.Integer)
+	if !ok {
+		return nil, false
+	}
+	switch left := left.(type) {
+	case *object.Array:
+		if idx.Value < 0 || idx.Value >= int64(len(left.Elements)) {
+			return &object.Null{}, true
+		}
+		return left.Elements[idx.Value], true
+	case *object.String:
+		char, ok := left.CharAt(idx.Value)
+		if !ok {
+			return &object.Null{}, true
+		}
+		return char, true
+	}
+	return nil, false
+}
+
+// foldPrefix applies a prefix operator to a constant operand.
+func foldPrefix(operator string, right object.Object) (object.Object, bool) {
+	switch right := right.(type) {
+	case *object.Integer:
+		switch operator {
+		case "-":
+			return foldedInteger(object.SubtractIntegers(0, right.Value))
+		case "~":
+			return &object.Integer{Value: ^right.Value}, true
+		}
+	case *object.Boolean:
+		if operator == "!" {
+			return &object.Boolean{Value: !right.Value}, true
+		}
+	}
+	return nil, false
+}
+
+// foldInfix applies an infix operator to two constant operands. Only the
+// combinations for which the VM's result is fully determined by the operand
+// values are folded.
+func foldInfix(operator string, left, right object.Object) (object.Object, bool) {
+	if comparable, ok := left.(object.Comparable); ok && left.Type() == right.Type() {
+		order, err := comparable.Compare(right)
+		if holds, ok := object.ComparisonHolds(operator, order); ok && err == nil {
+			return &object.Boolean{Value: holds}, true
+		}
+	}
+	switch {
+	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
+		return foldIntegerInfix(operator, left.(*object.Integer).Value, right.(*object.Integer).Value)
+
+	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
+		lval, rval := left.(*object.String).Value, right.(*object.String).Value
+		if operator == "+" {
+			return &object.String{Value: lval + rval}, true
+		}
+
+	case left.Type() == object.BOOLEAN_OBJ && right.Type() == object.BOOLEAN_OBJ:
+		lval, rval := left.(*object.Boolean).Value, right.(*object.Boolean).Value
+		switch operator {
+		case "==":
+			return &object.Boolean{Value: lval == rval}, true
+		case "!=":
+			return &object.Boolean{Value: lval != rval}, true
+		case "&", "&&":
+			return &object.Boolean{Value: lval && rval}, true
+		case "|", "||":
+			return &object.Boolean{Value: lval || rval}, true
+		}
+	}
+	return nil, false
+}
+
+func foldIntegerInfix(operator string, lval, rval int64) (object.Object, bool) {
+	switch operator {
+	case "+":
+		return foldedInteger(object.AddIntegers(lval, rval))
+	case "-":
+		return foldedInteger(object.SubtractIntegers(lval, rval))
+	case "*":
+		return foldedInteger(object.MultiplyIntegers(lval, rval))
+	case "/":
+		if rval == 0 {
+			return nil, false
+		}
+		return foldedInteger(object.DivideIntegers(lval, rval))
+	case "**":
+		if rval < 0 {
+			return nil, false
+		}
+		return foldedInteger(object.IntegerPower(lval, rval))
+	case "&":
+		return &object.Integer{Value: lval & rval}, true
+	case "|":
+		return &object.Integer{Value: lval | rval}, true
+	}
+	return nil, false
+}
+
+// foldedInteger wraps the result of a checked integer operation. An overflow
+// is not folded, so that the VM reports it at runtime.
+func foldedInteger(value int64, ok bool) (object.Object, bool) {
+	if !ok {
+		return nil, false
+	}
+	return &object.Integer{Value: value}, true
+}
@@ -0,0 +1,417 @@
+package compiler
+
+import (
+	"comp/code"
+	"comp/object"
+	"testing"
+)
+
+type foldingTestCase struct {
+	input                string
+	expectedConstants    []object.Object
+	expectedInstructions []code.Instructions
+}
+
+func TestConstantFolding(t *testing.T) {
+	tests := []foldingTestCase{
+		{
+			input:             "1 + 2 * 3",
+			expectedConstants: []object.Object{&object.Integer{Value: 7}},
+			expectedInstructions: []code.Instructions{
+				code.MakeInstruction(code.OpConstant, 0),
+				code.MakeInstruction(code.OpPop),
+			},
+		},
+		{
+			input:             "-(2 - 5)",
+			expectedConstants: []object.Object{&object.Integer{Value: 3}},
+			expectedInstructions: []code.Instructions{
+				code.MakeInstruction(code.OpConstant, 0),
+				code.MakeInstruction(code.OpPop),
+			},
+		},
+		{
+			input:             "2 ** 3 ** 2 - 2 ** 0",
+			expectedConstants: []object.Object{&object.Integer{Value: 511}},
+			expectedInstructions: []code.Instructions{
+				code.MakeInstruction(code.OpConstant, 0),
+				code.MakeInstruction(code.OpPop),
+			},
+		},
+		{
+			// the VM reports the negative exponent
+			input: "2 ** -1",
+			expectedConstants: []object.Object{
+				&object.Integer{Value: 2},
+				&object.Integer{Value: -1},
+			},
+			expectedInstructions: []code.Instructions{
+				code.MakeInstruction(code.OpConstant, 0),
+				code.MakeInstruction(code.OpConstant, 1),
+				code.MakeInstruction(code.OpPow),
+				code.MakeInstruction(code.OpPop),
+			},
+		},
+		{
+			// the VM reports the overflow
+			input: "9223372036854775807 + 1",
+			expectedConstants: []object.Object{
+				&object.Integer{Value: 9223372036854775807},
+				&object.Integer{Value: 1},
+			},
+			expectedInstructions: []code.Instructions{
+				code.MakeInstruction(code.OpConstant, 0),
+				code.MakeInstruction(code.OpConstant, 1),
+				code.MakeInstruction(code.OpAdd),
+				code.MakeInstruction(code.OpPop),
+			},
+		},
+		{
+			input:             "~0 * 2",
+			expectedConstants: []object.Object{&object.Integer{Value: -2}},
+			expectedInstructions: []code.Instructions{
+				code.MakeInstruction(code.OpConstant, 0),
+				code.MakeInstruction(code.OpPop),
+			},
+		},
+		{
+			input:             `"mon" + "key"`,
+			expectedConstants: []object.Object{&object.String{Value: "monkey"}},
+			expectedInstructions: []code.Instructions{
+				code.MakeInstruction(code.OpConstant, 0),
+				code.MakeInstruction(code.OpPop),
+			},
+		},
+		{
+			input:             "6 & 3 | 8",
+			expectedConstants: []object.Object{&object.Integer{Value: 10}},
+			expectedInstructions: []code.Instructions{
+				code.MakeInstruction(code.OpConstant, 0),
+				code.MakeInstruction(code.OpPop),
+			},
+		},
+		{
+			input:             "true && false || 1 > 0",
+			expectedConstants: []object.Object{},
+			expectedInstructions: []code.Instructions{
+				code.MakeInstruction(code.OpTrue),
+				code.MakeInstruction(code.OpPop),
+			},
+		},
+		{
+			input:             `"a" + "b" == "ab"`,
+			expectedConstants: []object.Object{},
+			expectedInstructions: []code.Instructions{
+				code.MakeInstruction(code.OpTrue),
+				code.MakeInstruction(code.OpPop),
+			},
+		},
+		{
+			input:             `"b" < "a"`,
+			expectedConstants: []object.Object{},
+			expectedInstructions: []code.Instructions{
+				code.MakeInstruction(code.OpFalse),
+				code.MakeInstruction(code.OpPop),
+			},
+		},
+		{
+			input:             "1 < 2 == true",
+			expectedConstants: []object.Object{},
+			expectedInstructions: []code.Instructions{
+				code.MakeInstruction(code.OpTrue),
+				code.MakeInstruction(code.OpPop),
+			},
+		},
+		{
+			// division by zero is left for the VM to report
+			input: "1 / 0",
+			expectedConstants: []object.Object{
+				&object.Integer{Value: 1},
+				&object.Integer{Value: 0},
+			},
+			expectedInstructions: []code.Instructions{
+				code.MakeInstruction(code.OpConstant, 0),
+				code.MakeInstruction(code.OpConstant, 1),
+				code.MakeInstruction(code.OpDiv),
+				code.MakeInstruction(code.OpPop),
+			},
+		},
+	}
+	runFoldingTests(t, tests)
+}
+
+func TestConstantFoldingPureBuiltins(t *testing.T) {
+	tests := []foldingTestCase{
+		{
+			input:             `len("four")`,
+			expectedConstants: []object.Object{&object.Integer{Value: 4}},
+			expectedInstructions: []code.Instructions{
+				code.MakeInstruction(code.OpConstant, 0),
+				code.MakeInstruction(code.OpPop),
+			},
+		},
+		{
+			input:             `abs(-5)`,
+			expectedConstants: []object.Object{&object.Integer{Value: 5}},
+			expectedInstructions: []code.Instructions{
+				code.MakeInstruction(code.OpConstant, 0),
+				code.MakeInstruction(code.OpPop),
+			},
+		},
+		{
+			input:             `pow(2, 10) - max(1, min(4, 3), 2)`,
+			expectedConstants: []object.Object{&object.Integer{Value: 1021}},
+			expectedInstructions: []code.Instructions{
+				code.MakeInstruction(code.OpConstant, 0),
+				code.MakeInstruction(code.OpPop),
+			},
+		},
+		{
+			input:             `clamp(15, 0, 10)`,
+			expectedConstants: []object.Object{&object.Integer{Value: 10}},
+			expectedInstructions: []code.Instructions{
+				code.MakeInstruction(code.OpConstant, 0),
+				code.MakeInstruction(code.OpPop),
+			},
+		},
+		{
+			input:             `format("{} + {} = {}", 1, 2, 1 + 2)`,
+			expectedConstants: []object.Object{&object.String{Value: "1 + 2 = 3"}},
+			expectedInstructions: []code.Instructions{
+				code.MakeInstruction(code.OpConstant, 0),
+				code.MakeInstruction(code.OpPop),
+			},
+		},
+		{
+			input:             `"${1 + 2} is ${true}"`,
+			expectedConstants: []object.Object{&object.String{Value: "3 is true"}},
+			expectedInstructions: []code.Instructions{
+				code.MakeInstruction(code.OpConstant, 0),
+				code.MakeInstruction(code.OpPop),
+			},
+		},
+		{
+			input:             `len([1, 2, 3]) * len("a" + "b")`,
+			expectedConstants: []object.Object{&object.Integer{Value: 6}},
+			expectedInstructions: []code.Instructions{
+				code.MakeInstruction(code.OpConstant, 0),
+				code.MakeInstruction(code.OpPop),
+			},
+		},
+		{
+			input:             `func() { len("abc") }`,
+			expectedConstants: []object.Object{&object.Integer{Value: 3}, nil},
+			expectedInstructions: []code.Instructions{
+				code.MakeInstruction(code.OpConstant, 1),
+				code.MakeInstruction(code.OpPop),
+			},
+		},
+		{
+			// the error is reported at runtime, not swallowed at compile time
+			input:             `len(1)`,
+			expectedConstants: []object.Object{&object.Integer{Value: 1}},
+			expectedInstructions: []code.Instructions{
+				code.MakeInstruction(code.OpGetBuiltin, 0),
+				code.MakeInstruction(code.OpConstant, 0),
+				code.MakeInstruction(code.OpCall, 1),
+				code.MakeInstruction(code.OpPop),
+			},
+		},
+	}
+	runFoldingTests(t, tests)
+}
+
+func TestConstantFoldingIndexExpressions(t *testing.T) {
+	tests := []foldingTestCase{
+		{
+			input:             "[1, 2, 3][1]",
+			expectedConstants: []object.Object{&object.Integer{Value: 2}},
+			expectedInstructions: []code.Instructions{
+				code.MakeInstruction(code.OpConstant, 0),
+				code.MakeInstruction(code.OpPop),
+			},
+		},
+		{
+			input:             "[[1, 2], [3, 4]][1][0] * 2",
+			expectedConstants: []object.Object{&object.Integer{Value: 6}},
+			expectedInstructions: []code.Instructions{
+				code.MakeInstruction(code.OpConstant, 0),
+				code.MakeInstruction(code.OpPop),
+			},
+		},
+		{
+			input:             "[1, 2, 3][-1]",
+			expectedConstants: []object.Object{},
+			expectedInstructions: []code.Instructions{
+				code.MakeInstruction(code.OpNull),
+				code.MakeInstruction(code.OpPop),
+			},
+		},
+		{
+			input:             "[1][1 + 4]",
+			expectedConstants: []object.Object{},
+			expectedInstructions: []code.Instructions{
+				code.MakeInstruction(code.OpNull),
+				code.MakeInstruction(code.OpPop),
+			},
+		},
+		{
+			input:             `"héllo"[1]`,
+			expectedConstants: []object.Object{&object.String{Value: "é"}},
+			expectedInstructions: []code.Instructions{
+				code.MakeInstruction(code.OpConstant, 0),
+				code.MakeInstruction(code.OpPop),
+			},
+		},
+		{
+			// an element that is not a scalar is still built at runtime
+			input: "[[1]][0]",
+			expectedConstants: []object.Object{
+				&object.Integer{Value: 1},
+				&object.Integer{Value: 0},
+			},
+			expectedInstructions: []code.Instructions{
+				code.MakeInstruction(code.OpConstant, 0),
+				code.MakeInstruction(code.OpArray, 1),
+				code.MakeInstruction(code.OpArray, 1),
+				code.MakeInstruction(code.OpConstant, 1),
+				code.MakeInstruction(code.OpIndex),
+				code.MakeInstruction(code.OpPop),
+			},
+		},
+		{
+			input: "let i = 1; [1, 2][i]",
+			expectedConstants: []object.Object{
+				&object.Integer{Value: 1},
+				&object.Integer{Value: 2},
+			},
+			expectedInstructions: []code.Instructions{
+				code.MakeInstruction(code.OpConstant, 0),
+				code.MakeInstruction(code.OpSetGlobal, 0),
+				code.MakeInstruction(code.OpConstant, 0),
+				code.MakeInstruction(code.OpConstant, 1),
+				code.MakeInstruction(code.OpArray, 2),
+				code.MakeInstruction(code.OpGetGlobal, 0),
+				code.MakeInstruction(code.OpIndex),
+				code.MakeInstruction(code.OpPop),
+			},
+		},
+	}
+	runFoldingTests(t, tests)
+}
+
+func TestConstantFoldingSkipsImpureAndShadowedBuiltins(t *testing.T) {
+	tests := []foldingTestCase{
+		{
+			input:             `puts("hi")`,
+			expectedConstants: []object.Object{&object.String{Value: "hi"}},
+			expectedInstructions: []code.Instructions{
+				code.MakeInstruction(code.OpGetBuiltin, 1),
+				code.MakeInstruction(code.OpConstant, 0),
+				code.MakeInstruction(code.OpCall, 1),
+				code.MakeInstruction(code.OpPop),
+			},
+		},
+		{
+			input: `first([1])`,
+			expectedConstants: []object.Object{
+				&object.Integer{Value: 1},
+			},
+			expectedInstructions: []code.Instructions{
+				code.MakeInstruction(code.OpGetBuiltin, 2),
+				code.MakeInstruction(code.OpConstant, 0),
+				code.MakeInstruction(code.OpArray, 1),
+				code.MakeInstruction(code.OpCall, 1),
+				code.MakeInstruction(code.OpPop),
+			},
+		},
+		{
+			input: `let len = func(x) { 0 }; len("four")`,
+			expectedConstants: []object.Object{
+				&object.Integer{Value: 0},
+				nil,
+				&object.String{Value: "four"},
+			},
+			expectedInstructions: []code.Instructions{
+				code.MakeInstruction(code.OpConstant, 1),
+				code.MakeInstruction(code.OpSetGlobal, 0),
+				code.MakeInstruction(code.OpGetGlobal, 0),
+				code.MakeInstruction(code.OpConstant, 2),
+				code.MakeInstruction(code.OpCall, 1),
+				code.MakeInstruction(code.OpPop),
+			},
+		},
+		{
+			input: `let s = "four"; len(s)`,
+			expectedConstants: []object.Object{
+				&object.String{Value: "four"},
+			},
+			expectedInstructions: []code.Instructions{
+				code.MakeInstruction(code.OpConstant, 0),
+				code.MakeInstruction(code.OpSetGlobal, 0),
+				code.MakeInstruction(code.OpGetBuiltin, 0),
+				code.MakeInstruction(code.OpGetGlobal, 0),
+				code.MakeInstruction(code.OpCall, 1),
+				code.MakeInstruction(code.OpPop),
+			},
+		},
+	}
+	runFoldingTests(t, tests)
+}
+
+func TestConstantFoldingIsOptIn(t *testing.T) {
+	compiler := NewCompiler()
+	if err := compiler.Compile(parse(`len("four") + 1`)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	expected := []code.Instructions{
+		code.MakeInstruction(code.OpGetBuiltin, 0),
+		code.MakeInstruction(code.OpConstant, 0),
+		code.MakeInstruction(code.OpCall, 1),
+		code.MakeInstruction(code.OpConstant, 1),
+		code.MakeInstruction(code.OpAdd),
+		code.MakeInstruction(code.OpPop),
+	}
+	if err := testInstructions(expected, compiler.ByteCode().Instructions); err != nil {
+		t.Fatalf("testInstructions failed: %s", err)
+	}
+}
+
+// runFoldingTests compiles every input with constant folding enabled. A nil
+// expected constant only asserts that the constant exists (e.g. a function).
+func runFoldingTests(t *testing.T, tests []foldingTestCase) {
+	t.Helper()
+	runOptimizedTests(t, tests, (*Compiler).EnableConstantFolding)
+}
+
+func runOptimizedTests(t *testing.T, tests []foldingTestCase, enable func(*Compiler)) {
+	t.Helper()
+
+	for _, tt := range tests {
+		compiler := NewCompiler()
+		enable(compiler)
+
+		if err := compiler.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		bytecode := compiler.ByteCode()
+
+		err := testInstructions(tt.expectedInstructions, bytecode.Instructions)
+		if err != nil {
+			t.Fatalf("%s: testInstructions failed: %s", tt.input, err)
+		}
+		if len(bytecode.Constants) != len(tt.expectedConstants) {
+			t.Fatalf("%s: wrong number of constants. want=%d, got=%d",
+				tt.input, len(tt.expectedConstants), len(bytecode.Constants))
+		}
+		for i, expected := range tt.expectedConstants {
+			if expected == nil {
+				continue
+			}
+			if !object.Equal(expected, bytecode.Constants[i]) {
+				t.Errorf("%s: constant %d wrong. want=%s, got=%s",
+					tt.input, i, expected.Inspect(), bytecode.Constants[i].Inspect())
+			}
+		}
+	}
+}
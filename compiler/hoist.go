@@ -0,0 +1,65 @@
+package compiler
+
+import (
+	"comp/ast"
+	"fmt"
+)
+
+// hoistableFunctions returns the names bound to a function literal by a let
+// directly in program. Such a function may be referred to before its let,
+// which is what makes top-level functions able to call themselves and each
+// other.
+func hoistableFunctions(program *ast.RootStatement) map[string]bool {
+	names := make(map[string]bool)
+	for _, stmt := range program.Statements {
+		let, ok := stmt.(*ast.LetStatement)
+		if !ok {
+			continue
+		}
+		if _, ok := let.Value.(*ast.FunctionLiteral); ok {
+			names[let.Name.Value] = true
+		}
+	}
+	return names
+}
+
+// resolveForward resolves name if it has not been defined yet but a top-level
+// let is going to bind a function to it. The global is defined right away so
+// that the code referring to it can be compiled; the let then reuses the
+// symbol instead of defining a new one. The VM reports an error if the global
+// is read before the let has run.
+func (c *Compiler) resolveForward(name string) (Symbol, bool) {
+	if !c.hoistable[name] {
+		return Symbol{}, false
+	}
+	global := c.symbolTable
+	for global.Outer != nil {
+		global = global.Outer
+	}
+	symbol := global.Define(name)
+	c.hoisted[name] = symbol
+	delete(c.hoistable, name)
+	return symbol, true
+}
+
+// defineLet defines the name bound by a let statement, reusing the symbol
+// hoisted for it by resolveForward or hoistFunctions if there is one. A
+// constant cannot be redefined in the scope defining it.
+func (c *Compiler) defineLet(name string) (Symbol, error) {
+	if c.symbolTable.definesConstant(name) {
+		return Symbol{}, fmt.Errorf("cannot redefine constant: %s", name)
+	}
+	if symbol, ok := c.scopes[c.scopeIndex].hoisted[name]; ok {
+		delete(c.scopes[c.scopeIndex].hoisted, name)
+		return symbol, nil
+	}
+	if symbol, ok := c.hoisted[name]; ok && c.symbolTable.Outer == nil {
+		delete(c.hoisted, name)
+		return symbol, nil
+	}
+	if c.symbolTable.Outer == nil {
+		// the name is taken now, later references resolve to this let
+		delete(c.hoistable, name)
+	}
+	return c.defineCell(c.symbolTable.Define(name)), nil
+}
@@ -0,0 +1,161 @@
+package compiler
+
+import (
+	"comp/ast"
+	"comp/object"
+)
+
+// EnableConstantPropagation makes the compiler substitute immutable let-bound
+// integers, strings and booleans into the constant expressions using them,
+// so that `let x = 2; x * 3` folds to `6`. It implies constant folding.
+func (c *Compiler) EnableConstantPropagation() {
+	c.foldConstants = true
+	c.propagateConstants = true
+}
+
+// recordLetConstant remembers the value of a let statement for propagation
+// if the binding is provably immutable and its value is a scalar constant.
+func (c *Compiler) recordLetConstant(node *ast.LetStatement) {
+	if !c.immutableLets[node] {
+		return
+	}
+	value, ok := c.constantValue(node.Value)
+	if !ok {
+		return
+	}
+	switch value.(type) {
+	case *object.Integer, *object.String, *object.Boolean:
+		c.propagated[node.Name.Value] = value
+	}
+}
+
+// immutableLets returns the let statements of program whose binding is never
+// changed. That holds for a name that is bound exactly once and never assigned
+// in the whole program, by a let sitting directly in the program or a
+// function body (a let inside a conditional or loop may never run).
+// Binding names only once also means every use of them refers to that let.
+func immutableLets(program *ast.RootStatement) map[*ast.LetStatement]bool {
+	var (
+		counts = make(map[string]int)
+		lets   []*ast.LetStatement
+	)
+	var walk func(node ast.Node, topLevel bool)
+	walkAll := func(nodes []ast.Expression) {
+		for _, node := range nodes {
+			walk(node, false)
+		}
+	}
+	walk = func(node ast.Node, topLevel bool) {
+		switch node := node.(type) {
+		case *ast.RootStatement:
+			for _, stmt := range node.Statements {
+				walk(stmt, true)
+			}
+		case *ast.BlockStatement:
+			for _, stmt := range node.Statements {
+				walk(stmt, topLevel)
+			}
+		case *ast.LetStatement:
+			counts[node.Name.Value]++
+			if topLevel {
+				lets = append(lets, node)
+			}
+			walk(node.Value, false)
+		case *ast.MultiLetStatement:
+			for _, name := range node.Names {
+				counts[name.Value]++
+			}
+			for _, value := range node.Values {
+				walk(value, false)
+			}
+		case *ast.ArrayLetStatement:
+			for _, name := range node.Names {
+				counts[name.Value]++
+			}
+			if node.Rest != nil {
+				counts[node.Rest.Value]++
+			}
+			walk(node.Value, false)
+		case *ast.HashLetStatement:
+			for _, name := range node.Names {
+				counts[name.Value]++
+			}
+			walk(node.Value, false)
+		case *ast.AssignStatement:
+			counts[node.Name.Value]++
+			walk(node.Value, false)
+		case *ast.ForStatement:
+			if node.Init != nil {
+				walk(node.Init, false)
+			}
+			if node.Condition != nil {
+				walk(node.Condition, false)
+			}
+			if node.Post != nil {
+				walk(node.Post, false)
+			}
+			walk(node.Body, false)
+		case *ast.DoWhileStatement:
+			walk(node.Body, false)
+			walk(node.Condition, false)
+		case *ast.ReturnStatement:
+			walk(node.ReturnValue, false)
+		case *ast.ExpressionStatement:
+			walk(node.Expression, false)
+		case *ast.PrefixExpression:
+			walk(node.Right, false)
+		case *ast.InfixExpression:
+			walk(node.Left, false)
+			walk(node.Right, false)
+		case *ast.SwitchExpression:
+			walk(node.Subject, false)
+			for _, sc := range node.Cases {
+				walk(sc.Value, false)
+				walk(sc.Body, false)
+			}
+			if node.Default != nil {
+				walk(node.Default, false)
+			}
+		case *ast.IfExpression:
+			walk(node.Condition, false)
+			walk(node.Consequence, false)
+			if node.Alternative != nil {
+				walk(node.Alternative, false)
+			}
+		case *ast.FunctionLiteral:
+			for _, param := range node.Parameters {
+				counts[param.Value]++
+			}
+			for _, def := range node.Defaults {
+				if def != nil {
+					walk(def, false)
+				}
+			}
+			walk(node.Body, true)
+		case *ast.CallExpression:
+			walk(node.Function, false)
+			walkAll(node.Arguments)
+		case *ast.ArrayLiteral:
+			walkAll(node.Elements)
+		case *ast.InterpolatedString:
+			walkAll(node.Parts)
+		case *ast.IndexExpression:
+			walk(node.Left, false)
+			walk(node.Index, false)
+		case *ast.HashLiteral:
+			for key, value := range node.Pairs {
+				walk(key, false)
+				walk(value, false)
+			}
+		}
+	}
+	walk(program, true)
+
+	immutable := make(map[*ast.LetStatement]bool)
+	for _, let := range lets {
+		if counts[let.Name.Value] == 1 {
+			immutable[let] = true
+		}
+	}
+	return immutable
+}
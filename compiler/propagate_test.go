@@ -0,0 +1,147 @@
+package compiler
+
+import (
+	"comp/code"
+	"comp/object"
+	"testing"
+)
+
+func TestConstantPropagation(t *testing.T) {
+	tests := []foldingTestCase{
+		{
+			input: "let x = 2; x * 3",
+			expectedConstants: []object.Object{
+				&object.Integer{Value: 2},
+				&object.Integer{Value: 6},
+			},
+			expectedInstructions: []code.Instructions{
+				code.MakeInstruction(code.OpConstant, 0),
+				code.MakeInstruction(code.OpSetGlobal, 0),
+				code.MakeInstruction(code.OpConstant, 1),
+				code.MakeInstruction(code.OpPop),
+			},
+		},
+		{
+			// folded values propagate in turn
+			input: `let x = 2 + 3; let y = x * 2; len("ab") + y`,
+			expectedConstants: []object.Object{
+				&object.Integer{Value: 5},
+				&object.Integer{Value: 10},
+				&object.Integer{Value: 12},
+			},
+			expectedInstructions: []code.Instructions{
+				code.MakeInstruction(code.OpConstant, 0),
+				code.MakeInstruction(code.OpSetGlobal, 0),
+				code.MakeInstruction(code.OpConstant, 1),
+				code.MakeInstruction(code.OpSetGlobal, 1),
+				code.MakeInstruction(code.OpConstant, 2),
+				code.MakeInstruction(code.OpPop),
+			},
+		},
+		{
+			input: `let s = "mon"; let f = func() { s + "key" }`,
+			expectedConstants: []object.Object{
+				&object.String{Value: "mon"},
+				&object.String{Value: "monkey"},
+				nil,
+			},
+			expectedInstructions: []code.Instructions{
+				code.MakeInstruction(code.OpConstant, 0),
+				code.MakeInstruction(code.OpSetGlobal, 0),
+				code.MakeInstruction(code.OpConstant, 2),
+				code.MakeInstruction(code.OpSetGlobal, 1),
+			},
+		},
+		{
+			input:             "let t = true; !t",
+			expectedConstants: []object.Object{},
+			expectedInstructions: []code.Instructions{
+				code.MakeInstruction(code.OpTrue),
+				code.MakeInstruction(code.OpSetGlobal, 0),
+				code.MakeInstruction(code.OpFalse),
+				code.MakeInstruction(code.OpPop),
+			},
+		},
+	}
+	runOptimizedTests(t, tests, (*Compiler).EnableConstantPropagation)
+}
+
+func TestConstantPropagationSkipsRebindings(t *testing.T) {
+	tests := []foldingTestCase{
+		{
+			// x is bound twice, so neither binding is propagated
+			input: "let x = 2; let x = 3; x * 3",
+			expectedConstants: []object.Object{
+				&object.Integer{Value: 2},
+				&object.Integer{Value: 3},
+			},
+			expectedInstructions: []code.Instructions{
+				code.MakeInstruction(code.OpConstant, 0),
+				code.MakeInstruction(code.OpSetGlobal, 0),
+				code.MakeInstruction(code.OpConstant, 1),
+				code.MakeInstruction(code.OpSetGlobal, 1),
+				code.MakeInstruction(code.OpGetGlobal, 1),
+				code.MakeInstruction(code.OpConstant, 1),
+				code.MakeInstruction(code.OpMul),
+				code.MakeInstruction(code.OpPop),
+			},
+		},
+		{
+			// a parameter of the same name rebinds x
+			input: "let x = 2; let f = func(x) { x * 3 }",
+			expectedConstants: []object.Object{
+				&object.Integer{Value: 2},
+				&object.Integer{Value: 3},
+				nil,
+			},
+			expectedInstructions: []code.Instructions{
+				code.MakeInstruction(code.OpConstant, 0),
+				code.MakeInstruction(code.OpSetGlobal, 0),
+				code.MakeInstruction(code.OpConstant, 2),
+				code.MakeInstruction(code.OpSetGlobal, 1),
+			},
+		},
+		{
+			// a let inside a conditional may never run
+			input: "if (true) { let x = 2; x * 3 }",
+			expectedConstants: []object.Object{
+				&object.Integer{Value: 2},
+				&object.Integer{Value: 3},
+			},
+			expectedInstructions: []code.Instructions{
+				code.MakeInstruction(code.OpTrue),
+				code.MakeInstruction(code.OpJumpNotTruthy, 20),
+				code.MakeInstruction(code.OpConstant, 0),
+				code.MakeInstruction(code.OpSetGlobal, 0),
+				code.MakeInstruction(code.OpGetGlobal, 0),
+				code.MakeInstruction(code.OpConstant, 1),
+				code.MakeInstruction(code.OpMul),
+				code.MakeInstruction(code.OpJump, 21),
+				code.MakeInstruction(code.OpNull),
+				code.MakeInstruction(code.OpPop),
+			},
+		},
+	}
+	runOptimizedTests(t, tests, (*Compiler).EnableConstantPropagation)
+}
+
+func TestConstantFoldingAloneDoesNotPropagate(t *testing.T) {
+	tests := []foldingTestCase{
+		{
+			input: "let x = 2; x * 3",
+			expectedConstants: []object.Object{
+				&object.Integer{Value: 2},
+				&object.Integer{Value: 3},
+			},
+			expectedInstructions: []code.Instructions{
+				code.MakeInstruction(code.OpConstant, 0),
+				code.MakeInstruction(code.OpSetGlobal, 0),
+				code.MakeInstruction(code.OpGetGlobal, 0),
+				code.MakeInstruction(code.OpConstant, 1),
+				code.MakeInstruction(code.OpMul),
+				code.MakeInstruction(code.OpPop),
+			},
+		},
+	}
+	runFoldingTests(t, tests)
+}
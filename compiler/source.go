@@ -0,0 +1,25 @@
+package compiler
+
+import (
+	"comp/lexer"
+	"comp/parser"
+	"fmt"
+)
+
+// CompileSource parses src and compiles it with a new compiler, sparing
+// embedders the wiring of lexer, parser and compiler. When src does not
+// parse, the parser errors of every broken statement are returned in the
+// slice, along with an error saying so, and nothing is compiled.
+func CompileSource(src string) (*ByteCode, []string, error) {
+	psr := parser.NewParser(lexer.NewLexer(src))
+	psr.EnableRecovery()
+	root := psr.ParseRootStatement()
+	if errs := psr.Errors(); len(errs) != 0 {
+		return nil, errs, fmt.Errorf("parsing failed with %d errors", len(errs))
+	}
+	cmp := NewCompiler()
+	if err := cmp.Compile(root); err != nil {
+		return nil, nil, err
+	}
+	return cmp.ByteCode(), nil, nil
+}
@@ -0,0 +1,56 @@
+package compiler
+
+import (
+	"comp/code"
+	"testing"
+)
+
+func TestCompileSource(t *testing.T) {
+	bytecode, errs, err := CompileSource("let a = 1; a + 2")
+	if err != nil || errs != nil {
+		t.Fatalf("unexpected failure. errs=%q, err=%v", errs, err)
+	}
+	expected := concatInstructions([]code.Instructions{
+		code.MakeInstruction(code.OpConstant, 0),
+		code.MakeInstruction(code.OpSetGlobal, 0),
+		code.MakeInstruction(code.OpGetGlobal, 0),
+		code.MakeInstruction(code.OpConstant, 1),
+		code.MakeInstruction(code.OpAdd),
+		code.MakeInstruction(code.OpPop),
+	})
+	if bytecode.Instructions.String() != expected.String() {
+		t.Errorf("wrong instructions.\nwant=%q\ngot=%q", expected, bytecode.Instructions)
+	}
+	if err := testConstants(t, []interface{}{1, 2}, bytecode.Constants); err != nil {
+		t.Errorf("testConstants failed: %s", err)
+	}
+}
+
+func TestCompileSourceErrors(t *testing.T) {
+	bytecode, errs, err := CompileSource("let = 1;")
+	if bytecode != nil || err == nil {
+		t.Errorf("syntax error did not fail. bytecode=%v, err=%v", bytecode, err)
+	}
+	if len(errs) == 0 || errs[0] != "expected next token to be IDENT, got = instead" {
+		t.Errorf("wrong parser errors. got=%q", errs)
+	}
+
+	// every broken statement is reported, without the errors following from
+	// the first one
+	_, errs, _ = CompileSource("let = 1; let x 5; let y = 10; puts(y)")
+	expected := []string{
+		"expected next token to be IDENT, got = instead",
+		"expected next token to be =, got INT instead",
+	}
+	if len(errs) != len(expected) || errs[0] != expected[0] || errs[1] != expected[1] {
+		t.Errorf("wrong parser errors. want=%q, got=%q", expected, errs)
+	}
+
+	bytecode, errs, err = CompileSource("x + 1")
+	if bytecode != nil || errs != nil {
+		t.Errorf("compiler error returned output. bytecode=%v, errs=%q", bytecode, errs)
+	}
+	if err == nil || err.Error() != "undefined variable: x" {
+		t.Errorf("wrong compiler error. got=%v", err)
+	}
+}
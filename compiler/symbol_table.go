@@ -3,8 +3,10 @@ package compiler
 type SymbolScope string
 
 const (
-	GlobalScope SymbolScope = "GLOBAL"
-	LocalScope  SymbolScope = "LOCAL"
+	GlobalScope  SymbolScope = "GLOBAL"
+	LocalScope   SymbolScope = "LOCAL"
+	BuiltinScope SymbolScope = "BUILTIN"
+	FreeScope    SymbolScope = "FREE"
 )
 
 // Symbol holds all the necessary information about a symbol we encounter.
@@ -20,6 +22,20 @@ type SymbolTable struct {
 	Outer    *SymbolTable
 	store    map[string]Symbol
 	defCount int
+
+	// constants holds the names in store bound by `const`, which cannot be
+	// assigned to or redefined.
+	constants map[string]bool
+	// cells holds the names in store of the locals living in a cell.
+	cells map[string]bool
+
+	// block marks the table of a block statement, whose definitions take
+	// their slots from the enclosing function or global table.
+	block bool
+
+	// FreeSymbols holds, for the table of a function, the symbols of the
+	// enclosing functions it refers to, in the order of their free indexes.
+	FreeSymbols []Symbol
 }
 
 // NewSymbolTable returns a pointer to a new instance of SymbolTable.
@@ -38,26 +54,127 @@ func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
 	return s
 }
 
+// NewBlockSymbolTable returns a symbol table for the variables of a block
+// statement. Its names are only visible inside the block, but the symbols
+// defined in it are slots of the function or global scope around the block:
+// locals inside a function, globals outside of any.
+func NewBlockSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewEnclosedSymbolTable(outer)
+	s.block = true
+	return s
+}
+
 // Define creates a new Symbol with the given name, assigns it the next available
 // index, and stores it in the symbol table. Returns the newly created Symbol.
 func (s *SymbolTable) Define(name string) Symbol {
+	symbol := s.nextSymbol(name)
+	s.store[name] = symbol
+	return symbol
+}
+
+// nextSymbol allocates the next slot of the function or global scope s
+// belongs to.
+func (s *SymbolTable) nextSymbol(name string) Symbol {
+	if s.block {
+		return s.Outer.nextSymbol(name)
+	}
 	symbol := Symbol{Name: name, Index: s.defCount}
 	if s.Outer == nil {
 		symbol.Scope = GlobalScope
 	} else {
 		symbol.Scope = LocalScope
 	}
-	s.store[name] = symbol
 	s.defCount++
 	return symbol
 }
 
+// markConstant flags the symbol defined under name in s as a constant.
+func (s *SymbolTable) markConstant(name string) {
+	if s.constants == nil {
+		s.constants = make(map[string]bool)
+	}
+	s.constants[name] = true
+}
+
+// IsConstant reports whether name resolves to a symbol defined by `const`.
+func (s *SymbolTable) IsConstant(name string) bool {
+	if _, ok := s.store[name]; ok {
+		return s.constants[name]
+	}
+	return s.Outer != nil && s.Outer.IsConstant(name)
+}
+
+// definesConstant reports whether s itself, rather than a table it is
+// enclosed in, defines name by `const`.
+func (s *SymbolTable) definesConstant(name string) bool {
+	return s.constants[name]
+}
+
+// markCell flags the local defined under name in s as living in a cell.
+func (s *SymbolTable) markCell(name string) {
+	if s.cells == nil {
+		s.cells = make(map[string]bool)
+	}
+	s.cells[name] = true
+}
+
+// isCell reports whether name resolves to a local, or a free symbol standing
+// for one, that lives in a cell.
+func (s *SymbolTable) isCell(name string) bool {
+	if _, ok := s.store[name]; ok {
+		return s.cells[name]
+	}
+	return s.Outer != nil && s.Outer.isCell(name)
+}
+
+// DefineBuiltin stores a Symbol for the builtin function at the given index
+// of object.Builtins. Builtins do not count towards the table's definitions.
+func (s *SymbolTable) DefineBuiltin(index int, name string) Symbol {
+	symbol := Symbol{Name: name, Index: index, Scope: BuiltinScope}
+	s.store[name] = symbol
+	return symbol
+}
+
 // Resolve looks up a symbol by name in the symbol table. Returns the Symbol
-// and true if found, or an empty Symbol and false if not found.
+// and true if found, or an empty Symbol and false if not found. A local of an
+// enclosing function resolves to a free symbol of the function s belongs to,
+// which is defined on first use.
 func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
 	symbol, ok := s.store[name]
-	if !ok && s.Outer != nil {
-		return s.Outer.Resolve(name)
+	if ok || s.Outer == nil {
+		return symbol, ok
+	}
+	symbol, ok = s.Outer.Resolve(name)
+	if !ok || s.block || symbol.Scope == GlobalScope || symbol.Scope == BuiltinScope {
+		return symbol, ok
+	}
+	return s.defineFree(symbol), true
+}
+
+// defineFree makes original, a symbol of an enclosing function, available in
+// s under the next free index.
+func (s *SymbolTable) defineFree(original Symbol) Symbol {
+	s.FreeSymbols = append(s.FreeSymbols, original)
+	symbol := Symbol{Name: original.Name, Scope: FreeScope, Index: len(s.FreeSymbols) - 1}
+	if s.Outer.IsConstant(original.Name) {
+		s.markConstant(original.Name)
+	}
+	if s.Outer.isCell(original.Name) {
+		s.markCell(original.Name)
+	}
+	s.store[original.Name] = symbol
+	return symbol
+}
+
+// GlobalNames returns the names of the global symbols defined in s, indexed
+// by their global index. A slot whose symbol has since been redefined under
+// a new index is left empty.
+func (s *SymbolTable) GlobalNames() []string {
+	names := make([]string, s.defCount)
+	for name, symbol := range s.store {
+		if symbol.Scope == GlobalScope {
+			names[symbol.Index] = name
+		}
 	}
-	return symbol, ok
+	return names
 }
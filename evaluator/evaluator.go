@@ -3,13 +3,16 @@ package evaluator
 import (
 	"comp/ast"
 	"comp/object"
-	"fmt"
+	"strings"
 )
 
 var (
 	NULL  = &object.Null{}
 	TRUE  = &object.Boolean{Value: true}
 	FALSE = &object.Boolean{Value: false}
+
+	BREAK    = &object.Break{}
+	CONTINUE = &object.Continue{}
 )
 
 func Evaluate(node ast.Node, env *object.Environment) object.Object {
@@ -18,25 +21,57 @@ func Evaluate(node ast.Node, env *object.Environment) object.Object {
 		return evalRootStatement(node, env)
 	case *ast.LetStatement:
 		value := Evaluate(node.Value, env)
-		if isError(value) {
+		if stopsEvaluation(value) {
+			return value
+		}
+		if errOb := checkRedefinition(env, node.Name); errOb != nil {
+			return errOb
+		}
+		if node.IsConstant() {
+			env.SetConstant(node.Name.Value, value)
+		} else {
+			env.Set(node.Name.Value, value)
+		}
+	case *ast.MultiLetStatement:
+		return evalMultiLetStatement(node, env)
+	case *ast.ArrayLetStatement:
+		return evalArrayLetStatement(node, env)
+	case *ast.HashLetStatement:
+		return evalHashLetStatement(node, env)
+	case *ast.AssignStatement:
+		value := Evaluate(node.Value, env)
+		if stopsEvaluation(value) {
 			return value
 		}
-		env.Set(node.Name.Value, value)
+		if env.IsConstant(node.Name.Value) {
+			return createError(object.TypeError, "cannot assign to constant: %s", node.Name.Value)
+		}
+		if _, ok := env.Assign(node.Name.Value, value); !ok {
+			return createError(object.NameError, "Identifier '%s' not found", node.Name.Value)
+		}
+	case *ast.ForStatement:
+		return evalForStatement(node, env)
+	case *ast.DoWhileStatement:
+		return evalDoWhileStatement(node, env)
+	case *ast.BreakStatement:
+		return BREAK
+	case *ast.ContinueStatement:
+		return CONTINUE
 	case *ast.ExpressionStatement:
 		return Evaluate(node.Expression, env)
 	case *ast.ReturnStatement:
 		reVal := Evaluate(node.ReturnValue, env)
-		if isError(reVal) {
+		if stopsEvaluation(reVal) {
 			return reVal
 		}
 		return &object.Return{Value: reVal}
 	case *ast.CallExpression:
 		fn := Evaluate(node.Function, env)
-		if isError(fn) {
+		if stopsEvaluation(fn) {
 			return fn
 		}
 		args := evalListExpression(node.Arguments, env)
-		if len(args) == 1 && isError(args[0]) {
+		if len(args) == 1 && stopsEvaluation(args[0]) {
 			return args[0]
 		}
 		return applyFunction(fn, args)
@@ -48,11 +83,15 @@ func Evaluate(node ast.Node, env *object.Environment) object.Object {
 		return &object.Integer{Value: node.Value}
 	case *ast.StringLiteral:
 		return &object.String{Value: node.Value}
+	case *ast.InterpolatedString:
+		return evalInterpolatedString(node, env)
 	case *ast.Boolean:
 		return boolNativeToBoolObject(node.Value)
+	case *ast.NullLiteral:
+		return NULL
 	case *ast.ArrayLiteral:
 		values := evalListExpression(node.Elements, env)
-		if len(values) == 1 && isError(values[0]) {
+		if len(values) == 1 && stopsEvaluation(values[0]) {
 			return values[0]
 		}
 		return &object.Array{Elements: values}
@@ -61,39 +100,50 @@ func Evaluate(node ast.Node, env *object.Environment) object.Object {
 
 	case *ast.PrefixExpression:
 		right := Evaluate(node.Right, env)
-		if isError(right) {
+		if stopsEvaluation(right) {
 			return right
 		}
 		return evalPrefixExpression(node.Operator, right)
 	case *ast.InfixExpression:
 		lt := Evaluate(node.Left, env)
-		if isError(lt) {
+		if stopsEvaluation(lt) {
 			return lt
 		}
+		if node.Operator == "&&" || node.Operator == "||" {
+			return evalLogicalExpression(node, lt, env)
+		}
 		rt := Evaluate(node.Right, env)
-		if isError(rt) {
+		if stopsEvaluation(rt) {
 			return rt
 		}
 		return evalInfixExpression(node.Operator, lt, rt)
 	case *ast.IndexExpression:
 		lt := Evaluate(node.Left, env)
-		if isError(lt) {
+		if stopsEvaluation(lt) {
 			return lt
 		}
 		idx := Evaluate(node.Index, env)
-		if isError(idx) {
+		if stopsEvaluation(idx) {
 			return idx
 		}
 		return evalIndexExpression(lt, idx)
 
 	case *ast.BlockStatement:
-		return evalBlockStatement(node, env)
+		return evalBlockStatement(node, object.NewEnclosedEnvironment(env))
 	case *ast.IfExpression:
 		return evalConditionalExpression(node, env)
+	case *ast.SwitchExpression:
+		return evalSwitchExpression(node, env)
 	case *ast.FunctionLiteral:
 		params := node.Parameters
 		body := node.Body
-		return &object.Function{Parameters: params, Body: body, Env: env}
+		return &object.Function{
+			Parameters: params,
+			Defaults:   node.Defaults,
+			Variadic:   node.Variadic,
+			Body:       body,
+			Env:        env,
+		}
 	}
 	return nil
 }
@@ -109,25 +159,178 @@ func evalRootStatement(root *ast.RootStatement, env *object.Environment) object.
 			return result
 		case *object.Return:
 			return result.Value
+		case *object.Break, *object.Continue:
+			return createError(object.RuntimeError, "%s outside of loop", result.Inspect())
 		}
 	}
 	return result
 }
 
+// evalBlockStatement runs the statements of block in env. Blocks reached
+// through Evaluate get an environment of their own, so that the variables
+// they define with let are gone once the block is left.
 func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) object.Object {
 	var result object.Object
 
 	for _, stmt := range block.Statements {
 		result = Evaluate(stmt, env)
 
+		if stopsEvaluation(result) {
+			return result
+		}
+	}
+	return result
+}
+
+// evalForStatement runs the loop in an environment of its own, so that the
+// variables defined by its init statement do not outlive it.
+func evalForStatement(node *ast.ForStatement, env *object.Environment) object.Object {
+	loopEnv := object.NewEnclosedEnvironment(env)
+
+	if node.Init != nil {
+		if init := Evaluate(node.Init, loopEnv); stopsEvaluation(init) {
+			return init
+		}
+	}
+	for {
+		if node.Condition != nil {
+			condition := Evaluate(node.Condition, loopEnv)
+			if stopsEvaluation(condition) {
+				return condition
+			}
+			if !isTruthy(condition) {
+				return nil
+			}
+		}
+		result := Evaluate(node.Body, loopEnv)
 		if result != nil {
-			rt := result.Type()
-			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ {
+			switch result.Type() {
+			case object.RETURN_VALUE_OBJ, object.ERROR_OBJ:
 				return result
+			case object.BREAK_OBJ:
+				return nil
+			}
+		}
+		if node.Post != nil {
+			if post := Evaluate(node.Post, loopEnv); isError(post) {
+				return post
 			}
 		}
 	}
-	return result
+}
+
+// evalMultiLetStatement evaluates all values before binding any name.
+func evalMultiLetStatement(node *ast.MultiLetStatement, env *object.Environment) object.Object {
+	if len(node.Names) != len(node.Values) {
+		return createError(object.ValueError, "let binds %d names to %d values", len(node.Names), len(node.Values))
+	}
+	values := make([]object.Object, len(node.Values))
+	for i, expr := range node.Values {
+		values[i] = Evaluate(expr, env)
+		if stopsEvaluation(values[i]) {
+			return values[i]
+		}
+	}
+	if errOb := checkRedefinition(env, node.Names...); errOb != nil {
+		return errOb
+	}
+	for i, name := range node.Names {
+		env.Set(name.Value, values[i])
+	}
+	return nil
+}
+
+// checkRedefinition returns an error if one of names is a constant of env
+// itself, which a let cannot bind again. Shadowing it in an inner scope is
+// fine.
+func checkRedefinition(env *object.Environment, names ...*ast.Identifier) *object.Error {
+	for _, name := range names {
+		if env.DefinesConstant(name.Value) {
+			return createError(object.TypeError, "cannot redefine constant: %s", name.Value)
+		}
+	}
+	return nil
+}
+
+// evalArrayLetStatement binds the names to the elements of the array by
+// position, null where it is shorter, and the rest name to the remaining ones.
+func evalArrayLetStatement(node *ast.ArrayLetStatement, env *object.Environment) object.Object {
+	value := Evaluate(node.Value, env)
+	if stopsEvaluation(value) {
+		return value
+	}
+	unpacked, errOb := object.UnpackArray(value, len(node.Names), node.Rest != nil)
+	if errOb != nil {
+		return errOb
+	}
+	names := node.Names
+	if node.Rest != nil {
+		names = append(names[:len(names):len(names)], node.Rest)
+	}
+	if errOb := checkRedefinition(env, names...); errOb != nil {
+		return errOb
+	}
+	for i, elem := range unpacked {
+		if elem == nil {
+			elem = NULL
+		}
+		if i < len(node.Names) {
+			env.Set(node.Names[i].Value, elem)
+		} else {
+			env.Set(node.Rest.Value, elem)
+		}
+	}
+	return nil
+}
+
+// evalHashLetStatement binds the names to the values under the same string
+// keys in the hash, null where a key is missing.
+func evalHashLetStatement(node *ast.HashLetStatement, env *object.Environment) object.Object {
+	value := Evaluate(node.Value, env)
+	if stopsEvaluation(value) {
+		return value
+	}
+	keys := make([]string, len(node.Names))
+	for i, name := range node.Names {
+		keys[i] = name.Value
+	}
+	unpacked, errOb := object.UnpackHash(value, keys)
+	if errOb != nil {
+		return errOb
+	}
+	if errOb := checkRedefinition(env, node.Names...); errOb != nil {
+		return errOb
+	}
+	for i, elem := range unpacked {
+		if elem == nil {
+			elem = NULL
+		}
+		env.Set(node.Names[i].Value, elem)
+	}
+	return nil
+}
+
+// evalDoWhileStatement runs the body, then keeps running it for as long as
+// the condition holds.
+func evalDoWhileStatement(node *ast.DoWhileStatement, env *object.Environment) object.Object {
+	for {
+		result := Evaluate(node.Body, env)
+		if result != nil {
+			switch result.Type() {
+			case object.RETURN_VALUE_OBJ, object.ERROR_OBJ:
+				return result
+			case object.BREAK_OBJ:
+				return nil
+			}
+		}
+		condition := Evaluate(node.Condition, env)
+		if stopsEvaluation(condition) {
+			return condition
+		}
+		if !isTruthy(condition) {
+			return nil
+		}
+	}
 }
 
 func evalListExpression(args []ast.Expression, env *object.Environment) []object.Object {
@@ -135,7 +338,7 @@ func evalListExpression(args []ast.Expression, env *object.Environment) []object
 
 	for _, arg := range args {
 		value := Evaluate(arg, env)
-		if isError(value) {
+		if stopsEvaluation(value) {
 			return []object.Object{value}
 		}
 		result = append(result, value)
@@ -147,10 +350,16 @@ func evalIndexExpression(lt, idx object.Object) object.Object {
 	switch {
 	case lt.Type() == object.ARRAY_OBJ && idx.Type() == object.INTEGER_OBJ:
 		return evalArrayIndexExpression(lt, idx)
+	case lt.Type() == object.STRING_OBJ && idx.Type() == object.INTEGER_OBJ:
+		char, ok := lt.(*object.String).CharAt(idx.(*object.Integer).Value)
+		if !ok {
+			return NULL
+		}
+		return char
 	case lt.Type() == object.HASH_OBJ:
 		return evalHashIndexExpression(lt, idx)
 	default:
-		return createError("index operator not supported: %s", lt.Type())
+		return createError(object.TypeError, "index operator not supported: %s", lt.Type())
 	}
 }
 
@@ -170,7 +379,7 @@ func evalHashIndexExpression(hash, idx object.Object) object.Object {
 
 	key, ok := idx.(object.Hashable)
 	if !ok {
-		return createError("unusable as hash key: %s", idx.Type())
+		return createError(object.TypeError, "unusable as hash key: %s", idx.Type())
 	}
 	pair, ok := hashOb.Pairs[key.HashKey()]
 	if !ok {
@@ -179,36 +388,41 @@ func evalHashIndexExpression(hash, idx object.Object) object.Object {
 	return pair.Value
 }
 
+// evalHashLiteral evaluates the pairs of a hash literal, in which a key may
+// appear only once.
 func evalHashLiteral(hash *ast.HashLiteral, env *object.Environment) object.Object {
 	pairs := make(map[object.HashKey]object.HashPair)
 
 	for keyNode, valNode := range hash.Pairs {
 		key := Evaluate(keyNode, env)
-		if isError(key) {
+		if stopsEvaluation(key) {
 			return key
 		}
 		hashKey, ok := key.(object.Hashable)
 		if !ok {
-			return createError("unusable as hash key: %s", key.Type())
+			return createError(object.TypeError, "unusable as hash key: %s", key.Type())
 		}
 		value := Evaluate(valNode, env)
-		if isError(value) {
+		if stopsEvaluation(value) {
 			return value
 		}
 		hashed := hashKey.HashKey()
+		if _, ok := pairs[hashed]; ok {
+			return createError(object.ValueError, "duplicate key in hash literal: %s", key.Inspect())
+		}
 		pairs[hashed] = object.HashPair{Key: key, Value: value}
 	}
 	return &object.Hash{Pairs: pairs}
 }
 
 func evalIdentifier(id *ast.Identifier, env *object.Environment) object.Object {
-	if builtIn, ok := builtIns[id.Value]; ok {
-		return builtIn
-	}
 	if val, ok := env.Get(id.Value); ok {
 		return val
 	}
-	return createError("Identifier '" + id.Value + "' not found")
+	if builtIn := env.Builtin(id.Value); builtIn != nil {
+		return builtIn
+	}
+	return createError(object.NameError, "Identifier '%s' not found", id.Value)
 }
 
 func evalPrefixExpression(operator string, right object.Object) object.Object {
@@ -217,8 +431,10 @@ func evalPrefixExpression(operator string, right object.Object) object.Object {
 		return evalBangOperatorExpression(right)
 	case "-":
 		return evalPrefixNegationExpression(right)
+	case "~":
+		return evalPrefixBitNotExpression(right)
 	default:
-		return createError("unknown operator: %s%s", operator, right.Type())
+		return createError(object.TypeError, "unknown operator: %s%s", operator, right.Type())
 	}
 }
 
@@ -227,18 +443,66 @@ func evalInfixExpression(operator string, left, right object.Object) object.Obje
 	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
 		return evalIntegerInfixExpression(operator, left, right)
 
+	case operator == "+" && left.Type() == object.ARRAY_OBJ && right.Type() == object.ARRAY_OBJ:
+		return evalArrayConcatenation(left, right)
+
+	case isCollection(left) && left.Type() == right.Type():
+		return evalCollectionInfixExpression(operator, left, right)
+
+	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
+		return evalStringInfixExpression(operator, left, right)
+
+	case operator == "*" && left.Type() == object.STRING_OBJ && right.Type() == object.INTEGER_OBJ:
+		return object.RepeatString(left.(*object.String), right.(*object.Integer))
+	case operator == "*" && left.Type() == object.INTEGER_OBJ && right.Type() == object.STRING_OBJ:
+		return object.RepeatString(right.(*object.String), left.(*object.Integer))
+
+	case left.Type() == object.BOOLEAN_OBJ && right.Type() == object.BOOLEAN_OBJ:
+		return evalBooleanInfixExpression(operator, left, right)
+
 	case operator == "==":
 		return boolNativeToBoolObject(left == right)
 	case operator == "!=":
 		return boolNativeToBoolObject(left != right)
 
-	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
-		return evalStringInfixExpression(operator, left, right)
-
 	case left.Type() != right.Type():
-		return createError("type mismatch: %s %s %s", left.Type(), operator, right.Type())
+		return createError(object.TypeError, "type mismatch: %s %s %s", left.Type(), operator, right.Type())
 	default:
-		return createError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+		return createError(object.TypeError, "unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+// evalLogicalExpression finishes a short-circuiting `&&` or `||` whose left
+// operand evaluated to lt. The right operand is only evaluated if lt does not
+// decide the result on its own.
+func evalLogicalExpression(node *ast.InfixExpression, lt object.Object, env *object.Environment) object.Object {
+	if isTruthy(lt) == (node.Operator == "||") {
+		return boolNativeToBoolObject(isTruthy(lt))
+	}
+	rt := Evaluate(node.Right, env)
+	if stopsEvaluation(rt) {
+		return rt
+	}
+	return boolNativeToBoolObject(isTruthy(rt))
+}
+
+// evalBooleanInfixExpression applies the eager `&` and `|`, for which both
+// operands have been evaluated already.
+func evalBooleanInfixExpression(operator string, lt, rt object.Object) object.Object {
+	ltVal := lt.(*object.Boolean).Value
+	rtVal := rt.(*object.Boolean).Value
+
+	switch operator {
+	case "&":
+		return boolNativeToBoolObject(ltVal && rtVal)
+	case "|":
+		return boolNativeToBoolObject(ltVal || rtVal)
+	case "==":
+		return boolNativeToBoolObject(ltVal == rtVal)
+	case "!=":
+		return boolNativeToBoolObject(ltVal != rtVal)
+	default:
+		return createError(object.TypeError, "unknown operator: %s %s %s", lt.Type(), operator, rt.Type())
 	}
 }
 
@@ -248,25 +512,50 @@ func evalIntegerInfixExpression(operator string, lt, rt object.Object) object.Ob
 
 	switch operator {
 	case "+":
-		return &object.Integer{Value: ltVal + rtVal}
+		return integerResult(object.AddIntegers(ltVal, rtVal))
 	case "-":
-		return &object.Integer{Value: ltVal - rtVal}
+		return integerResult(object.SubtractIntegers(ltVal, rtVal))
 	case "*":
-		return &object.Integer{Value: ltVal * rtVal}
+		return integerResult(object.MultiplyIntegers(ltVal, rtVal))
 	case "/":
-		return &object.Integer{Value: ltVal / rtVal}
-
-	case "<":
-		return boolNativeToBoolObject(ltVal < rtVal)
-	case ">":
-		return boolNativeToBoolObject(ltVal > rtVal)
-	case "==":
-		return boolNativeToBoolObject(ltVal == rtVal)
-	case "!=":
-		return boolNativeToBoolObject(ltVal != rtVal)
+		if rtVal == 0 {
+			return createError(object.ZeroDivisionError, "division by zero")
+		}
+		return integerResult(object.DivideIntegers(ltVal, rtVal))
+	case "**":
+		if rtVal < 0 {
+			return createError(object.ValueError, "negative exponent: %d", rtVal)
+		}
+		return integerResult(object.IntegerPower(ltVal, rtVal))
+	case "&":
+		return &object.Integer{Value: ltVal & rtVal}
+	case "|":
+		return &object.Integer{Value: ltVal | rtVal}
+	case "<", ">", "<=", ">=", "==", "!=":
+		return evalComparison(operator, lt.(*object.Integer), rt)
 	default:
-		return createError("unknown operator: %s %s %s", lt.Type(), operator, rt.Type())
+		return createError(object.TypeError, "unknown operator: %s %s %s", lt.Type(), operator, rt.Type())
+	}
+}
+
+// integerResult wraps the result of a checked integer operation, which is an
+// OverflowError if it did not fit.
+func integerResult(value int64, ok bool) object.Object {
+	if !ok {
+		return object.IntegerOverflow()
+	}
+	return &object.Integer{Value: value}
+}
+
+// evalComparison applies a comparison operator to lt and an rt of the same
+// type.
+func evalComparison(operator string, lt object.Comparable, rt object.Object) object.Object {
+	order, err := lt.Compare(rt)
+	if err != nil {
+		return createError(object.TypeError, "%s", err)
 	}
+	holds, _ := object.ComparisonHolds(operator, order)
+	return boolNativeToBoolObject(holds)
 }
 
 func evalStringInfixExpression(operator string, lt, rt object.Object) object.Object {
@@ -274,20 +563,54 @@ func evalStringInfixExpression(operator string, lt, rt object.Object) object.Obj
 	rtVal := rt.(*object.String).Value
 
 	switch operator {
-	case "==":
-		return boolNativeToBoolObject(ltVal == rtVal)
 	case "+":
 		return &object.String{Value: ltVal + rtVal}
+	case "<", ">", "<=", ">=", "==", "!=":
+		return evalComparison(operator, lt.(*object.String), rt)
+	default:
+		return createError(object.TypeError, "unknown operator: %s %s %s", lt.Type(), operator, rt.Type())
+	}
+}
+
+// evalInterpolatedString concatenates the parts of node, converting the value
+// of every interpolated expression as `str` does.
+func evalInterpolatedString(node *ast.InterpolatedString, env *object.Environment) object.Object {
+	var out strings.Builder
+	for _, part := range node.Parts {
+		value := Evaluate(part, env)
+		if stopsEvaluation(value) {
+			return value
+		}
+		out.WriteString(object.StringOf(value))
+	}
+	return &object.String{Value: out.String()}
+}
+
+// evalArrayConcatenation returns a new array with the elements of lt followed
+// by those of rt.
+func evalArrayConcatenation(lt, rt object.Object) object.Object {
+	ltVal, rtVal := lt.(*object.Array).Elements, rt.(*object.Array).Elements
+
+	elements := make([]object.Object, 0, len(ltVal)+len(rtVal))
+	elements = append(append(elements, ltVal...), rtVal...)
+	return &object.Array{Elements: elements}
+}
+
+// evalCollectionInfixExpression compares two arrays or two hashes structurally.
+func evalCollectionInfixExpression(operator string, lt, rt object.Object) object.Object {
+	switch operator {
+	case "==":
+		return boolNativeToBoolObject(object.Equal(lt, rt))
 	case "!=":
-		return boolNativeToBoolObject(ltVal != rtVal)
+		return boolNativeToBoolObject(!object.Equal(lt, rt))
 	default:
-		return createError("unknown operator: %s %s %s", lt.Type(), operator, rt.Type())
+		return createError(object.TypeError, "unknown operator: %s %s %s", lt.Type(), operator, rt.Type())
 	}
 }
 
 func evalConditionalExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
 	condition := Evaluate(ie.Condition, env)
-	if isError(condition) {
+	if stopsEvaluation(condition) {
 		return condition
 	}
 	if isTruthy(condition) {
@@ -299,12 +622,49 @@ func evalConditionalExpression(ie *ast.IfExpression, env *object.Environment) ob
 	}
 }
 
+// evalSwitchExpression evaluates the body of the first case whose value is
+// equal to the subject, as by `==`, or else the default body.
+func evalSwitchExpression(se *ast.SwitchExpression, env *object.Environment) object.Object {
+	subject := Evaluate(se.Subject, env)
+	if stopsEvaluation(subject) {
+		return subject
+	}
+	for _, sc := range se.Cases {
+		value := Evaluate(sc.Value, env)
+		if stopsEvaluation(value) {
+			return value
+		}
+		equal := evalInfixExpression("==", subject, value)
+		if isError(equal) {
+			return equal
+		}
+		if isTruthy(equal) {
+			return Evaluate(sc.Body, env)
+		}
+	}
+	if se.Default != nil {
+		return Evaluate(se.Default, env)
+	}
+	return NULL
+}
+
 func evalPrefixNegationExpression(right object.Object) object.Object {
 	if right.Type() != object.INTEGER_OBJ {
-		return createError("unknown operator: -%s", right.Type())
+		return createError(object.TypeError, "unknown operator: -%s", right.Type())
+	}
+	value, ok := object.SubtractIntegers(0, right.(*object.Integer).Value)
+	if !ok {
+		return object.IntegerOverflow()
+	}
+	return &object.Integer{Value: value}
+}
+
+func evalPrefixBitNotExpression(right object.Object) object.Object {
+	if right.Type() != object.INTEGER_OBJ {
+		return createError(object.TypeError, "unknown operator: ~%s", right.Type())
 	}
 	value := right.(*object.Integer).Value
-	return &object.Integer{Value: -value}
+	return &object.Integer{Value: ^value}
 }
 
 func evalBangOperatorExpression(right object.Object) object.Object {
@@ -341,8 +701,12 @@ func boolNativeToBoolObject(value bool) *object.Boolean {
 	}
 }
 
-func createError(format string, args ...any) *object.Error {
-	return &object.Error{Message: fmt.Sprintf(format, args...)}
+func createError(kind object.ErrorKind, format string, args ...any) *object.Error {
+	return object.NewError(kind, format, args...)
+}
+
+func isCollection(ob object.Object) bool {
+	return ob.Type() == object.ARRAY_OBJ || ob.Type() == object.HASH_OBJ
 }
 
 func isError(ob object.Object) bool {
@@ -352,18 +716,58 @@ func isError(ob object.Object) bool {
 	return false
 }
 
+// stopsEvaluation reports whether ob cuts the evaluation of whatever consumes
+// it short: an error, or a return, break or continue on its way out to the
+// function or loop it belongs to. Such a value is passed along as it is
+// instead of being used as an operand, argument or element.
+func stopsEvaluation(ob object.Object) bool {
+	if ob == nil {
+		return false
+	}
+	switch ob.Type() {
+	case object.ERROR_OBJ, object.RETURN_VALUE_OBJ, object.BREAK_OBJ, object.CONTINUE_OBJ:
+		return true
+	}
+	return false
+}
+
 func applyFunction(fun object.Object, args []object.Object) object.Object {
 	switch fn := fun.(type) {
 	case *object.Function:
-		evalOb := Evaluate(fn.Body, extendFunctionEnv(fn, args))
+		if err := checkArity(fn, len(args)); err != nil {
+			return err
+		}
+		env, err := extendFunctionEnv(fn, args)
+		if err != nil {
+			return err
+		}
+		// the environment of the call already scopes the body's variables
+		evalOb := evalBlockStatement(fn.Body, env)
+		switch evalOb.(type) {
+		case *object.Break, *object.Continue:
+			return createError(object.RuntimeError, "%s outside of loop", evalOb.Inspect())
+		}
 		return unwrapReturnValue(evalOb)
 	case *object.BuiltIn:
-		return fn.Func(args...)
+		switch result := fn.Call(callFunction, args...).(type) {
+		case nil:
+			return NULL
+		case *object.Boolean:
+			return boolNativeToBoolObject(result.Value)
+		default:
+			return result
+		}
 	default:
-		return createError("unknown function: %s", fn.Type())
+		return createError(object.TypeError, "unknown function: %s", fn.Type())
 	}
 }
 
+// callFunction is the object.Caller through which higher-order builtins call
+// the functions passed to them.
+func callFunction(fn object.Object, args ...object.Object) object.Object {
+	return applyFunction(fn, args)
+}
+
 func unwrapReturnValue(ob object.Object) object.Object {
 	if returnValue, ok := ob.(*object.Return); ok {
 		return returnValue.Value
@@ -371,11 +775,61 @@ func unwrapReturnValue(ob object.Object) object.Object {
 	return ob
 }
 
-func extendFunctionEnv(fn *object.Function, args []object.Object) *object.Environment {
+// checkArity reports an error if fn cannot be called with numArgs arguments.
+// Parameters with a default may be left out, and a variadic function takes
+// any number of arguments past the parameters before its rest parameter.
+func checkArity(fn *object.Function, numArgs int) *object.Error {
+	positional := len(fn.Parameters)
+	if fn.Variadic {
+		positional--
+	}
+	required := positional
+	for _, def := range fn.Defaults {
+		if def != nil {
+			required--
+		}
+	}
+	switch {
+	case fn.Variadic && numArgs < required:
+		return createError(object.ArgumentError, "wrong number of arguments: want at least %d, got=%d", required, numArgs)
+	case fn.Variadic:
+		return nil
+	case required == positional && numArgs != positional:
+		return createError(object.ArgumentError, "wrong number of arguments: want=%d, got=%d", positional, numArgs)
+	case numArgs < required || numArgs > positional:
+		return createError(object.ArgumentError, "wrong number of arguments: want between %d and %d, got=%d",
+			required, positional, numArgs)
+	}
+	return nil
+}
+
+// extendFunctionEnv binds the parameters of fn to args in a new environment
+// enclosed by the one fn was defined in. Parameters left without an argument
+// get their default, which is evaluated after binding the ones before it.
+func extendFunctionEnv(fn *object.Function, args []object.Object) (*object.Environment, object.Object) {
 	env := object.NewEnclosedEnvironment(fn.Env)
 
-	for pIdx, param := range fn.Parameters {
-		env.Set(param.Value, args[pIdx]) // binds args to param names with the help of param-index
+	params := fn.Parameters
+	if fn.Variadic {
+		params = params[:len(params)-1]
+	}
+	for pIdx, param := range params {
+		if pIdx < len(args) {
+			env.Set(param.Value, args[pIdx]) // binds args to param names with the help of param-index
+			continue
+		}
+		value := Evaluate(fn.Defaults[pIdx], env)
+		if isError(value) {
+			return nil, value
+		}
+		env.Set(param.Value, value)
+	}
+	if fn.Variadic {
+		rest := &object.Array{Elements: []object.Object{}}
+		if len(args) > len(params) {
+			rest.Elements = append(rest.Elements, args[len(params):]...)
+		}
+		env.Set(fn.Parameters[len(params)].Value, rest)
 	}
-	return env
+	return env, nil
 }
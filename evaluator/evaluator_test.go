@@ -27,6 +27,9 @@ func TestEvalIntegerExpression(t *testing.T) {
 		{"2 * (5 + 10)", 30},
 		{"3 * (3 * 3) + 10", 37},
 		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+		{"~0", -1},
+		{"~5", -6},
+		{"~~7", 7},
 	}
 	for _, tt := range tests {
 		evaluated := testEval(tt.input)
@@ -72,6 +75,9 @@ func TestEvalBooleanExpression(t *testing.T) {
 		{"1 > 2", false},
 		{"1 < 1", false},
 		{"1 > 1", false},
+		{"1 <= 1", true},
+		{"2 <= 1", false},
+		{"1 >= 2", false},
 		{"1 == 1", true},
 		{"1 != 1", false},
 		{"1 == 2", false},
@@ -92,6 +98,33 @@ func TestEvalBooleanExpression(t *testing.T) {
 	}
 }
 
+func TestCollectionEquality(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"[] == []", true},
+		{"[1, 2] == [1, 2]", true},
+		{"[1, 2] != [1, 2]", false},
+		{"[1, 2] == [2, 1]", false},
+		{"[1, 2] == [1, 2, 3]", false},
+		{`[1, "a", true] == [1, "a", true]`, true},
+		{"[[1, 2], [3]] == [[1, 2], [3]]", true},
+		{"[[1, 2], [3]] == [[1, 2], [4]]", false},
+		{"[[1, 2], [3]] != [[1, 2], [4]]", true},
+		{`{"a": 1, "b": 2} == {"b": 2, "a": 1}`, true},
+		{`{"a": 1, "b": 2} == {"a": 1, "b": 3}`, false},
+		{`{"a": 1} == {"a": 1, "b": 2}`, false},
+		{`{"a": [1, 2]} == {"a": [1, 2]}`, true},
+		{`{"a": 1} != {"a": 2}`, true},
+		{`let a = [1]; let b = a; a == b`, true},
+		{`[1] == {}`, false},
+	}
+	for _, tt := range tests {
+		testBooleanObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
 func TestBangOperator(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -110,6 +143,24 @@ func TestBangOperator(t *testing.T) {
 	}
 }
 
+func TestNullLiteral(t *testing.T) {
+	testNullObject(t, testEval("null"))
+	testNullObject(t, testEval("let x = null; x"))
+
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"let x = null; x == null", true},
+		{"let x = null; x != null", false},
+		{"let x = 1; x == null", false},
+		{"!null", true},
+	}
+	for _, tt := range tests {
+		testBooleanObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
 func TestIfElseExpressions(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -175,6 +226,10 @@ func TestErrorHandling(t *testing.T) {
 			"-true",
 			"unknown operator: -BOOLEAN",
 		},
+		{
+			`~"five"`,
+			"unknown operator: ~STRING",
+		},
 		{
 			"true + false",
 			"unknown operator: BOOLEAN + BOOLEAN",
@@ -206,6 +261,58 @@ func TestErrorHandling(t *testing.T) {
 			`{"name": "Monkey"}[func(x) { x }];`,
 			`unusable as hash key: FUNCTION`,
 		},
+		{
+			"func(a, b) { a + b }(1)",
+			"wrong number of arguments: want=2, got=1",
+		},
+		{
+			"let f = func(a) { a }; f(1, 2)",
+			"wrong number of arguments: want=1, got=2",
+		},
+		{
+			"func() { 1 }(1)",
+			"wrong number of arguments: want=0, got=1",
+		},
+		{
+			"func(a, ...rest) { a }()",
+			"wrong number of arguments: want at least 1, got=0",
+		},
+		{
+			"[1] + 1",
+			"type mismatch: ARRAY + INTEGER",
+		},
+		{
+			"[1] - [1]",
+			"unknown operator: ARRAY - ARRAY",
+		},
+		{
+			"let f = func(x) { x / 0 }; f(1) + 1",
+			"division by zero",
+		},
+		{
+			`{"a": 1, "a": 2}`,
+			"duplicate key in hash literal: a",
+		},
+		{
+			`{1: "one", 2: "two", 1: "uno"}`,
+			"duplicate key in hash literal: 1",
+		},
+		{
+			`let k = "a"; {k: 1, "a": 2}`,
+			"duplicate key in hash literal: a",
+		},
+		{
+			"func(a, b = 1) { a }(1, 2, 3)",
+			"wrong number of arguments: want between 1 and 2, got=3",
+		},
+		{
+			"func(a, b = a + true) { a }(1)",
+			"type mismatch: INTEGER + BOOLEAN",
+		},
+		{
+			"let f = func(a) { a }; f(f(1, 2))",
+			"wrong number of arguments: want=1, got=2",
+		},
 	}
 	for _, tt := range tests {
 		evaluated := testEval(tt.input)
@@ -235,6 +342,159 @@ func TestLetStatements(t *testing.T) {
 	}
 }
 
+func TestMultiLetCountMismatch(t *testing.T) {
+	evaluated := testEval("let a, b = 1, 2, 3; a")
+	errOb, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+	}
+	if errOb.Message != "let binds 2 names to 3 values" {
+		t.Errorf("wrong error message. got=%q", errOb.Message)
+	}
+}
+
+func TestConstRedefinition(t *testing.T) {
+	tests := []string{
+		"const pi = 3; let pi = 4; pi = 5",
+		"const pi = 3; const pi = 4",
+		"const pi = 3; let a, pi = 1, 2",
+		"const pi = 3; let [pi] = [4]",
+		`const pi = 3; let {pi} = {"pi": 4}`,
+	}
+	for _, input := range tests {
+		evaluated := testEval(input)
+		errOb, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Fatalf("%q: object is not Error. got=%T (%+v)", input, evaluated, evaluated)
+		}
+		if errOb.Message != "cannot redefine constant: pi" {
+			t.Errorf("%q: wrong error message. got=%q", input, errOb.Message)
+		}
+	}
+}
+
+func TestConstAssignment(t *testing.T) {
+	tests := []string{
+		"const pi = 3; pi = 4",
+		"const pi = 3; let f = func() { pi = 4 }; f()",
+		"const pi = 3; if (true) { pi = 4 }",
+	}
+	for _, input := range tests {
+		evaluated := testEval(input)
+		errOb, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Fatalf("%q: object is not Error. got=%T (%+v)", input, evaluated, evaluated)
+		}
+		if errOb.Message != "cannot assign to constant: pi" {
+			t.Errorf("%q: wrong error message. got=%q", input, errOb.Message)
+		}
+	}
+}
+
+func TestBlockScopedLetStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"if (true) { let x = 1; } x", "Identifier 'x' not found"},
+		{"if (false) { 1 } else { let y = 2; } y", "Identifier 'y' not found"},
+		{"for (let i = 0; i < 1; i = i + 1) { let z = i; } z", "Identifier 'z' not found"},
+		{"if (true) { let x = 1; x + 1 }", 2},
+		{"let x = 1; if (true) { let x = 2; } x", 1},
+		{"let x = 1; if (true) { let x = 2; x }", 2},
+		{"let x = 1; if (true) { x = 2; } x", 2},
+		{"let x = 1; if (true) { if (true) { let x = 3; } x }", 1},
+		{"let sum = 0; for (let i = 0; i < 3; i = i + 1) { let step = i; sum = sum + step; } sum", 3},
+		{"let f = func() { if (true) { let v = 4; } v }; f()", "Identifier 'v' not found"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errOb, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("%s: object is not Error. got=%T (%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if errOb.Message != expected {
+				t.Errorf("%s: wrong error message. expected=%q, got=%q", tt.input, expected, errOb.Message)
+			}
+		}
+	}
+}
+
+func TestAssignStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let a = 5; a = 6; a;", 6},
+		{"let a = 5; a = a * 2; a;", 10},
+		{"let a = 1; let inc = func() { a = a + 1; }; inc(); inc(); a;", 3},
+		{"let a = 1; let f = func(a) { a = 10; }; f(0); a;", 1},
+	}
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+
+	evaluated := testEval("b = 1")
+	errOb, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+	}
+	if errOb.Message != "Identifier 'b' not found" {
+		t.Errorf("wrong error message. got=%q", errOb.Message)
+	}
+}
+
+func TestForStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let sum = 0; for (let i = 1; i < 6; i = i + 1) { sum = sum + i; } sum", 15},
+		{"let i = 100; for (let i = 0; i < 3; i = i + 1) { } i", 100},
+		{"let f = func() { for (let i = 0; ; i = i + 1) { if (i > 2) { return i; } } }; f()", 3},
+	}
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+
+	evaluated := testEval("for (let i = 0; i < 1; i = i + 1) { } i")
+	errOb, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("loop variable leaked out of the loop. got=%T(%+v)", evaluated, evaluated)
+	}
+	if errOb.Message != "Identifier 'i' not found" {
+		t.Errorf("wrong error message. got=%q", errOb.Message)
+	}
+}
+
+func TestBreakAndContinueOutsideOfLoops(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"break; 5", "break outside of loop"},
+		{"if (true) { continue; }", "continue outside of loop"},
+		{"for (;;) { let f = func() { break; }; f(); }", "break outside of loop"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errOb, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errOb.Message != tt.expected {
+			t.Errorf("wrong error message. want=%q, got=%q", tt.expected, errOb.Message)
+		}
+	}
+}
+
 func TestFunctionObject(t *testing.T) {
 	input := "func(x) { x + 2; };"
 	evaluated := testEval(input)
@@ -266,6 +526,7 @@ func TestFunctionApplication(t *testing.T) {
 		{"let add = func(x, y) { x + y; }; add(5, 5);", 10},
 		{"let add = func(x, y) { x + y; }; add(5 + 5, add(5, 5));", 20},
 		{"func(x) { x; }(5)", 5},
+		{"let len = func(x) { 42; }; len(5);", 42},
 	}
 	for _, tt := range tests {
 		testIntegerObject(t, testEval(tt.input), tt.expected)
@@ -282,6 +543,39 @@ func TestBuiltinFunctions(t *testing.T) {
 		{`len("hello world")`, 11},
 		{`len(1)`, "argument to `len` not supported, got INTEGER"},
 		{`len("one", "two")`, "wrong number of arguments. got=2, want=1"},
+		{`len({"a": 1, "b": 2}) == 2`, true},
+		{`let h = {"a": 1}; len(set(h, "b", 2))`, 2},
+		{`contains([1, 2, 3], 2)`, true},
+		{`contains([1, 2, 3], 4)`, false},
+		{`contains("hello", "ell")`, true},
+		{`contains({"a": 1}, "a")`, true},
+		{`contains({"a": 1}, "b")`, false},
+		{`contains([1], 1) == true`, true},
+		{`contains(1, 1)`, "argument to `contains` not supported, got INTEGER"},
+		{`puts(5)`, 5},
+		{`puts()`, nil},
+		{`char(ord("A")) == "A"`, true},
+		{`ord("ab")`, `argument to ` + "`ord`" + ` must be a single character, got "ab"`},
+		{`len(range(3))`, 3},
+		{`range(1, 10, 2)[4]`, 9},
+		{`range(1, 10, 0)`, "step argument to `range` must not be zero"},
+		{`len("héllo")`, 5},
+		{`bytelen("héllo")`, 6},
+		{`deep_len([1, [2, [3]], []])`, 3},
+		{`let a = [1, 2]; set(a, 0, 3); a[0]`, 3},
+		{`set([1], 1, 0)`, "index out of range for `set`: 1 (length 1)"},
+		{`deep_len(1)`, "argument to `deep_len` must be ARRAY, got INTEGER"},
+		{`clamp(-5, 0, 10)`, 0},
+		{`clamp(5, 0, 10)`, 5},
+		{`clamp(15, 0, 10)`, 10},
+		{`clamp(1, 10, 0)`, "lower bound to `clamp` is greater than upper bound: 10 > 0"},
+		{`let h = {"a": 1, "b": 2}; delete(h, "a"); h["b"]`, 2},
+		{`delete(1, 1)`, "argument to `delete` must be HASH, got INTEGER"},
+		{`assert(1 == 1)`, nil},
+		{`assert(false, "boom")`, "assertion failed: boom"},
+		{`assert(false, "boom"); 1`, "assertion failed: boom"},
+		{`len(format("{} + {} = {}", 1, 2, 3))`, 9},
+		{`format("{}")`, "format string has 1 placeholders, got 0 arguments"},
 	}
 
 	for _, tt := range tests {
@@ -290,6 +584,8 @@ func TestBuiltinFunctions(t *testing.T) {
 		switch expected := tt.expected.(type) {
 		case int:
 			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
 		case nil:
 			testNullObject(t, evaluated)
 		case string:
@@ -460,6 +756,22 @@ func TestHashIndexExpressions(t *testing.T) {
 			`{false: 5}[false]`,
 			5,
 		},
+		{
+			`{1: 5, true: 6}[1]`,
+			5,
+		},
+		{
+			`{1: 5, true: 6}[true]`,
+			6,
+		},
+		{
+			`{0: 5}[false]`,
+			nil,
+		},
+		{
+			`{true: 5}[1]`,
+			nil,
+		},
 	}
 	for _, tt := range tests {
 		evaluated := testEval(tt.input)
@@ -0,0 +1,85 @@
+package lexer
+
+import "strings"
+
+// StringPart is a piece of a string literal: either literal text, or the
+// source of an expression interpolated with `${...}`.
+type StringPart struct {
+	Text          string
+	Interpolation bool
+}
+
+// SplitString splits the contents of a string literal into its text and its
+// interpolations, in order. An escaped `\${` is text standing for `${`. Empty
+// text between interpolations is left out.
+func SplitString(literal string) []StringPart {
+	var (
+		parts []StringPart
+		text  strings.Builder
+	)
+	for i := 0; i < len(literal); {
+		switch {
+		case strings.HasPrefix(literal[i:], `\${`):
+			text.WriteString("${")
+			i += 3
+		case strings.HasPrefix(literal[i:], "${"):
+			if text.Len() > 0 {
+				parts = append(parts, StringPart{Text: text.String()})
+				text.Reset()
+			}
+			end := interpolationEnd(literal, i)
+			source := literal[i+2:]
+			if literal[end-1] == '}' {
+				source = literal[i+2 : end-1]
+			}
+			parts = append(parts, StringPart{Text: source, Interpolation: true})
+			i = end
+		default:
+			text.WriteByte(literal[i])
+			i++
+		}
+	}
+	if text.Len() > 0 {
+		parts = append(parts, StringPart{Text: text.String()})
+	}
+	return parts
+}
+
+// stringEnd returns the index of the quote closing the string literal opened
+// by the quote at s[start], or len(s) if the literal is unterminated. Quotes
+// inside interpolations belong to the strings nested in them.
+func stringEnd(s string, start int) int {
+	for i := start + 1; i < len(s); i++ {
+		switch {
+		case s[i] == '"':
+			return i
+		case strings.HasPrefix(s[i:], `\${`):
+			i++
+		case strings.HasPrefix(s[i:], "${"):
+			i = interpolationEnd(s, i) - 1
+		}
+	}
+	return len(s)
+}
+
+// interpolationEnd returns the index just past the `}` closing the
+// interpolation opened by the `${` at s[start], or len(s) if it is
+// unterminated. Braces inside the expression, such as those of a hash literal,
+// are matched on the way.
+func interpolationEnd(s string, start int) int {
+	depth := 0
+	for i := start + 1; i < len(s); i++ {
+		switch s[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+		case '"':
+			i = stringEnd(s, i)
+		}
+	}
+	return len(s)
+}
@@ -9,15 +9,21 @@ type Lexer struct {
 	position     int // current position in input (points to current char)
 	readPosition int // current reading position in input (after reading char)
 	char         byte
+	line         int // line of the current char, counting from 1
+	lineStart    int // position of the first char of the current line
 }
 
 func NewLexer(input string) *Lexer {
-	lex := &Lexer{input: input}
+	lex := &Lexer{input: input, line: 1}
 	lex.readChar()
 	return lex
 }
 
 func (lex *Lexer) readChar() {
+	if lex.char == '\n' {
+		lex.line++
+		lex.lineStart = lex.readPosition
+	}
 	if lex.readPosition >= len(lex.input) {
 		lex.char = 0
 	} else {
@@ -35,10 +41,32 @@ func (lex *Lexer) peekChar() byte {
 	}
 }
 
+// NextToken returns the next token of the input, along with its position.
 func (lex *Lexer) NextToken() token.Token {
-	var tokn token.Token
 	lex.skipWhiteSpace()
 
+	line, column := lex.line, lex.position-lex.lineStart+1
+	tokn := lex.readToken()
+	tokn.Line, tokn.Column = line, column
+	return tokn
+}
+
+// Tokens scans the rest of the input and returns its tokens, ending with the
+// EOF token. It is meant for tools that want the whole token stream at once.
+func (lex *Lexer) Tokens() []token.Token {
+	var tokens []token.Token
+	for {
+		tokn := lex.NextToken()
+		tokens = append(tokens, tokn)
+		if tokn.Type == token.EOF {
+			return tokens
+		}
+	}
+}
+
+func (lex *Lexer) readToken() token.Token {
+	var tokn token.Token
+
 	switch lex.char {
 	case '=':
 		tokn = lex.readTwoCharToken('=', token.EQ, token.ASSIGN)
@@ -48,20 +76,28 @@ func (lex *Lexer) NextToken() token.Token {
 		tokn = newToken(token.MINUS, lex.char)
 	case '!':
 		tokn = lex.readTwoCharToken('=', token.NOT_EQ, token.BANG)
+	case '|':
+		tokn = lex.readTwoCharToken('|', token.OR, token.PIPE)
+	case '&':
+		tokn = lex.readTwoCharToken('&', token.AND, token.AMPERSAND)
+	case '~':
+		tokn = newToken(token.TILDE, lex.char)
 	case '/':
 		tokn = newToken(token.SLASH, lex.char)
 	case '*':
-		tokn = newToken(token.ASTERISK, lex.char)
+		tokn = lex.readTwoCharToken('*', token.POWER, token.ASTERISK)
 	case '<':
-		tokn = newToken(token.LT, lex.char)
+		tokn = lex.readTwoCharToken('=', token.LT_EQ, token.LT)
 	case '>':
-		tokn = newToken(token.GT, lex.char)
+		tokn = lex.readTwoCharToken('=', token.GT_EQ, token.GT)
 	case ';':
 		tokn = newToken(token.SEMICOLON, lex.char)
 	case ',':
 		tokn = newToken(token.COMMA, lex.char)
 	case ':':
 		tokn = newToken(token.COLON, lex.char)
+	case '.':
+		tokn = lex.readEllipsis()
 	case '(':
 		tokn = newToken(token.L_PAREN, lex.char)
 	case ')':
@@ -71,8 +107,7 @@ func (lex *Lexer) NextToken() token.Token {
 	case '}':
 		tokn = newToken(token.R_BRACE, lex.char)
 	case '"':
-		tokn.Type = token.STRING
-		tokn.Literal = lex.readString()
+		tokn = lex.readString()
 	case '[':
 		tokn = newToken(token.L_BRACKET, lex.char)
 	case ']':
@@ -93,6 +128,14 @@ func (lex *Lexer) skipWhiteSpace() {
 	}
 }
 
+// PeekToken returns the token NextToken would return, without consuming it.
+func (lex *Lexer) PeekToken() token.Token {
+	saved := *lex
+	tokn := lex.NextToken()
+	*lex = saved
+	return tokn
+}
+
 func (lex *Lexer) readTwoCharToken(expectedChar byte, twoCharType,
 	singleCharType token.TokenType) token.Token {
 
@@ -105,15 +148,37 @@ func (lex *Lexer) readTwoCharToken(expectedChar byte, twoCharType,
 	return newToken(singleCharType, lex.char)
 }
 
-func (lex *Lexer) readString() string {
-	position := lex.position + 1
-	for {
+// readEllipsis reads `...`; a dot on its own is not a valid token.
+func (lex *Lexer) readEllipsis() token.Token {
+	if lex.peekChar() != '.' || lex.readPosition+1 >= len(lex.input) ||
+		lex.input[lex.readPosition+1] != '.' {
+		return newToken(token.ILLEGAL, lex.char)
+	}
+	lex.readChar()
+	lex.readChar()
+	return token.Token{Type: token.ELLIPSIS, Literal: "..."}
+}
+
+// readString reads a string literal up to its closing quote. A string with
+// interpolations becomes a TEMPLATE token holding the raw source; any other
+// string a STRING token holding its value.
+func (lex *Lexer) readString() token.Token {
+	start := lex.position
+	end := stringEnd(lex.input, start)
+	for lex.position < end && lex.char != 0 {
 		lex.readChar()
-		if lex.char == '"' || lex.char == 0 {
-			break
-		}
 	}
-	return lex.input[position:lex.position]
+	literal := lex.input[start+1 : lex.position]
+
+	parts := SplitString(literal)
+	switch {
+	case len(parts) == 0:
+		return token.Token{Type: token.STRING, Literal: ""}
+	case len(parts) == 1 && !parts[0].Interpolation:
+		return token.Token{Type: token.STRING, Literal: parts[0].Text}
+	default:
+		return token.Token{Type: token.TEMPLATE, Literal: literal}
+	}
 }
 
 func (lex *Lexer) readDefaultToken() token.Token {
@@ -25,9 +25,17 @@ if (5 < 10) {
 }
 10 == 10;
 10 != 9;
+5 <= 10 >= 5;
 "foobar"
 "foo bar"
 [1, 2];
+null;
+~5;
+for break continue
+|
+...rest
+& && | ||
+2 ** 3 * 4
 `
 
 	tests := []struct {
@@ -106,6 +114,12 @@ if (5 < 10) {
 		{token.NOT_EQ, "!="},
 		{token.INT, "9"},
 		{token.SEMICOLON, ";"},
+		{token.INT, "5"},
+		{token.LT_EQ, "<="},
+		{token.INT, "10"},
+		{token.GT_EQ, ">="},
+		{token.INT, "5"},
+		{token.SEMICOLON, ";"},
 		{token.STRING, "foobar"},
 		{token.STRING, "foo bar"},
 		{token.L_BRACKET, "["},
@@ -114,6 +128,26 @@ if (5 < 10) {
 		{token.INT, "2"},
 		{token.R_BRACKET, "]"},
 		{token.SEMICOLON, ";"},
+		{token.NULL, "null"},
+		{token.SEMICOLON, ";"},
+		{token.TILDE, "~"},
+		{token.INT, "5"},
+		{token.SEMICOLON, ";"},
+		{token.FOR, "for"},
+		{token.BREAK, "break"},
+		{token.CONTINUE, "continue"},
+		{token.PIPE, "|"},
+		{token.ELLIPSIS, "..."},
+		{token.IDENT, "rest"},
+		{token.AMPERSAND, "&"},
+		{token.AND, "&&"},
+		{token.PIPE, "|"},
+		{token.OR, "||"},
+		{token.INT, "2"},
+		{token.POWER, "**"},
+		{token.INT, "3"},
+		{token.ASTERISK, "*"},
+		{token.INT, "4"},
 		{token.EOF, ""},
 	}
 
@@ -131,3 +165,113 @@ if (5 < 10) {
 		}
 	}
 }
+
+func TestTokenPositions(t *testing.T) {
+	input := "let x = 10;\n  x == \"a\nb\"\n\tfoo"
+
+	tests := []struct {
+		expectedLiteral string
+		line, column    int
+	}{
+		{"let", 1, 1},
+		{"x", 1, 5},
+		{"=", 1, 7},
+		{"10", 1, 9},
+		{";", 1, 11},
+		{"x", 2, 3},
+		{"==", 2, 5},
+		{"a\nb", 2, 8},
+		{"foo", 4, 2},
+		{"", 4, 5},
+	}
+
+	lex := NewLexer(input)
+	for i, test := range tests {
+		tok := lex.NextToken()
+
+		if tok.Literal != test.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, test.expectedLiteral, tok.Literal)
+		}
+		if tok.Line != test.line || tok.Column != test.column {
+			t.Errorf("tests[%d] - position of %q wrong. expected=%d:%d, got=%d:%d",
+				i, tok.Literal, test.line, test.column, tok.Line, tok.Column)
+		}
+	}
+}
+
+func TestTokens(t *testing.T) {
+	expected := []token.Token{
+		{Type: token.LET, Literal: "let", Line: 1, Column: 1},
+		{Type: token.IDENT, Literal: "x", Line: 1, Column: 5},
+		{Type: token.ASSIGN, Literal: "=", Line: 1, Column: 7},
+		{Type: token.INT, Literal: "5", Line: 1, Column: 9},
+		{Type: token.SEMICOLON, Literal: ";", Line: 1, Column: 10},
+		{Type: token.EOF, Literal: "", Line: 1, Column: 11},
+	}
+	tokens := NewLexer("let x = 5;").Tokens()
+	if len(tokens) != len(expected) {
+		t.Fatalf("wrong number of tokens. want=%d, got=%d (%+v)", len(expected), len(tokens), tokens)
+	}
+	for i, tok := range expected {
+		if tokens[i] != tok {
+			t.Errorf("tokens[%d] wrong. want=%+v, got=%+v", i, tok, tokens[i])
+		}
+	}
+
+	// the stream is the same as the one NextToken hands out
+	input := `let add = func(a, b) { a + b }; add(1, 2) == 3 && "s" != "t";`
+	lex := NewLexer(input)
+	for i, tok := range NewLexer(input).Tokens() {
+		if next := lex.NextToken(); next != tok {
+			t.Errorf("tokens[%d] differs from NextToken. want=%+v, got=%+v", i, next, tok)
+		}
+	}
+}
+
+func TestStringInterpolationTokens(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected token.Token
+	}{
+		{`"plain"`, token.Token{Type: token.STRING, Literal: "plain"}},
+		{`""`, token.Token{Type: token.STRING, Literal: ""}},
+		{`"a=${a}"`, token.Token{Type: token.TEMPLATE, Literal: "a=${a}"}},
+		{`"sum is ${a + b}!"`, token.Token{Type: token.TEMPLATE, Literal: "sum is ${a + b}!"}},
+		// an escaped `${` is plain text
+		{`"cost: \${x}"`, token.Token{Type: token.STRING, Literal: "cost: ${x}"}},
+		{`"$ and { alone"`, token.Token{Type: token.STRING, Literal: "$ and { alone"}},
+		// quotes and braces inside an interpolation do not end it
+		{`"${ {"k": "}"}["k"] }"`, token.Token{Type: token.TEMPLATE, Literal: `${ {"k": "}"}["k"] }`}},
+		{`"${"in" + "${x}"}"`, token.Token{Type: token.TEMPLATE, Literal: `${"in" + "${x}"}`}},
+	}
+	for _, tt := range tests {
+		lex := NewLexer(tt.input + ";")
+		tok := lex.NextToken()
+		if tok.Type != tt.expected.Type || tok.Literal != tt.expected.Literal {
+			t.Errorf("%s: wrong token. want=%s %q, got=%s %q",
+				tt.input, tt.expected.Type, tt.expected.Literal, tok.Type, tok.Literal)
+		}
+		if next := lex.NextToken(); next.Type != token.SEMICOLON {
+			t.Errorf("%s: string not consumed up to its closing quote. next=%+v", tt.input, next)
+		}
+	}
+}
+
+func TestSplitString(t *testing.T) {
+	parts := SplitString(`total: ${a + b}\${not} ${"{}"}${c}`)
+	expected := []StringPart{
+		{Text: "total: "},
+		{Text: "a + b", Interpolation: true},
+		{Text: "${not} "},
+		{Text: `"{}"`, Interpolation: true},
+		{Text: "c", Interpolation: true},
+	}
+	if len(parts) != len(expected) {
+		t.Fatalf("wrong number of parts. want=%d, got=%d (%+v)", len(expected), len(parts), parts)
+	}
+	for i, part := range expected {
+		if parts[i] != part {
+			t.Errorf("parts[%d] wrong. want=%+v, got=%+v", i, part, parts[i])
+		}
+	}
+}
@@ -1,19 +1,76 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"os"
 	"os/user"
+	"path/filepath"
+	"strings"
 
+	"comp/compiler"
 	"comp/repl"
 )
 
+// historyFile is where the REPL history is kept, relative to the user's home
+// directory.
+const historyFile = ".monkey_history"
+
 func main() {
+	useEvaluator := flag.Bool("eval", false, "run code on the tree-walking evaluator instead of the VM")
+	dump := flag.Bool("dump-bytecode", false, "print the bytecode compiled from the file given as argument and exit")
+	flag.Parse()
+
+	if *dump {
+		if err := dumpBytecode(flag.Arg(0), os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	usr, err := user.Current()
 	if err != nil {
 		panic(err)
 	}
+	historyPath := filepath.Join(usr.HomeDir, historyFile)
+	history, err := repl.LoadHistory(historyPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not load history: %s\n", err)
+		history = &repl.History{}
+	}
 	fmt.Printf("Hello %s! This is the monkey programming langauge!\n", usr.Username)
 	fmt.Printf("Feel free to type in commands\n")
-	repl.Start(os.Stdin, os.Stdout)
+	if *useEvaluator {
+		repl.StartEvaluator(os.Stdin, os.Stdout, history)
+	} else {
+		repl.Start(os.Stdin, os.Stdout, history)
+	}
+	if err := history.Save(historyPath); err != nil {
+		fmt.Fprintf(os.Stderr, "could not save history: %s\n", err)
+	}
+}
+
+// dumpBytecode compiles the file at path and writes its disassembly, the
+// constant pool with the functions in it followed by the main program, to out
+// without running it.
+func dumpBytecode(path string, out io.Writer) error {
+	if path == "" {
+		return errors.New("-dump-bytecode needs a file to compile")
+	}
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	bytecode, errs, err := compiler.CompileSource(string(src))
+	if errs != nil {
+		return fmt.Errorf("%s does not parse:\n\t%s", path, strings.Join(errs, "\n\t"))
+	}
+	if err != nil {
+		return fmt.Errorf("%s does not compile: %w", path, err)
+	}
+	_, err = io.WriteString(out, compiler.Disassemble(bytecode))
+	return err
 }
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDumpBytecode(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "program.monkey")
+	src := "let add = func(a, b) { a + b };\nadd(1, 2);\n"
+	if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := dumpBytecode(path, &out); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for _, want := range []string{
+		"constants:\n",
+		"0000 func params=2 locals=2\n",
+		"    0000 OpGetLocal 0\n",
+		"instructions:\n",
+		"OpConstant 0\n",
+		"OpCall 2\n",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output misses %q. got=\n%s", want, out.String())
+		}
+	}
+}
+
+func TestDumpBytecodeErrors(t *testing.T) {
+	dir := t.TempDir()
+	badSyntax := filepath.Join(dir, "syntax.monkey")
+	undefined := filepath.Join(dir, "undefined.monkey")
+	_ = os.WriteFile(badSyntax, []byte("let = 1"), 0o644)
+	_ = os.WriteFile(undefined, []byte("x + 1"), 0o644)
+
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{"", "-dump-bytecode needs a file to compile"},
+		{badSyntax, badSyntax + " does not parse:\n\texpected next token to be IDENT, got = instead"},
+		{undefined, undefined + " does not compile: undefined variable: x"},
+	}
+	for _, tt := range tests {
+		var out bytes.Buffer
+		err := dumpBytecode(tt.path, &out)
+		if err == nil || !strings.HasPrefix(err.Error(), tt.expected) {
+			t.Errorf("wrong error for %q. want prefix %q, got=%v", tt.path, tt.expected, err)
+		}
+		if out.Len() != 0 {
+			t.Errorf("output written for %q: %q", tt.path, out.String())
+		}
+	}
+	if err := dumpBytecode(filepath.Join(dir, "missing.monkey"), &bytes.Buffer{}); !os.IsNotExist(err) {
+		t.Errorf("missing file not reported. got=%v", err)
+	}
+}
@@ -0,0 +1,814 @@
+package object
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Builtins is the registry of builtin functions shared by the evaluator and
+// the virtual machine. The compiler refers to a builtin by its index in this
+// slice, so new builtins must only ever be appended to NewBuiltins.
+//
+// A builtin returns nil when it has no value to give back; each engine turns
+// that into its own Null object. Booleans are likewise swapped for the
+// engine's own True and False.
+//
+// Builtins never modify their arguments, with the exception of `set` and
+// `delete`: they write into the array or hash they are given, and the change
+// is visible through every binding referring to that same collection.
+var Builtins = NewBuiltins(os.Stdout)
+
+// BuiltinDef registers a builtin function under the name programs call it by.
+type BuiltinDef struct {
+	Name    string
+	BuiltIn *BuiltIn
+}
+
+// NewBuiltins returns a registry of the builtins in which `puts` and `print`
+// write to out. Each registry has its own random number generator for `rand`,
+// seeded from the time unless a program calls `seed`. Every registry lists
+// the same builtins in the same order as Builtins, so bytecode compiled
+// against Builtins can run with any of them.
+func NewBuiltins(out io.Writer) []BuiltinDef {
+	return newBuiltins(out, monotonicClock)
+}
+
+// processStart is the instant `clock` counts from.
+var processStart = time.Now()
+
+// monotonicClock returns the milliseconds elapsed since the process started,
+// measured on the monotonic clock so that changes to the wall clock do not
+// affect it.
+func monotonicClock() int64 {
+	return time.Since(processStart).Milliseconds()
+}
+
+// newBuiltins is NewBuiltins with `clock` reading the milliseconds from clock.
+func newBuiltins(out io.Writer, clock func() int64) []BuiltinDef {
+	// rng is shared by every VM and evaluator using this registry, which may
+	// run on different goroutines, so rngMu guards it
+	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+	var rngMu sync.Mutex
+	return []BuiltinDef{
+		{
+			"len",
+			&BuiltIn{Func: func(args ...Object) Object {
+				if len(args) != 1 {
+					return NewError(ArgumentError, "wrong number of arguments. got=%d, want=1", len(args))
+				}
+				sized, ok := args[0].(Sized)
+				if !ok {
+					return NewError(TypeError, "argument to `len` not supported, got %s", args[0].Type())
+				}
+				return &Integer{Value: int64(sized.Length())}
+			}},
+		},
+		{
+			"puts",
+			&BuiltIn{Func: func(args ...Object) Object {
+				for _, arg := range args {
+					fmt.Fprintln(out, arg.Inspect())
+				}
+				// returning the last argument lets puts wrap an expression in place
+				if len(args) == 0 {
+					return nil
+				}
+				return args[len(args)-1]
+			}},
+		},
+		{
+			"first",
+			&BuiltIn{Func: func(args ...Object) Object {
+				if len(args) != 1 {
+					return NewError(ArgumentError, "wrong number of arguments. got=%d, want=1", len(args))
+				}
+				if args[0].Type() != ARRAY_OBJ {
+					return NewError(TypeError, "argument to `first` must be ARRAY, got %s", args[0].Type())
+				}
+				array := args[0].(*Array)
+				if len(array.Elements) > 0 {
+					return array.Elements[0]
+				}
+				return nil
+			}},
+		},
+		{
+			"last",
+			&BuiltIn{Func: func(args ...Object) Object {
+				if len(args) != 1 {
+					return NewError(ArgumentError, "wrong number of arguments. got=%d, want=1", len(args))
+				}
+				if args[0].Type() != ARRAY_OBJ {
+					return NewError(TypeError, "argument to `last` must be ARRAY, got %s", args[0].Type())
+				}
+				array := args[0].(*Array)
+				if len(array.Elements) > 0 {
+					return array.Elements[len(array.Elements)-1]
+				}
+				return nil
+			}},
+		},
+		{
+			"rest",
+			&BuiltIn{Func: func(args ...Object) Object {
+				if len(args) != 1 {
+					return NewError(ArgumentError, "wrong number of arguments. got=%d, want=1", len(args))
+				}
+				if args[0].Type() != ARRAY_OBJ {
+					return NewError(TypeError, "argument to `rest` must be ARRAY, got %s", args[0].Type())
+				}
+				array := args[0].(*Array)
+
+				length := len(array.Elements)
+				if len(array.Elements) > 0 {
+					copied := make([]Object, length-1)
+					copy(copied, array.Elements[1:length])
+					return &Array{Elements: copied}
+				}
+				return nil
+			}},
+		},
+		{
+			"push",
+			&BuiltIn{Func: func(args ...Object) Object {
+				if len(args) != 2 {
+					return NewError(ArgumentError, "wrong number of arguments. got=%d, want=2", len(args))
+				}
+				if args[0].Type() != ARRAY_OBJ {
+					return NewError(TypeError, "argument to `push` must be ARRAY, got %s", args[0].Type())
+				}
+				array := args[0].(*Array)
+				length := len(array.Elements)
+
+				copied := make([]Object, length+1)
+				copy(copied, array.Elements)
+
+				copied[length] = args[1]
+				return &Array{Elements: copied}
+			}},
+		},
+		{
+			"abs",
+			&BuiltIn{Func: func(args ...Object) Object {
+				if len(args) != 1 {
+					return NewError(ArgumentError, "wrong number of arguments. got=%d, want=1", len(args))
+				}
+				if args[0].Type() != INTEGER_OBJ {
+					return NewError(TypeError, "argument to `abs` must be INTEGER, got %s", args[0].Type())
+				}
+				value := args[0].(*Integer).Value
+				if value >= 0 {
+					return args[0]
+				}
+				value, ok := SubtractIntegers(0, value)
+				if !ok {
+					return IntegerOverflow()
+				}
+				return &Integer{Value: value}
+			}},
+		},
+		{
+			"pow",
+			&BuiltIn{Func: func(args ...Object) Object {
+				if len(args) != 2 {
+					return NewError(ArgumentError, "wrong number of arguments. got=%d, want=2", len(args))
+				}
+				if args[0].Type() != INTEGER_OBJ || args[1].Type() != INTEGER_OBJ {
+					return NewError(TypeError, "arguments to `pow` must be INTEGER, got %s and %s",
+						args[0].Type(), args[1].Type())
+				}
+				base, exp := args[0].(*Integer).Value, args[1].(*Integer).Value
+				if exp < 0 {
+					return NewError(ValueError, "negative exponent to `pow`: %d", exp)
+				}
+				result, ok := IntegerPower(base, exp)
+				if !ok {
+					return IntegerOverflow()
+				}
+				return &Integer{Value: result}
+			}},
+		},
+		{
+			"min",
+			&BuiltIn{Func: func(args ...Object) Object {
+				return extremum("min", args, func(a, b int64) bool { return a < b })
+			}},
+		},
+		{
+			"max",
+			&BuiltIn{Func: func(args ...Object) Object {
+				return extremum("max", args, func(a, b int64) bool { return a > b })
+			}},
+		},
+		{
+			"contains",
+			&BuiltIn{Func: func(args ...Object) Object {
+				if len(args) != 2 {
+					return NewError(ArgumentError, "wrong number of arguments. got=%d, want=2", len(args))
+				}
+				switch collection := args[0].(type) {
+				case *Array:
+					for _, elem := range collection.Elements {
+						if Equal(elem, args[1]) {
+							return &Boolean{Value: true}
+						}
+					}
+					return &Boolean{Value: false}
+				case *String:
+					sub, ok := args[1].(*String)
+					if !ok {
+						return NewError(TypeError, "second argument to `contains` must be STRING, got %s", args[1].Type())
+					}
+					return &Boolean{Value: strings.Contains(collection.Value, sub.Value)}
+				case *Hash:
+					key, ok := args[1].(Hashable)
+					if !ok {
+						return NewError(TypeError, "unusable as hash key: %s", args[1].Type())
+					}
+					_, ok = collection.Pairs[key.HashKey()]
+					return &Boolean{Value: ok}
+				default:
+					return NewError(TypeError, "argument to `contains` not supported, got %s", args[0].Type())
+				}
+			}},
+		},
+		{
+			"sizeof",
+			&BuiltIn{Func: func(args ...Object) Object {
+				if len(args) != 1 {
+					return NewError(ArgumentError, "wrong number of arguments. got=%d, want=1", len(args))
+				}
+				return &Integer{Value: int64(SizeOf(args[0]))}
+			}},
+		},
+		{
+			"take_while",
+			&BuiltIn{HigherOrderFunc: func(call Caller, args ...Object) Object {
+				arr, n, err := leadingRun("take_while", call, args)
+				if err != nil {
+					return err
+				}
+				return &Array{Elements: append([]Object{}, arr.Elements[:n]...)}
+			}},
+		},
+		{
+			"drop_while",
+			&BuiltIn{HigherOrderFunc: func(call Caller, args ...Object) Object {
+				arr, n, err := leadingRun("drop_while", call, args)
+				if err != nil {
+					return err
+				}
+				return &Array{Elements: append([]Object{}, arr.Elements[n:]...)}
+			}},
+		},
+		{
+			"range",
+			&BuiltIn{Func: func(args ...Object) Object {
+				if len(args) == 0 || len(args) > 3 {
+					return NewError(ArgumentError, "wrong number of arguments. got=%d, want=1 to 3", len(args))
+				}
+				bounds := make([]int64, len(args))
+				for i, arg := range args {
+					integer, ok := arg.(*Integer)
+					if !ok {
+						return NewError(TypeError, "arguments to `range` must be INTEGER, got %s", arg.Type())
+					}
+					bounds[i] = integer.Value
+				}
+				start, end, step := int64(0), bounds[0], int64(1)
+				if len(bounds) > 1 {
+					start, end = bounds[0], bounds[1]
+				}
+				if len(bounds) > 2 {
+					step = bounds[2]
+				}
+				if step == 0 {
+					return NewError(ValueError, "step argument to `range` must not be zero")
+				}
+				count := rangeLength(start, end, step)
+				if count > maxRangeLength {
+					return NewError(ValueError, "`range` would have %d elements, more than %d", count, maxRangeLength)
+				}
+				elements := make([]Object, count)
+				for i := range elements {
+					elements[i] = &Integer{Value: start + int64(i)*step}
+				}
+				return &Array{Elements: elements}
+			}},
+		},
+		{
+			"ord",
+			&BuiltIn{Func: func(args ...Object) Object {
+				if len(args) != 1 {
+					return NewError(ArgumentError, "wrong number of arguments. got=%d, want=1", len(args))
+				}
+				str, ok := args[0].(*String)
+				if !ok {
+					return NewError(TypeError, "argument to `ord` must be STRING, got %s", args[0].Type())
+				}
+				if utf8.RuneCountInString(str.Value) != 1 {
+					return NewError(ValueError, "argument to `ord` must be a single character, got %q", str.Value)
+				}
+				char, _ := utf8.DecodeRuneInString(str.Value)
+				return &Integer{Value: int64(char)}
+			}},
+		},
+		{
+			"char",
+			&BuiltIn{Func: func(args ...Object) Object {
+				if len(args) != 1 {
+					return NewError(ArgumentError, "wrong number of arguments. got=%d, want=1", len(args))
+				}
+				code, ok := args[0].(*Integer)
+				if !ok {
+					return NewError(TypeError, "argument to `char` must be INTEGER, got %s", args[0].Type())
+				}
+				if code.Value < 0 || code.Value > utf8.MaxRune || !utf8.ValidRune(rune(code.Value)) {
+					return NewError(ValueError, "invalid code point for `char`: %d", code.Value)
+				}
+				return &String{Value: string(rune(code.Value))}
+			}},
+		},
+		{
+			"deep_len",
+			&BuiltIn{Func: func(args ...Object) Object {
+				if len(args) != 1 {
+					return NewError(ArgumentError, "wrong number of arguments. got=%d, want=1", len(args))
+				}
+				arr, ok := args[0].(*Array)
+				if !ok {
+					return NewError(TypeError, "argument to `deep_len` must be ARRAY, got %s", args[0].Type())
+				}
+				count, ok := leafCount(arr, 0)
+				if !ok {
+					return NewError(ValueError, "array passed to `deep_len` is nested deeper than %d levels", maxDeepLenDepth)
+				}
+				return &Integer{Value: count}
+			}},
+		},
+		{
+			"bytelen",
+			&BuiltIn{Func: func(args ...Object) Object {
+				if len(args) != 1 {
+					return NewError(ArgumentError, "wrong number of arguments. got=%d, want=1", len(args))
+				}
+				str, ok := args[0].(*String)
+				if !ok {
+					return NewError(TypeError, "argument to `bytelen` must be STRING, got %s", args[0].Type())
+				}
+				return &Integer{Value: int64(len(str.Value))}
+			}},
+		},
+		{
+			"set",
+			&BuiltIn{Func: func(args ...Object) Object {
+				if len(args) != 3 {
+					return NewError(ArgumentError, "wrong number of arguments. got=%d, want=3", len(args))
+				}
+				if reaches(args[2], args[0]) {
+					return NewError(ValueError, "`set` cannot store a collection inside itself")
+				}
+				switch collection := args[0].(type) {
+				case *Array:
+					index, ok := args[1].(*Integer)
+					if !ok {
+						return NewError(TypeError, "index to `set` must be INTEGER, got %s", args[1].Type())
+					}
+					if index.Value < 0 || index.Value >= int64(len(collection.Elements)) {
+						return NewError(ValueError, "index out of range for `set`: %d (length %d)",
+							index.Value, len(collection.Elements))
+					}
+					collection.Elements[index.Value] = args[2]
+				case *Hash:
+					key, ok := args[1].(Hashable)
+					if !ok {
+						return NewError(TypeError, "unusable as hash key: %s", args[1].Type())
+					}
+					collection.Pairs[key.HashKey()] = HashPair{Key: args[1], Value: args[2]}
+				default:
+					return NewError(TypeError, "argument to `set` must be ARRAY or HASH, got %s", args[0].Type())
+				}
+				return args[0]
+			}},
+		},
+		{
+			"clamp",
+			&BuiltIn{Func: func(args ...Object) Object {
+				if len(args) != 3 {
+					return NewError(ArgumentError, "wrong number of arguments. got=%d, want=3", len(args))
+				}
+				for _, arg := range args {
+					if arg.Type() != INTEGER_OBJ {
+						return NewError(TypeError, "arguments to `clamp` must be INTEGER, got %s, %s and %s",
+							args[0].Type(), args[1].Type(), args[2].Type())
+					}
+				}
+				x, lo, hi := args[0].(*Integer), args[1].(*Integer), args[2].(*Integer)
+				if lo.Value > hi.Value {
+					return NewError(ValueError, "lower bound to `clamp` is greater than upper bound: %d > %d",
+						lo.Value, hi.Value)
+				}
+				switch {
+				case x.Value < lo.Value:
+					return lo
+				case x.Value > hi.Value:
+					return hi
+				}
+				return x
+			}},
+		},
+		{
+			"assert",
+			&BuiltIn{Func: func(args ...Object) Object {
+				if len(args) != 1 && len(args) != 2 {
+					return NewError(ArgumentError, "wrong number of arguments. got=%d, want=1 or 2", len(args))
+				}
+				var message string
+				if len(args) == 2 {
+					str, ok := args[1].(*String)
+					if !ok {
+						return NewError(TypeError, "message to `assert` must be STRING, got %s", args[1].Type())
+					}
+					message = str.Value
+				}
+				if isTruthy(args[0]) {
+					return nil
+				}
+				if message == "" {
+					return NewError(AssertionError, "assertion failed")
+				}
+				return NewError(AssertionError, "assertion failed: %s", message)
+			}},
+		},
+		{
+			"delete",
+			&BuiltIn{Func: func(args ...Object) Object {
+				if len(args) != 2 {
+					return NewError(ArgumentError, "wrong number of arguments. got=%d, want=2", len(args))
+				}
+				hash, ok := args[0].(*Hash)
+				if !ok {
+					return NewError(TypeError, "argument to `delete` must be HASH, got %s", args[0].Type())
+				}
+				key, ok := args[1].(Hashable)
+				if !ok {
+					return NewError(TypeError, "unusable as hash key: %s", args[1].Type())
+				}
+				delete(hash.Pairs, key.HashKey())
+				return hash
+			}},
+		},
+		{
+			"format",
+			&BuiltIn{Func: func(args ...Object) Object {
+				if len(args) == 0 {
+					return NewError(ArgumentError, "wrong number of arguments. got=0, want at least 1")
+				}
+				template, ok := args[0].(*String)
+				if !ok {
+					return NewError(TypeError, "first argument to `format` must be STRING, got %s", args[0].Type())
+				}
+				values := args[1:]
+				if count := strings.Count(template.Value, formatPlaceholder); count != len(values) {
+					return NewError(ArgumentError,
+						"format string has %d placeholders, got %d arguments", count, len(values))
+				}
+				var out strings.Builder
+				rest := template.Value
+				for _, value := range values {
+					before, after, _ := strings.Cut(rest, formatPlaceholder)
+					out.WriteString(before)
+					out.WriteString(value.Inspect())
+					rest = after
+				}
+				out.WriteString(rest)
+				return &String{Value: out.String()}
+			}},
+		},
+		{
+			"str",
+			&BuiltIn{Func: func(args ...Object) Object {
+				if len(args) != 1 {
+					return NewError(ArgumentError, "wrong number of arguments. got=%d, want=1", len(args))
+				}
+				if str, ok := args[0].(*String); ok {
+					return str
+				}
+				return &String{Value: StringOf(args[0])}
+			}},
+		},
+		{
+			"print",
+			&BuiltIn{Func: func(args ...Object) Object {
+				values := make([]string, len(args))
+				for i, arg := range args {
+					values[i] = arg.Inspect()
+				}
+				// unlike puts there is no newline, so output can be built up piece by piece
+				fmt.Fprint(out, strings.Join(values, " "))
+				return nil
+			}},
+		},
+		{
+			"clock",
+			&BuiltIn{Func: func(args ...Object) Object {
+				if len(args) != 0 {
+					return NewError(ArgumentError, "wrong number of arguments. got=%d, want=0", len(args))
+				}
+				return &Integer{Value: clock()}
+			}},
+		},
+		{
+			"rand",
+			&BuiltIn{Func: func(args ...Object) Object {
+				if len(args) != 1 {
+					return NewError(ArgumentError, "wrong number of arguments. got=%d, want=1", len(args))
+				}
+				n, ok := args[0].(*Integer)
+				if !ok {
+					return NewError(TypeError, "argument to `rand` must be INTEGER, got %s", args[0].Type())
+				}
+				if n.Value <= 0 {
+					return NewError(ValueError, "argument to `rand` must be positive, got %d", n.Value)
+				}
+				rngMu.Lock()
+				defer rngMu.Unlock()
+				return &Integer{Value: rng.Int63n(n.Value)}
+			}},
+		},
+		{
+			"seed",
+			&BuiltIn{Func: func(args ...Object) Object {
+				if len(args) != 1 {
+					return NewError(ArgumentError, "wrong number of arguments. got=%d, want=1", len(args))
+				}
+				seed, ok := args[0].(*Integer)
+				if !ok {
+					return NewError(TypeError, "argument to `seed` must be INTEGER, got %s", args[0].Type())
+				}
+				rngMu.Lock()
+				rng.Seed(seed.Value)
+				rngMu.Unlock()
+				return nil
+			}},
+		},
+		{
+			"sort",
+			&BuiltIn{Func: func(args ...Object) Object {
+				if len(args) != 1 {
+					return NewError(ArgumentError, "wrong number of arguments. got=%d, want=1", len(args))
+				}
+				arr, ok := args[0].(*Array)
+				if !ok {
+					return NewError(TypeError, "argument to `sort` must be ARRAY, got %s", args[0].Type())
+				}
+				return sortArray(arr)
+			}},
+		},
+	}
+}
+
+// formatPlaceholder marks where `format` inserts the next argument.
+const formatPlaceholder = "{}"
+
+// maxStringLength is the length in bytes of the longest string RepeatString
+// builds. Anything longer is refused with an error instead of exhausting memory.
+const maxStringLength = 1 << 28
+
+// maxRangeLength is the number of elements of the longest array `range`
+// builds. Asking for more is a ValueError rather than exhausting memory.
+const maxRangeLength = 1 << 24
+
+// maxDeepLenDepth is how deep `deep_len` follows nested arrays before giving
+// up with an error.
+const maxDeepLenDepth = 100
+
+// BuiltinIndex returns the index of the builtin registered under name in
+// Builtins, or -1 if there is none.
+func BuiltinIndex(name string) int {
+	for i, def := range Builtins {
+		if def.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// GetBuiltinByName returns the builtin registered under name, or nil if there
+// is none.
+func GetBuiltinByName(name string) *BuiltIn {
+	return lookupBuiltin(Builtins, name)
+}
+
+// lookupBuiltin returns the builtin registered under name in builtins, or nil
+// if there is none.
+func lookupBuiltin(builtins []BuiltinDef, name string) *BuiltIn {
+	for _, def := range builtins {
+		if def.Name == name {
+			return def.BuiltIn
+		}
+	}
+	return nil
+}
+
+// leadingRun returns the array argument of the builtin name and the length of
+// its leading run of elements for which the predicate argument is truthy. The
+// predicate is not called again after the first element failing it.
+func leadingRun(name string, call Caller, args []Object) (*Array, int, *Error) {
+	if len(args) != 2 {
+		return nil, 0, NewError(ArgumentError, "wrong number of arguments. got=%d, want=2", len(args))
+	}
+	arr, ok := args[0].(*Array)
+	if !ok {
+		return nil, 0, NewError(TypeError, "argument to `%s` must be ARRAY, got %s", name, args[0].Type())
+	}
+	for i, elem := range arr.Elements {
+		result := call(args[1], elem)
+		if err, ok := result.(*Error); ok {
+			return nil, 0, err
+		}
+		if !isTruthy(result) {
+			return arr, i, nil
+		}
+	}
+	return arr, len(arr.Elements), nil
+}
+
+// leafCount counts the elements of arr that are not arrays themselves,
+// recursing into the ones that are. It reports false if the nesting goes
+// beyond maxDeepLenDepth.
+func leafCount(arr *Array, depth int) (int64, bool) {
+	if depth >= maxDeepLenDepth {
+		return 0, false
+	}
+	var count int64
+	for _, elem := range arr.Elements {
+		sub, ok := elem.(*Array)
+		if !ok {
+			count++
+			continue
+		}
+		n, ok := leafCount(sub, depth+1)
+		if !ok {
+			return 0, false
+		}
+		count += n
+	}
+	return count, true
+}
+
+// reaches reports whether target is from or one of the collections nested in
+// it. Keeping `set` from creating such a cycle means every other function can
+// walk arrays and hashes without looking out for one.
+func reaches(from, target Object) bool {
+	if from == target {
+		return true
+	}
+	switch from := from.(type) {
+	case *Array:
+		for _, elem := range from.Elements {
+			if reaches(elem, target) {
+				return true
+			}
+		}
+	case *Hash:
+		for _, pair := range from.Pairs {
+			if reaches(pair.Value, target) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isTruthy reports whether ob counts as true in a condition, which is
+// everything except false and null.
+func isTruthy(ob Object) bool {
+	switch ob := ob.(type) {
+	case *Boolean:
+		return ob.Value
+	case *Null, nil:
+		return false
+	default:
+		return true
+	}
+}
+
+// StringOf returns the value of a String and the Inspect output of any other
+// object. It is how `str` and string interpolation turn values into text.
+func StringOf(ob Object) string {
+	if str, ok := ob.(*String); ok {
+		return str.Value
+	}
+	return ob.Inspect()
+}
+
+// rangeLength returns the number of elements of `range(start, end, step)`,
+// counted without overflowing however far apart start and end are.
+func rangeLength(start, end, step int64) uint64 {
+	switch {
+	case step > 0 && start < end:
+		return (uint64(end)-uint64(start)-1)/uint64(step) + 1
+	case step < 0 && start > end:
+		return (uint64(start)-uint64(end)-1)/(uint64(-(step+1))+1) + 1
+	default:
+		return 0
+	}
+}
+
+// RepeatString returns str repeated count times, which is how both engines
+// evaluate `string * integer`. It returns a ValueError for a negative count or
+// a result longer than maxStringLength.
+func RepeatString(str *String, count *Integer) Object {
+	if count.Value < 0 {
+		return NewError(ValueError, "negative repeat count: %d", count.Value)
+	}
+	if len(str.Value) > 0 && count.Value > maxStringLength/int64(len(str.Value)) {
+		return NewError(ValueError, "repeated string too long: %d * %d bytes", count.Value, len(str.Value))
+	}
+	return &String{Value: strings.Repeat(str.Value, int(count.Value))}
+}
+
+// UnpackArray returns the first count elements of value, which must be an
+// array, followed if rest is set by an array of the elements after them. This
+// is how both engines bind `let [a, b, ...rest] = value`. Missing elements are
+// nil, which the engines bind as null.
+func UnpackArray(value Object, count int, rest bool) ([]Object, *Error) {
+	arr, ok := value.(*Array)
+	if !ok {
+		return nil, NewError(TypeError, "cannot destructure %s as an array", value.Type())
+	}
+	unpacked := make([]Object, count, count+1)
+	copy(unpacked, arr.Elements)
+	if rest {
+		tail := []Object{}
+		if count < len(arr.Elements) {
+			tail = append(tail, arr.Elements[count:]...)
+		}
+		unpacked = append(unpacked, &Array{Elements: tail})
+	}
+	return unpacked, nil
+}
+
+// UnpackHash returns the values of value, which must be a hash, under the
+// string keys. This is how both engines bind `let {a, b} = value`. Missing keys
+// give nil, which the engines bind as null, as indexing the hash would.
+func UnpackHash(value Object, keys []string) ([]Object, *Error) {
+	hash, ok := value.(*Hash)
+	if !ok {
+		return nil, NewError(TypeError, "cannot destructure %s as a hash", value.Type())
+	}
+	unpacked := make([]Object, len(keys))
+	for i, key := range keys {
+		if pair, ok := hash.Pairs[(&String{Value: key}).HashKey()]; ok {
+			unpacked[i] = pair.Value
+		}
+	}
+	return unpacked, nil
+}
+
+// sortArray returns a new array of the elements of arr in ascending order,
+// keeping equal elements in the order they had. The elements must be of one
+// Comparable type.
+func sortArray(arr *Array) Object {
+	for _, elem := range arr.Elements {
+		if _, ok := elem.(Comparable); !ok {
+			return NewError(TypeError, "cannot sort %s values", elem.Type())
+		}
+		if first := arr.Elements[0]; elem.Type() != first.Type() {
+			return mismatchedComparison(first, elem)
+		}
+	}
+	sorted := slices.Clone(arr.Elements)
+	slices.SortStableFunc(sorted, func(a, b Object) int {
+		order, _ := a.(Comparable).Compare(b)
+		return order
+	})
+	return &Array{Elements: sorted}
+}
+
+// extremum returns the integer argument for which better holds against all
+// the others.
+func extremum(name string, args []Object, better func(a, b int64) bool) Object {
+	if len(args) == 0 {
+		return NewError(ArgumentError, "wrong number of arguments. got=0, want at least 1")
+	}
+	var result *Integer
+	for _, arg := range args {
+		integer, ok := arg.(*Integer)
+		if !ok {
+			return NewError(TypeError, "arguments to `%s` must be INTEGER, got %s", name, arg.Type())
+		}
+		if result == nil || better(integer.Value, result.Value) {
+			result = integer
+		}
+	}
+	return result
+}
@@ -0,0 +1,61 @@
+package object
+
+import (
+	"cmp"
+	"strings"
+)
+
+// Comparable is implemented by the objects that have an order. The comparison
+// operators of both engines and the `sort` builtin order values through it.
+type Comparable interface {
+	Object
+
+	// Compare returns -1, 0 or 1 as the object is less than, equal to or
+	// greater than other. Other has to be of the same type; comparing
+	// objects of different types is a TypeError.
+	Compare(other Object) (int, error)
+}
+
+// Compare orders integers by value.
+func (ig *Integer) Compare(other Object) (int, error) {
+	o, ok := other.(*Integer)
+	if !ok {
+		return 0, mismatchedComparison(ig, other)
+	}
+	return cmp.Compare(ig.Value, o.Value), nil
+}
+
+// Compare orders strings byte-wise, which for UTF-8 text is by code point.
+func (str *String) Compare(other Object) (int, error) {
+	o, ok := other.(*String)
+	if !ok {
+		return 0, mismatchedComparison(str, other)
+	}
+	return strings.Compare(str.Value, o.Value), nil
+}
+
+func mismatchedComparison(a, b Object) *Error {
+	return NewError(TypeError, "cannot compare %s with %s", a.Type(), b.Type())
+}
+
+// ComparisonHolds reports whether the comparison operator, one of <, >, <=,
+// >=, == and !=, holds between two values whose Compare gave order. It reports
+// false for ok if operator is not a comparison.
+func ComparisonHolds(operator string, order int) (holds bool, ok bool) {
+	switch operator {
+	case "<":
+		return order < 0, true
+	case ">":
+		return order > 0, true
+	case "<=":
+		return order <= 0, true
+	case ">=":
+		return order >= 0, true
+	case "==":
+		return order == 0, true
+	case "!=":
+		return order != 0, true
+	default:
+		return false, false
+	}
+}
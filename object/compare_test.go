@@ -0,0 +1,77 @@
+package object
+
+import "testing"
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		a, b     Comparable
+		expected int
+	}{
+		{&Integer{Value: 1}, &Integer{Value: 2}, -1},
+		{&Integer{Value: 2}, &Integer{Value: 2}, 0},
+		{&Integer{Value: 3}, &Integer{Value: -2}, 1},
+		{&String{Value: "a"}, &String{Value: "b"}, -1},
+		{&String{Value: "ab"}, &String{Value: "ab"}, 0},
+		{&String{Value: "b"}, &String{Value: "abc"}, 1},
+		{&String{Value: "a"}, &String{Value: "B"}, 1},
+	}
+	for _, tt := range tests {
+		order, err := tt.a.Compare(tt.b)
+		if err != nil {
+			t.Errorf("%s vs %s: unexpected error: %s", tt.a.Inspect(), tt.b.Inspect(), err)
+		}
+		if order != tt.expected {
+			t.Errorf("%s vs %s: wrong order. want=%d, got=%d", tt.a.Inspect(), tt.b.Inspect(), tt.expected, order)
+		}
+	}
+
+	_, err := (&Integer{Value: 1}).Compare(&String{Value: "1"})
+	errOb, ok := err.(*Error)
+	if !ok || errOb.Kind != TypeError || errOb.Message != "cannot compare INTEGER with STRING" {
+		t.Errorf("wrong error comparing different types. got=%v", err)
+	}
+}
+
+func TestComparisonHolds(t *testing.T) {
+	expected := map[string][3]bool{
+		"<":  {true, false, false},
+		">":  {false, false, true},
+		"<=": {true, true, false},
+		">=": {false, true, true},
+		"==": {false, true, false},
+		"!=": {true, false, true},
+	}
+	for operator, want := range expected {
+		for i, order := range []int{-1, 0, 1} {
+			holds, ok := ComparisonHolds(operator, order)
+			if !ok || holds != want[i] {
+				t.Errorf("%s with order %d: want=%t, got=%t (ok=%t)", operator, order, want[i], holds, ok)
+			}
+		}
+	}
+	if _, ok := ComparisonHolds("+", 0); ok {
+		t.Errorf("+ accepted as a comparison")
+	}
+}
+
+func TestSortIsStable(t *testing.T) {
+	// equal integers are told apart by identity
+	elements := []Object{
+		&Integer{Value: 2}, &Integer{Value: 1}, &Integer{Value: 2},
+		&Integer{Value: 1}, &Integer{Value: 0}, &Integer{Value: 2},
+	}
+	arr := &Array{Elements: elements}
+	sorted, ok := lookupBuiltin(Builtins, "sort").Func(arr).(*Array)
+	if !ok {
+		t.Fatalf("sort did not return an array")
+	}
+	order := []int{4, 1, 3, 0, 2, 5}
+	for i, index := range order {
+		if sorted.Elements[i] != elements[index] {
+			t.Errorf("element %d is not the original element %d. got=%s", i, index, sorted.Inspect())
+		}
+	}
+	if arr.Inspect() != "[2, 1, 2, 1, 0, 2]" {
+		t.Errorf("sort changed its argument. got=%s", arr.Inspect())
+	}
+}
@@ -1,8 +1,16 @@
 package object
 
+import "sort"
+
 type Environment struct {
 	store map[string]Object
 	outer *Environment
+
+	// constants holds the names in store bound by SetConstant.
+	constants map[string]bool
+
+	// builtins replaces Builtins for this environment and those it encloses.
+	builtins []BuiltinDef
 }
 
 func NewEnvironment() *Environment {
@@ -19,11 +27,94 @@ func (env *Environment) Get(name string) (Object, bool) {
 
 func (env *Environment) Set(name string, val Object) Object {
 	env.store[name] = val
+	delete(env.constants, name)
+	return val
+}
+
+// SetConstant binds name like Set, but as a constant that IsConstant reports
+// until name is bound again.
+func (env *Environment) SetConstant(name string, val Object) Object {
+	env.Set(name, val)
+	if env.constants == nil {
+		env.constants = make(map[string]bool)
+	}
+	env.constants[name] = true
 	return val
 }
 
+// IsConstant reports whether the innermost environment defining name bound it
+// with SetConstant.
+func (env *Environment) IsConstant(name string) bool {
+	if _, ok := env.store[name]; ok {
+		return env.constants[name]
+	}
+	return env.outer != nil && env.outer.IsConstant(name)
+}
+
+// DefinesConstant reports whether env itself, rather than an environment
+// enclosing it, binds name with SetConstant.
+func (env *Environment) DefinesConstant(name string) bool {
+	return env.constants[name]
+}
+
+// Assign rebinds name in the innermost environment defining it. It reports
+// false, leaving all environments untouched, if name is not defined at all.
+func (env *Environment) Assign(name string, val Object) (Object, bool) {
+	if _, ok := env.store[name]; ok {
+		env.store[name] = val
+		return val, true
+	}
+	if env.outer != nil {
+		return env.outer.Assign(name, val)
+	}
+	return nil, false
+}
+
 func NewEnclosedEnvironment(outer *Environment) *Environment {
 	env := NewEnvironment()
 	env.outer = outer
 	return env
 }
+
+// SetBuiltins makes the builtins of env and of the environments enclosed by it
+// those of builtins, a registry returned by NewBuiltins.
+func (env *Environment) SetBuiltins(builtins []BuiltinDef) {
+	env.builtins = builtins
+}
+
+// Builtin returns the builtin registered under name in the registry set on
+// env or the closest environment enclosing it, by default Builtins. It is nil
+// if there is no such builtin.
+func (env *Environment) Builtin(name string) *BuiltIn {
+	for ; env != nil; env = env.outer {
+		if env.builtins != nil {
+			return lookupBuiltin(env.builtins, name)
+		}
+	}
+	return GetBuiltinByName(name)
+}
+
+// Names returns the sorted names bound directly in env, without those of the
+// enclosing environments.
+func (env *Environment) Names() []string {
+	names := make([]string, 0, len(env.store))
+	for name := range env.store {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Dump returns every binding visible from env, including those of the
+// enclosing environments. A name bound in an inner environment shadows the
+// same name in the outer ones.
+func (env *Environment) Dump() map[string]Object {
+	bindings := map[string]Object{}
+	if env.outer != nil {
+		bindings = env.outer.Dump()
+	}
+	for name, val := range env.store {
+		bindings[name] = val
+	}
+	return bindings
+}
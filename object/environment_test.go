@@ -0,0 +1,57 @@
+package object
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestEnvironmentNames(t *testing.T) {
+	outer := NewEnvironment()
+	outer.Set("b", &Integer{Value: 1})
+	outer.Set("a", &Integer{Value: 2})
+
+	inner := NewEnclosedEnvironment(outer)
+	inner.Set("c", &Integer{Value: 3})
+
+	if names := outer.Names(); !slices.Equal(names, []string{"a", "b"}) {
+		t.Errorf("outer.Names() wrong. got=%q", names)
+	}
+	if names := inner.Names(); !slices.Equal(names, []string{"c"}) {
+		t.Errorf("inner.Names() wrong. got=%q", names)
+	}
+}
+
+func TestEnvironmentDump(t *testing.T) {
+	global := NewEnvironment()
+	global.Set("x", &Integer{Value: 1})
+	global.Set("y", &Integer{Value: 2})
+
+	outer := NewEnclosedEnvironment(global)
+	outer.Set("x", &Integer{Value: 10})
+	outer.Set("z", &Integer{Value: 3})
+
+	inner := NewEnclosedEnvironment(outer)
+	inner.Set("z", &Integer{Value: 30})
+
+	expected := map[string]int64{"x": 10, "y": 2, "z": 30}
+
+	dump := inner.Dump()
+	if len(dump) != len(expected) {
+		t.Fatalf("dump has wrong number of bindings. want=%d, got=%d", len(expected), len(dump))
+	}
+	for name, want := range expected {
+		val, ok := dump[name].(*Integer)
+		if !ok {
+			t.Errorf("binding %s is not Integer. got=%T", name, dump[name])
+			continue
+		}
+		if val.Value != want {
+			t.Errorf("binding %s wrong. want=%d, got=%d", name, want, val.Value)
+		}
+	}
+
+	// the enclosing environments are left as they were
+	if got := global.Dump()["x"].(*Integer).Value; got != 1 {
+		t.Errorf("global x changed by dump. got=%d", got)
+	}
+}
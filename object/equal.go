@@ -0,0 +1,55 @@
+package object
+
+// Equal reports whether two objects are structurally equal. Integers, strings,
+// booleans and nulls compare by value, arrays element-wise and hashes
+// key/value-wise regardless of insertion order. Any other objects (functions,
+// builtins, ...) are only equal to themselves.
+func Equal(a, b Object) bool {
+	if a == b {
+		return true
+	}
+	if a == nil || b == nil || a.Type() != b.Type() {
+		return false
+	}
+	switch a := a.(type) {
+	case *Integer:
+		return a.Value == b.(*Integer).Value
+	case *String:
+		return a.Value == b.(*String).Value
+	case *Boolean:
+		return a.Value == b.(*Boolean).Value
+	case *Null:
+		return true
+	case *Array:
+		return arraysEqual(a, b.(*Array))
+	case *Hash:
+		return hashesEqual(a, b.(*Hash))
+	default:
+		return false
+	}
+}
+
+func arraysEqual(a, b *Array) bool {
+	if len(a.Elements) != len(b.Elements) {
+		return false
+	}
+	for i, elem := range a.Elements {
+		if !Equal(elem, b.Elements[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func hashesEqual(a, b *Hash) bool {
+	if len(a.Pairs) != len(b.Pairs) {
+		return false
+	}
+	for key, pair := range a.Pairs {
+		other, ok := b.Pairs[key]
+		if !ok || !Equal(pair.Value, other.Value) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,46 @@
+package object
+
+import "testing"
+
+func TestEqual(t *testing.T) {
+	one := &Integer{Value: 1}
+	two := &Integer{Value: 2}
+	str := &String{Value: "a"}
+
+	hashOf := func(pairs ...Object) *Hash {
+		hash := &Hash{Pairs: map[HashKey]HashPair{}}
+		for i := 0; i < len(pairs); i += 2 {
+			key := pairs[i].(Hashable).HashKey()
+			hash.Pairs[key] = HashPair{Key: pairs[i], Value: pairs[i+1]}
+		}
+		return hash
+	}
+	tests := []struct {
+		a, b     Object
+		expected bool
+	}{
+		{one, &Integer{Value: 1}, true},
+		{one, two, false},
+		{str, &String{Value: "a"}, true},
+		{&Boolean{Value: true}, &Boolean{Value: true}, true},
+		{&Null{}, &Null{}, true},
+		{one, str, false},
+		{&Array{Elements: []Object{one, two}}, &Array{Elements: []Object{one, two}}, true},
+		{&Array{Elements: []Object{one, two}}, &Array{Elements: []Object{two, one}}, false},
+		{&Array{Elements: []Object{one}}, &Array{Elements: []Object{one, two}}, false},
+		{
+			&Array{Elements: []Object{&Array{Elements: []Object{one}}}},
+			&Array{Elements: []Object{&Array{Elements: []Object{&Integer{Value: 1}}}}},
+			true,
+		},
+		{hashOf(str, one, two, str), hashOf(two, str, str, one), true},
+		{hashOf(str, one), hashOf(str, two), false},
+		{hashOf(str, one), hashOf(str, one, two, two), false},
+	}
+	for i, tt := range tests {
+		if got := Equal(tt.a, tt.b); got != tt.expected {
+			t.Errorf("tests[%d] - Equal(%s, %s) wrong. want=%t, got=%t",
+				i, tt.a.Inspect(), tt.b.Inspect(), tt.expected, got)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package object
+
+import "math"
+
+// The integer arithmetic of both engines goes through these functions, which
+// report false when the result does not fit in an int64. An overflowing
+// operation is an OverflowError rather than a wrapped-around value.
+
+// AddIntegers returns a + b.
+func AddIntegers(a, b int64) (int64, bool) {
+	c := a + b
+	return c, (a^c)&(b^c) >= 0
+}
+
+// SubtractIntegers returns a - b.
+func SubtractIntegers(a, b int64) (int64, bool) {
+	c := a - b
+	return c, (a^b)&(a^c) >= 0
+}
+
+// MultiplyIntegers returns a * b.
+func MultiplyIntegers(a, b int64) (int64, bool) {
+	if a == 0 || b == 0 {
+		return 0, true
+	}
+	if (a == -1 && b == math.MinInt64) || (b == -1 && a == math.MinInt64) {
+		return 0, false
+	}
+	c := a * b
+	return c, c/b == a
+}
+
+// DivideIntegers returns a / b, truncated towards zero. b must not be zero.
+func DivideIntegers(a, b int64) (int64, bool) {
+	if a == math.MinInt64 && b == -1 {
+		return 0, false
+	}
+	return a / b, true
+}
+
+// IntegerPower raises base to the non-negative exp by repeated squaring.
+func IntegerPower(base, exp int64) (int64, bool) {
+	var (
+		result = int64(1)
+		ok     bool
+	)
+	for exp > 0 {
+		if exp&1 == 1 {
+			if result, ok = MultiplyIntegers(result, base); !ok {
+				return 0, false
+			}
+		}
+		exp >>= 1
+		// the square is only needed if there are bits of exp left
+		if exp > 0 {
+			if base, ok = MultiplyIntegers(base, base); !ok {
+				return 0, false
+			}
+		}
+	}
+	return result, true
+}
+
+// IntegerOverflow is the error of an integer operation whose result does not
+// fit in an int64.
+func IntegerOverflow() *Error {
+	return NewError(OverflowError, "integer overflow")
+}
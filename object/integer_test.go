@@ -0,0 +1,51 @@
+package object
+
+import (
+	"math"
+	"testing"
+)
+
+func TestCheckedIntegerArithmetic(t *testing.T) {
+	tests := []struct {
+		name     string
+		op       func(a, b int64) (int64, bool)
+		a, b     int64
+		expected int64
+		ok       bool
+	}{
+		{"add", AddIntegers, 2, 3, 5, true},
+		{"add", AddIntegers, math.MaxInt64, 1, 0, false},
+		{"add", AddIntegers, math.MinInt64, -1, 0, false},
+		{"add", AddIntegers, math.MaxInt64, math.MinInt64, -1, true},
+		{"subtract", SubtractIntegers, 2, 3, -1, true},
+		{"subtract", SubtractIntegers, math.MinInt64, 1, 0, false},
+		{"subtract", SubtractIntegers, 0, math.MinInt64, 0, false},
+		{"subtract", SubtractIntegers, -1, math.MinInt64, math.MaxInt64, true},
+		{"multiply", MultiplyIntegers, 6, -7, -42, true},
+		{"multiply", MultiplyIntegers, math.MaxInt64, 2, 0, false},
+		{"multiply", MultiplyIntegers, math.MinInt64, -1, 0, false},
+		{"multiply", MultiplyIntegers, -1, math.MinInt64, 0, false},
+		{"multiply", MultiplyIntegers, 1 << 32, 1 << 31, 0, false},
+		{"multiply", MultiplyIntegers, math.MinInt64, 1, math.MinInt64, true},
+		{"multiply", MultiplyIntegers, math.MinInt64, 0, 0, true},
+		{"divide", DivideIntegers, 7, -2, -3, true},
+		{"divide", DivideIntegers, math.MinInt64, -1, 0, false},
+		{"power", IntegerPower, 2, 62, 1 << 62, true},
+		{"power", IntegerPower, 2, 63, 0, false},
+		{"power", IntegerPower, -2, 63, math.MinInt64, true},
+		{"power", IntegerPower, 3, 40, 0, false},
+		{"power", IntegerPower, 1, math.MaxInt64, 1, true},
+		{"power", IntegerPower, -1, math.MaxInt64, -1, true},
+		{"power", IntegerPower, 0, 0, 1, true},
+	}
+	for _, tt := range tests {
+		result, ok := tt.op(tt.a, tt.b)
+		if ok != tt.ok {
+			t.Errorf("%s(%d, %d): wrong overflow report. want ok=%t, got ok=%t", tt.name, tt.a, tt.b, tt.ok, ok)
+			continue
+		}
+		if ok && result != tt.expected {
+			t.Errorf("%s(%d, %d): wrong result. want=%d, got=%d", tt.name, tt.a, tt.b, tt.expected, result)
+		}
+	}
+}
@@ -6,12 +6,19 @@ import (
 	"fmt"
 	"hash/fnv"
 	"strings"
+	"unicode/utf8"
 )
 
 type ObjectType string
 
 type BuiltInFunction func(args ...Object) Object
 
+// Caller calls fn with args in the engine running the program. It is how
+// higher-order builtins call back into user functions.
+type Caller func(fn Object, args ...Object) Object
+
+type HigherOrderFunction func(call Caller, args ...Object) Object
+
 const (
 	COLOR_RED   = "\033[31m"
 	COLOR_RESET = "\033[0m"
@@ -23,6 +30,8 @@ const (
 	BOOLEAN_OBJ           = "BOOLEAN"
 	NULL_OBJ              = "NULL"
 	RETURN_VALUE_OBJ      = "RETURN_VALUE"
+	BREAK_OBJ             = "BREAK"
+	CONTINUE_OBJ          = "CONTINUE"
 	ERROR_OBJ             = "ERROR"
 	FUNCTION_OBJ          = "FUNCTION"
 	STRING_OBJ            = "STRING"
@@ -30,6 +39,8 @@ const (
 	HASH_OBJ              = "HASH"
 	ARRAY_OBJ             = "ARRAY"
 	COMPILED_FUNCTION_OBJ = "COMPILED_FUNCTION"
+	CLOSURE_OBJ           = "CLOSURE"
+	CELL_OBJ              = "CELL"
 )
 
 type Object interface {
@@ -41,6 +52,14 @@ type CompiledFunction struct {
 	Instructions  code.Instructions
 	NumLocals     int
 	NumParameters int
+	Variadic      bool // the last parameter collects the remaining arguments
+
+	// NumDefaults is how many of the parameters before a rest parameter have
+	// a default value. The instructions then start with the code setting the
+	// defaults, and Entries[i] is the offset to start from when the first i
+	// of those parameters are given.
+	NumDefaults int
+	Entries     []int
 }
 
 func (cf *CompiledFunction) Type() ObjectType { return COMPILED_FUNCTION_OBJ }
@@ -49,6 +68,31 @@ func (cf *CompiledFunction) Inspect() string {
 	return fmt.Sprintf("CompiledFunction[%p]", cf)
 }
 
+// Closure is a compiled function together with the values of the variables of
+// enclosing functions that it refers to, captured when the function literal
+// was evaluated.
+type Closure struct {
+	Fn   *CompiledFunction
+	Free []Object
+}
+
+func (cl *Closure) Type() ObjectType { return CLOSURE_OBJ }
+
+func (cl *Closure) Inspect() string {
+	return fmt.Sprintf("Closure[%p]", cl)
+}
+
+// Cell holds a variable of a compiled function that both the function and
+// its closures assign to, so that they all see the same value. It is never a
+// value of the program itself.
+type Cell struct {
+	Value Object
+}
+
+func (cl *Cell) Type() ObjectType { return CELL_OBJ }
+
+func (cl *Cell) Inspect() string { return cl.Value.Inspect() }
+
 type Integer struct {
 	Value int64
 }
@@ -65,6 +109,22 @@ func (str *String) Type() ObjectType { return STRING_OBJ }
 
 func (str *String) Inspect() string { return str.Value }
 
+// CharAt returns the character at index, counted in runes rather than bytes.
+// It reports false if index is negative or past the last character.
+func (str *String) CharAt(index int64) (*String, bool) {
+	if index < 0 {
+		return nil, false
+	}
+	var i int64
+	for _, char := range str.Value {
+		if i == index {
+			return &String{Value: string(char)}, true
+		}
+		i++
+	}
+	return nil, false
+}
+
 type Boolean struct {
 	Value bool
 }
@@ -87,18 +147,62 @@ func (rv *Return) Type() ObjectType { return RETURN_VALUE_OBJ }
 
 func (rv *Return) Inspect() string { return rv.Value.Inspect() }
 
+// Break and Continue unwind the evaluation of a loop body up to the loop,
+// the same way Return does for function bodies.
+type Break struct{}
+
+func (br *Break) Type() ObjectType { return BREAK_OBJ }
+
+func (br *Break) Inspect() string { return "break" }
+
+type Continue struct{}
+
+func (ct *Continue) Type() ObjectType { return CONTINUE_OBJ }
+
+func (ct *Continue) Inspect() string { return "continue" }
+
+// ErrorKind categorizes an Error, so that the kind of failure can be told
+// apart without looking at the message.
+type ErrorKind string
+
+const (
+	TypeError         ErrorKind = "TypeError"
+	NameError         ErrorKind = "NameError"
+	ArgumentError     ErrorKind = "ArgumentError"
+	ValueError        ErrorKind = "ValueError"
+	ZeroDivisionError ErrorKind = "ZeroDivisionError"
+	RuntimeError      ErrorKind = "RuntimeError"
+	AssertionError    ErrorKind = "AssertionError"
+	OverflowError     ErrorKind = "OverflowError"
+)
+
 type Error struct {
+	Kind    ErrorKind
 	Message string
 }
 
+// NewError returns an Error of the given kind with a formatted message.
+func NewError(kind ErrorKind, format string, args ...any) *Error {
+	return &Error{Kind: kind, Message: fmt.Sprintf(format, args...)}
+}
+
 func (er *Error) Type() ObjectType { return ERROR_OBJ }
 
 func (er *Error) Inspect() string {
-	return fmt.Sprintf("%sERROR::%s %s", COLOR_RED, COLOR_RESET, er.Message)
+	if er.Kind == "" {
+		return fmt.Sprintf("%sERROR::%s %s", COLOR_RED, COLOR_RESET, er.Message)
+	}
+	return fmt.Sprintf("%sERROR::%s %s: %s", COLOR_RED, COLOR_RESET, er.Kind, er.Message)
 }
 
+// Error makes an Error usable as a Go error, which is how the virtual machine
+// reports errors in the program it runs.
+func (er *Error) Error() string { return er.Message }
+
 type Function struct {
 	Parameters []*ast.Identifier
+	Defaults   []ast.Expression // default value of each parameter, nil where there is none
+	Variadic   bool             // the last parameter collects the remaining arguments
 	Env        *Environment
 	Body       *ast.BlockStatement
 }
@@ -109,9 +213,16 @@ func (fn *Function) Inspect() string {
 	var output strings.Builder
 	var params []string
 
-	for _, pr := range fn.Parameters {
+	for i, pr := range fn.Parameters {
+		if i < len(fn.Defaults) && fn.Defaults[i] != nil {
+			params = append(params, pr.String()+" = "+fn.Defaults[i].String())
+			continue
+		}
 		params = append(params, pr.String())
 	}
+	if fn.Variadic {
+		params[len(params)-1] = "..." + params[len(params)-1]
+	}
 	output.WriteString("func(")
 	output.WriteString(strings.Join(params, ", "))
 	output.WriteString(") {\n")
@@ -120,8 +231,19 @@ func (fn *Function) Inspect() string {
 	return output.String()
 }
 
+// BuiltIn is a function implemented in Go. Builtins that take functions as
+// arguments set HigherOrderFunc instead of Func.
 type BuiltIn struct {
-	Func BuiltInFunction
+	Func            BuiltInFunction
+	HigherOrderFunc HigherOrderFunction
+}
+
+// Call calls the builtin with args, handing call to higher-order builtins.
+func (bl *BuiltIn) Call(call Caller, args ...Object) Object {
+	if bl.HigherOrderFunc != nil {
+		return bl.HigherOrderFunc(call, args...)
+	}
+	return bl.Func(args...)
 }
 
 func (bl *BuiltIn) Type() ObjectType { return BUILTIN_OBJ }
@@ -148,6 +270,21 @@ func (arr *Array) Inspect() string {
 	return out.String()
 }
 
+// Sized is implemented by the objects that have a length, which is what the
+// `len` builtin reports.
+type Sized interface {
+	Length() int
+}
+
+// Length is the number of elements.
+func (arr *Array) Length() int { return len(arr.Elements) }
+
+// Length is the number of characters, not bytes.
+func (str *String) Length() int { return utf8.RuneCountInString(str.Value) }
+
+// Length is the number of pairs.
+func (hs *Hash) Length() int { return len(hs.Pairs) }
+
 type Hashable interface {
 	HashKey() HashKey // todo -> add caching to the HashKey() returned values
 }
@@ -1,6 +1,12 @@
 package object
 
-import "testing"
+import (
+	"bytes"
+	"io"
+	"math"
+	"regexp"
+	"testing"
+)
 
 func TestStringHashKey(t *testing.T) {
 	hello1 := &String{Value: "Hello World"}
@@ -15,3 +21,159 @@ func TestStringHashKey(t *testing.T) {
 		t.Errorf("strings with same content have different hash keys")
 	}
 }
+
+func TestIntegerHashKey(t *testing.T) {
+	values := []int64{0, 1, -1, 2, -2, 1 << 32, -(1 << 32), math.MaxInt64, math.MinInt64, math.MaxInt64 - 1}
+
+	seen := make(map[HashKey]int64)
+	for _, value := range values {
+		key := (&Integer{Value: value}).HashKey()
+		if other, ok := seen[key]; ok {
+			t.Errorf("integers %d and %d have the same hash key", value, other)
+		}
+		seen[key] = value
+
+		if key != (&Integer{Value: value}).HashKey() {
+			t.Errorf("integers with value %d have different hash keys", value)
+		}
+	}
+
+	// the type is part of the key, so 1 and true are different keys
+	if (&Integer{Value: 1}).HashKey() == (&Boolean{Value: true}).HashKey() {
+		t.Errorf("integer 1 and true have the same hash key")
+	}
+	if (&Integer{Value: 0}).HashKey() == (&Boolean{Value: false}).HashKey() {
+		t.Errorf("integer 0 and false have the same hash key")
+	}
+}
+
+func TestErrorKinds(t *testing.T) {
+	err := NewError(ZeroDivisionError, "division by %s", "zero")
+	if err.Kind != ZeroDivisionError || err.Message != "division by zero" {
+		t.Fatalf("wrong error. got=%+v", err)
+	}
+	if err.Error() != err.Message {
+		t.Errorf("Error() should be the message. got=%q", err.Error())
+	}
+	expected := COLOR_RED + "ERROR::" + COLOR_RESET + " ZeroDivisionError: division by zero"
+	if err.Inspect() != expected {
+		t.Errorf("wrong Inspect. want=%q, got=%q", expected, err.Inspect())
+	}
+	untyped := &Error{Message: "oops"}
+	if untyped.Inspect() != COLOR_RED+"ERROR::"+COLOR_RESET+" oops" {
+		t.Errorf("wrong Inspect for an error without a kind. got=%q", untyped.Inspect())
+	}
+}
+
+func TestCompiledFunctionInspect(t *testing.T) {
+	first, second := &CompiledFunction{}, &CompiledFunction{}
+
+	if first.Type() != COMPILED_FUNCTION_OBJ || string(first.Type()) != "COMPILED_FUNCTION" {
+		t.Errorf("wrong type. got=%q", first.Type())
+	}
+	pattern := regexp.MustCompile(`^CompiledFunction\[0x[0-9a-f]+\]$`)
+	if !pattern.MatchString(first.Inspect()) {
+		t.Errorf("wrong Inspect format. got=%q", first.Inspect())
+	}
+	if first.Inspect() == second.Inspect() {
+		t.Errorf("distinct functions inspect the same. got=%q", first.Inspect())
+	}
+}
+
+func TestDeleteMutatesInPlace(t *testing.T) {
+	del := GetBuiltinByName("delete").Func
+
+	gone, kept := &String{Value: "gone"}, &Integer{Value: 1}
+	hash := &Hash{Pairs: map[HashKey]HashPair{
+		gone.HashKey(): {Key: gone, Value: &Integer{Value: 1}},
+		kept.HashKey(): {Key: kept, Value: &Integer{Value: 2}},
+	}}
+	if result := del(hash, gone); result != hash {
+		t.Fatalf("delete should return the hash it was given. got=%s", result.Inspect())
+	}
+	if _, ok := hash.Pairs[gone.HashKey()]; ok {
+		t.Errorf("key not deleted. got=%s", hash.Inspect())
+	}
+	if pair, ok := hash.Pairs[kept.HashKey()]; !ok || pair.Value.Inspect() != "2" {
+		t.Errorf("other pair not kept. got=%s", hash.Inspect())
+	}
+}
+
+func TestSetMutatesInPlace(t *testing.T) {
+	set := GetBuiltinByName("set").Func
+
+	arr := &Array{Elements: []Object{&Integer{Value: 1}, &Integer{Value: 2}}}
+	if result := set(arr, &Integer{Value: 1}, &Integer{Value: 5}); result != arr {
+		t.Fatalf("set should return the array it was given. got=%s", result.Inspect())
+	}
+	if arr.Inspect() != "[1, 5]" {
+		t.Errorf("array not modified. got=%s", arr.Inspect())
+	}
+
+	hash := &Hash{Pairs: map[HashKey]HashPair{}}
+	key := &String{Value: "k"}
+	if result := set(hash, key, &Integer{Value: 7}); result != hash {
+		t.Fatalf("set should return the hash it was given. got=%s", result.Inspect())
+	}
+	if pair, ok := hash.Pairs[key.HashKey()]; !ok || pair.Value.Inspect() != "7" {
+		t.Errorf("hash not modified. got=%s", hash.Inspect())
+	}
+}
+
+func TestPrintWritesWithoutNewline(t *testing.T) {
+	var out bytes.Buffer
+	printFunc := lookupBuiltin(NewBuiltins(&out), "print").Func
+	printFunc(&String{Value: "a"}, &String{Value: "b"})
+	printFunc(&Integer{Value: 1})
+	printFunc()
+	printFunc(&String{Value: "c"})
+
+	if out.String() != "a b1c" {
+		t.Errorf("wrong output. want=%q, got=%q", "a b1c", out.String())
+	}
+}
+
+func TestPutsWritesToOutput(t *testing.T) {
+	var out bytes.Buffer
+	lookupBuiltin(NewBuiltins(&out), "puts").Func(&String{Value: "a"}, &Integer{Value: 1})
+
+	if out.String() != "a\n1\n" {
+		t.Errorf("wrong output. want=%q, got=%q", "a\n1\n", out.String())
+	}
+}
+
+func TestClockReadsItsSource(t *testing.T) {
+	now := int64(1000)
+	clock := lookupBuiltin(newBuiltins(io.Discard, func() int64 { return now }), "clock").Func
+
+	if got := clock().Inspect(); got != "1000" {
+		t.Errorf("wrong time. want=1000, got=%s", got)
+	}
+	now += 250
+	if got := clock().Inspect(); got != "1250" {
+		t.Errorf("wrong time. want=1250, got=%s", got)
+	}
+	if err, ok := clock(&Integer{Value: 1}).(*Error); !ok || err.Kind != ArgumentError {
+		t.Errorf("expected an ArgumentError for an argument. got=%s", clock(&Integer{Value: 1}).Inspect())
+	}
+}
+
+func TestLength(t *testing.T) {
+	key := &String{Value: "k"}
+	tests := []struct {
+		sized    Sized
+		expected int
+	}{
+		{&Array{Elements: []Object{&Integer{Value: 1}, &Integer{Value: 2}}}, 2},
+		{&Array{}, 0},
+		{&String{Value: "héllo"}, 5},
+		{&String{Value: ""}, 0},
+		{&Hash{Pairs: map[HashKey]HashPair{key.HashKey(): {Key: key, Value: key}}}, 1},
+		{&Hash{Pairs: map[HashKey]HashPair{}}, 0},
+	}
+	for _, tt := range tests {
+		if got := tt.sized.Length(); got != tt.expected {
+			t.Errorf("wrong length of %v. want=%d, got=%d", tt.sized, tt.expected, got)
+		}
+	}
+}
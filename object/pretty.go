@@ -0,0 +1,71 @@
+package object
+
+import (
+	"sort"
+	"strings"
+)
+
+// PrettyInspect renders ob like Inspect does, but spreads non-empty arrays and
+// hashes across multiple lines, indenting every nesting level by indent spaces.
+// Hash pairs are ordered by the Inspect output of their keys so that the
+// rendering is stable.
+func PrettyInspect(ob Object, indent int) string {
+	var out strings.Builder
+	prettyInspect(&out, ob, strings.Repeat(" ", indent), 0)
+	return out.String()
+}
+
+func prettyInspect(out *strings.Builder, ob Object, indent string, depth int) {
+	switch ob := ob.(type) {
+	case *Array:
+		if len(ob.Elements) == 0 {
+			out.WriteString("[]")
+			return
+		}
+		out.WriteString("[\n")
+		for i, elem := range ob.Elements {
+			out.WriteString(strings.Repeat(indent, depth+1))
+			prettyInspect(out, elem, indent, depth+1)
+			writeSeparator(out, i, len(ob.Elements))
+		}
+		out.WriteString(strings.Repeat(indent, depth) + "]")
+	case *Hash:
+		if len(ob.Pairs) == 0 {
+			out.WriteString("{}")
+			return
+		}
+		pairs := sortedPairs(ob)
+
+		out.WriteString("{\n")
+		for i, pair := range pairs {
+			out.WriteString(strings.Repeat(indent, depth+1))
+			out.WriteString(pair.Key.Inspect() + ": ")
+			prettyInspect(out, pair.Value, indent, depth+1)
+			writeSeparator(out, i, len(pairs))
+		}
+		out.WriteString(strings.Repeat(indent, depth) + "}")
+	default:
+		out.WriteString(ob.Inspect())
+	}
+}
+
+// writeSeparator ends the i-th of n elements with a comma unless it is the last.
+func writeSeparator(out *strings.Builder, i, n int) {
+	if i < n-1 {
+		out.WriteString(",")
+	}
+	out.WriteString("\n")
+}
+
+// sortedPairs returns the pairs of the hash ordered by the Inspect output of
+// their keys.
+func sortedPairs(hash *Hash) []HashPair {
+	pairs := make([]HashPair, 0, len(hash.Pairs))
+	for _, pair := range hash.Pairs {
+		pairs = append(pairs, pair)
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		return pairs[i].Key.Inspect() < pairs[j].Key.Inspect()
+	})
+	return pairs
+}
@@ -0,0 +1,57 @@
+package object
+
+import "testing"
+
+func TestPrettyInspect(t *testing.T) {
+	hash := func(pairs ...Object) *Hash {
+		h := &Hash{Pairs: map[HashKey]HashPair{}}
+		for i := 0; i < len(pairs); i += 2 {
+			key := pairs[i].(Hashable).HashKey()
+			h.Pairs[key] = HashPair{Key: pairs[i], Value: pairs[i+1]}
+		}
+		return h
+	}
+	input := &Array{Elements: []Object{
+		hash(
+			&String{Value: "name"}, &String{Value: "monkey"},
+			&String{Value: "tags"}, &Array{Elements: []Object{
+				&Integer{Value: 1}, &Integer{Value: 2},
+			}},
+		),
+		hash(&String{Value: "empty"}, &Array{}),
+		&Integer{Value: 3},
+	}}
+	expected := `[
+  {
+    name: monkey,
+    tags: [
+      1,
+      2
+    ]
+  },
+  {
+    empty: []
+  },
+  3
+]`
+	if got := PrettyInspect(input, 2); got != expected {
+		t.Errorf("PrettyInspect wrong.\nwant=%s\ngot=%s", expected, got)
+	}
+}
+
+func TestPrettyInspectScalarsAndEmpty(t *testing.T) {
+	tests := []struct {
+		input    Object
+		expected string
+	}{
+		{&Integer{Value: 5}, "5"},
+		{&String{Value: "five"}, "five"},
+		{&Array{}, "[]"},
+		{&Hash{Pairs: map[HashKey]HashPair{}}, "{}"},
+	}
+	for _, tt := range tests {
+		if got := PrettyInspect(tt.input, 4); got != tt.expected {
+			t.Errorf("PrettyInspect wrong. want=%q, got=%q", tt.expected, got)
+		}
+	}
+}
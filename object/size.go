@@ -0,0 +1,73 @@
+package object
+
+import "unsafe"
+
+// maxSizeDepth is how deep SizeOf follows nested arrays and hashes. Anything
+// nested deeper is only counted with the size of its reference.
+const maxSizeDepth = 100
+
+var (
+	referenceSize = int(unsafe.Sizeof(Object(nil)))
+	sliceSize     = int(unsafe.Sizeof([]Object(nil)))
+	stringSize    = int(unsafe.Sizeof(""))
+	hashEntrySize = int(unsafe.Sizeof(HashKey{}) + unsafe.Sizeof(HashPair{}))
+)
+
+// SizeOf estimates the memory in bytes taken up by ob and everything it
+// references: scalars have a fixed size, strings grow with their length and
+// arrays and hashes add up the sizes of their elements. An object referenced
+// more than once is counted in full only the first time, and after that with
+// the size of its reference. Functions are counted without the environment
+// they close over, which is shared.
+func SizeOf(ob Object) int {
+	return sizeOf(ob, 0, make(map[Object]bool))
+}
+
+func sizeOf(ob Object, depth int, visited map[Object]bool) int {
+	if ob == nil {
+		return 0
+	}
+	if depth > maxSizeDepth || visited[ob] {
+		return referenceSize
+	}
+	visited[ob] = true
+
+	switch ob := ob.(type) {
+	case *Integer:
+		return referenceSize + int(unsafe.Sizeof(*ob))
+	case *Boolean:
+		return referenceSize + int(unsafe.Sizeof(*ob))
+	case *Null:
+		return referenceSize
+	case *String:
+		return referenceSize + stringSize + len(ob.Value)
+	case *Array:
+		size := referenceSize + sliceSize
+		for _, elem := range ob.Elements {
+			size += sizeOf(elem, depth+1, visited)
+		}
+		return size
+	case *Hash:
+		size := referenceSize + int(unsafe.Sizeof(*ob))
+		for _, pair := range ob.Pairs {
+			size += hashEntrySize
+			size += sizeOf(pair.Key, depth+1, visited)
+			size += sizeOf(pair.Value, depth+1, visited)
+		}
+		return size
+	case *CompiledFunction:
+		return referenceSize + int(unsafe.Sizeof(*ob)) + len(ob.Instructions)
+	case *Closure:
+		size := referenceSize + int(unsafe.Sizeof(*ob)) + sizeOf(ob.Fn, depth+1, visited)
+		for _, free := range ob.Free {
+			size += sizeOf(free, depth+1, visited)
+		}
+		return size
+	case *Cell:
+		return referenceSize + sizeOf(ob.Value, depth+1, visited)
+	case *Error:
+		return referenceSize + stringSize + len(ob.Message)
+	default:
+		return referenceSize + int(unsafe.Sizeof(uintptr(0)))
+	}
+}
@@ -0,0 +1,91 @@
+package object
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSizeOfGrowsWithContent(t *testing.T) {
+	tests := []struct {
+		smaller Object
+		larger  Object
+	}{
+		{&String{Value: "a"}, &String{Value: "abcdef"}},
+		{
+			&Array{Elements: []Object{&Integer{Value: 1}}},
+			&Array{Elements: []Object{&Integer{Value: 1}, &Integer{Value: 2}}},
+		},
+		{
+			&Array{Elements: []Object{&String{Value: "x"}}},
+			&Array{Elements: []Object{&String{Value: strings.Repeat("x", 100)}}},
+		},
+		{
+			hashOf(&String{Value: "a"}, &Integer{Value: 1}),
+			hashOf(&String{Value: "a"}, &Integer{Value: 1}, &String{Value: "b"}, &Integer{Value: 2}),
+		},
+		{&Array{}, &Array{Elements: []Object{&Array{}}}},
+	}
+	for _, tt := range tests {
+		small, large := SizeOf(tt.smaller), SizeOf(tt.larger)
+		if small >= large {
+			t.Errorf("expected %s (%d) to be smaller than %s (%d)",
+				tt.smaller.Inspect(), small, tt.larger.Inspect(), large)
+		}
+	}
+}
+
+func TestSizeOfNestedStructures(t *testing.T) {
+	inner := &Array{Elements: []Object{&Integer{Value: 1}, &String{Value: "two"}}}
+	outer := &Array{Elements: []Object{inner, inner}}
+
+	// the second reference to inner only adds the reference itself
+	if got, want := SizeOf(outer), SizeOf(&Array{})+SizeOf(inner)+referenceSize; got != want {
+		t.Errorf("nested array size wrong. want=%d, got=%d", want, got)
+	}
+
+	hash := hashOf(&String{Value: "inner"}, inner)
+	if SizeOf(hash) <= SizeOf(inner) {
+		t.Errorf("hash (%d) should be larger than its value (%d)", SizeOf(hash), SizeOf(inner))
+	}
+}
+
+func TestSizeOfStopsAtDepthLimit(t *testing.T) {
+	var nested Object = &Integer{Value: 1}
+	for i := 0; i < 10*maxSizeDepth; i++ {
+		nested = &Array{Elements: []Object{nested}}
+	}
+	limited := SizeOf(nested)
+
+	// wrapping it once more only pushes another level past the limit
+	deeper := &Array{Elements: []Object{nested}}
+	if got := SizeOf(deeper); got != limited {
+		t.Errorf("expected size to stop growing past the depth limit. want=%d, got=%d",
+			limited, got)
+	}
+}
+
+func TestSizeOfCountsSharedObjectsOnce(t *testing.T) {
+	var shared Object = &Array{Elements: []Object{&Integer{Value: 1}}}
+	sizes := []int{SizeOf(shared)}
+	for i := 0; i < 40; i++ {
+		shared = &Array{Elements: []Object{shared, shared}}
+		sizes = append(sizes, SizeOf(shared))
+	}
+
+	// each level adds an array and its second reference to the previous level
+	step := SizeOf(&Array{}) + referenceSize
+	for i := 1; i < len(sizes); i++ {
+		if got := sizes[i] - sizes[i-1]; got != step {
+			t.Fatalf("level %d grew by the wrong size. want=%d, got=%d", i, step, got)
+		}
+	}
+}
+
+func hashOf(pairs ...Object) *Hash {
+	hash := &Hash{Pairs: map[HashKey]HashPair{}}
+	for i := 0; i < len(pairs); i += 2 {
+		key := pairs[i].(Hashable).HashKey()
+		hash.Pairs[key] = HashPair{Key: pairs[i], Value: pairs[i+1]}
+	}
+	return hash
+}
@@ -1,6 +1,7 @@
 package parser
 
 import (
+	"errors"
 	"fmt"
 	"strconv"
 
@@ -12,24 +13,36 @@ import (
 const (
 	_ int = iota
 	LOWEST
+	OR          // ||
+	AND         // &&
+	BIT_OR      // |
+	BIT_AND     // &
 	EQUALS      // ==
 	LESSGREATER // > or <
 	SUM         // +
 	PRODUCT     // *
+	POWER       // **
 	PREFIX      // -x or !x
 	CALL        // myFunc(x)
 	INDEX       // array[index]
 )
 
 var precedences = map[token.TokenType]int{
+	token.OR:        OR,
+	token.AND:       AND,
+	token.PIPE:      BIT_OR,
+	token.AMPERSAND: BIT_AND,
 	token.EQ:        EQUALS,
 	token.NOT_EQ:    EQUALS,
 	token.LT:        LESSGREATER,
 	token.GT:        LESSGREATER,
+	token.LT_EQ:     LESSGREATER,
+	token.GT_EQ:     LESSGREATER,
 	token.PLUS:      SUM,
 	token.MINUS:     SUM,
 	token.SLASH:     PRODUCT,
 	token.ASTERISK:  PRODUCT,
+	token.POWER:     POWER,
 	token.L_PAREN:   CALL,
 	token.L_BRACKET: INDEX,
 }
@@ -48,6 +61,11 @@ type Parser struct {
 
 	prefixParseFns map[token.TokenType]prefixParseFn
 	infixParseFns  map[token.TokenType]infixParseFn
+
+	recovery bool
+	// synced is the number of errors already recovered from, so that a
+	// statement around a block which recovered itself is kept
+	synced int
 }
 
 func NewParser(lxr *lexer.Lexer) *Parser {
@@ -62,12 +80,20 @@ func NewParser(lxr *lexer.Lexer) *Parser {
 	return psr
 }
 
+// EnableRecovery makes the parser carry on after a statement fails to parse:
+// it skips ahead to the next `;` or `}` and resumes there, so that a single
+// run reports the errors of several statements instead of only the first
+// one and whatever follows from it.
+func (psr *Parser) EnableRecovery() {
+	psr.recovery = true
+}
+
 func (psr *Parser) ParseRootStatement() *ast.RootStatement {
 	root := &ast.RootStatement{}
 	root.Statements = []ast.Statement{}
 
 	for !psr.currentTokenIs(token.EOF) {
-		stmt := psr.parseStatement()
+		stmt := psr.parseRecoverableStatement()
 		if stmt != nil {
 			root.Statements = append(root.Statements, stmt)
 		}
@@ -76,24 +102,282 @@ func (psr *Parser) ParseRootStatement() *ast.RootStatement {
 	return root
 }
 
+// parseRecoverableStatement parses a statement and, in recovery mode,
+// synchronizes on the end of the statement if parsing it failed.
+func (psr *Parser) parseRecoverableStatement() ast.Statement {
+	if !psr.recovery {
+		return psr.parseStatement()
+	}
+	errs := len(psr.errors)
+	stmt := psr.parseStatement()
+	if len(psr.errors) > max(errs, psr.synced) {
+		psr.synchronize()
+		psr.synced = len(psr.errors)
+		return nil
+	}
+	return stmt
+}
+
+// synchronize skips the rest of a broken statement. It stops on the `;`
+// ending it, or just before a `}` closing the enclosing block, so that the
+// next call to nextToken starts on a fresh statement.
+func (psr *Parser) synchronize() {
+	for !psr.currentTokenIs(token.SEMICOLON) {
+		switch psr.peekToken.Type {
+		case token.R_BRACE, token.EOF:
+			return
+		}
+		psr.nextToken()
+	}
+}
+
 func (psr *Parser) parseStatement() ast.Statement {
 	switch psr.curToken.Type {
 	case token.LET:
 		return psr.parseLetStatement()
+	case token.CONST:
+		return psr.parseConstStatement()
 	case token.RETURN:
 		return psr.parseReturnStatement()
+	case token.FOR:
+		return psr.parseForStatement()
+	case token.DO:
+		return psr.parseDoWhileStatement()
+	case token.BREAK:
+		stmt := &ast.BreakStatement{Token: psr.curToken}
+		if psr.peekTokenIs(token.SEMICOLON) {
+			psr.nextToken()
+		}
+		return stmt
+	case token.CONTINUE:
+		stmt := &ast.ContinueStatement{Token: psr.curToken}
+		if psr.peekTokenIs(token.SEMICOLON) {
+			psr.nextToken()
+		}
+		return stmt
+	default:
+		return psr.parseSimpleStatement()
+	}
+}
+
+// parseSimpleStatement parses the statements allowed in the clauses of a for
+// loop: let and assignment statements, and expressions.
+func (psr *Parser) parseSimpleStatement() ast.Statement {
+	switch {
+	case psr.currentTokenIs(token.LET):
+		return psr.parseLetStatement()
+	case psr.currentTokenIs(token.IDENT) && psr.peekTokenIs(token.ASSIGN):
+		return psr.parseAssignStatement()
 	default:
 		return psr.parseExpressionStatement()
 	}
 }
 
-func (psr *Parser) parseLetStatement() *ast.LetStatement {
+func (psr *Parser) parseAssignStatement() *ast.AssignStatement {
+	name := &ast.Identifier{Token: psr.curToken, Value: psr.curToken.Literal}
+	psr.nextToken()
+
+	stmt := &ast.AssignStatement{Token: psr.curToken, Name: name}
+	psr.nextToken()
+	stmt.Value = psr.parseExpression(LOWEST)
+
+	if psr.peekTokenIs(token.SEMICOLON) {
+		psr.nextToken()
+	}
+	return stmt
+}
+
+// parseForStatement parses `for (init; condition; post) { body }`, where any
+// of the three clauses may be left empty.
+func (psr *Parser) parseForStatement() *ast.ForStatement {
+	stmt := &ast.ForStatement{Token: psr.curToken}
+	if !psr.expectPeek(token.L_PAREN) {
+		return nil
+	}
+	psr.nextToken()
+
+	if !psr.currentTokenIs(token.SEMICOLON) {
+		stmt.Init = psr.parseSimpleStatement()
+		// the init statement consumes its terminating semicolon
+		if !psr.currentTokenIs(token.SEMICOLON) {
+			psr.peekError(token.SEMICOLON)
+			return nil
+		}
+	}
+	psr.nextToken()
+
+	if !psr.currentTokenIs(token.SEMICOLON) {
+		stmt.Condition = psr.parseExpression(LOWEST)
+		if !psr.expectPeek(token.SEMICOLON) {
+			return nil
+		}
+	}
+	psr.nextToken()
+
+	if !psr.currentTokenIs(token.R_PAREN) {
+		stmt.Post = psr.parseSimpleStatement()
+		if !psr.expectPeek(token.R_PAREN) {
+			return nil
+		}
+	}
+	if !psr.expectPeek(token.L_BRACE) {
+		return nil
+	}
+	stmt.Body = psr.parseBlockStatement()
+	if psr.peekTokenIs(token.SEMICOLON) {
+		psr.nextToken()
+	}
+	return stmt
+}
+
+// parseDoWhileStatement parses `do { body } while (condition)`, optionally
+// followed by a semicolon.
+func (psr *Parser) parseDoWhileStatement() *ast.DoWhileStatement {
+	stmt := &ast.DoWhileStatement{Token: psr.curToken}
+	if !psr.expectPeek(token.L_BRACE) {
+		return nil
+	}
+	stmt.Body = psr.parseBlockStatement()
+
+	if !psr.expectPeek(token.WHILE) || !psr.expectPeek(token.L_PAREN) {
+		return nil
+	}
+	psr.nextToken()
+	stmt.Condition = psr.parseExpression(LOWEST)
+	if !psr.expectPeek(token.R_PAREN) {
+		return nil
+	}
+	if psr.peekTokenIs(token.SEMICOLON) {
+		psr.nextToken()
+	}
+	return stmt
+}
+
+// parseLetStatement parses `let name = value`, or with comma-separated names
+// and values a *ast.MultiLetStatement, whether or not their counts match. A
+// '[' or '{' after `let` starts an array or hash pattern instead.
+func (psr *Parser) parseLetStatement() ast.Statement {
+	tok := psr.curToken
+	if psr.peekTokenIs(token.L_BRACKET) {
+		psr.nextToken()
+		return psr.parseArrayLetStatement(tok)
+	}
+	if psr.peekTokenIs(token.L_BRACE) {
+		psr.nextToken()
+		return psr.parseHashLetStatement(tok)
+	}
+	var names []*ast.Identifier
+	for {
+		if !psr.expectPeek(token.IDENT) {
+			return nil
+		}
+		names = append(names, &ast.Identifier{Token: psr.curToken, Value: psr.curToken.Literal})
+		if !psr.peekTokenIs(token.COMMA) {
+			break
+		}
+		psr.nextToken()
+	}
+	if !psr.expectPeek(token.ASSIGN) {
+		return nil
+	}
+	psr.nextToken()
+	values := []ast.Expression{psr.parseExpression(LOWEST)}
+	for psr.peekTokenIs(token.COMMA) {
+		psr.nextToken()
+		psr.nextToken()
+		values = append(values, psr.parseExpression(LOWEST))
+	}
+
+	if psr.peekTokenIs(token.SEMICOLON) {
+		psr.nextToken()
+	}
+	if len(names) == 1 && len(values) == 1 {
+		return &ast.LetStatement{Token: tok, Name: names[0], Value: values[0]}
+	}
+	return &ast.MultiLetStatement{Token: tok, Names: names, Values: values}
+}
+
+// parseConstStatement parses `const name = value` into a let statement whose
+// binding cannot be assigned to. Unlike let, const binds a single name.
+func (psr *Parser) parseConstStatement() ast.Statement {
 	stmt := &ast.LetStatement{Token: psr.curToken}
 	if !psr.expectPeek(token.IDENT) {
 		return nil
 	}
 	stmt.Name = &ast.Identifier{Token: psr.curToken, Value: psr.curToken.Literal}
+	if !psr.expectPeek(token.ASSIGN) {
+		return nil
+	}
+	psr.nextToken()
+	stmt.Value = psr.parseExpression(LOWEST)
 
+	if psr.peekTokenIs(token.SEMICOLON) {
+		psr.nextToken()
+	}
+	return stmt
+}
+
+// parseArrayLetStatement parses `let [a, b, ...rest] = value` from the '['
+// on. The rest name is optional but has to come last.
+func (psr *Parser) parseArrayLetStatement(tok token.Token) ast.Statement {
+	stmt := &ast.ArrayLetStatement{Token: tok}
+	for !psr.peekTokenIs(token.R_BRACKET) {
+		if psr.peekTokenIs(token.ELLIPSIS) {
+			psr.nextToken()
+			if !psr.expectPeek(token.IDENT) {
+				return nil
+			}
+			stmt.Rest = &ast.Identifier{Token: psr.curToken, Value: psr.curToken.Literal}
+			break
+		}
+		if !psr.expectPeek(token.IDENT) {
+			return nil
+		}
+		stmt.Names = append(stmt.Names, &ast.Identifier{Token: psr.curToken, Value: psr.curToken.Literal})
+		if !psr.peekTokenIs(token.COMMA) {
+			break
+		}
+		psr.nextToken()
+	}
+	if !psr.expectPeek(token.R_BRACKET) {
+		return nil
+	}
+	if len(stmt.Names) == 0 && stmt.Rest == nil {
+		psr.errors = append(psr.errors, "empty array pattern in let")
+		return nil
+	}
+	if !psr.expectPeek(token.ASSIGN) {
+		return nil
+	}
+	psr.nextToken()
+	stmt.Value = psr.parseExpression(LOWEST)
+
+	if psr.peekTokenIs(token.SEMICOLON) {
+		psr.nextToken()
+	}
+	return stmt
+}
+
+// parseHashLetStatement parses `let {a, b} = value` from the '{' on.
+func (psr *Parser) parseHashLetStatement(tok token.Token) ast.Statement {
+	stmt := &ast.HashLetStatement{Token: tok}
+	for !psr.peekTokenIs(token.R_BRACE) {
+		if !psr.expectPeek(token.IDENT) {
+			return nil
+		}
+		stmt.Names = append(stmt.Names, &ast.Identifier{Token: psr.curToken, Value: psr.curToken.Literal})
+		if !psr.peekTokenIs(token.COMMA) {
+			break
+		}
+		psr.nextToken()
+	}
+	if !psr.expectPeek(token.R_BRACE) {
+		return nil
+	}
+	if len(stmt.Names) == 0 {
+		psr.errors = append(psr.errors, "empty hash pattern in let")
+		return nil
+	}
 	if !psr.expectPeek(token.ASSIGN) {
 		return nil
 	}
@@ -154,6 +438,10 @@ func (psr *Parser) parseBoolean() ast.Expression {
 	return &ast.Boolean{Token: psr.curToken, Value: psr.currentTokenIs(token.TRUE)}
 }
 
+func (psr *Parser) parseNullLiteral() ast.Expression {
+	return &ast.NullLiteral{Token: psr.curToken}
+}
+
 func (psr *Parser) parseGroupedExpression() ast.Expression {
 	psr.nextToken()
 	expr := psr.parseExpression(LOWEST)
@@ -221,6 +509,12 @@ func (psr *Parser) parseIntegerLiteral() ast.Expression {
 	lit := &ast.IntegerLiteral{Token: psr.curToken}
 
 	value, err := strconv.ParseInt(psr.curToken.Literal, 0, 64)
+	if errors.Is(err, strconv.ErrRange) {
+		msg := fmt.Sprintf("integer literal out of range: %s at line %d, column %d",
+			psr.curToken.Literal, psr.curToken.Line, psr.curToken.Column)
+		psr.errors = append(psr.errors, msg)
+		return nil
+	}
 	if err != nil {
 		msg := fmt.Sprintf("could not parse %q as integer", psr.curToken.Literal)
 		psr.errors = append(psr.errors, msg)
@@ -234,6 +528,46 @@ func (psr *Parser) parseStringLiteral() ast.Expression {
 	return &ast.StringLiteral{Token: psr.curToken, Value: psr.curToken.Literal}
 }
 
+// parseInterpolatedString parses the text and the interpolated expressions of
+// a TEMPLATE token.
+func (psr *Parser) parseInterpolatedString() ast.Expression {
+	str := &ast.InterpolatedString{Token: psr.curToken}
+
+	for _, part := range lexer.SplitString(psr.curToken.Literal) {
+		if !part.Interpolation {
+			text := token.Token{Type: token.STRING, Literal: part.Text}
+			str.Parts = append(str.Parts, &ast.StringLiteral{Token: text, Value: part.Text})
+			continue
+		}
+		expr := psr.parseInterpolation(part.Text)
+		if expr == nil {
+			return nil
+		}
+		str.Parts = append(str.Parts, expr)
+	}
+	return str
+}
+
+// parseInterpolation parses the source of a `${...}` interpolation, which
+// must be a single expression, with a parser of its own.
+func (psr *Parser) parseInterpolation(source string) ast.Expression {
+	inner := NewParser(lexer.NewLexer(source))
+	if inner.currentTokenIs(token.EOF) {
+		psr.errors = append(psr.errors, "empty interpolation in string literal")
+		return nil
+	}
+	expr := inner.parseExpression(LOWEST)
+	if len(inner.errors) == 0 && !inner.peekTokenIs(token.EOF) {
+		msg := fmt.Sprintf("unexpected %s in interpolation %q", inner.peekToken.Type, source)
+		inner.errors = append(inner.errors, msg)
+	}
+	if len(inner.errors) != 0 {
+		psr.errors = append(psr.errors, inner.errors...)
+		return nil
+	}
+	return expr
+}
+
 func (psr *Parser) parsePrefixExpression() ast.Expression {
 	expr := &ast.PrefixExpression{
 		Token:    psr.curToken,
@@ -251,6 +585,10 @@ func (psr *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 		Left:     left,
 	}
 	precedence := psr.curPrecedence()
+	if precedence == POWER {
+		// right-associative: 2 ** 3 ** 2 is 2 ** (3 ** 2)
+		precedence--
+	}
 	psr.nextToken()
 	expr.Right = psr.parseExpression(precedence)
 	return expr
@@ -274,6 +612,11 @@ func (psr *Parser) parseIfExpression() ast.Expression {
 	if psr.peekTokenIs(token.ELSE) {
 		psr.nextToken()
 
+		if psr.peekTokenIs(token.IF) {
+			psr.nextToken()
+			expr.Alternative = psr.parseElseIf()
+			return expr
+		}
 		if !psr.expectPeek(token.L_BRACE) {
 			return nil
 		}
@@ -282,13 +625,89 @@ func (psr *Parser) parseIfExpression() ast.Expression {
 	return expr
 }
 
+// parseSwitchExpression parses `switch (subject) { case value: body ... }`
+// with at most one `default: body` among the cases.
+func (psr *Parser) parseSwitchExpression() ast.Expression {
+	expr := &ast.SwitchExpression{Token: psr.curToken}
+	if !psr.expectPeek(token.L_PAREN) {
+		return nil
+	}
+	psr.nextToken()
+	expr.Subject = psr.parseExpression(LOWEST)
+	if !psr.expectPeek(token.R_PAREN) || !psr.expectPeek(token.L_BRACE) {
+		return nil
+	}
+	for !psr.peekTokenIs(token.R_BRACE) {
+		switch {
+		case psr.peekTokenIs(token.CASE):
+			psr.nextToken()
+			sc := &ast.SwitchCase{Token: psr.curToken}
+			psr.nextToken()
+			sc.Value = psr.parseExpression(LOWEST)
+			if !psr.expectPeek(token.COLON) {
+				return nil
+			}
+			sc.Body = psr.parseCaseBody()
+			expr.Cases = append(expr.Cases, sc)
+		case psr.peekTokenIs(token.DEFAULT) && expr.Default == nil:
+			psr.nextToken()
+			if !psr.expectPeek(token.COLON) {
+				return nil
+			}
+			expr.Default = psr.parseCaseBody()
+		case psr.peekTokenIs(token.DEFAULT):
+			psr.errors = append(psr.errors, "multiple defaults in switch")
+			return nil
+		default:
+			msg := fmt.Sprintf("expected next token to be CASE or DEFAULT, got %s instead",
+				psr.peekToken.Type)
+			psr.errors = append(psr.errors, msg)
+			return nil
+		}
+	}
+	psr.nextToken()
+	return expr
+}
+
+// parseCaseBody parses the statements after the colon of a case, up to the
+// next case, the default or the end of the switch.
+func (psr *Parser) parseCaseBody() *ast.BlockStatement {
+	block := &ast.BlockStatement{Token: psr.curToken}
+	block.Statements = []ast.Statement{}
+
+	for {
+		switch psr.peekToken.Type {
+		case token.CASE, token.DEFAULT, token.R_BRACE, token.EOF:
+			return block
+		}
+		psr.nextToken()
+		if stmt := psr.parseRecoverableStatement(); stmt != nil {
+			block.Statements = append(block.Statements, stmt)
+		}
+	}
+}
+
+// parseElseIf parses the `if` following an `else` and wraps it in a block of
+// its own, so `else if (b) {}` yields the same AST as `else { if (b) {} }`.
+func (psr *Parser) parseElseIf() *ast.BlockStatement {
+	tok := psr.curToken
+	return &ast.BlockStatement{
+		Token: tok,
+		Statements: []ast.Statement{
+			&ast.ExpressionStatement{Token: tok, Expression: psr.parseIfExpression()},
+		},
+	}
+}
+
 func (psr *Parser) parseFunctionLiteral() ast.Expression {
 	fnLit := &ast.FunctionLiteral{Token: psr.curToken}
 
 	if !psr.expectPeek(token.L_PAREN) {
 		return nil
 	}
-	fnLit.Parameters = psr.parseFunctionParameters()
+	if !psr.parseFunctionParameters(fnLit, token.R_PAREN) {
+		return nil
+	}
 	if !psr.expectPeek(token.L_BRACE) {
 		return nil
 	}
@@ -296,27 +715,76 @@ func (psr *Parser) parseFunctionLiteral() ast.Expression {
 	return fnLit
 }
 
-func (psr *Parser) parseFunctionParameters() []*ast.Identifier {
-	var identifiers []*ast.Identifier
+// parseFunctionParameters parses a comma separated list of identifiers up to
+// and including the end token into the parameters of fnLit. A parameter may be
+// followed by `= default`, after which all but a rest parameter need one too.
+// The last identifier may be prefixed with `...` to collect the remaining
+// arguments.
+func (psr *Parser) parseFunctionParameters(fnLit *ast.FunctionLiteral, end token.TokenType) bool {
+	fnLit.Parameters = []*ast.Identifier{}
 
-	if psr.peekTokenIs(token.R_PAREN) {
+	if psr.peekTokenIs(end) {
 		psr.nextToken()
-		return identifiers
+		return true
 	}
 	psr.nextToken()
-	ident := &ast.Identifier{Token: psr.curToken, Value: psr.curToken.Literal}
-	identifiers = append(identifiers, ident)
+	for {
+		if psr.currentTokenIs(token.ELLIPSIS) {
+			if !psr.expectPeek(token.IDENT) {
+				return false
+			}
+			fnLit.Variadic = true
+		}
+		ident := &ast.Identifier{Token: psr.curToken, Value: psr.curToken.Literal}
+		fnLit.Parameters = append(fnLit.Parameters, ident)
 
-	for psr.peekTokenIs(token.COMMA) {
+		if !psr.parseParameterDefault(fnLit, end) {
+			return false
+		}
+		if !psr.peekTokenIs(token.COMMA) {
+			break
+		}
+		if fnLit.Variadic {
+			psr.errors = append(psr.errors, "rest parameter must be the last parameter")
+			return false
+		}
 		psr.nextToken()
 		psr.nextToken()
-		ident := &ast.Identifier{Token: psr.curToken, Value: psr.curToken.Literal}
-		identifiers = append(identifiers, ident)
 	}
-	if !psr.expectPeek(token.R_PAREN) {
-		return nil
+	return psr.expectPeek(end)
+}
+
+// parseParameterDefault parses the optional default value of the parameter
+// just added to fnLit. When the parameter list ends with a pipe, the default
+// stops in front of any `|`, `||` or `&&`; such a default has to be wrapped in
+// parentheses.
+func (psr *Parser) parseParameterDefault(fnLit *ast.FunctionLiteral, end token.TokenType) bool {
+	param := fnLit.Parameters[len(fnLit.Parameters)-1]
+
+	if !psr.peekTokenIs(token.ASSIGN) {
+		if len(fnLit.Defaults) > 0 && !fnLit.Variadic {
+			msg := fmt.Sprintf("parameter %s without a default follows parameters with defaults", param.Value)
+			psr.errors = append(psr.errors, msg)
+			return false
+		}
+		return true
+	}
+	if fnLit.Variadic {
+		psr.errors = append(psr.errors, "rest parameter cannot have a default")
+		return false
 	}
-	return identifiers
+	psr.nextToken()
+	psr.nextToken()
+
+	for len(fnLit.Defaults) < len(fnLit.Parameters)-1 {
+		fnLit.Defaults = append(fnLit.Defaults, nil)
+	}
+	precedence := LOWEST
+	if end == token.PIPE {
+		precedence = BIT_OR
+	}
+	fnLit.Defaults = append(fnLit.Defaults, psr.parseExpression(precedence))
+	return true
 }
 
 func (psr *Parser) parseBlockStatement() *ast.BlockStatement {
@@ -326,7 +794,7 @@ func (psr *Parser) parseBlockStatement() *ast.BlockStatement {
 	psr.nextToken()
 
 	for !psr.currentTokenIs(token.R_BRACE) && !psr.currentTokenIs(token.EOF) {
-		stmt := psr.parseStatement()
+		stmt := psr.parseRecoverableStatement()
 		if stmt != nil {
 			block.Statements = append(block.Statements, stmt)
 		}
@@ -338,9 +806,44 @@ func (psr *Parser) parseBlockStatement() *ast.BlockStatement {
 func (psr *Parser) parseCallExpression(function ast.Expression) ast.Expression {
 	expr := &ast.CallExpression{Token: psr.curToken, Function: function}
 	expr.Arguments = psr.parseExpressionList(token.R_PAREN)
+
+	if psr.peekTokenIs(token.L_BRACE) && startsLambdaParameters(psr.lxr.PeekToken().Type) {
+		psr.nextToken()
+		expr.Arguments = append(expr.Arguments, psr.parseTrailingLambda())
+	}
 	return expr
 }
 
+// startsLambdaParameters reports whether a token following `{` opens the
+// parameter list of a trailing lambda. An empty list `||` lexes as a single
+// token.
+func startsLambdaParameters(tokn token.TokenType) bool {
+	return tokn == token.PIPE || tokn == token.OR
+}
+
+// parseTrailingLambda parses the block `{ |x, y| body }` following a call
+// into a function literal, so that `each(arr) { |x| puts(x) }` is the same
+// call as `each(arr, func(x) { puts(x) })`.
+func (psr *Parser) parseTrailingLambda() ast.Expression {
+	fnLit := &ast.FunctionLiteral{Token: token.Token{Type: token.FUNCTION, Literal: "func"}}
+	lbrace := psr.curToken
+
+	psr.nextToken()
+	if psr.currentTokenIs(token.OR) {
+		fnLit.Parameters = []*ast.Identifier{}
+	} else if !psr.parseFunctionParameters(fnLit, token.PIPE) {
+		return nil
+	}
+
+	fnLit.Body = psr.parseBlockStatement()
+	fnLit.Body.Token = lbrace
+	if !psr.currentTokenIs(token.R_BRACE) {
+		psr.peekError(token.R_BRACE)
+		return nil
+	}
+	return fnLit
+}
+
 func (psr *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
 	expr := &ast.IndexExpression{Token: psr.curToken, Left: left}
 
@@ -425,19 +928,23 @@ func registerPrefixParseFunctions(psr *Parser) {
 	psr.registerPrefix(token.IDENT, psr.parseIdentifier)
 
 	psr.registerPrefix(token.STRING, psr.parseStringLiteral)
+	psr.registerPrefix(token.TEMPLATE, psr.parseInterpolatedString)
 	psr.registerPrefix(token.INT, psr.parseIntegerLiteral)
 
 	psr.registerPrefix(token.BANG, psr.parsePrefixExpression)
 	psr.registerPrefix(token.MINUS, psr.parsePrefixExpression)
+	psr.registerPrefix(token.TILDE, psr.parsePrefixExpression)
 
 	psr.registerPrefix(token.TRUE, psr.parseBoolean)
 	psr.registerPrefix(token.FALSE, psr.parseBoolean)
+	psr.registerPrefix(token.NULL, psr.parseNullLiteral)
 
 	psr.registerPrefix(token.L_PAREN, psr.parseGroupedExpression)
 	psr.registerPrefix(token.L_BRACE, psr.parseHashLiteral)
 	psr.registerPrefix(token.L_BRACKET, psr.parseArrayLiteral)
 
 	psr.registerPrefix(token.IF, psr.parseIfExpression)
+	psr.registerPrefix(token.SWITCH, psr.parseSwitchExpression)
 	psr.registerPrefix(token.FUNCTION, psr.parseFunctionLiteral)
 }
 
@@ -448,12 +955,20 @@ func registerInfixParseFunctions(psr *Parser) {
 	psr.registerInfix(token.MINUS, psr.parseInfixExpression)
 	psr.registerInfix(token.SLASH, psr.parseInfixExpression)
 	psr.registerInfix(token.ASTERISK, psr.parseInfixExpression)
+	psr.registerInfix(token.POWER, psr.parseInfixExpression)
 
 	psr.registerInfix(token.EQ, psr.parseInfixExpression)
 	psr.registerInfix(token.NOT_EQ, psr.parseInfixExpression)
 
 	psr.registerInfix(token.LT, psr.parseInfixExpression)
 	psr.registerInfix(token.GT, psr.parseInfixExpression)
+	psr.registerInfix(token.LT_EQ, psr.parseInfixExpression)
+	psr.registerInfix(token.GT_EQ, psr.parseInfixExpression)
+
+	psr.registerInfix(token.AMPERSAND, psr.parseInfixExpression)
+	psr.registerInfix(token.PIPE, psr.parseInfixExpression)
+	psr.registerInfix(token.AND, psr.parseInfixExpression)
+	psr.registerInfix(token.OR, psr.parseInfixExpression)
 
 	psr.registerInfix(token.L_PAREN, psr.parseCallExpression)
 	psr.registerInfix(token.L_BRACKET, psr.parseIndexExpression)
@@ -2,6 +2,7 @@ package parser
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 
 	"comp/ast"
@@ -74,6 +75,373 @@ func testLetStatement(t *testing.T, stmt ast.Statement, name string) bool {
 	return true
 }
 
+func TestConstStatement(t *testing.T) {
+	psr := NewParser(lexer.NewLexer("const pi = 3;"))
+	root := psr.ParseRootStatement()
+	checkParserErrors(t, psr)
+
+	if len(root.Statements) != 1 {
+		t.Fatalf("root.Statements does not contain 1 statements. got=%d", len(root.Statements))
+	}
+	stmt, ok := root.Statements[0].(*ast.LetStatement)
+	if !ok {
+		t.Fatalf("stmt is not *ast.LetStatement. got=%T", root.Statements[0])
+	}
+	if !stmt.IsConstant() {
+		t.Errorf("const statement is not constant")
+	}
+	if stmt.Name.Value != "pi" || !testLiteralExpression(t, stmt.Value, 3) {
+		t.Fatalf("wrong binding. got=%s", stmt.String())
+	}
+	if stmt.String() != "const pi = 3;" {
+		t.Errorf("wrong String(). got=%q", stmt.String())
+	}
+
+	psr = NewParser(lexer.NewLexer("const a, b = 1, 2"))
+	psr.ParseRootStatement()
+	if len(psr.Errors()) == 0 || psr.Errors()[0] != "expected next token to be =, got , instead" {
+		t.Errorf("wrong errors. got=%q", psr.Errors())
+	}
+}
+
+func TestMultiLetStatement(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		names    int
+		values   int
+	}{
+		{"let a, b = 1, 2;", "let a, b = 1, 2;", 2, 2},
+		{"let a, b, c = b, a, [1, 2]", "let a, b, c = b, a, [1, 2];", 3, 3},
+		{"let a, b = f(1, 2)", "let a, b = f(1, 2);", 2, 1},
+		{"let a = 1, 2", "let a = 1, 2;", 1, 2},
+	}
+	for _, tt := range tests {
+		psr := NewParser(lexer.NewLexer(tt.input))
+		root := psr.ParseRootStatement()
+		checkParserErrors(t, psr)
+
+		if len(root.Statements) != 1 {
+			t.Fatalf("root.Statements does not contain 1 statements. got=%d",
+				len(root.Statements))
+		}
+		stmt, ok := root.Statements[0].(*ast.MultiLetStatement)
+		if !ok {
+			t.Fatalf("stmt is not *ast.MultiLetStatement. got=%T", root.Statements[0])
+		}
+		if len(stmt.Names) != tt.names || len(stmt.Values) != tt.values {
+			t.Errorf("wrong counts. want=%d names, %d values, got=%d, %d",
+				tt.names, tt.values, len(stmt.Names), len(stmt.Values))
+		}
+		if stmt.String() != tt.expected {
+			t.Errorf("wrong let statement. want=%q, got=%q", tt.expected, stmt.String())
+		}
+	}
+
+	for _, input := range []string{"let a, = 1, 2", "let a, 1 = 1, 2", "let a b = 1"} {
+		psr := NewParser(lexer.NewLexer(input))
+		psr.ParseRootStatement()
+
+		if len(psr.Errors()) == 0 {
+			t.Errorf("expected parser errors for %q, got none", input)
+		}
+	}
+}
+
+func TestArrayLetStatement(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		names    []string
+		rest     string
+	}{
+		{"let [a, b, c] = arr;", "let [a, b, c] = arr;", []string{"a", "b", "c"}, ""},
+		{"let [head, ...tail] = f(x)", "let [head, ...tail] = f(x);", []string{"head"}, "tail"},
+		{"let [...all] = [1, 2]", "let [...all] = [1, 2];", nil, "all"},
+		{"let [a,] = arr", "let [a] = arr;", []string{"a"}, ""},
+	}
+	for _, tt := range tests {
+		psr := NewParser(lexer.NewLexer(tt.input))
+		root := psr.ParseRootStatement()
+		checkParserErrors(t, psr)
+
+		if len(root.Statements) != 1 {
+			t.Fatalf("root.Statements does not contain 1 statements. got=%d",
+				len(root.Statements))
+		}
+		stmt, ok := root.Statements[0].(*ast.ArrayLetStatement)
+		if !ok {
+			t.Fatalf("stmt is not *ast.ArrayLetStatement. got=%T", root.Statements[0])
+		}
+		if stmt.String() != tt.expected {
+			t.Errorf("wrong let statement. want=%q, got=%q", tt.expected, stmt.String())
+		}
+		var names []string
+		for _, name := range stmt.Names {
+			names = append(names, name.Value)
+		}
+		if strings.Join(names, ",") != strings.Join(tt.names, ",") {
+			t.Errorf("wrong names. want=%v, got=%v", tt.names, names)
+		}
+		if (stmt.Rest == nil) != (tt.rest == "") || stmt.Rest != nil && stmt.Rest.Value != tt.rest {
+			t.Errorf("wrong rest name. want=%q, got=%v", tt.rest, stmt.Rest)
+		}
+	}
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{"let [] = arr", "empty array pattern in let"},
+		{"let [...rest, a] = arr", "expected next token to be ], got , instead"},
+		{"let [a, 1] = arr", "expected next token to be IDENT, got INT instead"},
+		{"let [a] arr", "expected next token to be =, got IDENT instead"},
+	}
+	for _, tt := range errorTests {
+		psr := NewParser(lexer.NewLexer(tt.input))
+		psr.ParseRootStatement()
+
+		if len(psr.Errors()) == 0 || psr.Errors()[0] != tt.expected {
+			t.Errorf("wrong errors for %q. want=%q first, got=%q", tt.input, tt.expected, psr.Errors())
+		}
+	}
+}
+
+func TestHashLetStatement(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		names    []string
+	}{
+		{"let {name, age} = person;", "let {name, age} = person;", []string{"name", "age"}},
+		{`let {a,} = {"a": 1}`, "let {a} = {a:1};", []string{"a"}},
+	}
+	for _, tt := range tests {
+		psr := NewParser(lexer.NewLexer(tt.input))
+		root := psr.ParseRootStatement()
+		checkParserErrors(t, psr)
+
+		if len(root.Statements) != 1 {
+			t.Fatalf("root.Statements does not contain 1 statements. got=%d",
+				len(root.Statements))
+		}
+		stmt, ok := root.Statements[0].(*ast.HashLetStatement)
+		if !ok {
+			t.Fatalf("stmt is not *ast.HashLetStatement. got=%T", root.Statements[0])
+		}
+		if stmt.String() != tt.expected {
+			t.Errorf("wrong let statement. want=%q, got=%q", tt.expected, stmt.String())
+		}
+		var names []string
+		for _, name := range stmt.Names {
+			names = append(names, name.Value)
+		}
+		if strings.Join(names, ",") != strings.Join(tt.names, ",") {
+			t.Errorf("wrong names. want=%v, got=%v", tt.names, names)
+		}
+	}
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{"let {} = person", "empty hash pattern in let"},
+		{`let {"name"} = person`, "expected next token to be IDENT, got STRING instead"},
+		{"let {a b} = person", "expected next token to be }, got IDENT instead"},
+	}
+	for _, tt := range errorTests {
+		psr := NewParser(lexer.NewLexer(tt.input))
+		psr.ParseRootStatement()
+
+		if len(psr.Errors()) == 0 || psr.Errors()[0] != tt.expected {
+			t.Errorf("wrong errors for %q. want=%q first, got=%q", tt.input, tt.expected, psr.Errors())
+		}
+	}
+}
+
+func TestAssignStatement(t *testing.T) {
+	tests := []struct {
+		input              string
+		expectedIdentifier string
+		expectedValue      interface{}
+	}{
+		{"x = 5;", "x", 5},
+		{"y = true", "y", true},
+		{"foobar = y;", "foobar", "y"},
+	}
+	for _, tt := range tests {
+		lxr := lexer.NewLexer(tt.input)
+		psr := NewParser(lxr)
+		root := psr.ParseRootStatement()
+		checkParserErrors(t, psr)
+
+		if len(root.Statements) != 1 {
+			t.Fatalf("root.Statements does not contain 1 statements. got=%d",
+				len(root.Statements))
+		}
+		stmt, ok := root.Statements[0].(*ast.AssignStatement)
+		if !ok {
+			t.Fatalf("stmt is not *ast.AssignStatement. got=%T", root.Statements[0])
+		}
+		if stmt.Name.Value != tt.expectedIdentifier {
+			t.Errorf("stmt.Name.Value not %q. got=%q", tt.expectedIdentifier, stmt.Name.Value)
+		}
+		if !testLiteralExpression(t, stmt.Value, tt.expectedValue) {
+			return
+		}
+	}
+}
+
+func TestForStatement(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			"for (let i = 0; i < 10; i = i + 1) { puts(i); }",
+			"for (let i = 0; (i < 10); i = (i + 1)) puts(i)",
+		},
+		{"for (i = 0; i < 10; i = i + 1) { x }", "for (i = 0; (i < 10); i = (i + 1)) x"},
+		{"for (; x; ) { x }", "for (; x; ) x"},
+		{"for (;;) { }", "for (; ; ) "},
+		{"for (f(); ; g()) { }", "for (f(); ; g()) "},
+		{"for (;;) { break; continue }", "for (; ; ) break;continue;"},
+		{"for (;;) { x };", "for (; ; ) x"},
+	}
+	for _, tt := range tests {
+		lxr := lexer.NewLexer(tt.input)
+		psr := NewParser(lxr)
+		root := psr.ParseRootStatement()
+		checkParserErrors(t, psr)
+
+		if len(root.Statements) != 1 {
+			t.Fatalf("root.Statements does not contain 1 statements. got=%d",
+				len(root.Statements))
+		}
+		stmt, ok := root.Statements[0].(*ast.ForStatement)
+		if !ok {
+			t.Fatalf("stmt is not *ast.ForStatement. got=%T", root.Statements[0])
+		}
+		if stmt.String() != tt.expected {
+			t.Errorf("wrong for statement. want=%q, got=%q", tt.expected, stmt.String())
+		}
+	}
+}
+
+func TestDoWhileStatement(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"do { x = x + 1; } while (x < 10);", "do x = (x + 1); while ((x < 10));"},
+		{"do { } while (true)", "do  while (true);"},
+		{"do { break; continue } while (f())", "do break;continue; while (f());"},
+	}
+	for _, tt := range tests {
+		psr := NewParser(lexer.NewLexer(tt.input))
+		root := psr.ParseRootStatement()
+		checkParserErrors(t, psr)
+
+		if len(root.Statements) != 1 {
+			t.Fatalf("root.Statements does not contain 1 statements. got=%d",
+				len(root.Statements))
+		}
+		stmt, ok := root.Statements[0].(*ast.DoWhileStatement)
+		if !ok {
+			t.Fatalf("stmt is not *ast.DoWhileStatement. got=%T", root.Statements[0])
+		}
+		if stmt.String() != tt.expected {
+			t.Errorf("wrong do/while statement. want=%q, got=%q", tt.expected, stmt.String())
+		}
+	}
+
+	inputs := []string{
+		"do x while (true)",
+		"do { x } (true)",
+		"do { x } while true",
+		"do { x } while (true",
+	}
+	for _, input := range inputs {
+		psr := NewParser(lexer.NewLexer(input))
+		psr.ParseRootStatement()
+
+		if len(psr.Errors()) == 0 {
+			t.Errorf("expected parser errors for %q, got none", input)
+		}
+	}
+}
+
+func TestSwitchExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			`switch (x) { case 1: "one"; case 2: let y = 2; y default: "many" }`,
+			`switch (x) { case 1: one case 2: let y = 2;y default: many }`,
+		},
+		{"switch (f(x)) { default: 0 }", "switch (f(x)) { default: 0 }"},
+		{"switch (x) { }", "switch (x) { }"},
+		{"switch (x) { default: 0 case 1: }", "switch (x) { case 1:  default: 0 }"},
+	}
+	for _, tt := range tests {
+		psr := NewParser(lexer.NewLexer(tt.input))
+		root := psr.ParseRootStatement()
+		checkParserErrors(t, psr)
+
+		if len(root.Statements) != 1 {
+			t.Fatalf("root.Statements does not contain 1 statements. got=%d",
+				len(root.Statements))
+		}
+		stmt, ok := root.Statements[0].(*ast.ExpressionStatement)
+		if !ok {
+			t.Fatalf("stmt is not *ast.ExpressionStatement. got=%T", root.Statements[0])
+		}
+		expr, ok := stmt.Expression.(*ast.SwitchExpression)
+		if !ok {
+			t.Fatalf("expression is not *ast.SwitchExpression. got=%T", stmt.Expression)
+		}
+		if expr.String() != tt.expected {
+			t.Errorf("wrong switch expression. want=%q, got=%q", tt.expected, expr.String())
+		}
+	}
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{"switch x { }", "expected next token to be (, got IDENT instead"},
+		{"switch (x) { case 1 2 }", "expected next token to be :, got INT instead"},
+		{"switch (x) { 1 }", "expected next token to be CASE or DEFAULT, got INT instead"},
+		{"switch (x) { default: 1 default: 2 }", "multiple defaults in switch"},
+	}
+	for _, tt := range errorTests {
+		psr := NewParser(lexer.NewLexer(tt.input))
+		psr.ParseRootStatement()
+
+		if len(psr.Errors()) == 0 || psr.Errors()[0] != tt.expected {
+			t.Errorf("wrong errors for %q. want=%q first, got=%q", tt.input, tt.expected, psr.Errors())
+		}
+	}
+}
+
+func TestForStatementErrors(t *testing.T) {
+	inputs := []string{
+		"for i < 10 { }",
+		"for (let i = 0 i < 10; ) { }",
+		"for (; i < 10 ) { }",
+		"for (;;) x",
+	}
+	for _, input := range inputs {
+		psr := NewParser(lexer.NewLexer(input))
+		psr.ParseRootStatement()
+
+		if len(psr.Errors()) == 0 {
+			t.Errorf("expected parser errors for %q, got none", input)
+		}
+	}
+}
+
 func TestReturnStatement(tst *testing.T) {
 	input := `
 return 5;
@@ -157,6 +525,30 @@ func TestBooleanExpression(t *testing.T) {
 	}
 }
 
+func TestNullLiteralExpression(t *testing.T) {
+	input := `null;`
+
+	lxr := lexer.NewLexer(input)
+	psr := NewParser(lxr)
+	root := psr.ParseRootStatement()
+	checkParserErrors(t, psr)
+
+	if len(root.Statements) != 1 {
+		t.Fatalf("root does not have 1 statement. got=%d", len(root.Statements))
+	}
+	stmt, ok := root.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("root.Statements[0] is not ast.ExpressionStatement. got=%T", root.Statements[0])
+	}
+	null, ok := stmt.Expression.(*ast.NullLiteral)
+	if !ok {
+		t.Fatalf("Expression is not *ast.NullLiteral. got=%T", stmt.Expression)
+	}
+	if null.TokenLiteral() != "null" {
+		t.Errorf("null.TokenLiteral not '%s'. got=%s", "null", null.TokenLiteral())
+	}
+}
+
 func TestIntegerLiteralExpression(t *testing.T) {
 	input := `5;`
 
@@ -202,6 +594,57 @@ func TestStringLiteralExpression(t *testing.T) {
 	}
 }
 
+func TestInterpolatedStringParsing(t *testing.T) {
+	input := `"sum of ${a} and ${b} is ${a + b}"`
+
+	psr := NewParser(lexer.NewLexer(input))
+	root := psr.ParseRootStatement()
+	checkParserErrors(t, psr)
+
+	stmt := root.Statements[0].(*ast.ExpressionStatement)
+	str, ok := stmt.Expression.(*ast.InterpolatedString)
+	if !ok {
+		t.Fatalf("exp not %T. got=%T", &ast.InterpolatedString{}, stmt.Expression)
+	}
+	if len(str.Parts) != 6 {
+		t.Fatalf("str.Parts does not contain 6 parts. got=%d", len(str.Parts))
+	}
+	for i, text := range map[int]string{0: "sum of ", 2: " and ", 4: " is "} {
+		literal, ok := str.Parts[i].(*ast.StringLiteral)
+		if !ok || literal.Value != text {
+			t.Errorf("str.Parts[%d] is not the text %q. got=%s", i, text, str.Parts[i])
+		}
+	}
+	testIdentifier(t, str.Parts[1], "a")
+	testIdentifier(t, str.Parts[3], "b")
+	testInfixExpression(t, str.Parts[5], "a", "+", "b")
+}
+
+func TestInterpolatedStringErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`"${}"`, "empty interpolation in string literal"},
+		{`"${ }"`, "empty interpolation in string literal"},
+		{`"${a b}"`, `unexpected IDENT in interpolation "a b"`},
+		{`"${a; b}"`, `unexpected ; in interpolation "a; b"`},
+		{`"${1 +}"`, "no prefix parse function for EOF found"},
+	}
+	for _, tt := range tests {
+		psr := NewParser(lexer.NewLexer(tt.input))
+		psr.ParseRootStatement()
+
+		errors := psr.Errors()
+		if len(errors) == 0 {
+			t.Fatalf("%s: expected parser errors, got none", tt.input)
+		}
+		if errors[0] != tt.expected {
+			t.Errorf("%s: wrong parser error. want=%q, got=%q", tt.input, tt.expected, errors[0])
+		}
+	}
+}
+
 func TestParsingPrefixExpressions(t *testing.T) {
 	prefixTests := []struct {
 		input        string
@@ -210,6 +653,7 @@ func TestParsingPrefixExpressions(t *testing.T) {
 	}{
 		{"!5", "!", 5},
 		{"-15", "-", 15},
+		{"~15", "~", 15},
 		{"!true", "!", true},
 		{"!false", "!", false},
 	}
@@ -250,14 +694,21 @@ func TestParsingInfixExpressions(t *testing.T) {
 		{"5 + 5;", 5, "+", 5},
 		{"5 - 5;", 5, "-", 5},
 		{"5 * 5;", 5, "*", 5},
+		{"5 ** 5;", 5, "**", 5},
 		{"5 / 5;", 5, "/", 5},
 		{"5 > 5;", 5, ">", 5},
 		{"5 < 5;", 5, "<", 5},
+		{"5 >= 5;", 5, ">=", 5},
+		{"5 <= 5;", 5, "<=", 5},
 		{"5 == 5;", 5, "==", 5},
 		{"5 != 5;", 5, "!=", 5},
 		{"true == true", true, "==", true},
 		{"true != false", true, "!=", false},
 		{"false == false", false, "==", false},
+		{"true & false", true, "&", false},
+		{"true | false", true, "|", false},
+		{"true && false", true, "&&", false},
+		{"true || false", true, "||", false},
 	}
 	for _, it := range infixTests {
 		lxr := lexer.NewLexer(it.input)
@@ -298,6 +749,42 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"-a * b",
 			"((-a) * b)",
 		},
+		{
+			"a || b && c",
+			"(a || (b && c))",
+		},
+		{
+			"a && b || c && d",
+			"((a && b) || (c && d))",
+		},
+		{
+			"a | b & c",
+			"(a | (b & c))",
+		},
+		{
+			"a > 1 & b == c",
+			"((a > 1) & (b == c))",
+		},
+		{
+			"a & b && c | d",
+			"((a & b) && (c | d))",
+		},
+		{
+			"2 ** 3 ** 2",
+			"(2 ** (3 ** 2))",
+		},
+		{
+			"a * b ** c * d",
+			"((a * (b ** c)) * d)",
+		},
+		{
+			"(a ** b) ** c",
+			"((a ** b) ** c)",
+		},
+		{
+			"-a ** b + f(c) ** d[0]",
+			"(((-a) ** b) + (f(c) ** (d[0])))",
+		},
 		{
 			"!-a",
 			"(!(-a))",
@@ -373,6 +860,10 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"5 < 4 != 3 > 4",
 			"((5 < 4) != (3 > 4))",
 		},
+		{
+			"1 + 2 <= 3 == 4 >= 5",
+			"(((1 + 2) <= 3) == (4 >= 5))",
+		},
 		{
 			"3 + 4 * 5 == 3 * 1 + 4 * 5",
 			"((3 + (4 * 5)) == ((3 * 1) + (4 * 5)))",
@@ -503,6 +994,75 @@ func TestIfElseExpression(t *testing.T) {
 	}
 }
 
+func TestElseIfExpression(t *testing.T) {
+	input := `if (x < y) { x } else if (x > y) { y } else { z }`
+
+	lxr := lexer.NewLexer(input)
+	psr := NewParser(lxr)
+	root := psr.ParseRootStatement()
+	checkParserErrors(t, psr)
+
+	if len(root.Statements) != 1 {
+		t.Fatalf("root.Body does not contain %d statements. got=%d\n",
+			1, len(root.Statements))
+	}
+	stmt, ok := root.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("root.Statements[0] is not %T. got=%T", &ast.ExpressionStatement{},
+			root.Statements[0])
+	}
+	exp, ok := stmt.Expression.(*ast.IfExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not %T. got=%T", &ast.IfExpression{}, stmt.Expression)
+	}
+	if !testInfixExpression(t, exp.Condition, "x", "<", "y") {
+		return
+	}
+	if len(exp.Alternative.Statements) != 1 {
+		t.Fatalf("exp.Alternative.Statements does not contain 1 statements. got=%d\n",
+			len(exp.Alternative.Statements))
+	}
+	alternative, ok := exp.Alternative.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("Statements[0] is not %T. got=%T", &ast.ExpressionStatement{},
+			exp.Alternative.Statements[0])
+	}
+	nested, ok := alternative.Expression.(*ast.IfExpression)
+	if !ok {
+		t.Fatalf("alternative is not %T. got=%T", &ast.IfExpression{}, alternative.Expression)
+	}
+	if !testInfixExpression(t, nested.Condition, "x", ">", "y") {
+		return
+	}
+	consequence := nested.Consequence.Statements[0].(*ast.ExpressionStatement)
+	if !testIdentifier(t, consequence.Expression, "y") {
+		return
+	}
+	if nested.Alternative == nil || len(nested.Alternative.Statements) != 1 {
+		t.Fatalf("nested alternative does not contain 1 statement. got=%+v", nested.Alternative)
+	}
+	last := nested.Alternative.Statements[0].(*ast.ExpressionStatement)
+	if !testIdentifier(t, last.Expression, "z") {
+		return
+	}
+
+	braced := `if (x < y) { x } else { if (x > y) { y } else { z } }`
+	bracedRoot := NewParser(lexer.NewLexer(braced)).ParseRootStatement()
+	if root.String() != bracedRoot.String() {
+		t.Errorf("else if does not match its braced form. want=%q, got=%q",
+			bracedRoot.String(), root.String())
+	}
+}
+
+func TestElseIfWithoutConditionIsAnError(t *testing.T) {
+	psr := NewParser(lexer.NewLexer(`if (a) { 1 } else if { 2 }`))
+	psr.ParseRootStatement()
+
+	if len(psr.Errors()) == 0 {
+		t.Fatalf("expected a parser error for a missing else-if condition")
+	}
+}
+
 func TestFunctionLiteralParsing(t *testing.T) {
 	input := `func(x, y) { x + y; }`
 
@@ -572,6 +1132,231 @@ func TestCallExpressionParsing(t *testing.T) {
 	testInfixExpression(t, expr.Arguments[2], 4, "+", 5)
 }
 
+func TestTrailingLambdaParsing(t *testing.T) {
+	input := "each(arr) { |x, y| puts(x); x * y }"
+
+	lxr := lexer.NewLexer(input)
+	psr := NewParser(lxr)
+	root := psr.ParseRootStatement()
+	checkParserErrors(t, psr)
+
+	if len(root.Statements) != 1 {
+		t.Fatalf("root.Statements does not contain %d statements. got=%d\n",
+			1, len(root.Statements))
+	}
+	stmt, ok := root.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("stmt is not *ast.ExpressionStatement. got=%T", root.Statements[0])
+	}
+	expr, ok := stmt.Expression.(*ast.CallExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not *ast.CallExpression. got=%T", stmt.Expression)
+	}
+	if !testIdentifier(t, expr.Function, "each") {
+		return
+	}
+	if len(expr.Arguments) != 2 {
+		t.Fatalf("wrong length of arguments. got=%d", len(expr.Arguments))
+	}
+	testLiteralExpression(t, expr.Arguments[0], "arr")
+
+	lambda, ok := expr.Arguments[1].(*ast.FunctionLiteral)
+	if !ok {
+		t.Fatalf("last argument is not *ast.FunctionLiteral. got=%T", expr.Arguments[1])
+	}
+	if len(lambda.Parameters) != 2 {
+		t.Fatalf("wrong number of lambda parameters. got=%d", len(lambda.Parameters))
+	}
+	testLiteralExpression(t, lambda.Parameters[0], "x")
+	testLiteralExpression(t, lambda.Parameters[1], "y")
+
+	if len(lambda.Body.Statements) != 2 {
+		t.Fatalf("lambda body does not contain 2 statements. got=%d", len(lambda.Body.Statements))
+	}
+	body := lambda.Body.Statements[1].(*ast.ExpressionStatement)
+	testInfixExpression(t, body.Expression, "x", "*", "y")
+
+	desugared := NewParser(lexer.NewLexer("each(arr, func(x, y) { puts(x); x * y })")).ParseRootStatement()
+	if root.String() != desugared.String() {
+		t.Errorf("trailing lambda does not match the desugared call. want=%q, got=%q",
+			desugared.String(), root.String())
+	}
+}
+
+func TestTrailingLambdaVariants(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"run() { || 1 }", "run(func()1)"},
+		{"run() { || a || b }", "run(func()(a || b))"},
+		{"f() { |x| x | 1 }", "f(func(x)(x | 1))"},
+		{"f() { |x = (1 | 2)| x }", "f(func(x = (1 | 2))x)"},
+		{"f() { |x = 1 + 2| x }", "f(func(x = (1 + 2))x)"},
+		{"f(1)(2) { |x| x }", "f(1)(2, func(x)x)"},
+		{"if (ok(x)) { 1 }", "ifok(x) 1"},
+		{"let r = f(a) { |b| b }; r", "let r = f(a, func(b)b);r"},
+	}
+	for _, tt := range tests {
+		psr := NewParser(lexer.NewLexer(tt.input))
+		root := psr.ParseRootStatement()
+		checkParserErrors(t, psr)
+
+		if root.String() != tt.expected {
+			t.Errorf("wrong parse of %q. want=%q, got=%q", tt.input, tt.expected, root.String())
+		}
+	}
+}
+
+func TestVariadicParameterParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		variadic bool
+	}{
+		{"func(a, ...rest) { rest }", "func(a, ...rest)rest", true},
+		{"func(...args) { args }", "func(...args)args", true},
+		{"func(a, b) { a }", "func(a, b)a", false},
+		{"each(xs) { |x, ...more| more }", "each(xs, func(x, ...more)more)", true},
+	}
+	for _, tt := range tests {
+		psr := NewParser(lexer.NewLexer(tt.input))
+		root := psr.ParseRootStatement()
+		checkParserErrors(t, psr)
+
+		if root.String() != tt.expected {
+			t.Errorf("wrong parse of %q. want=%q, got=%q", tt.input, tt.expected, root.String())
+		}
+		var function *ast.FunctionLiteral
+		switch expr := root.Statements[0].(*ast.ExpressionStatement).Expression.(type) {
+		case *ast.FunctionLiteral:
+			function = expr
+		case *ast.CallExpression:
+			function = expr.Arguments[len(expr.Arguments)-1].(*ast.FunctionLiteral)
+		}
+		if function.Variadic != tt.variadic {
+			t.Errorf("%q: function.Variadic wrong. want=%t, got=%t",
+				tt.input, tt.variadic, function.Variadic)
+		}
+	}
+}
+
+func TestDefaultParameterParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		defaults []string
+	}{
+		{"func(x, y = 10) { x + y }", "func(x, y = 10)(x + y)", []string{"", "10"}},
+		{"func(a, b = a + 1) { b }", "func(a, b = (a + 1))b", []string{"", "(a + 1)"}},
+		{"func(a = 1, b = 2) { a }", "func(a = 1, b = 2)a", []string{"1", "2"}},
+		{"func(a = 1, ...rest) { a }", "func(a = 1, ...rest)a", []string{"1"}},
+		{"func(a, b) { a }", "func(a, b)a", nil},
+		{"f() { |x = 3| x }", "f(func(x = 3)x)", []string{"3"}},
+	}
+	for _, tt := range tests {
+		psr := NewParser(lexer.NewLexer(tt.input))
+		root := psr.ParseRootStatement()
+		checkParserErrors(t, psr)
+
+		if root.String() != tt.expected {
+			t.Errorf("wrong parse of %q. want=%q, got=%q", tt.input, tt.expected, root.String())
+		}
+		var function *ast.FunctionLiteral
+		switch expr := root.Statements[0].(*ast.ExpressionStatement).Expression.(type) {
+		case *ast.FunctionLiteral:
+			function = expr
+		case *ast.CallExpression:
+			function = expr.Arguments[len(expr.Arguments)-1].(*ast.FunctionLiteral)
+		}
+		if len(function.Defaults) != len(tt.defaults) {
+			t.Fatalf("%q: wrong number of defaults. want=%d, got=%d",
+				tt.input, len(tt.defaults), len(function.Defaults))
+		}
+		for i, expected := range tt.defaults {
+			def := function.Defaults[i]
+			if expected == "" {
+				if def != nil {
+					t.Errorf("%q: parameter %d should have no default. got=%s", tt.input, i, def)
+				}
+				continue
+			}
+			if def == nil || def.String() != expected {
+				t.Errorf("%q: wrong default for parameter %d. want=%s, got=%v", tt.input, i, expected, def)
+			}
+		}
+	}
+}
+
+func TestDefaultParameterErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"func(a = 1, b) { a }", "parameter b without a default follows parameters with defaults"},
+		{"func(a, ...rest = 1) { a }", "rest parameter cannot have a default"},
+	}
+	for _, tt := range tests {
+		psr := NewParser(lexer.NewLexer(tt.input))
+		psr.ParseRootStatement()
+
+		errors := psr.Errors()
+		if len(errors) == 0 {
+			t.Fatalf("%q: expected parser errors, got none", tt.input)
+		}
+		if errors[0] != tt.expected {
+			t.Errorf("%q: wrong parser error. want=%q, got=%q", tt.input, tt.expected, errors[0])
+		}
+	}
+}
+
+func TestRestParameterMustBeLast(t *testing.T) {
+	psr := NewParser(lexer.NewLexer("func(...rest, a) { a }"))
+	psr.ParseRootStatement()
+
+	errors := psr.Errors()
+	if len(errors) == 0 {
+		t.Fatalf("expected parser errors, got none")
+	}
+	if errors[0] != "rest parameter must be the last parameter" {
+		t.Errorf("wrong parser error. got=%q", errors[0])
+	}
+}
+
+func TestIntegerLiteralOutOfRange(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			"99999999999999999999999",
+			"integer literal out of range: 99999999999999999999999 at line 1, column 1",
+		},
+		{
+			"let a = 1;\nlet b = [1, 9223372036854775808];",
+			"integer literal out of range: 9223372036854775808 at line 2, column 13",
+		},
+	}
+	for _, tt := range tests {
+		psr := NewParser(lexer.NewLexer(tt.input))
+		psr.ParseRootStatement()
+
+		errors := psr.Errors()
+		if len(errors) == 0 {
+			t.Fatalf("%q: expected parser errors, got none", tt.input)
+		}
+		if errors[0] != tt.expected {
+			t.Errorf("%q: wrong parser error. want=%q, got=%q", tt.input, tt.expected, errors[0])
+		}
+	}
+
+	// the largest int64 still fits
+	psr := NewParser(lexer.NewLexer("9223372036854775807"))
+	root := psr.ParseRootStatement()
+	checkParserErrors(t, psr)
+	testIntegerLiteral(t, root.Statements[0].(*ast.ExpressionStatement).Expression, 9223372036854775807)
+}
+
 func TestParsingArrayLiteral(t *testing.T) {
 	input := "[1, 2 * 2, 3 + 3]"
 
@@ -820,3 +1605,42 @@ func testIntegerLiteral(t *testing.T, il ast.Expression, value int64) bool {
 	}
 	return true
 }
+
+func TestRecoveryReportsEveryBrokenStatement(t *testing.T) {
+	input := `
+let = 1;
+let x 5;
+let y = 10;
+if (y) { let z = ; z }
+puts(y);
+`
+	psr := NewParser(lexer.NewLexer(input))
+	psr.EnableRecovery()
+	root := psr.ParseRootStatement()
+
+	expected := []string{
+		"expected next token to be IDENT, got = instead",
+		"expected next token to be =, got INT instead",
+		"no prefix parse function for ; found",
+	}
+	errors := psr.Errors()
+	if len(errors) != len(expected) {
+		t.Fatalf("wrong number of parser errors. want=%d, got=%d: %q",
+			len(expected), len(errors), errors)
+	}
+	for i, want := range expected {
+		if errors[i] != want {
+			t.Errorf("errors[%d] wrong. want=%q, got=%q", i, want, errors[i])
+		}
+	}
+
+	// the statements around the broken ones still parse
+	if len(root.Statements) != 3 {
+		t.Fatalf("root.Statements does not contain 3 statements. got=%d", len(root.Statements))
+	}
+	testLetStatement(t, root.Statements[0], "y")
+	ifExpr := root.Statements[1].(*ast.ExpressionStatement).Expression.(*ast.IfExpression)
+	if len(ifExpr.Consequence.Statements) != 1 {
+		t.Errorf("consequence does not contain 1 statement. got=%d", len(ifExpr.Consequence.Statements))
+	}
+}
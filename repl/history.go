@@ -0,0 +1,69 @@
+package repl
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+)
+
+// HISTORY_DIRECTIVE lists the lines entered so far, oldest first.
+const HISTORY_DIRECTIVE = ":history"
+
+// historyLimit is how many of the most recent lines Save keeps.
+const historyLimit = 1000
+
+// History records the lines entered into a REPL, including the ones loaded
+// from earlier sessions.
+type History struct {
+	lines []string
+}
+
+// LoadHistory reads the history saved at path. A file that does not exist
+// yet results in an empty history.
+func LoadHistory(path string) (*History, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &History{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var lines []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return &History{lines: lines}, nil
+}
+
+// Save writes the most recent lines of the history to path, one per line.
+func (h *History) Save(path string) error {
+	lines := h.lines[max(0, len(h.lines)-historyLimit):]
+	if len(lines) == 0 {
+		return os.WriteFile(path, nil, 0o600)
+	}
+	return os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o600)
+}
+
+// Add records line unless it is blank.
+func (h *History) Add(line string) {
+	if strings.TrimSpace(line) != "" {
+		h.lines = append(h.lines, line)
+	}
+}
+
+// Lines returns the recorded lines, oldest first.
+func (h *History) Lines() []string {
+	return h.lines
+}
+
+// print writes the recorded lines numbered from 1.
+func (h *History) print(output io.Writer) {
+	for i, line := range h.lines {
+		_, _ = fmt.Fprintf(output, "%d  %s\n", i+1, line)
+	}
+}
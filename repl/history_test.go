@@ -0,0 +1,62 @@
+package repl
+
+import (
+	"path/filepath"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+func TestHistorySaveAndLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+
+	history, err := LoadHistory(path)
+	if err != nil {
+		t.Fatalf("loading a missing history failed: %s", err)
+	}
+	if len(history.Lines()) != 0 {
+		t.Fatalf("expected an empty history. got=%q", history.Lines())
+	}
+	history.Add("let a = 1;")
+	history.Add("   ")
+	history.Add("a + 1")
+	if err := history.Save(path); err != nil {
+		t.Fatalf("Save failed: %s", err)
+	}
+
+	loaded, err := LoadHistory(path)
+	if err != nil {
+		t.Fatalf("LoadHistory failed: %s", err)
+	}
+	expected := []string{"let a = 1;", "a + 1"}
+	if !slices.Equal(loaded.Lines(), expected) {
+		t.Errorf("wrong lines. want=%q, got=%q", expected, loaded.Lines())
+	}
+}
+
+func TestHistorySaveKeepsTheMostRecentLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+
+	history := &History{}
+	for i := range historyLimit + 5 {
+		history.Add(strconv.Itoa(i))
+	}
+	if err := history.Save(path); err != nil {
+		t.Fatalf("Save failed: %s", err)
+	}
+	loaded, err := LoadHistory(path)
+	if err != nil {
+		t.Fatalf("LoadHistory failed: %s", err)
+	}
+	lines := loaded.Lines()
+	if len(lines) != historyLimit || lines[0] != "5" || lines[len(lines)-1] != strconv.Itoa(historyLimit+4) {
+		t.Errorf("wrong lines kept. got %d lines from %q to %q", len(lines), lines[0], lines[len(lines)-1])
+	}
+}
+
+func TestLoadHistoryError(t *testing.T) {
+	// a directory cannot be read as a history file
+	if _, err := LoadHistory(t.TempDir()); err == nil {
+		t.Errorf("expected an error")
+	}
+}
@@ -2,28 +2,53 @@ package repl
 
 import (
 	"bufio"
+	"comp/code"
 	"comp/compiler"
+	"comp/evaluator"
 	"comp/object"
 	"comp/parser"
 	"comp/vm"
 	"fmt"
 	"io"
+	"os"
+	"strings"
 
 	"comp/lexer"
 )
 
 const PROMPT = ">>"
 
+// ENV_DIRECTIVE lists the globals defined in the VM session, or the bindings of
+// the evaluator's environment.
+const ENV_DIRECTIVE = ":env"
+
+// BYTECODE_DIRECTIVE dumps the bytecode compiled during the VM session so far.
+const BYTECODE_DIRECTIVE = ":bytecode"
+
+// LOAD_DIRECTIVE runs the file named after it in the VM session, as if its
+// contents had been entered as a single line.
+const LOAD_DIRECTIVE = ":load"
+
+// prettyThreshold is the length of a result's single-line Inspect output above
+// which the REPL switches to the indented, multi-line rendering.
+const prettyThreshold = 80
+
 // TODO: add file support with extension .sc?
 
-func Start(input io.Reader, output io.Writer) {
+// Start runs the REPL on the compiler and VM. Every line entered is added to
+// history; a nil history keeps the lines for this session only.
+func Start(input io.Reader, output io.Writer, history *History) {
 	scanner := bufio.NewScanner(input)
-	// env := object.NewEnvironment()
+	if history == nil {
+		history = &History{}
+	}
 
 	var (
-		constants   []object.Object
-		globals     = make([]object.Object, vm.GlobalsSize)
-		symbolTable = compiler.NewSymbolTable()
+		constants []object.Object
+		globals   = make([]object.Object, vm.GlobalsSize)
+		cmp       = compiler.NewCompiler()
+		session   []compiledLine
+		builtins  = object.NewBuiltins(output)
 	)
 	for {
 		fmt.Print(PROMPT)
@@ -33,21 +58,39 @@ func Start(input io.Reader, output io.Writer) {
 		}
 		scanned := scanner.Text()
 
-		lxr := lexer.NewLexer(scanned)
+		if strings.TrimSpace(scanned) == HISTORY_DIRECTIVE {
+			history.print(output)
+			continue
+		}
+		history.Add(scanned)
+
+		if strings.TrimSpace(scanned) == BYTECODE_DIRECTIVE {
+			printSession(output, constants, session)
+			continue
+		}
+		if strings.TrimSpace(scanned) == ENV_DIRECTIVE {
+			printGlobals(output, cmp.ByteCode().GlobalNames, globals)
+			continue
+		}
+		source := scanned
+		if path, ok := loadPath(scanned); ok {
+			contents, err := os.ReadFile(path)
+			if err != nil {
+				_, _ = fmt.Fprintf(output, "Loading failed:\n %s\n", err)
+				continue
+			}
+			source = string(contents)
+		}
+		lxr := lexer.NewLexer(source)
 		psr := parser.NewParser(lxr)
+		psr.EnableRecovery()
 
 		root := psr.ParseRootStatement()
 		if len(psr.Errors()) != 0 {
 			printParserErrors(output, psr.Errors())
 			continue
 		}
-		/*		evaluated := evaluator.Evaluate(root, env)
-				if evaluated != nil {
-					_, _ = io.WriteString(output, evaluated.Inspect())
-					_, _ = io.WriteString(output, "\n")
-				}
-		*/
-		cmp := compiler.NewWithState(symbolTable, constants)
+		cmp.Reset()
 		err := cmp.Compile(root)
 		if err != nil {
 			_, _ = fmt.Fprintf(output, "Compilation failed:\n %s\n", err)
@@ -55,8 +98,9 @@ func Start(input io.Reader, output io.Writer) {
 		}
 		bytecode := cmp.ByteCode()
 		constants = bytecode.Constants
+		session = append(session, compiledLine{scanned, bytecode.Instructions})
 
-		vrm := vm.NewVMWithGlobalsStore(bytecode, globals)
+		vrm := vm.NewVM(bytecode, vm.WithGlobals(globals), vm.WithBuiltins(builtins))
 
 		err = vrm.RunVM()
 		if err != nil {
@@ -64,12 +108,122 @@ func Start(input io.Reader, output io.Writer) {
 			continue
 		}
 		stackTop := vrm.LastPoppedStackElement()
-
-		_, _ = io.WriteString(output, stackTop.Inspect())
+		if stackTop == nil || stackTop == vm.Null {
+			continue
+		}
+		_, _ = io.WriteString(output, inspect(stackTop))
 		_, _ = io.WriteString(output, "\n")
 	}
 }
 
+// StartEvaluator runs the REPL on the tree-walking evaluator instead of the
+// compiler and VM, keeping one environment for the whole session. Next to
+// Monkey code it understands the `:env` directive. History is kept as in
+// Start.
+func StartEvaluator(input io.Reader, output io.Writer, history *History) {
+	scanner := bufio.NewScanner(input)
+	env := object.NewEnvironment()
+	env.SetBuiltins(object.NewBuiltins(output))
+	if history == nil {
+		history = &History{}
+	}
+
+	for {
+		_, _ = io.WriteString(output, PROMPT)
+		ok := scanner.Scan()
+		if !ok {
+			return
+		}
+		scanned := scanner.Text()
+
+		if strings.TrimSpace(scanned) == HISTORY_DIRECTIVE {
+			history.print(output)
+			continue
+		}
+		history.Add(scanned)
+
+		if strings.TrimSpace(scanned) == ENV_DIRECTIVE {
+			printEnvironment(output, env)
+			continue
+		}
+		lxr := lexer.NewLexer(scanned)
+		psr := parser.NewParser(lxr)
+		psr.EnableRecovery()
+
+		root := psr.ParseRootStatement()
+		if len(psr.Errors()) != 0 {
+			printParserErrors(output, psr.Errors())
+			continue
+		}
+		evaluated := evaluator.Evaluate(root, env)
+		if evaluated != nil && evaluated != evaluator.NULL {
+			_, _ = io.WriteString(output, inspect(evaluated))
+			_, _ = io.WriteString(output, "\n")
+		}
+	}
+}
+
+// loadPath returns the path of a LOAD_DIRECTIVE line.
+func loadPath(line string) (string, bool) {
+	rest, ok := strings.CutPrefix(strings.TrimSpace(line), LOAD_DIRECTIVE)
+	if !ok || (rest != "" && rest[0] != ' ' && rest[0] != '\t') {
+		return "", false
+	}
+	return strings.TrimSpace(rest), true
+}
+
+// compiledLine is a line of a VM session together with the instructions it
+// compiled to. Every line runs as a program of its own, only the constants
+// and the globals carry over to the next one.
+type compiledLine struct {
+	source       string
+	instructions code.Instructions
+}
+
+// printSession writes the constant pool shared by the session, followed by
+// the instructions of every line compiled so far.
+func printSession(output io.Writer, constants []object.Object, session []compiledLine) {
+	_, _ = io.WriteString(output, compiler.DisassembleConstants(constants))
+	for _, line := range session {
+		_, _ = fmt.Fprintf(output, "instructions of %q:\n", line.source)
+		_, _ = io.WriteString(output, line.instructions.String())
+	}
+}
+
+// printEnvironment writes one `name = value` line per binding of env.
+func printEnvironment(output io.Writer, env *object.Environment) {
+	for _, name := range env.Names() {
+		value, _ := env.Get(name)
+		_, _ = fmt.Fprintf(output, "%s = %s\n", name, value.Inspect())
+	}
+}
+
+// printGlobals writes one `index: name = value` line per global defined in
+// the VM session. The value of a global whose definition has not run, because
+// its line failed, is left empty.
+func printGlobals(output io.Writer, names []string, globals []object.Object) {
+	for index, name := range names {
+		if name == "" {
+			continue
+		}
+		if globals[index] == nil {
+			_, _ = fmt.Fprintf(output, "%d: %s =\n", index, name)
+			continue
+		}
+		_, _ = fmt.Fprintf(output, "%d: %s = %s\n", index, name, globals[index].Inspect())
+	}
+}
+
+// inspect renders the result of a REPL line, pretty-printing it when it is
+// too long to read comfortably on a single line.
+func inspect(ob object.Object) string {
+	str := ob.Inspect()
+	if len(str) > prettyThreshold {
+		return object.PrettyInspect(ob, 2)
+	}
+	return str
+}
+
 func printParserErrors(output io.Writer, errors []string) {
 	errMsg := fmt.Sprintf("%sParser ERROR::%s\n", object.COLOR_RED, object.COLOR_RESET)
 	_, _ = io.WriteString(output, errMsg)
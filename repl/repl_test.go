@@ -0,0 +1,210 @@
+package repl
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEvaluatorEnvDirective(t *testing.T) {
+	input := strings.Join([]string{
+		`let answer = 6 * 7;`,
+		`let name = "monkey";`,
+		`answer`,
+		`:env`,
+	}, "\n")
+
+	var output bytes.Buffer
+	StartEvaluator(strings.NewReader(input), &output, nil)
+
+	lines := strings.Split(strings.TrimSuffix(output.String(), PROMPT), "\n")
+	expected := []string{
+		PROMPT + PROMPT + PROMPT + "42",
+		PROMPT + "answer = 42",
+		"name = monkey",
+	}
+	if len(lines) != len(expected)+1 || lines[len(lines)-1] != "" {
+		t.Fatalf("wrong output. got=%q", output.String())
+	}
+	for i, line := range expected {
+		if lines[i] != line {
+			t.Errorf("wrong line %d. want=%q, got=%q", i, line, lines[i])
+		}
+	}
+}
+
+func TestEnvDirective(t *testing.T) {
+	input := strings.Join([]string{
+		`let answer = 6 * 7;`,
+		`let name = "monkey";`,
+		`let broken = 1 / 0;`,
+		`let answer = answer + 1;`,
+		`:env`,
+	}, "\n")
+
+	var output bytes.Buffer
+	Start(strings.NewReader(input), &output, nil)
+
+	// the redefined answer lives in a new slot, the old one is no longer
+	// listed; broken was never assigned
+	expected := "1: name = monkey\n2: broken =\n3: answer = 43\n"
+	if !strings.HasSuffix(output.String(), expected) {
+		t.Errorf("wrong :env listing. want=%q, got=%q", expected, output.String())
+	}
+}
+
+func TestEvaluatorKeepsEnvironment(t *testing.T) {
+	input := "let add = func(a, b) { a + b };\nadd(1, 2)\n"
+
+	var output bytes.Buffer
+	StartEvaluator(strings.NewReader(input), &output, nil)
+
+	if !strings.Contains(output.String(), "3\n") {
+		t.Errorf("expected the second line to see the first's binding. got=%q", output.String())
+	}
+}
+
+func TestNullResultsAreNotEchoed(t *testing.T) {
+	input := "if (false) { 1 }\nputs(5)\nnull\nfor (let i = 0; i < 2; i = i + 1) { }\n1 + 1\n"
+
+	var output bytes.Buffer
+	Start(strings.NewReader(input), &output, nil)
+	// puts prints 5 and then the REPL echoes it, as puts returns its argument
+	if output.String() != "5\n5\n2\n" {
+		t.Errorf("wrong VM REPL output. want=%q, got=%q", "5\n5\n2\n", output.String())
+	}
+
+	output.Reset()
+	StartEvaluator(strings.NewReader(input), &output, nil)
+	expected := PROMPT + PROMPT + "5\n5\n" + PROMPT + PROMPT + PROMPT + "2\n" + PROMPT
+	if output.String() != expected {
+		t.Errorf("wrong evaluator REPL output. want=%q, got=%q", expected, output.String())
+	}
+}
+
+func TestBytecodeDirective(t *testing.T) {
+	input := strings.Join([]string{
+		`let add = func(a, b) { a + b };`,
+		`let twice = func(x) { add(x, x) };`,
+		`twice(21)`,
+		`:bytecode`,
+	}, "\n")
+
+	var output bytes.Buffer
+	Start(strings.NewReader(input), &output, nil)
+
+	expected := `constants:
+0000 func params=2 locals=2
+    0000 OpGetLocal 0
+    0002 OpGetLocal 1
+    0004 OpAdd
+    0005 OpReturnValue
+0001 func params=1 locals=1
+    0000 OpGetGlobal 0
+    0003 OpGetLocal 0
+    0005 OpGetLocal 0
+    0007 OpCall 2
+    0009 OpReturnValue
+0002 INTEGER 21
+instructions of "let add = func(a, b) { a + b };":
+0000 OpConstant 0
+0003 OpSetGlobal 0
+instructions of "let twice = func(x) { add(x, x) };":
+0000 OpConstant 1
+0003 OpSetGlobal 1
+instructions of "twice(21)":
+0000 OpGetGlobal 1
+0003 OpConstant 2
+0006 OpCall 1
+0008 OpPop
+`
+	_, dump, ok := strings.Cut(output.String(), "42\n")
+	if !ok {
+		t.Fatalf("missing the result of twice(21). got=%q", output.String())
+	}
+	if dump != expected {
+		t.Errorf("wrong :bytecode output.\nwant:\n%s\ngot:\n%s", expected, dump)
+	}
+}
+
+func TestLoadDirective(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "double.sc")
+	if err := os.WriteFile(path, []byte("let double = func(x) { x * 2 };\nlet ten = 10;\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	input := strings.Join([]string{
+		LOAD_DIRECTIVE + " " + path,
+		`double(21)`,
+		`double(ten)`,
+		`:bytecode`,
+	}, "\n")
+
+	var output bytes.Buffer
+	Start(strings.NewReader(input), &output, nil)
+
+	if !strings.Contains(output.String(), "42\n20\n") {
+		t.Errorf("expected later lines to see the loaded definitions. got=%q", output.String())
+	}
+	if label := `instructions of "` + LOAD_DIRECTIVE + " " + path + `":`; !strings.Contains(output.String(), label) {
+		t.Errorf("expected the load to be listed as %q. got=%q", label, output.String())
+	}
+}
+
+func TestLoadDirectiveErrors(t *testing.T) {
+	dir := t.TempDir()
+	broken := filepath.Join(dir, "broken.sc")
+	if err := os.WriteFile(broken, []byte("let = 1;\nlet x 5;"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	input := strings.Join([]string{
+		LOAD_DIRECTIVE + " " + filepath.Join(dir, "missing.sc"),
+		LOAD_DIRECTIVE + " " + broken,
+		`1 + 1`,
+	}, "\n")
+
+	var output bytes.Buffer
+	Start(strings.NewReader(input), &output, nil)
+
+	out := output.String()
+	if !strings.Contains(out, "Loading failed:") {
+		t.Errorf("expected the missing file to be reported. got=%q", out)
+	}
+	if !strings.Contains(out, "Parser ERROR::") {
+		t.Errorf("expected the broken file's parser errors to be reported. got=%q", out)
+	}
+	// both broken statements, without what follows from the first error
+	if !strings.Contains(out, "got INT instead") || strings.Contains(out, "no prefix parse function") {
+		t.Errorf("expected the errors of every broken statement only. got=%q", out)
+	}
+	if !strings.HasSuffix(out, "2\n") {
+		t.Errorf("expected the session to go on after failed loads. got=%q", out)
+	}
+}
+
+func TestHistoryDirective(t *testing.T) {
+	input := strings.Join([]string{
+		`let a = 1;`,
+		``,
+		`a + 1`,
+		`:history`,
+	}, "\n")
+	expected := "1  let a = 1;\n2  a + 1\n"
+
+	var output bytes.Buffer
+	history := &History{lines: []string{"puts(0)"}}
+	Start(strings.NewReader(input), &output, history)
+	if !strings.HasSuffix(output.String(), "1  puts(0)\n2  let a = 1;\n3  a + 1\n") {
+		t.Errorf("wrong VM REPL history. got=%q", output.String())
+	}
+	if len(history.Lines()) != 3 {
+		t.Errorf("the :history line itself should not be recorded. got=%q", history.Lines())
+	}
+
+	output.Reset()
+	StartEvaluator(strings.NewReader(input), &output, nil)
+	if !strings.HasSuffix(output.String(), PROMPT+expected+PROMPT) {
+		t.Errorf("wrong evaluator REPL history. got=%q", output.String())
+	}
+}
@@ -5,6 +5,11 @@ type TokenType string
 type Token struct {
 	Type    TokenType
 	Literal string
+
+	// Line and Column locate the first character of the token in the
+	// source, both counting from 1. Column counts bytes.
+	Line   int
+	Column int
 }
 
 const (
@@ -13,9 +18,10 @@ const (
 
 	// Identifiers and literals
 
-	IDENT  = "IDENT" // add, foobar, x, y...
-	INT    = "INT"   // 12345...
-	STRING = "STRING"
+	IDENT    = "IDENT" // add, foobar, x, y...
+	INT      = "INT"   // 12345...
+	STRING   = "STRING"
+	TEMPLATE = "TEMPLATE" // a string with ${...} interpolations
 
 	// Operators
 
@@ -23,20 +29,30 @@ const (
 	PLUS     = "+"
 	MINUS    = "-"
 	BANG     = "!"
+	TILDE    = "~"
 	ASTERISK = "*"
 	SLASH    = "/"
+	POWER    = "**"
 
 	EQ     = "=="
 	NOT_EQ = "!="
 
-	LT = "<"
-	GT = ">"
+	LT    = "<"
+	GT    = ">"
+	LT_EQ = "<="
+	GT_EQ = ">="
+
+	AMPERSAND = "&"
+	AND       = "&&"
+	OR        = "||"
 
 	// Delimiters
 
 	COMMA     = ","
 	SEMICOLON = ";"
 	COLON     = ":"
+	PIPE      = "|" // also the bitwise or operator
+	ELLIPSIS  = "..."
 
 	L_PAREN   = "("
 	R_PAREN   = ")"
@@ -49,21 +65,41 @@ const (
 
 	FUNCTION = "FUNCTION"
 	LET      = "LET"
+	CONST    = "CONST"
 	TRUE     = "TRUE"
 	FALSE    = "FALSE"
 	IF       = "IF"
 	ELSE     = "ELSE"
 	RETURN   = "RETURN"
+	NULL     = "NULL"
+	FOR      = "FOR"
+	BREAK    = "BREAK"
+	CONTINUE = "CONTINUE"
+	DO       = "DO"
+	WHILE    = "WHILE"
+	SWITCH   = "SWITCH"
+	CASE     = "CASE"
+	DEFAULT  = "DEFAULT"
 )
 
 var keywords = map[string]TokenType{
-	"func":   FUNCTION,
-	"let":    LET,
-	"true":   TRUE,
-	"false":  FALSE,
-	"if":     IF,
-	"else":   ELSE,
-	"return": RETURN,
+	"func":     FUNCTION,
+	"let":      LET,
+	"const":    CONST,
+	"true":     TRUE,
+	"false":    FALSE,
+	"if":       IF,
+	"else":     ELSE,
+	"return":   RETURN,
+	"null":     NULL,
+	"for":      FOR,
+	"break":    BREAK,
+	"continue": CONTINUE,
+	"do":       DO,
+	"while":    WHILE,
+	"switch":   SWITCH,
+	"case":     CASE,
+	"default":  DEFAULT,
 }
 
 func LookupIdent(ident string) TokenType {
@@ -0,0 +1,79 @@
+package vm
+
+import (
+	"comp/code"
+	"comp/object"
+)
+
+// Step executes exactly one instruction of the program, which for a call
+// means entering the function and for a return leaving it, and reports
+// whether the program is done. Once done, Step does nothing. An error stops
+// the program, so done is true whenever err is not nil.
+func (vm *VM) Step() (done bool, err error) {
+	if vm.finished(0) {
+		return true, nil
+	}
+	if err := vm.step(); err != nil {
+		return true, err
+	}
+	return vm.finished(0), nil
+}
+
+// IP returns the offset of the instruction Step executes next within the
+// instructions of the current frame, which are those of the function being
+// called or of the program itself. It equals the length of the instructions
+// once the program is done.
+func (vm *VM) IP() int {
+	return vm.currentFrame().ip + 1
+}
+
+// CurrentOpcode returns the opcode of the instruction Step executes next, and
+// false if the program is done.
+func (vm *VM) CurrentOpcode() (code.Opcode, bool) {
+	if vm.finished(0) {
+		return 0, false
+	}
+	return code.Opcode(vm.currentFrame().Instructions()[vm.IP()]), true
+}
+
+// StackTop returns the top n elements of the stack, or all of them if there
+// are fewer, in stack order: the top of the stack comes last.
+func (vm *VM) StackTop(n int) []object.Object {
+	n = max(0, min(n, vm.sp))
+	top := make([]object.Object, n)
+	copy(top, vm.stack[vm.sp-n:vm.sp])
+	return top
+}
+
+// SetBreakpoint makes Continue stop before the instruction at offset. The
+// offset is within the instructions of whichever frame is current, so a
+// breakpoint set at the offset of an instruction in a function is hit on
+// every call to it, as well as by any other function with an instruction at
+// that offset.
+func (vm *VM) SetBreakpoint(offset int) {
+	if vm.breakpoints == nil {
+		vm.breakpoints = make(map[int]bool)
+	}
+	vm.breakpoints[offset] = true
+}
+
+// ClearBreakpoint removes the breakpoint at offset, if any.
+func (vm *VM) ClearBreakpoint(offset int) {
+	delete(vm.breakpoints, offset)
+}
+
+// Continue runs the program until the instruction Step executes next is at a
+// breakpoint, or the program is done, and returns IP at that point. It always
+// executes at least one instruction, so that continuing from a breakpoint
+// moves past it.
+func (vm *VM) Continue() (int, error) {
+	for {
+		done, err := vm.Step()
+		if err != nil {
+			return vm.IP(), err
+		}
+		if done || vm.breakpoints[vm.IP()] {
+			return vm.IP(), nil
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package vm
+
+import (
+	"comp/code"
+	"comp/compiler"
+	"comp/object"
+	"reflect"
+	"testing"
+)
+
+func TestStep(t *testing.T) {
+	input := `let add = func(a, b) { a + b }; add(1, 2)`
+
+	// each step: the instruction about to run and the stack right after it
+	steps := []struct {
+		ip    int
+		op    code.Opcode
+		stack []string
+	}{
+		{0, code.OpConstant, []string{"fn"}},
+		{3, code.OpSetGlobal, []string{}},
+		{6, code.OpGetGlobal, []string{"fn"}},
+		{9, code.OpConstant, []string{"fn", "1"}},
+		{12, code.OpConstant, []string{"fn", "1", "2"}},
+		{15, code.OpCall, []string{"fn", "1", "2"}},
+		// inside add, offsets are within its instructions
+		{0, code.OpGetLocal, []string{"fn", "1", "2", "1"}},
+		{2, code.OpGetLocal, []string{"fn", "1", "2", "1", "2"}},
+		{4, code.OpAdd, []string{"fn", "1", "2", "3"}},
+		{5, code.OpReturnValue, []string{"3"}},
+		{17, code.OpPop, []string{}},
+	}
+
+	vm := newStepVM(t, input)
+	for i, step := range steps {
+		op, ok := vm.CurrentOpcode()
+		if !ok {
+			t.Fatalf("step %d: program done early", i)
+		}
+		if op != step.op || vm.IP() != step.ip {
+			t.Fatalf("step %d: wrong next instruction. want=%d at %d, got=%d at %d",
+				i, step.op, step.ip, op, vm.IP())
+		}
+		done, err := vm.Step()
+		if err != nil {
+			t.Fatalf("step %d: vm error: %s", i, err)
+		}
+		if done != (i == len(steps)-1) {
+			t.Fatalf("step %d: wrong done. got=%t", i, done)
+		}
+		if stack := inspectStack(vm.StackTop(StackSize)); !reflect.DeepEqual(stack, step.stack) {
+			t.Fatalf("step %d: wrong stack. want=%v, got=%v", i, step.stack, stack)
+		}
+	}
+	if _, ok := vm.CurrentOpcode(); ok {
+		t.Errorf("expected no next instruction once done")
+	}
+	if done, err := vm.Step(); !done || err != nil {
+		t.Errorf("expected Step to do nothing once done. got=(%t, %v)", done, err)
+	}
+	testExpectedObject(t, 3, vm.LastPoppedStackElement())
+}
+
+func TestStepStopsOnError(t *testing.T) {
+	vm := newStepVM(t, `1 / 0; 2`)
+
+	for range 2 {
+		if done, err := vm.Step(); done || err != nil {
+			t.Fatalf("unexpected stop before the division. got=(%t, %v)", done, err)
+		}
+	}
+	done, err := vm.Step()
+	if !done || err == nil {
+		t.Fatalf("expected the division to stop the program. got=(%t, %v)", done, err)
+	}
+}
+
+func TestStackTop(t *testing.T) {
+	vm := newStepVM(t, `[1, 2, 3]`)
+	for range 3 {
+		if _, err := vm.Step(); err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+	}
+
+	tests := []struct {
+		n        int
+		expected []string
+	}{
+		{0, []string{}},
+		{2, []string{"2", "3"}},
+		{5, []string{"1", "2", "3"}},
+		{-1, []string{}},
+	}
+	for _, tt := range tests {
+		if top := inspectStack(vm.StackTop(tt.n)); !reflect.DeepEqual(top, tt.expected) {
+			t.Errorf("StackTop(%d): want=%v, got=%v", tt.n, tt.expected, top)
+		}
+	}
+}
+
+func TestBreakpoints(t *testing.T) {
+	vm := newStepVM(t, `let x = 1; let y = 2; x + y`)
+	vm.SetBreakpoint(18)
+
+	offset, err := vm.Continue()
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	if op, _ := vm.CurrentOpcode(); offset != 18 || op != code.OpAdd {
+		t.Fatalf("wrong stop. want=OpAdd at 18, got=%d at %d", op, offset)
+	}
+	if operands := inspectStack(vm.StackTop(2)); !reflect.DeepEqual(operands, []string{"1", "2"}) {
+		t.Fatalf("wrong operands. got=%v", operands)
+	}
+
+	offset, err = vm.Continue()
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	if _, ok := vm.CurrentOpcode(); ok || offset != 20 {
+		t.Fatalf("expected the program to run to its end at 20. got=%d", offset)
+	}
+	testExpectedObject(t, 3, vm.LastPoppedStackElement())
+}
+
+func TestBreakpointsInFunctions(t *testing.T) {
+	vm := newStepVM(t, `let add = func(a, b) { a + b }; add(1, 2) + add(3, 4)`)
+	// OpAdd in add; in the program, offset 4 is inside an instruction
+	vm.SetBreakpoint(4)
+
+	for _, expected := range [][]string{{"1", "2"}, {"3", "4"}} {
+		offset, err := vm.Continue()
+		if err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+		if op, _ := vm.CurrentOpcode(); offset != 4 || op != code.OpAdd {
+			t.Fatalf("wrong stop. want=OpAdd at 4, got=%d at %d", op, offset)
+		}
+		if operands := inspectStack(vm.StackTop(2)); !reflect.DeepEqual(operands, expected) {
+			t.Fatalf("wrong operands. want=%v, got=%v", expected, operands)
+		}
+	}
+
+	vm.ClearBreakpoint(4)
+	if _, err := vm.Continue(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	if _, ok := vm.CurrentOpcode(); ok {
+		t.Fatalf("expected the program to run to its end")
+	}
+	testExpectedObject(t, 10, vm.LastPoppedStackElement())
+}
+
+func newStepVM(t *testing.T, input string) *VM {
+	t.Helper()
+	comp := compiler.NewCompiler()
+	if err := comp.Compile(parse(input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	return NewVM(comp.ByteCode())
+}
+
+// inspectStack renders the stack elements for comparison, with "fn" standing
+// in for compiled functions, whose Inspect shows their address.
+func inspectStack(stack []object.Object) []string {
+	inspected := make([]string, len(stack))
+	for i, ob := range stack {
+		if _, ok := ob.(*object.CompiledFunction); ok {
+			inspected[i] = "fn"
+			continue
+		}
+		inspected[i] = ob.Inspect()
+	}
+	return inspected
+}
@@ -10,11 +10,13 @@ import (
 //   - fn: the compiled function being executed
 //   - ip: instruction pointer, the index of the next instruction to execute
 //   - basePointer: the base pointer in the VM's stack for this frame's local variables
+//   - free: the captured variables when fn is called through a closure
 type Frame struct {
 	fn *object.CompiledFunction
 	ip int
 
 	basePointer int
+	free        []object.Object
 }
 
 // NewFrame returns a pointer to an initialized Frame with the basePointer
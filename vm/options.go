@@ -0,0 +1,81 @@
+package vm
+
+import (
+	"comp/code"
+	"comp/object"
+	"errors"
+	"maps"
+)
+
+// ErrInstructionLimit is the error a VM created WithInstructionLimit stops
+// with once the program tries to go past the limit.
+var ErrInstructionLimit = errors.New("instruction limit exceeded")
+
+// A VMOption configures a VM when passed to NewVM.
+type VMOption func(*VM)
+
+// WithGlobals makes the VM use globals as its global store, so that
+// several VMs, such as those of the lines of a REPL session, share variables.
+func WithGlobals(globals []object.Object) VMOption {
+	return func(vm *VM) {
+		vm.globals = globals
+	}
+}
+
+// WithMaxFrames limits the depth of calls to n frames, the program itself
+// included, instead of MaxFrames. A call past the limit fails with a stack
+// overflow. n is raised to 1 if lower.
+func WithMaxFrames(n int) VMOption {
+	return func(vm *VM) {
+		frames := make([]*Frame, max(n, 1))
+		frames[0] = vm.frames[0]
+		vm.frames = frames
+	}
+}
+
+// WithInstructionLimit makes the VM stop with ErrInstructionLimit instead of
+// executing more than n instructions, counting those of builtins calling back
+// into the program. A limit of zero or less means no limit, the default.
+func WithInstructionLimit(n int) VMOption {
+	return func(vm *VM) {
+		vm.instructionLimit = n
+	}
+}
+
+// WithProfiling makes the VM count the instructions it executes by opcode,
+// as reported by Profile.
+func WithProfiling() VMOption {
+	return func(vm *VM) {
+		vm.profile = make(map[code.Opcode]int)
+	}
+}
+
+// WithErrorValues makes the VM keep errors in the program as values, as
+// EnableErrorValues does.
+func WithErrorValues() VMOption {
+	return func(vm *VM) {
+		vm.EnableErrorValues()
+	}
+}
+
+// WithBuiltins makes the program use builtins, as SetBuiltins does.
+func WithBuiltins(builtins []object.BuiltinDef) VMOption {
+	return func(vm *VM) {
+		vm.SetBuiltins(builtins)
+	}
+}
+
+// WithBreakpoints sets a breakpoint at each of offsets, as SetBreakpoint does.
+func WithBreakpoints(offsets ...int) VMOption {
+	return func(vm *VM) {
+		for _, offset := range offsets {
+			vm.SetBreakpoint(offset)
+		}
+	}
+}
+
+// Profile returns how many instructions of each opcode the VM has executed so
+// far, or nil if it was not created WithProfiling.
+func (vm *VM) Profile() map[code.Opcode]int {
+	return maps.Clone(vm.profile)
+}
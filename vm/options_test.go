@@ -0,0 +1,111 @@
+package vm
+
+import (
+	"bytes"
+	"comp/code"
+	"comp/compiler"
+	"comp/object"
+	"errors"
+	"testing"
+)
+
+func compileForOptions(t *testing.T, input string) *compiler.ByteCode {
+	t.Helper()
+	bytecode, _, err := compiler.CompileSource(input)
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	return bytecode
+}
+
+func TestMaxFramesAndInstructionLimit(t *testing.T) {
+	recursion := "let f = func(n) { if (n == 0) { return 0 } f(n - 1) }; "
+
+	vm := NewVM(compileForOptions(t, recursion+"f(5)"),
+		WithMaxFrames(10), WithInstructionLimit(1000))
+	if err := vm.RunVM(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	testExpectedObject(t, 0, vm.LastPoppedStackElement())
+
+	vm = NewVM(compileForOptions(t, recursion+"f(20)"),
+		WithMaxFrames(10), WithInstructionLimit(1000))
+	if err := vm.RunVM(); err == nil || err.Error() != "stack overflow" {
+		t.Fatalf("want stack overflow past the frame limit, got=%v", err)
+	}
+
+	vm = NewVM(compileForOptions(t, recursion+"f(5)"),
+		WithMaxFrames(10), WithInstructionLimit(20))
+	if err := vm.RunVM(); !errors.Is(err, ErrInstructionLimit) {
+		t.Fatalf("want ErrInstructionLimit, got=%v", err)
+	}
+}
+
+func TestInstructionLimitStopsInfiniteLoop(t *testing.T) {
+	vm := NewVM(compileForOptions(t, "let x = 0; for (let i = 0; ; i = i + 1) { x = x + 1 }"),
+		WithInstructionLimit(500))
+	if err := vm.RunVM(); !errors.Is(err, ErrInstructionLimit) {
+		t.Fatalf("want ErrInstructionLimit, got=%v", err)
+	}
+}
+
+func TestProfilingWithErrorValues(t *testing.T) {
+	vm := NewVM(compileForOptions(t, "let a = 1 / 0; a + 1; 2 + 3"),
+		WithProfiling(), WithErrorValues())
+	if err := vm.RunVM(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	testExpectedObject(t, 5, vm.LastPoppedStackElement())
+
+	profile := vm.Profile()
+	if profile[code.OpDiv] != 1 {
+		t.Errorf("wrong OpDiv count. want=1, got=%d", profile[code.OpDiv])
+	}
+	if profile[code.OpAdd] != 2 {
+		t.Errorf("wrong OpAdd count. want=2, got=%d", profile[code.OpAdd])
+	}
+	if NewVM(compileForOptions(t, "1")).Profile() != nil {
+		t.Errorf("profile of a VM without profiling is not nil")
+	}
+}
+
+func TestGlobalsAndBuiltinsOptions(t *testing.T) {
+	var (
+		out      bytes.Buffer
+		globals  = make([]object.Object, GlobalsSize)
+		builtins = object.NewBuiltins(&out)
+	)
+	comp := compiler.NewCompiler()
+	if err := comp.Compile(parse("let x = 40;")); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	first := NewVM(comp.ByteCode(), WithGlobals(globals), WithBuiltins(builtins))
+	if err := first.RunVM(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	// The second program is compiled knowing about x, as in a REPL session.
+	comp.Reset()
+	if err := comp.Compile(parse("puts(x + 2)")); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	second := NewVM(comp.ByteCode(), WithGlobals(globals), WithBuiltins(builtins))
+	if err := second.RunVM(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	if out.String() != "42\n" {
+		t.Errorf("wrong output. want=%q, got=%q", "42\n", out.String())
+	}
+}
+
+func TestBreakpointsOption(t *testing.T) {
+	// OpConstant 0, OpConstant 1, OpAdd, OpPop
+	vm := NewVM(compileForOptions(t, "1 + 2"), WithBreakpoints(6))
+	ip, err := vm.Continue()
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	if ip != 6 {
+		t.Errorf("stopped at the wrong offset. want=6, got=%d", ip)
+	}
+}
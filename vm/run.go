@@ -0,0 +1,44 @@
+package vm
+
+import (
+	"comp/compiler"
+	"comp/object"
+	"strings"
+)
+
+// CompileError is the error Run returns when its source does not parse or
+// compile, as opposed to an error raised while running it.
+type CompileError struct {
+	// ParserErrors holds the parser's errors when the source did not parse.
+	ParserErrors []string
+	Err          error
+}
+
+func (ce *CompileError) Error() string {
+	if len(ce.ParserErrors) != 0 {
+		return "parsing failed: " + strings.Join(ce.ParserErrors, "; ")
+	}
+	return "compilation failed: " + ce.Err.Error()
+}
+
+func (ce *CompileError) Unwrap() error { return ce.Err }
+
+// Run compiles src and runs it on a fresh VM, returning the element it popped
+// last, as LastPoppedStackElement does, or Null for an empty program. A
+// source that does not compile fails with a *CompileError; an error in the
+// running program, such as a division by zero, is returned as the VM reports
+// it.
+func Run(src string) (object.Object, error) {
+	bytecode, errs, err := compiler.CompileSource(src)
+	if err != nil {
+		return nil, &CompileError{ParserErrors: errs, Err: err}
+	}
+	vm := NewVM(bytecode)
+	if err := vm.RunVM(); err != nil {
+		return nil, err
+	}
+	if result := vm.LastPoppedStackElement(); result != nil {
+		return result, nil
+	}
+	return Null, nil
+}
@@ -0,0 +1,52 @@
+package vm
+
+import (
+	"comp/object"
+	"errors"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	tests := []vmTestCase{
+		{"1 + 2", 3},
+		{`let greet = func(name) { "hi " + name }; greet("you")`, "hi you"},
+		{"", Null},
+		{"for (let i = 0; i < 3; i = i + 1) { }", Null},
+		{"let n = 0; do { n = n + 1; } while (n < 3);", Null},
+	}
+	for _, tt := range tests {
+		result, err := Run(tt.input)
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %s", tt.input, err)
+		}
+		testExpectedObject(t, tt.expected, result)
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	_, err := Run("let = 1")
+	var compileErr *CompileError
+	if !errors.As(err, &compileErr) || len(compileErr.ParserErrors) == 0 {
+		t.Fatalf("syntax error is not a CompileError with parser errors. got=%T (%v)", err, err)
+	}
+	if compileErr.ParserErrors[0] != "expected next token to be IDENT, got = instead" {
+		t.Errorf("wrong error. got=%q", err.Error())
+	}
+
+	_, err = Run("x")
+	if !errors.As(err, &compileErr) || compileErr.ParserErrors != nil {
+		t.Fatalf("undefined variable is not a CompileError. got=%T (%v)", err, err)
+	}
+	if err.Error() != "compilation failed: undefined variable: x" {
+		t.Errorf("wrong error. got=%q", err.Error())
+	}
+
+	_, err = Run("1 / 0")
+	var errOb *object.Error
+	if !errors.As(err, &errOb) || errOb.Kind != object.ZeroDivisionError {
+		t.Fatalf("runtime error not returned as such. got=%T (%v)", err, err)
+	}
+	if errors.As(err, &compileErr) {
+		t.Errorf("runtime error reported as a CompileError")
+	}
+}
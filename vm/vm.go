@@ -6,6 +6,7 @@ import (
 	"comp/object"
 	"errors"
 	"fmt"
+	"slices"
 )
 
 var (
@@ -29,34 +30,76 @@ type VM struct {
 	frames     []*Frame
 	frameIndex int
 
-	globals []object.Object
+	globals     []object.Object
+	globalNames []string
+
+	// callErr holds an error raised while a builtin called back into the
+	// program, to be returned once the builtin is done.
+	callErr error
+
+	errorValues bool
+
+	// builtins is the registry OpGetBuiltin indexes into.
+	builtins []object.BuiltinDef
+
+	// breakpoints holds the offsets Continue stops at.
+	breakpoints map[int]bool
+
+	// instructionLimit is the number of instructions the VM may execute, or
+	// zero or less for no limit; executed counts those executed so far.
+	instructionLimit int
+	executed         int
+
+	// profile counts the executed instructions by opcode when profiling.
+	profile map[code.Opcode]int
 }
 
 // NewVMWithGlobalsStore creates a new VM instance initialized with existing global variables.
 // This is useful for resuming execution or sharing state across multiple VM instances.
+// It is the same as NewVM(bytecode, WithGlobals(globals)).
 func NewVMWithGlobalsStore(bytecode *compiler.ByteCode, globals []object.Object) *VM {
-	vm := NewVM(bytecode)
-	vm.globals = globals
-	return vm
+	return NewVM(bytecode, WithGlobals(globals))
 }
 
 // NewVM creates and returns a new VM instance initialized with the provided bytecode.
 // This is the standard entry point for creating a VM from compiled bytecode.
-func NewVM(bytecode *compiler.ByteCode) *VM {
+// Any opts are applied in order to the VM, which otherwise uses the defaults.
+func NewVM(bytecode *compiler.ByteCode, opts ...VMOption) *VM {
 	var (
 		mainFn    = &object.CompiledFunction{Instructions: bytecode.Instructions}
 		mainFrame = NewFrame(mainFn, 0)
 		frames    = make([]*Frame, MaxFrames)
 	)
 	frames[0] = mainFrame
-	return &VM{
-		constants:  bytecode.Constants,
-		stack:      make([]object.Object, StackSize),
-		sp:         0,
-		globals:    make([]object.Object, GlobalsSize),
-		frames:     frames,
-		frameIndex: 1,
+	vm := &VM{
+		constants:   bytecode.Constants,
+		stack:       make([]object.Object, StackSize),
+		sp:          0,
+		globals:     make([]object.Object, GlobalsSize),
+		frames:      frames,
+		frameIndex:  1,
+		globalNames: bytecode.GlobalNames,
+		builtins:    object.Builtins,
+	}
+	for _, opt := range opts {
+		opt(vm)
 	}
+	return vm
+}
+
+// EnableErrorValues makes the VM treat errors in the program, such as a
+// division by zero or a type mismatch, as values: the failing instruction
+// results in an *object.Error, which operations on it pass along, and the
+// program keeps running. Errors in the VM itself and failed assertions still
+// stop it.
+func (vm *VM) EnableErrorValues() {
+	vm.errorValues = true
+}
+
+// SetBuiltins makes the program use builtins, a registry returned by
+// object.NewBuiltins, for example to capture what `puts` prints.
+func (vm *VM) SetBuiltins(builtins []object.BuiltinDef) {
+	vm.builtins = builtins
 }
 
 // currentFrame returns the Frame most likely at the top.
@@ -83,178 +126,623 @@ func (vm *VM) LastPoppedStackElement() object.Object {
 	return vm.stack[vm.sp]
 }
 
+// Globals returns a copy of the VM's global store, indexed like the
+// compiler's global symbols. Slots that were never set are nil. Changing the
+// copy leaves the VM's globals as they are.
+func (vm *VM) Globals() []object.Object {
+	return slices.Clone(vm.globals)
+}
+
+// NamedGlobals pairs the set globals with the names they were defined under
+// in the compiled bytecode. Unset slots and slots without a name are left out.
+func (vm *VM) NamedGlobals() map[string]object.Object {
+	named := make(map[string]object.Object)
+	for i, name := range vm.globalNames {
+		if name == "" || i >= len(vm.globals) || vm.globals[i] == nil {
+			continue
+		}
+		named[name] = vm.globals[i]
+	}
+	return named
+}
+
+// SetGlobal stores value in the global name was declared under in the compiled
+// bytecode, so that the program reads it as an ordinary identifier. Booleans
+// and null are replaced by the VM's own instances, which comparisons rely on.
+// A global past the end of a store supplied through WithGlobals is an error.
+func (vm *VM) SetGlobal(name string, value object.Object) error {
+	for i, global := range vm.globalNames {
+		if global != name {
+			continue
+		}
+		if err := vm.checkGlobalIndex(i); err != nil {
+			return err
+		}
+		switch v := value.(type) {
+		case *object.Boolean:
+			value = boolNativeToBoolObject(v.Value)
+		case *object.Null:
+			value = Null
+		}
+		vm.globals[i] = value
+		return nil
+	}
+	return fmt.Errorf("undefined global: %s", name)
+}
+
 // RunVM executes the bytecode instructions stored in the VM. It loops through
 // instructions, decodes opcodes, and performs corresponding operations.
 // Returns an error if execution fails at any point.
 func (vm *VM) RunVM() error {
+	return vm.run(0)
+}
+
+// run executes instructions until the frame stack shrinks back to
+// stopAt frames or the current frame runs out of instructions.
+func (vm *VM) run(stopAt int) error {
+	for !vm.finished(stopAt) {
+		if err := vm.step(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// finished reports whether the frame stack has shrunk back to stopAt frames
+// or the current frame has run out of instructions.
+func (vm *VM) finished(stopAt int) bool {
+	if vm.frameIndex <= stopAt {
+		return true
+	}
+	return vm.currentFrame().ip >= len(vm.currentFrame().Instructions())-1
+}
+
+// step executes the next instruction of the current frame.
+func (vm *VM) step() error {
+	if vm.instructionLimit > 0 && vm.executed >= vm.instructionLimit {
+		return ErrInstructionLimit
+	}
+	vm.executed++
+	vm.currentFrame().ip++
 	var (
-		ins       code.Instructions
-		ip        int
-		operation code.Opcode
-	)
-	for vm.currentFrame().ip < len(vm.currentFrame().Instructions())-1 {
-		vm.currentFrame().ip++
-		ip = vm.currentFrame().ip
+		ip  = vm.currentFrame().ip
 		ins = vm.currentFrame().Instructions()
+	)
+	if vm.profile != nil {
+		vm.profile[code.Opcode(ins[ip])]++
+	}
+	if err := vm.execute(code.Opcode(ins[ip]), ins, ip); err != nil {
+		return vm.recoverError(err)
+	}
+	return nil
+}
+
+// execute executes the instruction at ip in ins, whose opcode is operation.
+func (vm *VM) execute(operation code.Opcode, ins code.Instructions, ip int) error {
+	switch operation {
+	case code.OpTrue:
+		if err := vm.push(True); err != nil {
+			return err
+		}
+	case code.OpFalse:
+		if err := vm.push(False); err != nil {
+			return err
+		}
+	case code.OpBang:
+		err := vm.executeBangOperator()
+		if err != nil {
+			return err
+		}
+	case code.OpConstant:
+		constIndex := code.ReadUint16(ins[ip+1:])
+		vm.currentFrame().ip += 2
+		err := vm.push(vm.constants[constIndex])
+		if err != nil {
+			return err
+		}
+	case code.OpJump:
+		pos := int(code.ReadUint16(ins[ip+1:]))
+		vm.currentFrame().ip = pos - 1
 
-		operation = code.Opcode(ins[ip])
-		switch operation {
-		case code.OpTrue:
-			if err := vm.push(True); err != nil {
-				return err
-			}
-		case code.OpFalse:
-			if err := vm.push(False); err != nil {
-				return err
-			}
-		case code.OpBang:
-			err := vm.executeBangOperator()
-			if err != nil {
-				return err
-			}
-		case code.OpConstant:
-			constIndex := code.ReadUint16(ins[ip+1:])
-			vm.currentFrame().ip += 2
-			err := vm.push(vm.constants[constIndex])
-			if err != nil {
-				return err
-			}
-		case code.OpJump:
-			pos := int(code.ReadUint16(ins[ip+1:]))
+	case code.OpJumpNotTruthy:
+		pos := int(code.ReadUint16(ins[ip+1:]))
+		vm.currentFrame().ip += 2
+
+		condition := vm.pop()
+		if !isTruthy(condition) {
 			vm.currentFrame().ip = pos - 1
+		}
+	case code.OpPop:
+		vm.pop()
+	case code.OpUnpackArray:
+		count := int(code.ReadUint16(ins[ip+1:]))
+		rest := code.ReadUint8(ins[ip+3:]) == 1
+		vm.currentFrame().ip += 3
+
+		if err := vm.unpackArray(count, rest); err != nil {
+			return err
+		}
+	case code.OpClosure:
+		constIndex := int(code.ReadUint16(ins[ip+1:]))
+		numFree := int(code.ReadUint8(ins[ip+3:]))
+		vm.currentFrame().ip += 3
+
+		if err := vm.pushClosure(constIndex, numFree); err != nil {
+			return err
+		}
+	case code.OpGetFree:
+		freeIndex := code.ReadUint8(ins[ip+1:])
+		vm.currentFrame().ip += 1
+
+		if err := vm.push(vm.currentFrame().free[freeIndex]); err != nil {
+			return err
+		}
+	case code.OpCell:
+		vm.stack[vm.sp-1] = &object.Cell{Value: vm.stack[vm.sp-1]}
+	case code.OpEmptyCell:
+		if err := vm.push(&object.Cell{}); err != nil {
+			return err
+		}
+	case code.OpDeref:
+		value := vm.stack[vm.sp-1].(*object.Cell).Value
+		if value == nil {
+			return object.NewError(object.NameError, "use of uninitialized variable")
+		}
+		vm.stack[vm.sp-1] = value
+	case code.OpSetCell:
+		cell := vm.pop().(*object.Cell)
+		cell.Value = vm.pop()
+	case code.OpUnpackHash:
+		count := int(code.ReadUint16(ins[ip+1:]))
+		vm.currentFrame().ip += 2
+
+		if err := vm.unpackHash(count); err != nil {
+			return err
+		}
+	case code.OpDup:
+		if err := vm.push(vm.stack[vm.sp-1]); err != nil {
+			return err
+		}
+	case code.OpPopN:
+		count := int(code.ReadUint16(ins[ip+1:]))
+		vm.currentFrame().ip += 2
+		vm.popN(count)
+	case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv, code.OpPow:
+		err := vm.executeBinaryOperation(operation)
+		if err != nil {
+			return err
+		}
+	case code.OpMinus:
+		err := vm.executeMinusOperation()
+		if err != nil {
+			return err
+		}
+	case code.OpBitNot:
+		err := vm.executeBitNotOperation()
+		if err != nil {
+			return err
+		}
+	case code.OpBitAnd, code.OpBitOr:
+		err := vm.executeBitwiseOperation(operation)
+		if err != nil {
+			return err
+		}
+	case code.OpEqual, code.OpNotEqual, code.OpGreaterThan, code.OpGreaterEqual,
+		code.OpLessThan, code.OpLessEqual:
+		err := vm.executeComparison(operation)
+		if err != nil {
+			return err
+		}
+	case code.OpSetLocal:
+		localIndex := code.ReadUint8(ins[ip+1:])
+		vm.currentFrame().ip += 1
+		frame := vm.currentFrame()
+		vm.stack[frame.basePointer+int(localIndex)] = vm.pop()
+
+	case code.OpGetLocal:
+		localIndex := code.ReadUint8(ins[ip+1:])
+		vm.currentFrame().ip += 1
+		frame := vm.currentFrame()
+
+		ob := vm.stack[frame.basePointer+int(localIndex)]
+		if err := vm.push(ob); err != nil {
+			return err
+		}
+	case code.OpSetGlobal:
+		globalIndex := int(code.ReadUint16(ins[ip+1:]))
+		vm.currentFrame().ip += 2
+		if err := vm.checkGlobalIndex(globalIndex); err != nil {
+			return err
+		}
+		vm.globals[globalIndex] = vm.pop()
+
+	case code.OpGetGlobal:
+		globalIndex := int(code.ReadUint16(ins[ip+1:]))
+		vm.currentFrame().ip += 2
+		if err := vm.checkGlobalIndex(globalIndex); err != nil {
+			return err
+		}
+		global := vm.globals[globalIndex]
+		if global == nil {
+			return vm.uninitializedGlobal(globalIndex)
+		}
+		err := vm.push(global)
+		if err != nil {
+			return err
+		}
+	case code.OpGetBuiltin:
+		builtinIndex := code.ReadUint8(ins[ip+1:])
+		vm.currentFrame().ip += 1
+
+		def := vm.builtins[builtinIndex]
+		if err := vm.push(def.BuiltIn); err != nil {
+			return err
+		}
+	case code.OpNull:
+		if err := vm.push(Null); err != nil {
+			return err
+		}
+	case code.OpReturnValue:
+		returnVal := vm.pop()
+		if vm.frameIndex == 1 {
+			vm.returnFromMain(returnVal)
+			return nil
+		}
+		frame := vm.popFrame()
+		vm.sp = frame.basePointer - 1
+		if err := vm.push(returnVal); err != nil {
+			return err
+		}
+	case code.OpReturn:
+		frame := vm.popFrame()
+		vm.sp = frame.basePointer - 1
+		if err := vm.push(Null); err != nil {
+			return err
+		}
+	case code.OpCall:
+		numArgs := code.ReadUint8(ins[ip+1:])
+		vm.currentFrame().ip += 1
+		err := vm.callFunction(int(numArgs))
+		if err != nil {
+			return err
+		}
+	case code.OpIndex:
+		var (
+			index = vm.pop()
+			left  = vm.pop()
+		)
+		err := vm.executeIndexExpression(left, index)
+		if err != nil {
+			return err
+		}
+	case code.OpArray:
+		length := int(code.ReadUint16(ins[ip+1:]))
+		vm.currentFrame().ip += 2
+		array := vm.buildArray(vm.sp-length, vm.sp)
+
+		vm.sp = vm.sp - length
+		if err := vm.push(array); err != nil {
+			return err
+		}
+	case code.OpHash:
+		length := int(code.ReadUint16(ins[ip+1:]))
+		vm.currentFrame().ip += 2
+		hash, err := vm.buildHash(vm.sp-length, vm.sp)
+		vm.sp = vm.sp - length
+		if err != nil {
+			return err
+		}
+		if err := vm.push(hash); err != nil {
+			return err
+		}
+	case code.OpExtend:
+		length := int(code.ReadUint16(ins[ip+1:]))
+		vm.currentFrame().ip += 2
+
+		if err := vm.extendCollection(vm.sp-length, vm.sp); err != nil {
+			vm.sp = vm.sp - length - 1 // drop the collection too
+			return err
+		}
+		vm.sp = vm.sp - length
+	}
+	return nil
+}
+
+// recoverError pushes err as the result of the failed instruction if the VM
+// keeps errors as values and err is an error in the program rather than in the
+// VM, whose instructions leave their operands popped when failing that way.
+// Any other error is returned, as is a failed assertion, which always stops
+// the program.
+func (vm *VM) recoverError(err error) error {
+	var errOb *object.Error
+	if !vm.errorValues || !errors.As(err, &errOb) || errOb.Kind == object.AssertionError {
+		return err
+	}
+	return vm.push(errOb)
+}
 
-		case code.OpJumpNotTruthy:
-			pos := int(code.ReadUint16(ins[ip+1:]))
-			vm.currentFrame().ip += 2
-
-			condition := vm.pop()
-			if !isTruthy(condition) {
-				vm.currentFrame().ip = pos - 1
-			}
-		case code.OpPop:
-			vm.pop()
-		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv:
-			err := vm.executeBinaryOperation(operation)
-			if err != nil {
-				return err
-			}
-		case code.OpMinus:
-			err := vm.executeMinusOperation()
-			if err != nil {
-				return err
-			}
-		case code.OpEqual, code.OpNotEqual, code.OpGreaterThan:
-			err := vm.executeComparison(operation)
-			if err != nil {
-				return err
-			}
-		case code.OpSetLocal:
-			localIndex := code.ReadUint8(ins[ip+1:])
-			vm.currentFrame().ip += 1
-			frame := vm.currentFrame()
-			vm.stack[frame.basePointer+int(localIndex)] = vm.pop()
-
-		case code.OpGetLocal:
-			localIndex := code.ReadUint8(ins[ip+1:])
-			vm.currentFrame().ip += 1
-			frame := vm.currentFrame()
-
-			ob := vm.stack[frame.basePointer+int(localIndex)]
-			if err := vm.push(ob); err != nil {
-				return err
-			}
-		case code.OpSetGlobal:
-			globalIndex := code.ReadUint16(ins[ip+1:])
-			vm.currentFrame().ip += 2
-			vm.globals[globalIndex] = vm.pop()
-
-		case code.OpGetGlobal:
-			globalIndex := code.ReadUint16(ins[ip+1:])
-			vm.currentFrame().ip += 2
-			err := vm.push(vm.globals[globalIndex])
-			if err != nil {
-				return err
-			}
-		case code.OpNull:
-			if err := vm.push(Null); err != nil {
-				return err
-			}
-		case code.OpReturnValue:
-			returnVal := vm.pop()
-			frame := vm.popFrame()
-			vm.sp = frame.basePointer - 1
-			if err := vm.push(returnVal); err != nil {
-				return err
-			}
-		case code.OpReturn:
-			frame := vm.popFrame()
-			vm.sp = frame.basePointer - 1
-			if err := vm.push(Null); err != nil {
-				return err
-			}
-		case code.OpCall:
-			numArgs := code.ReadUint8(ins[ip+1:])
-			vm.currentFrame().ip += 1
-			err := vm.callFunction(int(numArgs))
-			if err != nil {
-				return err
-			}
-		case code.OpIndex:
-			var (
-				index = vm.pop()
-				left  = vm.pop()
-			)
-			err := vm.executeIndexExpression(left, index)
-			if err != nil {
-				return err
-			}
-		case code.OpArray:
-			length := int(code.ReadUint16(ins[ip+1:]))
-			vm.currentFrame().ip += 2
-			array := vm.buildArray(vm.sp-length, vm.sp)
-
-			vm.sp = vm.sp - length
-			if err := vm.push(array); err != nil {
-				return err
-			}
-		case code.OpHash:
-			length := int(code.ReadUint16(ins[ip+1:]))
-			vm.currentFrame().ip += 2
-			hash, err := vm.buildHash(vm.sp-length, vm.sp)
-			if err != nil {
-				return err
-			}
-			vm.sp = vm.sp - length
-			if err := vm.push(hash); err != nil {
-				return err
-			}
+// errorOperand returns the first of operands that is an error value if the VM
+// keeps errors as values, so that an operation on it results in that error.
+func (vm *VM) errorOperand(operands ...object.Object) error {
+	if !vm.errorValues {
+		return nil
+	}
+	for _, operand := range operands {
+		if errOb, ok := operand.(*object.Error); ok {
+			return errOb
 		}
 	}
 	return nil
 }
 
+// returnFromMain ends the program at a return outside of any function, with
+// returnVal as its result, just as the evaluator stops evaluating the program.
+func (vm *VM) returnFromMain(returnVal object.Object) {
+	vm.stack[0] = returnVal
+	vm.sp = 0
+	vm.currentFrame().ip = len(vm.currentFrame().Instructions()) - 1
+}
+
+// callFunction calls the function sitting below its numArgs arguments on the
+// stack, which is either a compiled function, a closure or a builtin.
 func (vm *VM) callFunction(numArgs int) error {
-	fn, ok := vm.stack[vm.sp-1-numArgs].(*object.CompiledFunction)
-	if !ok {
-		return fmt.Errorf("calling non-function")
+	var err error
+	switch callee := vm.stack[vm.sp-1-numArgs].(type) {
+	case *object.CompiledFunction:
+		err = vm.callCompiledFunction(callee, nil, numArgs)
+	case *object.Closure:
+		err = vm.callCompiledFunction(callee.Fn, callee.Free, numArgs)
+	case *object.BuiltIn:
+		return vm.callBuiltin(callee, numArgs)
+	default:
+		err = object.NewError(object.TypeError, "calling non-function")
+	}
+	if err != nil {
+		vm.sp = vm.sp - numArgs - 1 // the call did not happen
+	}
+	return err
+}
+
+// callCompiledFunction pushes a new Frame for fn with the captured variables
+// free, reserving room for its locals on the stack. The arguments past the
+// positional parameters of a variadic function are collected into an array
+// for its rest parameter, and a call leaving out parameters with defaults
+// starts at the code setting them.
+func (vm *VM) callCompiledFunction(fn *object.CompiledFunction, free []object.Object, numArgs int) error {
+	positional := fn.NumParameters
+	if fn.Variadic {
+		positional--
 	}
-	if numArgs != fn.NumParameters {
-		return fmt.Errorf(
+	required := positional - fn.NumDefaults
+
+	switch {
+	case fn.Variadic && numArgs < required:
+		return object.NewError(object.ArgumentError,
+			"wrong number of arguments: want at least %d, got=%d", required, numArgs)
+	case fn.Variadic:
+	case fn.NumDefaults == 0 && numArgs != positional:
+		return object.NewError(object.ArgumentError,
 			"wrong number of arguments: want=%d, got=%d",
 			fn.NumParameters,
 			numArgs,
 		)
+	case numArgs < required || numArgs > positional:
+		return object.NewError(object.ArgumentError, "wrong number of arguments: want between %d and %d, got=%d",
+			required, positional, numArgs)
+	}
+	basePointer := vm.sp - numArgs
+	if basePointer+fn.NumLocals > StackSize || vm.frameIndex >= len(vm.frames) {
+		return errors.New("stack overflow")
+	}
+	if fn.Variadic {
+		vm.packRestArguments(basePointer + positional)
+	}
+	nf := NewFrame(fn, basePointer)
+	nf.free = free
+	if fn.NumDefaults > 0 {
+		nf.ip = fn.Entries[min(numArgs, positional)-required] - 1
 	}
-	nf := NewFrame(fn, vm.sp-numArgs)
 	vm.pushFrame(nf)
 	vm.sp = nf.basePointer + fn.NumLocals
 	return nil
 }
 
+// packRestArguments replaces the arguments from slot on, up to the top of the
+// stack, with an array holding them. The array is empty if there are none.
+func (vm *VM) packRestArguments(slot int) {
+	rest := []object.Object{}
+	if slot < vm.sp {
+		rest = append(rest, vm.stack[slot:vm.sp]...)
+		for i := slot + 1; i < vm.sp; i++ {
+			vm.stack[i] = nil
+		}
+	}
+	vm.stack[slot] = &object.Array{Elements: rest}
+}
+
+// callBuiltin calls the builtin with the numArgs arguments on top of the stack
+// and replaces them, and the builtin itself, with the result. Errors returned
+// by the builtin are pushed like any other value, except for a failed
+// assertion, which stops the program.
+func (vm *VM) callBuiltin(builtin *object.BuiltIn, numArgs int) error {
+	args := vm.stack[vm.sp-numArgs : vm.sp]
+
+	result := builtin.Call(vm.callValue, args...)
+	vm.sp = vm.sp - numArgs - 1
+	if err := vm.callErr; err != nil {
+		vm.callErr = nil
+		return err
+	}
+
+	switch result := result.(type) {
+	case nil:
+		return vm.push(Null)
+	case *object.Boolean:
+		return vm.push(boolNativeToBoolObject(result.Value))
+	case *object.Error:
+		if result.Kind == object.AssertionError {
+			return result
+		}
+		return vm.push(result)
+	default:
+		return vm.push(result)
+	}
+}
+
+// checkGlobalIndex reports an error if index is past the end of the globals
+// store, which may be smaller than GlobalsSize when it is supplied through
+// NewVMWithGlobalsStore.
+func (vm *VM) checkGlobalIndex(index int) error {
+	if index >= len(vm.globals) {
+		return fmt.Errorf("global index out of range: %d (globals size %d)", index, len(vm.globals))
+	}
+	return nil
+}
+
+// uninitializedGlobal returns the error for reading the global at index
+// before anything was stored in it. Compiled programs only do that with a
+// function referred to ahead of its let; any other unset global comes from
+// handcrafted bytecode or a globals store that does not match the program.
+func (vm *VM) uninitializedGlobal(index int) error {
+	if index < len(vm.globalNames) && vm.globalNames[index] != "" {
+		return object.NewError(object.NameError, "%s used before its definition", vm.globalNames[index])
+	}
+	return object.NewError(object.NameError, "use of uninitialized variable: global %d", index)
+}
+
+// CallFunction calls the function bound to the global name with args and
+// returns its result. It is meant for calling into a program from Go after
+// RunVM has defined its globals.
+func (vm *VM) CallFunction(name string, args ...object.Object) (object.Object, error) {
+	for i, global := range vm.globalNames {
+		if global != name {
+			continue
+		}
+		if i >= len(vm.globals) || vm.globals[i] == nil {
+			return nil, fmt.Errorf("global %s is not set", name)
+		}
+		return vm.call(vm.globals[i], args)
+	}
+	return nil, fmt.Errorf("undefined global: %s", name)
+}
+
+// call runs fn with args to completion on top of the current stack and
+// returns its result. If that fails, the stack and frames are put back as
+// they were.
+func (vm *VM) call(fn object.Object, args []object.Object) (object.Object, error) {
+	stopAt, sp := vm.frameIndex, vm.sp
+
+	err := vm.push(fn)
+	for _, arg := range args {
+		if err != nil {
+			break
+		}
+		err = vm.push(arg)
+	}
+	if err == nil {
+		err = vm.callFunction(len(args))
+	}
+	if err == nil {
+		err = vm.run(stopAt)
+	}
+	if err != nil {
+		vm.frameIndex, vm.sp = stopAt, sp
+		return nil, err
+	}
+	return vm.pop(), nil
+}
+
+// callValue is the object.Caller through which higher-order builtins call the
+// functions passed to them. A VM error is kept in callErr and aborts the
+// calling builtin with an error object.
+func (vm *VM) callValue(fn object.Object, args ...object.Object) object.Object {
+	if vm.callErr != nil {
+		return &object.Error{Kind: object.RuntimeError, Message: vm.callErr.Error()}
+	}
+	result, err := vm.call(fn, args)
+	if err != nil {
+		vm.callErr = err
+		return &object.Error{Kind: object.RuntimeError, Message: err.Error()}
+	}
+	return result
+}
+
+// pushClosure replaces the numFree values on top of the stack with a closure
+// of the compiled function at constIndex capturing them.
+func (vm *VM) pushClosure(constIndex, numFree int) error {
+	fn, ok := vm.constants[constIndex].(*object.CompiledFunction)
+	if !ok {
+		return fmt.Errorf("not a function: %+v", vm.constants[constIndex])
+	}
+	free := make([]object.Object, numFree)
+	copy(free, vm.stack[vm.sp-numFree:vm.sp])
+	vm.sp -= numFree
+	return vm.push(&object.Closure{Fn: fn, Free: free})
+}
+
+// unpackArray replaces the array on top of the stack with its first count
+// elements, null where it is shorter, followed if rest is set by an array of
+// the remaining ones.
+func (vm *VM) unpackArray(count int, rest bool) error {
+	value := vm.pop()
+	if err := vm.errorOperand(value); err != nil {
+		return err
+	}
+	unpacked, errOb := object.UnpackArray(value, count, rest)
+	if errOb != nil {
+		return errOb
+	}
+	for _, elem := range unpacked {
+		if elem == nil {
+			elem = Null
+		}
+		if err := vm.push(elem); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unpackHash replaces a hash and the count string keys above it with the
+// values under those keys, null for the missing ones.
+func (vm *VM) unpackHash(count int) error {
+	keys := make([]string, count)
+	for i, keyOb := range vm.stack[vm.sp-count : vm.sp] {
+		keys[i] = keyOb.(*object.String).Value
+	}
+	vm.sp -= count
+
+	value := vm.pop()
+	if err := vm.errorOperand(value); err != nil {
+		return err
+	}
+	unpacked, errOb := object.UnpackHash(value, keys)
+	if errOb != nil {
+		return errOb
+	}
+	for _, elem := range unpacked {
+		if elem == nil {
+			elem = Null
+		}
+		if err := vm.push(elem); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // buildHash creates a new hash object from a range of stack elements.
 func (vm *VM) buildHash(startIndex, endIndex int) (object.Object, error) {
 	pairs := make(map[object.HashKey]object.HashPair, (endIndex-startIndex)/2)
+	if err := vm.addHashPairs(pairs, startIndex, endIndex); err != nil {
+		return nil, err
+	}
+	return &object.Hash{Pairs: pairs}, nil
+}
 
+// addHashPairs adds the key-value pairs in a range of stack elements to pairs.
+// A key already in pairs is an error, as keys appear once in a hash literal.
+func (vm *VM) addHashPairs(pairs map[object.HashKey]object.HashPair, startIndex, endIndex int) error {
 	for i := startIndex; i < endIndex; i += 2 {
 		var (
 			key  = vm.stack[i]
@@ -263,11 +751,29 @@ func (vm *VM) buildHash(startIndex, endIndex int) (object.Object, error) {
 		)
 		hashKey, ok := key.(object.Hashable)
 		if !ok {
-			return nil, fmt.Errorf("unusable as hash key: %s", key.Type())
+			return object.NewError(object.TypeError, "unusable as hash key: %s", key.Type())
+		}
+		if _, ok := pairs[hashKey.HashKey()]; ok {
+			return object.NewError(object.ValueError, "duplicate key in hash literal: %s", key.Inspect())
 		}
 		pairs[hashKey.HashKey()] = pair
 	}
-	return &object.Hash{Pairs: pairs}, nil
+	return nil
+}
+
+// extendCollection adds the stack elements in the given range to the array or
+// hash right below them, which is still being built from a literal and thus
+// not shared with anything yet.
+func (vm *VM) extendCollection(startIndex, endIndex int) error {
+	switch collection := vm.stack[startIndex-1].(type) {
+	case *object.Array:
+		collection.Elements = append(collection.Elements, vm.stack[startIndex:endIndex]...)
+	case *object.Hash:
+		return vm.addHashPairs(collection.Pairs, startIndex, endIndex)
+	default:
+		return fmt.Errorf("cannot extend %s", collection.Type())
+	}
+	return nil
 }
 
 // buildArray creates a new array object from a range of stack elements.
@@ -282,14 +788,24 @@ func (vm *VM) buildArray(startIndex, endIndex int) object.Object {
 
 // executeIndexExpression performs an indexing operation on the provided object.
 func (vm *VM) executeIndexExpression(left, index object.Object) error {
+	if err := vm.errorOperand(left, index); err != nil {
+		return err
+	}
 	switch {
 	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
 		return vm.executeArrayIndex(left, index)
 
+	case left.Type() == object.STRING_OBJ && index.Type() == object.INTEGER_OBJ:
+		char, ok := left.(*object.String).CharAt(index.(*object.Integer).Value)
+		if !ok {
+			return vm.push(Null)
+		}
+		return vm.push(char)
+
 	case left.Type() == object.HASH_OBJ:
 		return vm.executeHashIndex(left, index)
 	default:
-		return fmt.Errorf("index operator not supported for type: %s", left.Type())
+		return object.NewError(object.TypeError, "index operator not supported for type: %s", left.Type())
 	}
 }
 
@@ -314,7 +830,7 @@ func (vm *VM) executeHashIndex(left, keyOb object.Object) error {
 
 	key, ok := keyOb.(object.Hashable)
 	if !ok {
-		return fmt.Errorf("unusable as hash key: %s", keyOb.Type())
+		return object.NewError(object.TypeError, "unusable as hash key: %s", keyOb.Type())
 	}
 	pairs, ok := hashOb.Pairs[key.HashKey()]
 	if !ok {
@@ -330,14 +846,25 @@ func (vm *VM) executeBinaryOperation(op code.Opcode) error {
 		right = vm.pop()
 		left  = vm.pop()
 	)
+	if err := vm.errorOperand(left, right); err != nil {
+		return err
+	}
 	switch {
 	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
 		return vm.executeBinaryIntegerOperation(op, left, right)
 
 	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
 		return vm.executeBinaryStringOperation(op, left, right)
+
+	case op == code.OpMul && left.Type() == object.STRING_OBJ && right.Type() == object.INTEGER_OBJ:
+		return vm.executeStringRepetition(left.(*object.String), right.(*object.Integer))
+	case op == code.OpMul && left.Type() == object.INTEGER_OBJ && right.Type() == object.STRING_OBJ:
+		return vm.executeStringRepetition(right.(*object.String), left.(*object.Integer))
+
+	case left.Type() == object.ARRAY_OBJ && right.Type() == object.ARRAY_OBJ:
+		return vm.executeBinaryArrayOperation(op, left, right)
 	default:
-		return fmt.Errorf("invalid types for binary operation: %s %s",
+		return object.NewError(object.TypeError, "invalid types for binary operation: %s %s",
 			left.Type(), right.Type(),
 		)
 	}
@@ -350,29 +877,40 @@ func (vm *VM) executeBinaryIntegerOperation(op code.Opcode, left, right object.O
 		lval = left.(*object.Integer).Value
 		rval = right.(*object.Integer).Value
 	)
-	var result int64
+	var (
+		result int64
+		ok     bool
+	)
 	switch op {
 	case code.OpAdd:
-		result = lval + rval
+		result, ok = object.AddIntegers(lval, rval)
 	case code.OpSub:
-		result = lval - rval
+		result, ok = object.SubtractIntegers(lval, rval)
 	case code.OpMul:
-		result = lval * rval
+		result, ok = object.MultiplyIntegers(lval, rval)
 	case code.OpDiv:
 		if rval == 0 {
-			return fmt.Errorf("division by zero")
+			return object.NewError(object.ZeroDivisionError, "division by zero")
+		}
+		result, ok = object.DivideIntegers(lval, rval)
+	case code.OpPow:
+		if rval < 0 {
+			return object.NewError(object.ValueError, "negative exponent: %d", rval)
 		}
-		result = lval / rval
+		result, ok = object.IntegerPower(lval, rval)
 	default:
 		return fmt.Errorf("invalid integer operation: %d", op)
 	}
+	if !ok {
+		return object.IntegerOverflow()
+	}
 	return vm.push(&object.Integer{Value: result})
 }
 
 // executeBinaryStringOperation concatenates two strings together.
 func (vm *VM) executeBinaryStringOperation(op code.Opcode, left, right object.Object) error {
 	if op != code.OpAdd {
-		return fmt.Errorf("invalid string operation: %d", op)
+		return object.NewError(object.TypeError, "invalid string operation: %d", op)
 	}
 	var (
 		lval = left.(*object.String).Value
@@ -381,6 +919,30 @@ func (vm *VM) executeBinaryStringOperation(op code.Opcode, left, right object.Ob
 	return vm.push(&object.String{Value: lval + rval})
 }
 
+// executeStringRepetition pushes str repeated count times, for `*` between a
+// string and an integer in either order.
+func (vm *VM) executeStringRepetition(str *object.String, count *object.Integer) error {
+	result := object.RepeatString(str, count)
+	if err, ok := result.(*object.Error); ok {
+		return err
+	}
+	return vm.push(result)
+}
+
+// executeBinaryArrayOperation concatenates two arrays into a new one.
+func (vm *VM) executeBinaryArrayOperation(op code.Opcode, left, right object.Object) error {
+	if op != code.OpAdd {
+		return object.NewError(object.TypeError, "invalid array operation: %d", op)
+	}
+	var (
+		lval = left.(*object.Array).Elements
+		rval = right.(*object.Array).Elements
+	)
+	elements := make([]object.Object, 0, len(lval)+len(rval))
+	elements = append(append(elements, lval...), rval...)
+	return vm.push(&object.Array{Elements: elements})
+}
+
 // executeBangOperator performs logical negation on the top stack element.
 // Returns False for True, True for False and Null, and False for all other values.
 func (vm *VM) executeBangOperator() error {
@@ -402,26 +964,86 @@ func (vm *VM) executeBangOperator() error {
 // objects.
 func (vm *VM) executeMinusOperation() error {
 	operand := vm.pop()
-
+	if err := vm.errorOperand(operand); err != nil {
+		return err
+	}
 	if operand.Type() != object.INTEGER_OBJ {
-		return fmt.Errorf(
+		return object.NewError(object.TypeError,
 			"invalid object type for negation: %s",
 			operand.Type(),
 		)
 	}
+	value, ok := object.SubtractIntegers(0, operand.(*object.Integer).Value)
+	if !ok {
+		return object.IntegerOverflow()
+	}
+	return vm.push(&object.Integer{Value: value})
+}
+
+// executeBitNotOperation replaces the integer on top of the stack with its
+// bitwise complement.
+func (vm *VM) executeBitNotOperation() error {
+	operand := vm.pop()
+	if err := vm.errorOperand(operand); err != nil {
+		return err
+	}
+	if operand.Type() != object.INTEGER_OBJ {
+		return object.NewError(object.TypeError,
+			"invalid object type for bitwise not: %s",
+			operand.Type(),
+		)
+	}
 	value := operand.(*object.Integer).Value
-	return vm.push(&object.Integer{Value: -value})
+	return vm.push(&object.Integer{Value: ^value})
+}
+
+// executeBitwiseOperation performs `&` or `|` on the top two stack elements.
+// Integers are combined bit by bit, booleans as an eager logical and/or for
+// which, unlike `&&` and `||`, both operands have already been evaluated.
+func (vm *VM) executeBitwiseOperation(op code.Opcode) error {
+	var (
+		right = vm.pop()
+		left  = vm.pop()
+	)
+	if err := vm.errorOperand(left, right); err != nil {
+		return err
+	}
+	switch {
+	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
+		lval, rval := left.(*object.Integer).Value, right.(*object.Integer).Value
+		if op == code.OpBitAnd {
+			return vm.push(&object.Integer{Value: lval & rval})
+		}
+		return vm.push(&object.Integer{Value: lval | rval})
+
+	case left.Type() == object.BOOLEAN_OBJ && right.Type() == object.BOOLEAN_OBJ:
+		lval, rval := left.(*object.Boolean).Value, right.(*object.Boolean).Value
+		if op == code.OpBitAnd {
+			return vm.push(boolNativeToBoolObject(lval && rval))
+		}
+		return vm.push(boolNativeToBoolObject(lval || rval))
+	default:
+		return object.NewError(object.TypeError, "invalid types for bitwise operation: %s %s",
+			left.Type(), right.Type(),
+		)
+	}
 }
 
 // executeComparison performs comparison operations on the top two stack elements.
-// Handles both integer and pointer equality comparisons.
+// Handles integer, structural (arrays and hashes) and pointer equality comparisons.
 func (vm *VM) executeComparison(op code.Opcode) error {
 	var (
 		right = vm.pop()
 		left  = vm.pop()
 	)
-	if left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ {
-		return vm.executeIntegerComparison(op, left, right)
+	if err := vm.errorOperand(left, right); err != nil {
+		return err
+	}
+	if comparable, ok := left.(object.Comparable); ok && left.Type() == right.Type() {
+		return vm.executeOrderedComparison(op, comparable, right)
+	}
+	if isCollection(left) && left.Type() == right.Type() {
+		return vm.executeCollectionComparison(op, left, right)
 	}
 	switch op {
 	case code.OpEqual:
@@ -429,32 +1051,77 @@ func (vm *VM) executeComparison(op code.Opcode) error {
 	case code.OpNotEqual:
 		return vm.push(boolNativeToBoolObject(right != left))
 	default:
-		return fmt.Errorf(
-			"invalid operator: %d (%s %s)",
-			op, left.Type(), right.Type(),
-		)
+		return comparisonError(op, left, right)
 	}
 }
 
-// executeIntegerComparison performs comparison operations (greater than, equal, not equal)
-// on two integer operands and pushes the boolean result onto the stack.
-func (vm *VM) executeIntegerComparison(op code.Opcode, left, right object.Object) error {
-	var (
-		leftVal  = left.(*object.Integer).Value
-		rightVal = right.(*object.Integer).Value
-	)
+// executeOrderedComparison pushes the result of comparing left with right, a
+// value of the same type, through their order.
+func (vm *VM) executeOrderedComparison(op code.Opcode, left object.Comparable, right object.Object) error {
+	order, err := left.Compare(right)
+	if err != nil {
+		return err
+	}
 	switch op {
 	case code.OpGreaterThan:
-		return vm.push(boolNativeToBoolObject(leftVal > rightVal))
+		return vm.push(boolNativeToBoolObject(order > 0))
+	case code.OpGreaterEqual:
+		return vm.push(boolNativeToBoolObject(order >= 0))
+	case code.OpLessThan:
+		return vm.push(boolNativeToBoolObject(order < 0))
+	case code.OpLessEqual:
+		return vm.push(boolNativeToBoolObject(order <= 0))
 	case code.OpEqual:
-		return vm.push(boolNativeToBoolObject(leftVal == rightVal))
+		return vm.push(boolNativeToBoolObject(order == 0))
 	case code.OpNotEqual:
-		return vm.push(boolNativeToBoolObject(leftVal != rightVal))
+		return vm.push(boolNativeToBoolObject(order != 0))
 	default:
 		return fmt.Errorf("invalid operator: %d", op)
 	}
 }
 
+// executeCollectionComparison compares two arrays or two hashes structurally
+// and pushes the boolean result onto the stack.
+func (vm *VM) executeCollectionComparison(op code.Opcode, left, right object.Object) error {
+	switch op {
+	case code.OpEqual:
+		return vm.push(boolNativeToBoolObject(object.Equal(left, right)))
+	case code.OpNotEqual:
+		return vm.push(boolNativeToBoolObject(!object.Equal(left, right)))
+	default:
+		return comparisonError(op, left, right)
+	}
+}
+
+// comparisonOperators maps the comparison opcodes to the operators they are
+// compiled from.
+var comparisonOperators = map[code.Opcode]string{
+	code.OpEqual:        "==",
+	code.OpNotEqual:     "!=",
+	code.OpGreaterThan:  ">",
+	code.OpGreaterEqual: ">=",
+	code.OpLessThan:     "<",
+	code.OpLessEqual:    "<=",
+}
+
+// comparisonError reports a comparison that left and right do not support,
+// worded the way the evaluator words it.
+func comparisonError(op code.Opcode, left, right object.Object) error {
+	if left.Type() != right.Type() {
+		return object.NewError(object.TypeError, "type mismatch: %s %s %s",
+			left.Type(), comparisonOperators[op], right.Type(),
+		)
+	}
+	return object.NewError(object.TypeError, "unknown operator: %s %s %s",
+		left.Type(), comparisonOperators[op], right.Type(),
+	)
+}
+
+// isCollection reports whether the object is an array or a hash.
+func isCollection(ob object.Object) bool {
+	return ob.Type() == object.ARRAY_OBJ || ob.Type() == object.HASH_OBJ
+}
+
 // isTruthy determines whether an object evaluates to true in a boolean context.
 // Returns false for False and Null, true for all other values.
 func isTruthy(condition object.Object) bool {
@@ -485,6 +1152,18 @@ func (vm *VM) pop() object.Object {
 	return ob
 }
 
+// popN removes the top count elements from the stack in one step. Like pop, it
+// keeps the last of them, now at stack[sp], for LastPoppedStackElement, but
+// clears the slots above so that the popped objects can be collected.
+func (vm *VM) popN(count int) {
+	if count == 0 {
+		return
+	}
+	top := vm.sp
+	vm.sp -= count
+	clear(vm.stack[vm.sp+1 : top])
+}
+
 // push adds an object to the top of the stack.
 // Returns an error if the stack is full.
 func (vm *VM) push(ob object.Object) error {
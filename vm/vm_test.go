@@ -1,12 +1,18 @@
 package vm
 
 import (
+	"bytes"
 	"comp/ast"
+	"comp/code"
 	"comp/compiler"
+	"comp/evaluator"
 	"comp/lexer"
 	"comp/object"
 	"comp/parser"
+	"errors"
 	"fmt"
+	"strings"
+	"sync"
 	"testing"
 )
 
@@ -34,11 +40,52 @@ func TestIntegerArithmetic(t *testing.T) {
 		{"-10", -10},
 		{"-50 + 100 + -50", 0},
 		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+		{"~0", -1},
+		{"~0 == -1", true},
+		{"~5", -6},
+		{"~-1", 0},
+		{"~~7", 7},
+		{"~2 * 3", -9},
 	}
 
 	runVmTests(t, tests)
 }
 
+func TestPowerOperator(t *testing.T) {
+	tests := []vmTestCase{
+		{"2 ** 10", 1024},
+		{"2 ** 10 == 1024", true},
+		{"2 ** 0", 1},
+		{"0 ** 0", 1},
+		{"0 ** 5", 0},
+		{"(-2) ** 3", -8},
+		{"-2 ** 2", 4}, // the prefix minus binds tighter
+		{"-(2 ** 2)", -4},
+		{"2 ** 3 ** 2", 512},
+		{"(2 ** 3) ** 2", 64},
+		{"2 * 3 ** 2", 18},
+		{"3 ** 4 == pow(3, 4)", true},
+		{"let e = 62; 2 ** e", 1 << 62},
+		{"2 ** -1", &object.Error{Message: "negative exponent: -1"}},
+		{`2 ** "a"`, &object.Error{Message: "invalid types for binary operation: INTEGER STRING"}},
+	}
+	runVmTests(t, tests[:len(tests)-2])
+	runAgainstEvaluator(t, tests[:len(tests)-2])
+
+	for _, tt := range tests[len(tests)-2:] {
+		comp := compiler.NewCompiler()
+		if err := comp.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		vm := NewVM(comp.ByteCode())
+		vm.EnableErrorValues()
+		if err := vm.RunVM(); err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+		testExpectedObject(t, tt.expected, vm.LastPoppedStackElement())
+	}
+}
+
 func TestBooleanExpressions(t *testing.T) {
 	tests := []vmTestCase{
 		{"true", true},
@@ -47,6 +94,10 @@ func TestBooleanExpressions(t *testing.T) {
 		{"1 > 2", false},
 		{"1 < 1", false},
 		{"1 > 1", false},
+		{"1 <= 1", true},
+		{"2 <= 1", false},
+		{"1 >= 1", true},
+		{"1 >= 2", false},
 		{"1 == 1", true},
 		{"1 != 1", false},
 		{"1 == 2", false},
@@ -71,6 +122,59 @@ func TestBooleanExpressions(t *testing.T) {
 	runVmTests(t, tests)
 }
 
+// TestBooleanSingletons checks that boolean results are the VM's shared True
+// and False rather than fresh objects, whichever instruction produced them.
+func TestBooleanSingletons(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected *object.Boolean
+	}{
+		{"true", True},
+		{"false", False},
+		{"1 < 2", True},
+		{"1 == 1", True},
+		{"1 != 1", False},
+		{`"a" == "b"`, False},
+		{"true == true", True},
+		{"(1 < 2) == true", True},
+		{"[1] == [1]", True},
+		{"!true", False},
+		{"!5", False},
+		{"!null", True},
+		{"true && false", False},
+		{"false || true", True},
+		{"true & true", True},
+		{"false | false", False},
+		{"contains([1, 2], 2)", True},
+	}
+	for _, tt := range tests {
+		comp := compiler.NewCompiler()
+		if err := comp.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		vm := NewVM(comp.ByteCode())
+		if err := vm.RunVM(); err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+		if result := vm.LastPoppedStackElement(); result != tt.expected {
+			t.Errorf("%s: result is not the %s singleton. got=%T (%p)",
+				tt.input, tt.expected.Inspect(), result, result)
+		}
+	}
+}
+
+func TestNullLiteral(t *testing.T) {
+	tests := []vmTestCase{
+		{"null", Null},
+		{"let x = null; x", Null},
+		{"let x = null; x == null", true},
+		{"let x = null; x != null", false},
+		{"let x = 1; x == null", false},
+		{"!null", true},
+	}
+	runVmTests(t, tests)
+}
+
 func TestConditionals(t *testing.T) {
 	tests := []vmTestCase{
 		{"if (true) { 10 }", 10},
@@ -87,6 +191,48 @@ func TestConditionals(t *testing.T) {
 	runVmTests(t, tests)
 }
 
+func TestConditionalsWithDifferentlyTypedBranches(t *testing.T) {
+	tests := []vmTestCase{
+		{`if (true) { 1 } else { "two" }`, 1},
+		{`if (false) { 1 } else { "two" }`, "two"},
+		{`if (1 > 2) { "one" } else { [2, 3] }`, []int{2, 3}},
+		{`if (1 < 2) { [1] } else { 2 }`, []int{1}},
+		{`if (false) { 1 } else { if (true) { "inner" } else { [3] } }`, "inner"},
+		{`if (true) { if (false) { "a" } else { [4, 5] } } else { 6 }`, []int{4, 5}},
+		{`let x = if (false) { "a" } else { 7 }; x + 1`, 8},
+		{`len([if (true) { "a" } else { 1 }, if (false) { "b" } else { [2] }])`, 2},
+	}
+	runVmTests(t, tests)
+
+	// whichever branch is taken leaves exactly one value, which the
+	// expression statement pops again
+	for _, tt := range tests {
+		comp := compiler.NewCompiler()
+		if err := comp.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		vm := NewVM(comp.ByteCode())
+		if err := vm.RunVM(); err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+		if vm.sp != 0 {
+			t.Errorf("%s: stack not balanced. sp=%d", tt.input, vm.sp)
+		}
+	}
+}
+
+func TestElseIfChains(t *testing.T) {
+	sign := `let sign = func(x) { if (x < 0) { -1 } else if (x == 0) { 0 } else { 1 } };`
+	tests := []vmTestCase{
+		{sign + "sign(-5)", -1},
+		{sign + "sign(0)", 0},
+		{sign + "sign(7)", 1},
+		{"if (false) { 1 } else if (false) { 2 }", Null},
+		{"if (false) { 1 } else if (false) { 2 } else if (true) { 3 } else { 4 }", 3},
+	}
+	runVmTests(t, tests)
+}
+
 func TestGlobalLetStatements(t *testing.T) {
 	tests := []vmTestCase{
 		{"let one = 1; one", 1},
@@ -96,13 +242,383 @@ func TestGlobalLetStatements(t *testing.T) {
 	runVmTests(t, tests)
 }
 
+func TestMultiLetStatements(t *testing.T) {
+	tests := []vmTestCase{
+		{"let a, b = 1, 2; [a, b]", []int{1, 2}},
+		{"let a, b = 1, 2; let a, b = b, a; [a, b]", []int{2, 1}},
+		{"let a, b, c = 1, 2, 3; let a, b, c = c, a, b; [a, b, c]", []int{3, 1, 2}},
+		{"let f = func(x, y) { let x, y = y, x; x - y }; f(1, 10)", 9},
+		{"let a = 1; let a, b = a + 1, a + 2; [a, b]", []int{2, 3}},
+		{"let a, b = 1, 2; if (true) { let a, b = b, a; [a, b] }", []int{2, 1}},
+		{"let a, b = 1, 2; if (true) { let a, b = b, a; }; [a, b]", []int{1, 2}},
+	}
+	runVmTests(t, tests)
+	runAgainstEvaluator(t, tests)
+}
+
+func TestClosures(t *testing.T) {
+	tests := []vmTestCase{
+		{"func(a) { func(b) { a + b } }(1)(2)", 3},
+		{"let f = func(a) { let g = func() { a }; g() }; f(5)", 5},
+		{
+			`let adder = func(a) { func(b) { a + b } };
+			let addTwo = adder(2);
+			let addTen = adder(10);
+			addTwo(1) + addTen(1)`,
+			14,
+		},
+		{
+			`let outer = func(a) {
+				let b = a * 2;
+				func(c) {
+					let d = c + 1;
+					func(e) { a + b + c + d + e }
+				}
+			};
+			outer(1)(10)(100)`,
+			124,
+		},
+		{
+			`let f = func(x) {
+				if (x > 0) { let y = x * 10; func() { y + x } } else { func() { 0 } }
+			};
+			f(2)() + f(-1)()`,
+			22,
+		},
+		{
+			`let makers = func() {
+				let fs = [];
+				for (let i = 0; i < 3; i = i + 1) { let j = i; fs = push(fs, func() { j }) }
+				fs
+			};
+			let fs = makers();
+			fs[0]() * 100 + fs[1]() * 10 + fs[2]()`,
+			12,
+		},
+		{"let f = func(limit) { take_while([1, 2, 3, 4], func(x) { x < limit }) }; f(3)", []int{1, 2}},
+		{"let f = func(a) { func(b = a) { b } }; f(7)() + f(7)(1)", 8},
+		{"let counter = func() { let n = [0]; func() { set(n, 0, n[0] + 1); n[0] } }; let c = counter(); c(); c()", 2},
+	}
+	runVmTests(t, tests)
+	runAgainstEvaluator(t, tests)
+}
+
+func TestAssigningCapturedVariables(t *testing.T) {
+	tests := []vmTestCase{
+		{"let counter = func() { let n = 0; func() { n = n + 1; n } }; let c = counter(); c(); c()", 2},
+		// every call of the outer function makes a variable of its own
+		{
+			`let counter = func() { let n = 0; func() { n = n + 1; n } };
+			let a = counter(); let b = counter();
+			a(); a(); b(); [a(), b()]`,
+			[]int{3, 2},
+		},
+		// the function and its closures share the variable both ways
+		{
+			`let f = func(x) {
+				let get = func() { x };
+				let set = func(v) { x = v };
+				set(5);
+				let seen = get();
+				x = x + 1;
+				[seen, get(), x]
+			};
+			f(1)`,
+			[]int{5, 6, 6},
+		},
+		// through a function in between that does not use the variable
+		{"let f = func() { let n = 1; let g = func() { func() { n = n * 10 } }; g()(); g()(); n }; f()", 100},
+		// a loop variable assigned by the loop is shared by the closures made in it
+		{
+			`let f = func() {
+				let fs = [];
+				for (let i = 0; i < 3; i = i + 1) { fs = push(fs, func() { i }) }
+				[fs[0](), fs[2]()]
+			};
+			f()`,
+			[]int{3, 3},
+		},
+		// a let run again makes a new variable
+		{
+			`let f = func() {
+				let fs = [];
+				for (let i = 0; i < 3; i = i + 1) { let j = i; fs = push(fs, func() { j = j * 2; j }) }
+				[fs[0](), fs[1](), fs[2](), fs[2]()]
+			};
+			f()`,
+			[]int{0, 2, 4, 8},
+		},
+		{"let f = func(a, b = 2) { let g = func() { b = b + a }; g(); b }; [f(1), f(1, 10)]", []int{3, 11}},
+	}
+	runVmTests(t, tests)
+	runAgainstEvaluator(t, tests)
+}
+
+func TestLocalRecursiveFunctions(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			`let f = func() {
+				let r = func(n) { if (n == 0) { 0 } else { r(n - 1) } };
+				r(3)
+			};
+			f()`,
+			0,
+		},
+		{
+			`let sum = func(n) {
+				let go = func(i, acc) { if (i > n) { acc } else { go(i + 1, acc + i) } };
+				go(1, 0)
+			};
+			sum(10)`,
+			55,
+		},
+		// functions calling each other, the first referring to the second
+		// before its let
+		{
+			`let f = func() {
+				let ev = func(n) { if (n == 0) { true } else { od(n - 1) } };
+				let od = func(n) { if (n == 0) { false } else { ev(n - 1) } };
+				[ev(10), od(10), ev(7)] == [true, false, false]
+			};
+			f()`,
+			true,
+		},
+		// the closure keeps calling the function it was made with
+		{
+			`let f = func() {
+				let r = func(n) { if (n == 0) { "done" } else { r(n - 1) } };
+				r
+			};
+			let r = f(); r(5)`,
+			"done",
+		},
+	}
+	runVmTests(t, tests)
+	runAgainstEvaluator(t, tests)
+}
+
+func TestConstStatements(t *testing.T) {
+	tests := []vmTestCase{
+		{"const pi = 3; pi * 2", 6},
+		{"const a = [1]; let b = push(a, 2); b", []int{1, 2}},
+		{"const a = 1; if (true) { let a = 2; a = 3; a }", 3},
+		{"const a = 1; let f = func(a) { a = a + 1; a }; f(a)", 2},
+	}
+	runVmTests(t, tests)
+	runAgainstEvaluator(t, tests)
+}
+
+func TestArrayLetStatements(t *testing.T) {
+	tests := []vmTestCase{
+		{"let [a, b, c] = [1, 2, 3]; a * 100 + b * 10 + c", 123},
+		{"let [a, b, c] = [1, 2]; [a, b]", []int{1, 2}},
+		{"let [a, b, c] = [1, 2]; c", Null},
+		{"let [a, b] = []; b", Null},
+		{"let [a] = [1, 2, 3]; a", 1},
+		{"let [head, ...tail] = [1, 2, 3]; head", 1},
+		{"let [head, ...tail] = [1, 2, 3]; tail", []int{2, 3}},
+		{"let [a, b, ...rest] = [1]; b", Null},
+		{"let [a, b, ...rest] = [1]; rest", []int{}},
+		{"let [...all] = [1, 2]; all", []int{1, 2}},
+		{"let a = 1; let b = 2; let [a, b] = [b, a]; [a, b]", []int{2, 1}},
+		{
+			`let sum = func(arr) {
+				if (len(arr) == 0) { return 0; }
+				let [x, ...xs] = arr;
+				x + sum(xs)
+			};
+			sum([1, 2, 3, 4])`,
+			10,
+		},
+	}
+	runVmTests(t, tests)
+	runAgainstEvaluator(t, tests)
+}
+
+func TestHashLetStatements(t *testing.T) {
+	tests := []vmTestCase{
+		{`let {name, age} = {"name": "Ada", "age": 36}; name + " is " + str(age)`, "Ada is 36"},
+		{`let {age} = {"name": "Ada", "age": 36}; age`, 36},
+		{`let {name, email} = {"name": "Ada"}; email`, Null},
+		{`let {a} = {1: "one", true: "yes"}; a`, Null},
+		{`let a = 1; let {a, b} = {"a": a + 1, "b": a}; [a, b]`, []int{2, 1}},
+		{
+			`let greet = func(person) {
+				let {first, last} = person;
+				first + " " + last
+			};
+			greet({"first": "Ada", "last": "Lovelace"})`,
+			"Ada Lovelace",
+		},
+	}
+	runVmTests(t, tests)
+	runAgainstEvaluator(t, tests)
+}
+
+func TestBlockScopedLetStatements(t *testing.T) {
+	tests := []vmTestCase{
+		{"if (true) { let a = 1; a } + if (true) { let a = 2; a }", 3},
+		{"let x = 1; if (true) { let x = 2; }; x", 1},
+		{"let x = 1; if (true) { let x = 2; x }", 2},
+		{"let x = 1; if (true) { x = 2; }; x", 2},
+		{"let x = 1; if (true) { if (true) { let x = 3; }; x }", 1},
+		{"let sum = 0; for (let i = 0; i < 3; i = i + 1) { let step = i * 2; sum = sum + step; } sum", 6},
+		{"let i = 10; for (let i = 0; i < 3; i = i + 1) { } i", 10},
+		{"let f = func(r) { if (true) { let r = 5; }; r }; f(1)", 1},
+		{"let f = func() { let n = 0; if (true) { let a = 1; n = n + a; }; if (true) { let b = 2; n = n + b; }; n }; f()", 3},
+	}
+	runVmTests(t, tests)
+	runAgainstEvaluator(t, tests)
+}
+
 func TestStringExpressions(t *testing.T) {
 	tests := []vmTestCase{
 		{`"monkey"`, "monkey"},
 		{`"mon" + "key"`, "monkey"},
 		{`"mon" + "key" + "banana"`, "monkeybanana"},
+		{`"monkey" == "mon" + "key"`, true},
+		{`"monkey" != "monkey"`, false},
+		{`"a" == "b"`, false},
+		{`let s = "x"; s == "x"`, true},
+		{`"a" == "a"`, true},
+		{`"a" < "b"`, true},
+		{`"b" < "a"`, false},
+		{`"b" > "a"`, true},
+		{`"a" > "a"`, false},
+		{`"apple" < "banana"`, true},
+		{`"ab" < "abc"`, true},
+		{`"abc" > "ab"`, true},
+		{`"abc" <= "abc"`, true},
+		{`"abd" <= "abc"`, false},
+		{`"ab" >= "abc"`, false},
+		{`"B" < "a"`, true},
+	}
+	runVmTests(t, tests)
+	runAgainstEvaluator(t, tests)
+}
+
+func TestIntegerOverflow(t *testing.T) {
+	tests := []vmTestCase{
+		// the largest and smallest results still fit
+		{"9223372036854775806 + 1", 9223372036854775807},
+		{"-9223372036854775807 - 1 == -9223372036854775807 - 1", true},
+		{"(-2) ** 63 == -9223372036854775807 - 1", true},
+		{"4611686018427387903 * 2 + 1", 9223372036854775807},
+		{"abs(-9223372036854775807)", 9223372036854775807},
+		{"9223372036854775807 + 1", &object.Error{Message: "integer overflow"}},
+		{"3037000500 * 3037000500", &object.Error{Message: "integer overflow"}},
+		{"pow(10, 19)", &object.Error{Message: "integer overflow"}},
+		{"abs(-9223372036854775807 - 1)", &object.Error{Message: "integer overflow"}},
+	}
+	runVmTests(t, tests[:5])
+	runAgainstEvaluator(t, tests[:5])
+
+	for _, tt := range tests[5:] {
+		comp := compiler.NewCompiler()
+		if err := comp.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		vm := NewVM(comp.ByteCode())
+		vm.EnableErrorValues()
+		if err := vm.RunVM(); err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+		testExpectedObject(t, tt.expected, vm.LastPoppedStackElement())
+
+		evaluated := evaluator.Evaluate(parse(tt.input), object.NewEnvironment())
+		testExpectedObject(t, tt.expected, evaluated)
+	}
+}
+
+func TestStringInterpolation(t *testing.T) {
+	tests := []vmTestCase{
+		{`let a = 2; "a=${a}"`, "a=2"},
+		{`let a = 2; "a=${a}" == "a=2"`, true},
+		{`let a = 1; let b = 2; "sum is ${a + b}"`, "sum is 3"},
+		{`"${1}${2}${3}"`, "123"},
+		{`"${"nested ${"strings"}"}"`, "nested strings"},
+		{`"${true}, ${null}, ${[1, "a"]}"`, "true, nil, [1, a]"},
+		{`"${ {"k": "v"}["k"] }"`, "v"},
+		{`let f = func(x) { x * 2 }; "f(3) = ${f(3)}"`, "f(3) = 6"},
+		{`let name = "monkey"; "hi ${name}"`, "hi monkey"},
+		{`"cost: \${x}"`, "cost: ${x}"},
+		{`let str = 5; "${str}"`, "5"},
+		{`str(42) + str("!")`, "42!"},
+	}
+	runVmTests(t, tests)
+	runAgainstEvaluator(t, tests)
+}
+
+func TestStringRepetition(t *testing.T) {
+	tests := []vmTestCase{
+		{`"ab" * 3`, "ababab"},
+		{`"ab" * 3 == "ababab"`, true},
+		{`3 * "ab"`, "ababab"},
+		{`"x" * 0`, ""},
+		{`"x" * 0 == ""`, true},
+		{`"" * 5`, ""},
+		{`"-" * 2 + "|"`, "--|"},
+		{`let n = 2; "ab" * (n + 1)`, "ababab"},
+		{`len("abc" * 4)`, 12},
+		// refused before anything is allocated
+		{`"a" * 1000000000000`, &object.Error{Message: "repeated string too long: 1000000000000 * 1 bytes"}},
+		{`"ab" * 134217729`, &object.Error{Message: "repeated string too long: 134217729 * 2 bytes"}},
+	}
+	runVmTests(t, tests[:len(tests)-2])
+	runAgainstEvaluator(t, tests)
+
+	for _, tt := range tests[len(tests)-2:] {
+		comp := compiler.NewCompiler()
+		if err := comp.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		vm := NewVM(comp.ByteCode())
+		vm.EnableErrorValues()
+		if err := vm.RunVM(); err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+		testExpectedObject(t, tt.expected, vm.LastPoppedStackElement())
+	}
+}
+
+func TestArrayConcatenation(t *testing.T) {
+	tests := []vmTestCase{
+		{"[1, 2] + [3, 4]", []int{1, 2, 3, 4}},
+		{"[1, 2] + [3, 4] == [1, 2, 3, 4]", true},
+		{"[] + [1]", []int{1}},
+		{"[1] + []", []int{1}},
+		{"[] + []", []int{}},
+		{"[1] + [2] + [3]", []int{1, 2, 3}},
+		{`len([[1], "a"] + [true])`, 3},
+		// the operands are left unchanged
+		{"let a = [1, 2]; let b = [3]; let c = a + b; a", []int{1, 2}},
+		{"let a = [1, 2]; let b = [3]; let c = a + b; b", []int{3}},
+		{"let a = [1]; let b = a + a; b", []int{1, 1}},
 	}
 	runVmTests(t, tests)
+	runAgainstEvaluator(t, tests)
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{"[1] + 1", "invalid types for binary operation: ARRAY INTEGER"},
+		{`"a" + [1]`, "invalid types for binary operation: STRING ARRAY"},
+		{"[1] - [1]", fmt.Sprintf("invalid array operation: %d", code.OpSub)},
+	}
+	for _, tt := range errorTests {
+		comp := compiler.NewCompiler()
+		if err := comp.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		err := NewVM(comp.ByteCode()).RunVM()
+		if err == nil {
+			t.Fatalf("%s: expected VM error but resulted in none.", tt.input)
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("wrong VM error: want=%q, got=%q", tt.expected, err.Error())
+		}
+	}
 }
 
 func TestArrayLiterals(t *testing.T) {
@@ -137,6 +653,109 @@ func TestHashLiterals(t *testing.T) {
 	runVmTests(t, tests)
 }
 
+func TestIntegerAndBooleanHashKeys(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			"{1: 10, true: 20, 0: 30, false: 40}",
+			map[object.HashKey]int64{
+				(&object.Integer{Value: 1}).HashKey():     10,
+				(&object.Boolean{Value: true}).HashKey():  20,
+				(&object.Integer{Value: 0}).HashKey():     30,
+				(&object.Boolean{Value: false}).HashKey(): 40,
+			},
+		},
+		{`{1: "a", true: "b"}[1]`, "a"},
+		{`{1: "a", true: "b"}[true]`, "b"},
+		{`{0: "zero", false: "no"}[0]`, "zero"},
+		{`{0: "zero", false: "no"}[false]`, "no"},
+		{`let h = {1: "a", true: "b"}; h[2 - 1] + h[1 < 2]`, "ab"},
+		{`{-1: "minus one"}[0 - 1]`, "minus one"},
+		{`{9223372036854775807: "max"}[9223372036854775807]`, "max"},
+		{`{1: "a"}[true]`, Null},
+		{`{true: "b"}[1]`, Null},
+	}
+	runVmTests(t, tests)
+	runAgainstEvaluator(t, tests[1:])
+}
+
+func TestDuplicateHashKeysAtRuntime(t *testing.T) {
+	pairs := make([]string, 300)
+	for i := range pairs {
+		pairs[i] = fmt.Sprintf("%d: %d", i+1, i)
+	}
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let k = "a"; {k: 1, "a": 2}`, "duplicate key in hash literal: a"},
+		{`let one = func() { 1 }; {one(): 1, 1: 2}`, "duplicate key in hash literal: 1"},
+		{
+			// the duplicate may end up in another chunk of a large literal
+			"let k = 300; {k: 0, " + strings.Join(pairs, ", ") + "}",
+			"duplicate key in hash literal: 300",
+		},
+	}
+	for _, tt := range tests {
+		comp := compiler.NewCompiler()
+		if err := comp.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		vm := NewVM(comp.ByteCode())
+		err := vm.RunVM()
+		if err == nil {
+			t.Fatalf("expected VM error but resulted in none.")
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("wrong VM error: want=%q, got=%q", tt.expected, err.Error())
+		}
+	}
+}
+
+func TestCollectionEquality(t *testing.T) {
+	tests := []vmTestCase{
+		{"[] == []", true},
+		{"[1, 2] == [1, 2]", true},
+		{"[1, 2] != [1, 2]", false},
+		{"[1, 2] == [2, 1]", false},
+		{"[1, 2] == [1, 2, 3]", false},
+		{`[1, "a", true] == [1, "a", true]`, true},
+		{"[[1, 2], [3]] == [[1, 2], [3]]", true},
+		{"[[1, 2], [3]] == [[1, 2], [4]]", false},
+		{"[[1, 2], [3]] != [[1, 2], [4]]", true},
+		{`{"a": 1, "b": 2} == {"b": 2, "a": 1}`, true},
+		{`{"a": 1, "b": 2} == {"a": 1, "b": 3}`, false},
+		{`{"a": 1} == {"a": 1, "b": 2}`, false},
+		{`{"a": [1, 2]} == {"a": [1, 2]}`, true},
+		{`{"a": 1} != {"a": 2}`, true},
+		{`let a = [1]; let b = a; a == b`, true},
+		{`[1] == {}`, false},
+	}
+	runVmTests(t, tests)
+}
+
+func TestLargeLiterals(t *testing.T) {
+	const size = 10000
+
+	elements := make([]string, size)
+	pairs := make([]string, size)
+	for i := range elements {
+		elements[i] = fmt.Sprint(i)
+		pairs[i] = fmt.Sprintf("%d: %d", i, i*2)
+	}
+	array := "[" + strings.Join(elements, ", ") + "]"
+	hash := "{" + strings.Join(pairs, ", ") + "}"
+	nested := strings.Repeat("[", size) + "1" + strings.Repeat("]", size)
+
+	tests := []vmTestCase{
+		{fmt.Sprintf("len(%s)", array), size},
+		{fmt.Sprintf("%s[0] + %s[%d]", array, array, size-1), size - 1},
+		{fmt.Sprintf("%s[%d]", hash, size-1), (size - 1) * 2},
+		{fmt.Sprintf("let h = %s; h[0] + h[5000]", hash), 10000},
+		{fmt.Sprintf("len(%s)", nested), 1},
+	}
+	runVmTests(t, tests)
+}
+
 func TestIndexExpressions(t *testing.T) {
 	tests := []vmTestCase{
 		{"[1, 2, 3][1]", 2},
@@ -153,6 +772,21 @@ func TestIndexExpressions(t *testing.T) {
 	runVmTests(t, tests)
 }
 
+func TestStringIndexExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{`"abc"[0]`, "a"},
+		{`"héllo"[1]`, "é"},
+		{`"héllo"[2]`, "l"},
+		{`"日本語"[len("日本語") - 1]`, "語"},
+		{`"abc"[3]`, Null},
+		{`"abc"[-1]`, Null},
+		{`""[0]`, Null},
+		{`let s = "añb"; s[0] + s[1] + s[2] == s`, true},
+	}
+	runVmTests(t, tests)
+	runAgainstEvaluator(t, tests)
+}
+
 func TestCallingFunctionsWithoutArguments(t *testing.T) {
 	tests := []vmTestCase{
 		{
@@ -209,40 +843,650 @@ func TestCallingFunctionsWithoutArguments(t *testing.T) {
 			`,
 			expected: Null,
 		},
+		{
+			input: `
+			let onlyLet = func() { let a = 1; };
+			onlyLet();
+			`,
+			expected: Null,
+		},
 	}
 	runVmTests(t, tests)
 }
 
-func TestFirstClassFunctions(t *testing.T) {
+func TestEarlyReturnsFromConditionals(t *testing.T) {
+	sign := `let sign = func(x) { if (x > 0) { return 1 } return -1 };`
+	nested := `
+	let classify = func(x) {
+		if (x > 0) {
+			if (x > 100) { return 3; }
+			if (x > 10) { return 2; }
+			return 1;
+		}
+		0
+	};`
 	tests := []vmTestCase{
-		{
-			input: `
-			let returnsOne = func() { 1; };
-			let returnsOneReturner = func() { returnsOne; };
-			returnsOneReturner()();
-			`,
-			expected: 1,
-		},
-		{
-			input: `
-			let returnsOneReturner = func() {
-				let returnsOne = func() { 1; };
-				returnsOne;
-			};
-			returnsOneReturner()();
-			`,
-			expected: 1,
-		},
+		{sign + "sign(5)", 1},
+		{sign + "sign(-5)", -1},
+		{sign + "sign(5) + sign(-5) + sign(5)", 1},
+		{nested + "classify(500)", 3},
+		{nested + "classify(50)", 2},
+		{nested + "classify(5)", 1},
+		{nested + "classify(-5)", 0},
+		{nested + "[classify(500), classify(5), classify(-5)]", []int{3, 1, 0}},
+		{"let f = func() { if (true) { let a = 1; } }; f()", Null},
+		{"let f = func() { if (false) { 1 } else { } }; f()", Null},
+		{"let f = func(x) { let y = if (x) { 10 } else { let z = 1; }; y }; f(true)", 10},
+		{"let f = func(x) { let y = if (x) { 10 } else { let z = 1; }; y }; f(false)", Null},
+		{"if (true) { } 5", 5},
+		{"if (true) { return 5; } 10", 5},
+		{"return 3; 4", 3},
+		{"let x = 1; if (x > 0) { if (x < 2) { return x * 2 } } x", 2},
+		{"let x = 1; if (x > 5) { return x * 2 } x", 1},
+		{"for (let i = 0; ; i = i + 1) { if (i == 3) { return i } }", 3},
+		{sign + "switch (sign(-2)) { case -1: return 7; default: 8 }", 7},
+		{"let f = func(x) { if (x > 0) { return 1; } return 2; }; [f(3), f(-3)]", []int{1, 2}},
+		{"let f = func() { for (let i = 0; ; i = i + 1) { if (i == 4) { return i } } }; f()", 4},
 	}
 	runVmTests(t, tests)
+	runAgainstEvaluator(t, tests)
 }
 
-func TestCallingFunctionsWithBindings(t *testing.T) {
+// runAgainstEvaluator checks that the tree-walking evaluator agrees with the
+// expected results of the VM tests.
+func runAgainstEvaluator(t *testing.T, tests []vmTestCase) {
+	t.Helper()
+
+	for _, tt := range tests {
+		evaluated := evaluator.Evaluate(parse(tt.input), object.NewEnvironment())
+		if evaluated == nil {
+			evaluated = evaluator.NULL
+		}
+		if evaluated == evaluator.NULL {
+			evaluated = Null
+		}
+		testExpectedObject(t, tt.expected, evaluated)
+	}
+}
+
+func TestBooleanOperators(t *testing.T) {
 	tests := []vmTestCase{
-		{
-			input: `
-			let one = func() { let one = 1; one };
-			one();
+		{"6 & 3", 2},
+		{"6 | 3", 7},
+		{"~0 & 12 | 1", 13},
+		{"1 < 2 & 2 < 3", true},
+		{"1 > 2 | 2 > 3", false},
+		{"1 && 0", true},
+		{"null || false", false},
+		{"if (1 > 2 || 2 < 3) { 10 } else { 20 }", 10},
+		{"let f = func(a, b) { a && b || !a }; f(true, false)", false},
+		{"let f = func(a, b) { a && b || !a }; f(false, false)", true},
+		// && and || only evaluate the right side when it decides the result
+		{"let n = 0; let bump = func() { n = n + 1; true }; false && bump(); n", 0},
+		{"let n = 0; let bump = func() { n = n + 1; true }; true || bump(); n", 0},
+		{"let n = 0; let bump = func() { n = n + 1; true }; true && bump(); n", 1},
+		{"let n = 0; let bump = func() { n = n + 1; true }; false || bump(); n", 1},
+		{"false && 1 / 0", false},
+		// & and | always evaluate both sides
+		{"let n = 0; let bump = func() { n = n + 1; true }; false & bump(); n", 1},
+		{"let n = 0; let bump = func() { n = n + 1; true }; true | bump(); n", 1},
+	}
+	runVmTests(t, tests)
+	runAgainstEvaluator(t, tests)
+}
+
+func TestEagerAndShortCircuitOperatorsAgree(t *testing.T) {
+	var tests []vmTestCase
+	for _, left := range []string{"true", "false"} {
+		for _, right := range []string{"true", "false"} {
+			for _, ops := range [][2]string{{"&", "&&"}, {"|", "||"}} {
+				eager := fmt.Sprintf("%s %s %s", left, ops[0], right)
+				lazy := fmt.Sprintf("%s %s %s", left, ops[1], right)
+				tests = append(tests, vmTestCase{"(" + eager + ") == (" + lazy + ")", true})
+			}
+		}
+	}
+	runVmTests(t, tests)
+	runAgainstEvaluator(t, tests)
+}
+
+func TestSetBuiltin(t *testing.T) {
+	tests := []vmTestCase{
+		{"let a = [1, 2, 3]; set(a, 1, 5); a", []int{1, 5, 3}},
+		{`let h = {"a": 1}; set(h, "b", 2); h["b"]`, 2},
+		{`let h = {"a": 1}; set(h, "a", 3); h["a"]`, 3},
+		// set hands back the collection itself, not a copy
+		{"let a = [1]; let b = set(a, 0, 2); set(b, 0, 7); a[0]", 7},
+		{"let a = [1]; let b = a; set(b, 0, 9); a", []int{9}},
+		{
+			`let fill = func(arr, v) {
+				for (let i = 0; i < len(arr); i = i + 1) { set(arr, i, v); }
+			};
+			let a = [1, 2, 3];
+			fill(a, 0);
+			a`,
+			[]int{0, 0, 0},
+		},
+		{"let a = [1]; let b = a + [2]; set(b, 0, 5); a", []int{1}},
+		{"let a = [1]; let b = push(a, 2); set(b, 0, 5); a", []int{1}},
+	}
+	runVmTests(t, tests)
+	runAgainstEvaluator(t, tests)
+
+	errorTests := []vmTestCase{
+		{
+			"set([1], 1, 0)",
+			&object.Error{Message: "index out of range for `set`: 1 (length 1)"},
+		},
+		{
+			"set([1], -1, 0)",
+			&object.Error{Message: "index out of range for `set`: -1 (length 1)"},
+		},
+		{
+			`set([1], "0", 0)`,
+			&object.Error{Message: "index to `set` must be INTEGER, got STRING"},
+		},
+		{
+			"set({}, [1], 0)",
+			&object.Error{Message: "unusable as hash key: ARRAY"},
+		},
+		{
+			`set("abc", 0, "x")`,
+			&object.Error{Message: "argument to `set` must be ARRAY or HASH, got STRING"},
+		},
+		{
+			"let a = [1]; set(a, 0, [[a]])",
+			&object.Error{Message: "`set` cannot store a collection inside itself"},
+		},
+		{
+			"set([1], 0)",
+			&object.Error{Message: "wrong number of arguments. got=2, want=3"},
+		},
+	}
+	runVmTests(t, errorTests)
+}
+
+func TestDeleteBuiltin(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			`let h = {"a": 1, "b": 2, 3: 3, true: 4}; delete(h, "a"); h`,
+			map[object.HashKey]int64{
+				(&object.String{Value: "b"}).HashKey():   2,
+				(&object.Integer{Value: 3}).HashKey():    3,
+				(&object.Boolean{Value: true}).HashKey(): 4,
+			},
+		},
+		{`let h = {"a": 1}; delete(h, "a"); h`, map[object.HashKey]int64{}},
+		// a missing key leaves the hash as it was
+		{
+			`let h = {"a": 1}; delete(h, "b"); h`,
+			map[object.HashKey]int64{(&object.String{Value: "a"}).HashKey(): 1},
+		},
+	}
+	runVmTests(t, tests)
+
+	lookups := []vmTestCase{
+		{`let h = {"a": 1, "b": 2}; delete(h, "a"); h["a"]`, Null},
+		{`let h = {"a": 1, "b": 2}; delete(h, "a"); h["b"]`, 2},
+		{`let h = {1: "x", true: "y"}; delete(h, 1); h[true]`, "y"},
+		{`let h = {1: "x", true: "y"}; delete(h, 1); h[1]`, Null},
+		// delete hands back the hash itself, like set
+		{`let h = {"a": 1}; let g = delete(h, "b"); set(g, "c", 3); h["c"]`, 3},
+		{`let h = {"a": 1}; let g = h; delete(g, "a"); h["a"]`, Null},
+		{`let h = {"a": 1}; delete(h, "a"); set(h, "a", 5); h["a"]`, 5},
+	}
+	runVmTests(t, lookups)
+	runAgainstEvaluator(t, lookups)
+
+	errorTests := []vmTestCase{
+		{
+			"delete({}, [1])",
+			&object.Error{Message: "unusable as hash key: ARRAY"},
+		},
+		{
+			`delete([1], 0)`,
+			&object.Error{Message: "argument to `delete` must be HASH, got ARRAY"},
+		},
+		{
+			`delete({})`,
+			&object.Error{Message: "wrong number of arguments. got=1, want=2"},
+		},
+	}
+	runVmTests(t, errorTests)
+}
+
+func TestRecursiveFunctions(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			`let isEven = func(n) { if (n == 0) { true } else { isOdd(n - 1) } };
+			let isOdd = func(n) { if (n == 0) { false } else { isEven(n - 1) } };
+			isEven(10)`,
+			true,
+		},
+		{
+			`let isEven = func(n) { if (n == 0) { true } else { isOdd(n - 1) } };
+			let isOdd = func(n) { if (n == 0) { false } else { isEven(n - 1) } };
+			isOdd(7)`,
+			true,
+		},
+		{
+			`let isEven = func(n) { if (n == 0) { true } else { isOdd(n - 1) } };
+			let isOdd = func(n) { if (n == 0) { false } else { isEven(n - 1) } };
+			[isEven(7), isOdd(10)] == [false, false]`,
+			true,
+		},
+		{
+			`let factorial = func(n) { if (n == 0) { return 1; } n * factorial(n - 1) };
+			factorial(5)`,
+			120,
+		},
+		{
+			`let run = func() { later(2) };
+			let later = func(x) { x * 10 };
+			run()`,
+			20,
+		},
+	}
+	runVmTests(t, tests)
+	runAgainstEvaluator(t, tests)
+}
+
+func TestFunctionUsedBeforeItsDefinition(t *testing.T) {
+	comp := compiler.NewCompiler()
+	if err := comp.Compile(parse("let a = func() { b() }; a(); let b = func() { 1 };")); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	err := NewVM(comp.ByteCode()).RunVM()
+	if err == nil || err.Error() != "b used before its definition" {
+		t.Errorf("wrong error. got=%v", err)
+	}
+}
+
+func TestUninitializedGlobals(t *testing.T) {
+	ins, err := code.Assemble(`
+	OpConstant 0
+	OpSetGlobal 0
+	OpGetGlobal 1
+	OpPop
+	`)
+	if err != nil {
+		t.Fatalf("assemble error: %s", err)
+	}
+	bytecode := &compiler.ByteCode{Instructions: ins, Constants: []object.Object{&object.Integer{Value: 1}}}
+
+	err = NewVM(bytecode).RunVM()
+	var errOb *object.Error
+	if !errors.As(err, &errOb) || errOb.Kind != object.NameError {
+		t.Fatalf("expected a NameError, got=%T (%v)", err, err)
+	}
+	if errOb.Message != "use of uninitialized variable: global 1" {
+		t.Errorf("wrong error message. got=%q", errOb.Message)
+	}
+
+	// a globals store smaller than the program needs is an error, not a panic
+	err = NewVMWithGlobalsStore(bytecode, make([]object.Object, 1)).RunVM()
+	if err == nil || err.Error() != "global index out of range: 1 (globals size 1)" {
+		t.Errorf("wrong error for a short globals store. got=%v", err)
+	}
+	err = NewVMWithGlobalsStore(bytecode, nil).RunVM()
+	if err == nil || err.Error() != "global index out of range: 0 (globals size 0)" {
+		t.Errorf("wrong error for an empty globals store. got=%v", err)
+	}
+}
+
+func TestForLoops(t *testing.T) {
+	tests := []vmTestCase{
+		{"let sum = 0; for (let i = 1; i < 6; i = i + 1) { sum = sum + i; } sum", 15},
+		{"let sum = 0; let i = 1; for (; i < 6; ) { sum = sum + i; i = i + 1; } sum", 15},
+		{"let n = 0; for (let i = 0; false; i = i + 1) { n = 1; } n", 0},
+		{
+			`let total = func(arr) {
+				let sum = 0;
+				for (let i = 0; i < len(arr); i = i + 1) { sum = sum + arr[i]; }
+				sum
+			};
+			total([1, 2, 3, 4, 5])`,
+			15,
+		},
+		{
+			`let find = func(arr, x) {
+				for (let i = 0; i < len(arr); i = i + 1) {
+					if (arr[i] == x) { return i; }
+				}
+				-1
+			};
+			[find([4, 5, 6], 6), find([4, 5, 6], 7)]`,
+			[]int{2, -1},
+		},
+		{
+			`let firstOver = func(limit) {
+				for (let i = 0; ; i = i + 1) {
+					if (i * i > limit) { return i; }
+				}
+			};
+			firstOver(50)`,
+			8,
+		},
+		{"let f = func() { for (let i = 0; i < 3; i = i + 1) { i } }; f()", Null},
+		// a loop results in no value, not in the condition that ended it
+		{"for (let i = 0; i < 3; i = i + 1) { i }", Null},
+		{"for (;;) { break }", Null},
+		{"let n = 0; for (; n < 3; ) { n = n + 1 }; n", 3},
+	}
+	runVmTests(t, tests)
+	runAgainstEvaluator(t, tests)
+}
+
+func TestSwitchExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{`switch (2) { case 1: "one" case 2: "two" default: "many" }`, "two"},
+		{`switch (5) { case 1: "one" case 2: "two" default: "many" }`, "many"},
+		{`switch (5) { case 1: "one" case 2: "two" }`, Null},
+		{`switch (5) { }`, Null},
+		{`switch ("b") { case "a": 1 case "b": 2 }`, 2},
+		{`switch (true) { case 1 > 2: 1 case 2 > 1: 2 }`, 2},
+		{`switch (null) { case 0: 1 case null: 2 }`, 2},
+		{`switch ([1, 2]) { case [1, 2]: "same" default: "different" }`, "same"},
+		// the first matching case wins and does not fall through
+		{`let n = 0; switch (1) { case 1: n = n + 1; case 1: n = n + 10; } n`, 1},
+		// the subject is evaluated once
+		{
+			`let calls = 0;
+			let next = func() { calls = calls + 1; calls };
+			switch (next()) { case 3: 3 case 2: 2 case 1: 1 };
+			calls`,
+			1,
+		},
+		{`let x = switch (1 + 1) { case 2: let y = 20; y + 2 }; x`, 22},
+		{
+			`let name = func(n) {
+				switch (n) {
+					case 0: return "zero";
+					case 1: "one"
+					default: "many"
+				}
+			};
+			name(0) + " " + name(1) + " " + name(2)`,
+			"zero one many",
+		},
+		{
+			`let sum = 0;
+			for (let i = 0; i < 10; i = i + 1) {
+				switch (i) { case 3: continue; case 5: break; }
+				sum = sum + i;
+			}
+			sum`,
+			7,
+		},
+	}
+	runVmTests(t, tests)
+	runAgainstEvaluator(t, tests)
+}
+
+func TestDoWhileLoops(t *testing.T) {
+	tests := []vmTestCase{
+		{"let n = 0; do { n = n + 1; } while (false); n", 1},
+		{"let n = 0; do { n = n + 1; } while (n < 5); n", 5},
+		{"let n = 10; do { n = n + 1; } while (n < 5); n", 11},
+		{"let n = 0; do { n = n + 1; if (n == 3) { break; } } while (true); n", 3},
+		{
+			`let n = 0; let odd = 0;
+			do { n = n + 1; if (n == 2 | n == 4 | n == 6) { continue; } odd = odd + 1; } while (n < 6);
+			odd`,
+			3,
+		},
+		{
+			`let digits = func(x) {
+				let count = 0;
+				do { count = count + 1; x = x / 10; } while (x > 0);
+				count
+			};
+			[digits(0), digits(7), digits(12345)]`,
+			[]int{1, 1, 5},
+		},
+		{"let f = func() { do { return 7; } while (true); }; f()", 7},
+		{"let n = 0; do { n = n + 1; } while (n < 5)", Null},
+		{"do { break; } while (true)", Null},
+	}
+	runVmTests(t, tests)
+	runAgainstEvaluator(t, tests)
+}
+
+func TestBreakAndContinue(t *testing.T) {
+	tests := []vmTestCase{
+		{"let n = 0; for (let i = 0; i < 10; i = i + 1) { if (i == 3) { break; } n = n + 1; } n", 3},
+		{"let n = 0; for (;;) { n = n + 1; if (n > 4) { break; } } n", 5},
+		{
+			// sums the odd numbers below 10
+			"let sum = 0; for (let i = 0; i < 10; i = i + 1) { if (i / 2 * 2 == i) { continue; } sum = sum + i; } sum",
+			25,
+		},
+		{
+			`let pairs = 0;
+			for (let i = 0; i < 4; i = i + 1) {
+				for (let j = 0; j < 4; j = j + 1) {
+					if (j == i) { break; }
+					pairs = pairs + 1;
+				}
+				if (i == 2) { continue; }
+			}
+			pairs`,
+			6,
+		},
+		{
+			`let firstEven = func(arr) {
+				let found = -1;
+				for (let i = 0; i < len(arr); i = i + 1) {
+					if (arr[i] / 2 * 2 != arr[i]) { continue; }
+					found = arr[i];
+					break;
+				}
+				found
+			};
+			firstEven([3, 5, 8, 10])`,
+			8,
+		},
+	}
+	runVmTests(t, tests)
+	runAgainstEvaluator(t, tests)
+}
+
+func TestBreakAndContinueInsideExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			`let s = 0;
+			for (let i = 0; i < 5; i = i + 1) {
+				let c = i == 2;
+				let a = if (c) { continue } else { i };
+				s = s + a;
+			}
+			s`,
+			8,
+		},
+		{
+			`let arr = [];
+			for (let i = 0; i < 4; i = i + 1) { arr = push(arr, if (i == 2) { continue } else { i }) }
+			arr`,
+			[]int{0, 1, 3},
+		},
+		{"let s = 0; for (let i = 0; i < 5; i = i + 1) { s = s + (10 * if (i == 3) { break } else { i }) }; s", 30},
+		// the operands waiting under a continue are popped, so that running
+		// the loop many times does not overflow the stack
+		{"let n = 0; for (; n < 5000; n = n + 1) { 1 + if (true) { continue } else { 2 } }; n", 5000},
+		{
+			`let n = 0;
+			for (; n < 5000; n = n + 1) { push([1, 2], {"a": [n, if (true) { continue } else { 3 }]}) }
+			n`,
+			5000,
+		},
+		{"let n = 0; do { n = n + 1; n * if (true) { continue } else { 2 } } while (n < 5000); n", 5000},
+		{"let n = 0; for (; n < 3000; n = n + 1) { switch (n) { case if (true) { continue } else { 1 }: 2 } }; n", 3000},
+		// a loop inside an expression leaves the operands waiting on it alone
+		{"let t = 0; for (let i = 0; i < 3000; i = i + 1) { t = t + (1 + if (true) { for (;;) { break }; 1 } else { 0 }) }; t", 6000},
+	}
+	runVmTests(t, tests)
+	runAgainstEvaluator(t, tests)
+}
+
+func TestTrailingLambdas(t *testing.T) {
+	mapFn := `
+	let map = func(arr, f) {
+		let out = [];
+		for (let i = 0; i < len(arr); i = i + 1) { out = push(out, f(arr[i])); }
+		out
+	};`
+	tests := []vmTestCase{
+		{mapFn + "map([1, 2, 3]) { |x| x * 2 }", []int{2, 4, 6}},
+		{mapFn + "map([]) { |x| x * 2 }", []int{}},
+		{mapFn + "let double = map([1, 2]) { |x| x + x }; double[1]", 4},
+		{"let apply = func(f) { f() }; apply() { || 7 }", 7},
+	}
+	runVmTests(t, tests)
+	runAgainstEvaluator(t, tests)
+}
+
+func TestVariadicFunctions(t *testing.T) {
+	tests := []vmTestCase{
+		{"let f = func(a, ...rest) { len(rest) }; f(1, 2, 3)", 2},
+		{"let f = func(a, ...rest) { rest }; f(1, 2, 3)", []int{2, 3}},
+		{"let f = func(a, ...rest) { rest }; f(1)", []int{}},
+		{"let f = func(...args) { args }; f()", []int{}},
+		{"let f = func(a, ...rest) { a }; f(1, 2, 3)", 1},
+		{
+			`let sum = func(...xs) {
+				let total = 0;
+				for (let i = 0; i < len(xs); i = i + 1) { total = total + xs[i]; }
+				total
+			};
+			sum(1, 2, 3, 4) + sum()`,
+			10,
+		},
+		{"let f = func(a, ...rest) { let b = 5; a + b + len(rest) }; f(1, 2)", 7},
+		{"let apply = func(f) { f(1, 2, 3) }; apply() { |x, ...more| x + len(more) }", 3},
+	}
+	runVmTests(t, tests)
+	runAgainstEvaluator(t, tests)
+}
+
+func TestDefaultParameters(t *testing.T) {
+	tests := []vmTestCase{
+		{"let f = func(a, b = a + 1) { b }; f(1)", 2},
+		{"let f = func(a, b = a + 1) { b }; f(1, 5)", 5},
+		{"let f = func(x, y = 10) { x + y }; f(1) + f(1, 1)", 13},
+		{"let f = func(a = 1, b = a * 2, c = a + b) { [a, b, c] }; f()", []int{1, 2, 3}},
+		{"let f = func(a = 1, b = a * 2, c = a + b) { [a, b, c] }; f(2)", []int{2, 4, 6}},
+		{"let f = func(a = 1, b = a * 2, c = a + b) { [a, b, c] }; f(2, 0)", []int{2, 0, 2}},
+		{"let f = func(a = 1, b = a * 2, c = a + b) { [a, b, c] }; f(7, 8, 9)", []int{7, 8, 9}},
+		{"let f = func(a, b = 2, ...rest) { [a, b, len(rest)] }; f(1)", []int{1, 2, 0}},
+		{"let f = func(a, b = 2, ...rest) { [a, b, len(rest)] }; f(1, 3, 4, 5)", []int{1, 3, 2}},
+		{"let f = func(a, b = 2, ...rest) { rest }; f(1)", []int{}},
+		{"let f = func(a, b = null) { b }; f(1)", Null},
+		{"let f = func(a, b = a) { let c = a + b; c }; f(4)", 8},
+		{"let f = func(a, b = len(a)) { b }; f([1, 2, 3])", 3},
+		{"let y = 5; let f = func(x = y) { x }; f()", 5},
+		{"let apply = func(f) { f() }; apply() { |x = 3| x * x }", 9},
+	}
+	runVmTests(t, tests)
+	runAgainstEvaluator(t, tests)
+}
+
+func TestHigherOrderBuiltins(t *testing.T) {
+	tests := []vmTestCase{
+		{"take_while([1, 2, 3, 1], func(x) { x < 3 })", []int{1, 2}},
+		{"drop_while([1, 2, 3, 1], func(x) { x < 3 })", []int{3, 1}},
+		{"take_while([1, 2, 3], func(x) { true })", []int{1, 2, 3}},
+		{"drop_while([1, 2, 3], func(x) { true })", []int{}},
+		{"take_while([1, 2, 3], func(x) { false })", []int{}},
+		{"drop_while([1, 2, 3], func(x) { false })", []int{1, 2, 3}},
+		{"take_while([], func(x) { true })", []int{}},
+		{"take_while([1, 2, 3]) { |x| x != 2 }", []int{1}},
+		{"take_while([1, 2, 3], func(x) { if (x < 3) { 1 } })", []int{1, 2}},
+		{"let small = func(x) { x < 2 }; drop_while([1, 2], small)", []int{2}},
+		{
+			"take_while([1], len)",
+			&object.Error{Message: "argument to `len` not supported, got INTEGER"},
+		},
+		{
+			// the predicate is not called past the first failing element
+			"let n = 0; take_while([1, 2, 3, 1], func(x) { n = n + 1; x < 2 }); n",
+			2,
+		},
+		{
+			"let f = func(xs) { let n = 3; take_while(xs, func(x) { x < 3 }) }; len(f([1, 2, 3])) + len(f([1, 5]))",
+			3,
+		},
+		{
+			"take_while([[1, 2], [3]], func(xs) { len(take_while(xs, func(x) { x < 3 })) == 2 })",
+			[][]int{{1, 2}},
+		},
+		{
+			"take_while(1, func(x) { true })",
+			&object.Error{Message: "argument to `take_while` must be ARRAY, got INTEGER"},
+		},
+		{
+			"drop_while([1])",
+			&object.Error{Message: "wrong number of arguments. got=1, want=2"},
+		},
+	}
+	runVmTests(t, tests)
+	runAgainstEvaluator(t, tests)
+}
+
+func TestHigherOrderBuiltinErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"take_while([1], func(x) { x + true })", "invalid types for binary operation: INTEGER BOOLEAN"},
+		{"drop_while([1], func() { true })", "wrong number of arguments: want=0, got=1"},
+		{"take_while([1], 5)", "calling non-function"},
+	}
+	for _, tt := range tests {
+		comp := compiler.NewCompiler()
+		if err := comp.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		vm := NewVM(comp.ByteCode())
+		err := vm.RunVM()
+		if err == nil {
+			t.Fatalf("%s: expected VM error but resulted in none.", tt.input)
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("wrong VM error: want=%q, got=%q", tt.expected, err.Error())
+		}
+	}
+}
+
+func TestFirstClassFunctions(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			input: `
+			let returnsOne = func() { 1; };
+			let returnsOneReturner = func() { returnsOne; };
+			returnsOneReturner()();
+			`,
+			expected: 1,
+		},
+		{
+			input: `
+			let returnsOneReturner = func() {
+				let returnsOne = func() { 1; };
+				returnsOne;
+			};
+			returnsOneReturner()();
+			`,
+			expected: 1,
+		},
+	}
+	runVmTests(t, tests)
+}
+
+func TestCallingFunctionsWithBindings(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			input: `
+			let one = func() { let one = 1; one };
+			one();
 			`,
 			expected: 1,
 		},
@@ -325,126 +1569,421 @@ func TestCallingFunctionsWithArgumentsAndBindings(t *testing.T) {
 			expected: 10,
 		},
 		{
-			input: `
-			let sum = func(a, b) {
-				let c = a + b;
-				c;
-			};
-			let outer = func() {
-				sum(1, 2) + sum(3, 4);
-			}
-			outer();
-			`,
-			expected: 10,
+			input: `
+			let sum = func(a, b) {
+				let c = a + b;
+				c;
+			};
+			let outer = func() {
+				sum(1, 2) + sum(3, 4);
+			}
+			outer();
+			`,
+			expected: 10,
+		},
+		{
+			input: `
+			let globalNum = 10;
+		
+			let sum = func(a, b) {
+				let c = a + b;
+				c + globalNum;
+			};
+		
+			let outer = func() {
+				sum(1, 2) + sum(3, 4) + globalNum;
+			}
+			outer() + globalNum;
+			`,
+			expected: 50,
+		},
+	}
+	runVmTests(t, tests)
+}
+
+func TestCallingFunctionsWithWrongArguments(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			input:    `func() { 1; }(1);`,
+			expected: `wrong number of arguments: want=0, got=1`,
+		},
+		{
+			input:    `func(a) { a; }();`,
+			expected: `wrong number of arguments: want=1, got=0`,
+		},
+		{
+			input:    `func(a, b) { a + b; }(1);`,
+			expected: `wrong number of arguments: want=2, got=1`,
+		},
+		{
+			input:    `func(a, b, ...rest) { a + b; }(1);`,
+			expected: `wrong number of arguments: want at least 2, got=1`,
+		},
+		{
+			input:    `func(a, b = 1) { a + b; }();`,
+			expected: `wrong number of arguments: want between 1 and 2, got=0`,
+		},
+		{
+			input:    `func(a, b = 1) { a + b; }(1, 2, 3);`,
+			expected: `wrong number of arguments: want between 1 and 2, got=3`,
+		},
+		{
+			input:    `func(a, b = 1, ...rest) { a + b; }();`,
+			expected: `wrong number of arguments: want at least 1, got=0`,
+		},
+	}
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+
+		comp := compiler.NewCompiler()
+		err := comp.Compile(program)
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		vm := NewVM(comp.ByteCode())
+		err = vm.RunVM()
+		if err == nil {
+			t.Fatalf("expected VM error but resulted in none.")
+		}
+		if err.Error() != tt.expected {
+			t.Fatalf("wrong VM error: want=%q, got=%q", tt.expected, err.Error())
+		}
+	}
+}
+
+func TestPrefixOperatorsOnCalls(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			input: `
+			let isEmpty = func(arr) { arr[0] == null };
+			!isEmpty([]);
+			`,
+			expected: false,
+		},
+		{
+			input: `
+			let isEmpty = func(arr) { arr[0] == null };
+			!isEmpty([1, 2]);
+			`,
+			expected: true,
+		},
+		{
+			input: `
+			let compute = func() { 2 * 21 };
+			-compute();
+			`,
+			expected: -42,
+		},
+		{
+			input: `
+			let compute = func(a, b) { a - b };
+			-compute(1, 3) + 1;
+			`,
+			expected: 3,
+		},
+		{
+			input: `
+			let compute = func() { -7 };
+			--compute();
+			`,
+			expected: -7,
+		},
+	}
+	runVmTests(t, tests)
+}
+
+func TestPrefixMinusOnNonIntegerCallResult(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			input: `
+			let compute = func() { "five" };
+			-compute();
+			`,
+			expected: "invalid object type for negation: STRING",
+		},
+		{
+			input: `
+			let compute = func() { };
+			-compute();
+			`,
+			expected: "invalid object type for negation: NULL",
+		},
+		{
+			input: `
+			let compute = func() { true };
+			~compute();
+			`,
+			expected: "invalid object type for bitwise not: BOOLEAN",
+		},
+	}
+	for _, tt := range tests {
+		program := parse(tt.input)
+
+		comp := compiler.NewCompiler()
+		err := comp.Compile(program)
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		vm := NewVM(comp.ByteCode())
+		err = vm.RunVM()
+		if err == nil {
+			t.Fatalf("expected VM error but resulted in none.")
+		}
+		if err.Error() != tt.expected {
+			t.Fatalf("wrong VM error: want=%q, got=%q", tt.expected, err.Error())
+		}
+	}
+}
+
+func TestBuiltinFunctions(t *testing.T) {
+	tests := []vmTestCase{
+		{`len("")`, 0},
+		{`len("four")`, 4},
+		{`len("hello world")`, 11},
+		{
+			`len(1)`,
+			&object.Error{Message: "argument to `len` not supported, got INTEGER"},
+		},
+		{
+			`len("one", "two")`,
+			&object.Error{Message: "wrong number of arguments. got=2, want=1"},
+		},
+		{`len([1, 2, 3])`, 3},
+		{`len([])`, 0},
+		{`len("héllo")`, 5},
+		{`len({"a": 1, "b": 2})`, 2},
+		{`len({"a": 1, "b": 2}) == 2`, true},
+		{`len({})`, 0},
+		{`let h = {"a": 1}; len(set(h, "b", 2))`, 2},
+		{`puts("hello", "world!")`, "world!"},
+		{`puts(5)`, 5},
+		{`puts(2) * puts(3)`, 6},
+		{`puts()`, Null},
+		{`first([1, 2, 3])`, 1},
+		{`first([])`, Null},
+		{
+			`first(1)`,
+			&object.Error{Message: "argument to `first` must be ARRAY, got INTEGER"},
+		},
+		{`last([1, 2, 3])`, 3},
+		{`last([])`, Null},
+		{
+			`last(1)`,
+			&object.Error{Message: "argument to `last` must be ARRAY, got INTEGER"},
+		},
+		{`rest([1, 2, 3])`, []int{2, 3}},
+		{`rest([])`, Null},
+		{`push([], 1)`, []int{1}},
+		{
+			`push(1, 1)`,
+			&object.Error{Message: "argument to `push` must be ARRAY, got INTEGER"},
+		},
+		{`abs(-5)`, 5},
+		{`abs(5)`, 5},
+		{
+			`abs("5")`,
+			&object.Error{Message: "argument to `abs` must be INTEGER, got STRING"},
+		},
+		{`pow(2, 10)`, 1024},
+		{`pow(7, 0)`, 1},
+		{
+			`pow(2, -1)`,
+			&object.Error{Message: "negative exponent to `pow`: -1"},
+		},
+		{`min(3, 1, 2)`, 1},
+		{`max(3, 1, 2)`, 3},
+		{`min(7)`, 7},
+		{
+			`min()`,
+			&object.Error{Message: "wrong number of arguments. got=0, want at least 1"},
+		},
+		{
+			`max(1, "two")`,
+			&object.Error{Message: "arguments to `max` must be INTEGER, got STRING"},
+		},
+		{`contains([1, 2, 3], 2)`, true},
+		{`contains([1, 2, 3], 4)`, false},
+		{`contains([[1], [2]], [2])`, true},
+		{`contains("hello", "ell")`, true},
+		{`contains("hello", "olé")`, false},
+		{`contains({"a": 1}, "a")`, true},
+		{`contains({"a": 1}, "b")`, false},
+		{`contains([1], 1) == true`, true},
+		{`if (contains("abc", "b")) { 10 } else { 20 }`, 10},
+		{
+			`contains(1, 1)`,
+			&object.Error{Message: "argument to `contains` not supported, got INTEGER"},
+		},
+		{
+			`contains("abc", 1)`,
+			&object.Error{Message: "second argument to `contains` must be STRING, got INTEGER"},
+		},
+		{
+			`contains({}, [1])`,
+			&object.Error{Message: "unusable as hash key: ARRAY"},
+		},
+		{`range(3)`, []int{0, 1, 2}},
+		{`range(1, 10, 2)`, []int{1, 3, 5, 7, 9}},
+		{`range(2, 5)`, []int{2, 3, 4}},
+		{`range(5, 0, -2)`, []int{5, 3, 1}},
+		{`range(0)`, []int{}},
+		{`range(-3)`, []int{}},
+		{`range(3, 1)`, []int{}},
+		{`len(range(100))`, 100},
+		{`range(9223372036854775806, 9223372036854775807, 5)`, []int{9223372036854775806}},
+		{`range(-9223372036854775807, 9223372036854775807, 9223372036854775807)`, []int{-9223372036854775807, 0}},
+		{
+			`range(1000000000000)`,
+			&object.Error{Message: "`range` would have 1000000000000 elements, more than 16777216"},
+		},
+		{
+			`range(9223372036854775807, -9223372036854775807 - 1, -1)`,
+			&object.Error{Message: "`range` would have 18446744073709551615 elements, more than 16777216"},
+		},
+		{
+			`range(1, 10, 0)`,
+			&object.Error{Message: "step argument to `range` must not be zero"},
+		},
+		{
+			`range("3")`,
+			&object.Error{Message: "arguments to `range` must be INTEGER, got STRING"},
+		},
+		{
+			`range()`,
+			&object.Error{Message: "wrong number of arguments. got=0, want=1 to 3"},
+		},
+		{
+			`range(1, 2, 3, 4)`,
+			&object.Error{Message: "wrong number of arguments. got=4, want=1 to 3"},
+		},
+		{`ord("A")`, 65},
+		{`ord("é")`, 233},
+		{`char(97)`, "a"},
+		{`char(8364)`, "€"},
+		{`char(ord("A")) == "A"`, true},
+		{`char(ord("A") + 1)`, "B"},
+		{`char(0)`, "\x00"},
+		{
+			`ord("")`,
+			&object.Error{Message: `argument to ` + "`ord`" + ` must be a single character, got ""`},
+		},
+		{
+			`ord("ab")`,
+			&object.Error{Message: `argument to ` + "`ord`" + ` must be a single character, got "ab"`},
+		},
+		{
+			`ord(65)`,
+			&object.Error{Message: "argument to `ord` must be STRING, got INTEGER"},
+		},
+		{
+			`char(-1)`,
+			&object.Error{Message: "invalid code point for `char`: -1"},
+		},
+		{
+			`char(1114112)`,
+			&object.Error{Message: "invalid code point for `char`: 1114112"},
+		},
+		{
+			`char(55296)`,
+			&object.Error{Message: "invalid code point for `char`: 55296"},
+		},
+		{
+			`char("a")`,
+			&object.Error{Message: "argument to `char` must be INTEGER, got STRING"},
+		},
+		{`sizeof([1, 2, 3]) > sizeof([1])`, true},
+		{`sizeof("hello") > sizeof("")`, true},
+		{`sizeof([[1, 2], [3]]) > sizeof([1, 2, 3])`, true},
+		{`let x = [1]; for (let i = 0; i < 40; i = i + 1) { x = [x, x] }; sizeof(x) > sizeof([1])`, true},
+		{
+			`sizeof(1, 2)`,
+			&object.Error{Message: "wrong number of arguments. got=2, want=1"},
+		},
+		{`len("héllo")`, 5},
+		{`len("日本語")`, 3},
+		{`bytelen("héllo")`, 6},
+		{`bytelen("")`, 0},
+		{
+			`bytelen([1])`,
+			&object.Error{Message: "argument to `bytelen` must be STRING, got ARRAY"},
+		},
+		{`deep_len([1, 2, 3])`, 3},
+		{`deep_len([1, 2, 3]) == len([1, 2, 3])`, true},
+		{`deep_len([1, [2, [3, 4]], [], "five"])`, 5},
+		{`deep_len([])`, 0},
+		{`deep_len([[], [[]]])`, 0},
+		{
+			`deep_len("abc")`,
+			&object.Error{Message: "argument to `deep_len` must be ARRAY, got STRING"},
+		},
+		{
+			`let a = [1]; for (let i = 0; i < 100; i = i + 1) { a = [a]; } deep_len(a)`,
+			&object.Error{Message: "array passed to `deep_len` is nested deeper than 100 levels"},
+		},
+		{`let a = [1]; for (let i = 0; i < 99; i = i + 1) { a = [a]; } deep_len(a)`, 1},
+		{`clamp(-5, 0, 10)`, 0},
+		{`clamp(5, 0, 10)`, 5},
+		{`clamp(15, 0, 10)`, 10},
+		{`clamp(0, 0, 0)`, 0},
+		{`let lo = -3; clamp(-10, lo, lo + 1)`, -3},
+		{
+			`clamp(1, 10, 0)`,
+			&object.Error{Message: "lower bound to `clamp` is greater than upper bound: 10 > 0"},
+		},
+		{
+			`clamp("1", 0, 10)`,
+			&object.Error{Message: "arguments to `clamp` must be INTEGER, got STRING, INTEGER and INTEGER"},
+		},
+		{
+			`clamp(1, 0)`,
+			&object.Error{Message: "wrong number of arguments. got=2, want=3"},
 		},
 		{
-			input: `
-			let globalNum = 10;
-		
-			let sum = func(a, b) {
-				let c = a + b;
-				c + globalNum;
-			};
-		
-			let outer = func() {
-				sum(1, 2) + sum(3, 4) + globalNum;
-			}
-			outer() + globalNum;
-			`,
-			expected: 50,
+			`deep_len([1], [2])`,
+			&object.Error{Message: "wrong number of arguments. got=2, want=1"},
 		},
+		{`let len = func(x) { 42 }; len("shadowed")`, 42},
+		{`let count = func(arr) { len(arr) }; count([1, 2])`, 2},
 	}
 	runVmTests(t, tests)
 }
 
-func TestCallingFunctionsWithWrongArguments(t *testing.T) {
+func TestFormatBuiltin(t *testing.T) {
 	tests := []vmTestCase{
+		{`format("{} + {} = {}", 1, 2, 3)`, "1 + 2 = 3"},
+		{`format("{} + {} = {}", 1, 2, 3) == "1 + 2 = 3"`, true},
+		{`format("no placeholders")`, "no placeholders"},
+		{`format("")`, ""},
+		{`format("{}{}", "a", "b")`, "ab"},
+		{`format("[{}]", [1, "two", true])`, "[[1, two, true]]"},
+		{`let name = "monkey"; format("hello, {}!", name)`, "hello, monkey!"},
+		{`format("{}", format("{}", 42))`, "42"},
+	}
+	runVmTests(t, tests)
+	runAgainstEvaluator(t, tests)
+
+	errorTests := []vmTestCase{
 		{
-			input:    `func() { 1; }(1);`,
-			expected: `wrong number of arguments: want=0, got=1`,
+			`format("{} and {}", 1)`,
+			&object.Error{Message: "format string has 2 placeholders, got 1 arguments"},
 		},
 		{
-			input:    `func(a) { a; }();`,
-			expected: `wrong number of arguments: want=1, got=0`,
+			`format("{}", 1, 2)`,
+			&object.Error{Message: "format string has 1 placeholders, got 2 arguments"},
 		},
 		{
-			input:    `func(a, b) { a + b; }(1);`,
-			expected: `wrong number of arguments: want=2, got=1`,
+			`format(1)`,
+			&object.Error{Message: "first argument to `format` must be STRING, got INTEGER"},
+		},
+		{
+			`format()`,
+			&object.Error{Message: "wrong number of arguments. got=0, want at least 1"},
 		},
 	}
-
-	for _, tt := range tests {
-		program := parse(tt.input)
-
-		comp := compiler.NewCompiler()
-		err := comp.Compile(program)
-		if err != nil {
-			t.Fatalf("compiler error: %s", err)
-		}
-		vm := NewVM(comp.ByteCode())
-		err = vm.RunVM()
-		if err == nil {
-			t.Fatalf("expected VM error but resulted in none.")
-		}
-		if err.Error() != tt.expected {
-			t.Fatalf("wrong VM error: want=%q, got=%q", tt.expected, err.Error())
-		}
-	}
+	runVmTests(t, errorTests)
 }
 
-// func TestBuiltinFunctions(t *testing.T) {
-// 	tests := []vmTestCase{
-// 		{`len("")`, 0},
-// 		{`len("four")`, 4},
-// 		{`len("hello world")`, 11},
-// 		{
-// 			`len(1)`,
-// 			&object.Error{
-// 				Message: fmt.Sprintf(
-// 					"argument to %q not supported, got %s",
-// 					object.BuiltinFuncNameLen, object.IntegerObj,
-// 				),
-// 			},
-// 		},
-// 		{
-// 			`len("one", "two")`,
-// 			&object.Error{
-// 				Message: "wrong number of arguments. got=2, want=1",
-// 			},
-// 		},
-// 		{`len([1, 2, 3])`, 3},
-// 		{`len([])`, 0},
-// 		{`puts("hello", "world!")`, Null},
-// 		{`first([1, 2, 3])`, 1},
-// 		{`first([])`, Null},
-// 		{
-// 			`first(1)`,
-// 			&object.Error{
-// 				Message: fmt.Sprintf("argument to %q must be %s, got %s", object.BuiltinFuncNameFirst, object.ArrayObj, object.IntegerObj),
-// 			},
-// 		},
-// 		{`last([1, 2, 3])`, 3},
-// 		{`last([])`, Null},
-// 		{
-// 			`last(1)`,
-// 			&object.Error{
-// 				Message: fmt.Sprintf("argument to %q must be %s, got %s", object.BuiltinFuncNameLast, object.ArrayObj, object.IntegerObj),
-// 			},
-// 		},
-// 		{`rest([1, 2, 3])`, []int{2, 3}},
-// 		{`rest([])`, Null},
-// 		{`push([], 1)`, []int{1}},
-// 		{
-// 			`push(1, 1)`,
-// 			&object.Error{
-// 				Message: fmt.Sprintf("argument to %q must be %s, got %s", object.BuiltinFuncNamePush, object.ArrayObj, object.IntegerObj),
-// 			},
-// 		},
-// 	}
-//
-// 	runVmTests(t, tests)
-// }
-
 // func TestClosures(t *testing.T) {
 // 	tests := []vmTestCase{
 // 		{
@@ -548,6 +2087,546 @@ func TestCallingFunctionsWithWrongArguments(t *testing.T) {
 // 	runVmTests(t, tests)
 // }
 
+func TestAssertBuiltin(t *testing.T) {
+	passing := []vmTestCase{
+		{"assert(1 == 1)", Null},
+		{`assert([1], "non-empty")`, Null},
+		{"let n = 0; assert(true); n = n + 1; assert(1, \"one\"); n + 1", 2},
+		{
+			`assert(true, 1)`,
+			&object.Error{Message: "message to `assert` must be STRING, got INTEGER"},
+		},
+		{
+			`assert()`,
+			&object.Error{Message: "wrong number of arguments. got=0, want=1 or 2"},
+		},
+	}
+	runVmTests(t, passing)
+
+	tests := []struct {
+		input   string
+		message string
+	}{
+		{`assert(false, "boom")`, "assertion failed: boom"},
+		{`assert(null)`, "assertion failed"},
+		{`let check = func(x) { assert(x > 0, "x must be positive"); x }; check(1) + check(-1)`, "assertion failed: x must be positive"},
+	}
+	for _, tt := range tests {
+		comp := compiler.NewCompiler()
+		if err := comp.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		err := NewVM(comp.ByteCode()).RunVM()
+		if err == nil || err.Error() != tt.message {
+			t.Errorf("%s: wrong error. want=%q, got=%v", tt.input, tt.message, err)
+		}
+	}
+
+	// the program stops at the failed assertion
+	comp := compiler.NewCompiler()
+	if err := comp.Compile(parse(`let n = 1; assert(n == 2, "boom"); n = 3;`)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	vm := NewVM(comp.ByteCode())
+	if err := vm.RunVM(); err == nil {
+		t.Fatalf("expected the assertion to fail")
+	}
+	testExpectedObject(t, 1, vm.NamedGlobals()["n"])
+}
+
+func TestNamedGlobals(t *testing.T) {
+	input := `
+	let one = 1;
+	let greeting = "hi";
+	let pair = [one, 2];
+	let unset = if (false) { 1 };
+	`
+	comp := compiler.NewCompiler()
+	if err := comp.Compile(parse(input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	vm := NewVM(comp.ByteCode())
+	if err := vm.RunVM(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	globals := vm.Globals()
+	if len(globals) != GlobalsSize {
+		t.Fatalf("wrong globals size. want=%d, got=%d", GlobalsSize, len(globals))
+	}
+	if globals[4] != nil {
+		t.Errorf("expected unused global slot to be nil, got=%+v", globals[4])
+	}
+	// the result is a copy, changing it leaves the VM alone
+	globals[0] = &object.Integer{Value: 99}
+	testExpectedObject(t, 1, vm.Globals()[0])
+
+	expected := map[string]interface{}{
+		"one":      1,
+		"greeting": "hi",
+		"pair":     []int{1, 2},
+		"unset":    Null,
+	}
+	named := vm.NamedGlobals()
+	if len(named) != len(expected) {
+		t.Fatalf("wrong number of named globals. want=%d, got=%d", len(expected), len(named))
+	}
+	for name, value := range expected {
+		actual, ok := named[name]
+		if !ok {
+			t.Errorf("global %q missing", name)
+			continue
+		}
+		testExpectedObject(t, value, actual)
+	}
+}
+
+func TestNamedGlobalsSkipsUnsetSlots(t *testing.T) {
+	bytecode := &compiler.ByteCode{GlobalNames: []string{"a", "b"}}
+	vm := NewVM(bytecode)
+	vm.globals[1] = &object.Integer{Value: 2}
+
+	named := vm.NamedGlobals()
+	if len(named) != 1 {
+		t.Fatalf("wrong number of named globals. want=1, got=%d", len(named))
+	}
+	testExpectedObject(t, 2, named["b"])
+}
+
+func TestSetGlobal(t *testing.T) {
+	port, host := &object.String{Value: "port"}, &object.String{Value: "host"}
+	config := &object.Hash{Pairs: map[object.HashKey]object.HashPair{
+		port.HashKey(): {Key: port, Value: &object.Integer{Value: 8080}},
+		host.HashKey(): {Key: host, Value: &object.String{Value: "localhost"}},
+	}}
+
+	comp := compiler.NewCompiler()
+	comp.DeclareGlobal("config")
+	comp.DeclareGlobal("debug")
+	if err := comp.Compile(parse(`if (debug == true) { config["port"] + 1 } else { 0 }`)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	vm := NewVM(comp.ByteCode())
+	if err := vm.SetGlobal("config", config); err != nil {
+		t.Fatalf("SetGlobal error: %s", err)
+	}
+	if err := vm.SetGlobal("debug", &object.Boolean{Value: true}); err != nil {
+		t.Fatalf("SetGlobal error: %s", err)
+	}
+	if err := vm.RunVM(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	testExpectedObject(t, 8081, vm.LastPoppedStackElement())
+
+	err := vm.SetGlobal("missing", config)
+	if err == nil || err.Error() != "undefined global: missing" {
+		t.Errorf("wrong error for an undeclared global. got=%v", err)
+	}
+
+	short := NewVM(comp.ByteCode(), WithGlobals(make([]object.Object, 1)))
+	err = short.SetGlobal("debug", &object.Boolean{Value: true})
+	if err == nil || err.Error() != "global index out of range: 1 (globals size 1)" {
+		t.Errorf("wrong error for a global past the store. got=%v", err)
+	}
+}
+
+var errorKindTests = []struct {
+	input string
+	kind  object.ErrorKind
+}{
+	{"10 / 0", object.ZeroDivisionError},
+	{"2 ** -1", object.ValueError},
+	{`"ab" * -1`, object.ValueError},
+	{`"ab" * 1000000000000`, object.ValueError},
+	{"9223372036854775807 + 1", object.OverflowError},
+	{"-9223372036854775807 - 2", object.OverflowError},
+	{"4611686018427387904 * 2", object.OverflowError},
+	{"2 ** 63", object.OverflowError},
+	{"let min = -9223372036854775807 - 1; -min", object.OverflowError},
+	{"let min = -9223372036854775807 - 1; min / -1", object.OverflowError},
+	{`"ab" + 1`, object.TypeError},
+	{`"ab" - 1`, object.TypeError},
+	{"1 + true", object.TypeError},
+	{"1 & true", object.TypeError},
+	{"-true", object.TypeError},
+	{"true < false", object.TypeError},
+	{"true > false", object.TypeError},
+	{"true <= false", object.TypeError},
+	{`"a" >= 1`, object.TypeError},
+	{`"a" - "b"`, object.TypeError},
+	{"1[0]", object.TypeError},
+	{`let [a] = "ab"`, object.TypeError},
+	{`let {a} = [1]`, object.TypeError},
+	{"{[1]: 2}", object.TypeError},
+	{`{"a": 1, "a": 2}["a"]`, object.ValueError},
+	{"1(2)", object.TypeError},
+	{"let a = func() { b }; let r = a(); let b = func() { 1 }; r", object.NameError},
+	{"func(a) { a }()", object.ArgumentError},
+	{"let f = func(x) { x / 0 }; f(1)", object.ZeroDivisionError},
+	{`assert(1 > 2, "boom")`, object.AssertionError},
+}
+
+func TestErrorKinds(t *testing.T) {
+	for _, tt := range errorKindTests {
+		comp := compiler.NewCompiler()
+		if err := comp.Compile(parse(tt.input)); err != nil {
+			// duplicate literal keys are already caught by the compiler
+			continue
+		}
+		err := NewVM(comp.ByteCode()).RunVM()
+
+		var errOb *object.Error
+		if !errors.As(err, &errOb) {
+			t.Fatalf("%s: expected an *object.Error, got=%T (%v)", tt.input, err, err)
+		}
+		if errOb.Kind != tt.kind {
+			t.Errorf("%s: wrong error kind. want=%s, got=%s", tt.input, tt.kind, errOb.Kind)
+		}
+
+		evaluated, ok := evaluator.Evaluate(parse(tt.input), object.NewEnvironment()).(*object.Error)
+		if !ok {
+			t.Fatalf("%s: evaluator returned no error", tt.input)
+		}
+		if evaluated.Kind != tt.kind {
+			t.Errorf("%s: wrong evaluator error kind. want=%s, got=%s", tt.input, tt.kind, evaluated.Kind)
+		}
+	}
+}
+
+func TestComparisonErrors(t *testing.T) {
+	tests := []struct {
+		input   string
+		message string
+	}{
+		{`1 > "a"`, "type mismatch: INTEGER > STRING"},
+		{`1 < "a"`, "type mismatch: INTEGER < STRING"},
+		{`"a" <= 1`, "type mismatch: STRING <= INTEGER"},
+		{"true < false", "unknown operator: BOOLEAN < BOOLEAN"},
+		{"true >= false", "unknown operator: BOOLEAN >= BOOLEAN"},
+		{"null > null", "unknown operator: NULL > NULL"},
+		{"[1] < [2]", "unknown operator: ARRAY < ARRAY"},
+		{"{} >= {}", "unknown operator: HASH >= HASH"},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.NewCompiler()
+		if err := comp.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		err := NewVM(comp.ByteCode()).RunVM()
+		if err == nil || err.Error() != tt.message {
+			t.Errorf("%s: wrong vm error. want=%q, got=%v", tt.input, tt.message, err)
+		}
+
+		evaluated, ok := evaluator.Evaluate(parse(tt.input), object.NewEnvironment()).(*object.Error)
+		if !ok || evaluated.Message != tt.message {
+			t.Errorf("%s: wrong evaluator error. want=%q, got=%v", tt.input, tt.message, evaluated)
+		}
+	}
+}
+
+func TestErrorValues(t *testing.T) {
+	run := func(input string) object.Object {
+		t.Helper()
+		comp := compiler.NewCompiler()
+		if err := comp.Compile(parse(input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		vm := NewVM(comp.ByteCode())
+		vm.EnableErrorValues()
+		if err := vm.RunVM(); err != nil {
+			t.Fatalf("%s: unexpected VM error: %s", input, err)
+		}
+		return vm.LastPoppedStackElement()
+	}
+
+	for _, tt := range errorKindTests {
+		if tt.kind == object.ValueError || tt.kind == object.AssertionError {
+			continue
+		}
+		result, ok := run(tt.input).(*object.Error)
+		if !ok {
+			t.Fatalf("%s: expected an error value", tt.input)
+		}
+		if result.Kind != tt.kind {
+			t.Errorf("%s: wrong error kind. want=%s, got=%s", tt.input, tt.kind, result.Kind)
+		}
+	}
+
+	tests := []vmTestCase{
+		// the program keeps running past an error
+		{"let r = 10 / 0; 5", 5},
+		{"let r = func(a) { a }(); 7", 7},
+		{"let r = 1(2); [1, 2][1]", 2},
+		{"let r = {[1]: 2}; 3", 3},
+		// operations on an error result in that error
+		{"(1 / 0) + 1 * 2", &object.Error{Message: "division by zero"}},
+		{"-(1 + true)", &object.Error{Message: "invalid types for binary operation: INTEGER BOOLEAN"}},
+		{"let r = 1 / 0; r == 1", &object.Error{Message: "division by zero"}},
+		{"let r = 1 / 0; [r][0]", &object.Error{Message: "division by zero"}},
+		// a check on the error value
+		{"let r = 1 / 0; if (r) { 1 } else { 2 }", 1},
+		{`let r = 1 / 0; len(r)`, &object.Error{Message: "argument to `len` not supported, got ERROR"}},
+	}
+	for _, tt := range tests {
+		testExpectedObject(t, tt.expected, run(tt.input))
+	}
+
+	// a failed assertion stops the program even so
+	for _, input := range []string{
+		`assert(1 > 2, "boom"); 5`,
+		`let r = take_while([1, 2], func(x) { assert(x < 2); true }); 5`,
+	} {
+		comp := compiler.NewCompiler()
+		if err := comp.Compile(parse(input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		vm := NewVM(comp.ByteCode(), WithErrorValues())
+		var errOb *object.Error
+		if err := vm.RunVM(); !errors.As(err, &errOb) || errOb.Kind != object.AssertionError {
+			t.Errorf("%s: want an AssertionError, got=%v", input, err)
+		}
+	}
+}
+
+func TestClock(t *testing.T) {
+	tests := []vmTestCase{
+		{"let start = clock(); clock() - start >= 0", true},
+		{"clock() >= 0", true},
+	}
+	runVmTests(t, tests)
+	runAgainstEvaluator(t, tests)
+}
+
+func TestSort(t *testing.T) {
+	tests := []vmTestCase{
+		{"sort([3, 1, 2])", []int{1, 2, 3}},
+		{"sort([])", []int{}},
+		{"let a = [2, 1]; let b = sort(a); a", []int{2, 1}},
+		{`let s = sort(["b", "B", "a", "ab"]); s[0] + s[1] + s[2] + s[3]`, "Baabb"},
+		{`sort([1, "a"])`, &object.Error{Kind: object.TypeError, Message: "cannot compare INTEGER with STRING"}},
+		{`sort([true])`, &object.Error{Kind: object.TypeError, Message: "cannot sort BOOLEAN values"}},
+		{`sort(1)`, &object.Error{Kind: object.TypeError, Message: "argument to `sort` must be ARRAY, got INTEGER"}},
+	}
+	runVmTests(t, tests)
+	runAgainstEvaluator(t, tests)
+}
+
+func TestSeededRand(t *testing.T) {
+	input := "seed(42); let a = []; for (let i = 0; i < 20; i = i + 1) { a = push(a, rand(10)) } a"
+
+	var runs []string
+	for range 2 {
+		vrm := newStepVM(t, input)
+		if err := vrm.RunVM(); err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+		runs = append(runs, vrm.LastPoppedStackElement().Inspect())
+	}
+	evaluated := evaluator.Evaluate(parse(input), object.NewEnvironment())
+	runs = append(runs, evaluated.Inspect())
+
+	for _, run := range runs[1:] {
+		if run != runs[0] {
+			t.Errorf("seeded runs differ. first=%s, got=%s", runs[0], run)
+		}
+	}
+	if runs[0] == "[0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0]" {
+		t.Errorf("rand gave no variation. got=%s", runs[0])
+	}
+
+	tests := []vmTestCase{
+		{"let r = rand(3); r >= 0 & r < 3", true},
+		{"rand(1)", 0},
+		{"rand(0)", &object.Error{Kind: object.ValueError, Message: "argument to `rand` must be positive, got 0"}},
+		{`rand("a")`, &object.Error{Kind: object.TypeError, Message: "argument to `rand` must be INTEGER, got STRING"}},
+		{`seed(true)`, &object.Error{Kind: object.TypeError, Message: "argument to `seed` must be INTEGER, got BOOLEAN"}},
+		{"seed(1)", Null},
+	}
+	runVmTests(t, tests)
+	runAgainstEvaluator(t, tests)
+}
+
+func TestConcurrentRand(t *testing.T) {
+	// the VMs share the default registry and so its random number generator,
+	// which must hold up under `go test -race`
+	input := "seed(7); let n = 0; for (let i = 0; i < 100; i = i + 1) { n = n + rand(10) } n >= 0"
+
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, err := Run(input)
+			if err != nil || result != True {
+				t.Errorf("wrong result. got=%v, err=%v", result, err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestBuiltinOutput(t *testing.T) {
+	input := `puts("hi"); print("a", 1); print("b"); let f = func() { puts([1]) }; f();`
+	expected := "hi\na 1b[1]\n"
+
+	var out bytes.Buffer
+	vrm := newStepVM(t, input)
+	vrm.SetBuiltins(object.NewBuiltins(&out))
+	if err := vrm.RunVM(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	if out.String() != expected {
+		t.Errorf("wrong vm output. want=%q, got=%q", expected, out.String())
+	}
+
+	out.Reset()
+	env := object.NewEnvironment()
+	env.SetBuiltins(object.NewBuiltins(&out))
+	evaluator.Evaluate(parse(input), env)
+	if out.String() != expected {
+		t.Errorf("wrong evaluator output. want=%q, got=%q", expected, out.String())
+	}
+}
+
+func TestCallFunction(t *testing.T) {
+	input := `
+	let add = func(a, b) { a + b };
+	let greet = func(name, greeting = "hello") { greeting + " " + name };
+	let nothing = func() { };
+	let twice = func(f, x) { f(f(x)) };
+	let size = len;
+	let count = 3;
+	`
+	comp := compiler.NewCompiler()
+	if err := comp.Compile(parse(input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	vm := NewVM(comp.ByteCode())
+	if err := vm.RunVM(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	integer := func(value int64) object.Object { return &object.Integer{Value: value} }
+
+	tests := []struct {
+		name     string
+		args     []object.Object
+		expected interface{}
+	}{
+		{"add", []object.Object{integer(2), integer(3)}, 5},
+		{"add", []object.Object{integer(-1), integer(1)}, 0},
+		{"greet", []object.Object{&object.String{Value: "you"}}, "hello you"},
+		{"nothing", nil, Null},
+		{"size", []object.Object{&object.String{Value: "four"}}, 4},
+	}
+	for _, tt := range tests {
+		result, err := vm.CallFunction(tt.name, tt.args...)
+		if err != nil {
+			t.Fatalf("CallFunction(%q) error: %s", tt.name, err)
+		}
+		testExpectedObject(t, tt.expected, result)
+	}
+
+	errorTests := []struct {
+		name     string
+		args     []object.Object
+		expected string
+	}{
+		{"missing", nil, "undefined global: missing"},
+		{"count", nil, "calling non-function"},
+		{"add", []object.Object{integer(1)}, "wrong number of arguments: want=2, got=1"},
+		{"add", []object.Object{integer(1), &object.String{Value: "a"}},
+			"invalid types for binary operation: INTEGER STRING"},
+		{"twice", []object.Object{integer(1), integer(1)}, "calling non-function"},
+	}
+	for _, tt := range errorTests {
+		_, err := vm.CallFunction(tt.name, tt.args...)
+		if err == nil {
+			t.Fatalf("expected CallFunction(%q) error but resulted in none.", tt.name)
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("wrong error: want=%q, got=%q", tt.expected, err.Error())
+		}
+	}
+
+	// a failed call leaves the VM usable
+	result, err := vm.CallFunction("add", integer(20), integer(22))
+	if err != nil {
+		t.Fatalf("CallFunction after errors: %s", err)
+	}
+	testExpectedObject(t, 42, result)
+	if vm.frameIndex != 1 {
+		t.Errorf("frames left behind by failed calls. want=1, got=%d", vm.frameIndex)
+	}
+}
+
+func TestFoldedIndexExpressions(t *testing.T) {
+	inputs := []string{
+		"[1, 2, 3][0]",
+		"[1, 2, 3][2]",
+		"[1, 2, 3][3]",
+		"[1, 2, 3][-1]",
+		"[[1, 2], [3, 4]][1][1]",
+		`["a", "b"][1] + "c"`,
+		`"日本語"[2]`,
+		`"日本語"[3]`,
+		"[1, 2][1 - 1] + 10",
+	}
+	for _, input := range inputs {
+		plain, folded := compiler.NewCompiler(), compiler.NewCompiler()
+		folded.EnableConstantFolding()
+
+		var results []object.Object
+		for _, comp := range []*compiler.Compiler{plain, folded} {
+			if err := comp.Compile(parse(input)); err != nil {
+				t.Fatalf("%s: compiler error: %s", input, err)
+			}
+			vm := NewVM(comp.ByteCode())
+			if err := vm.RunVM(); err != nil {
+				t.Fatalf("%s: vm error: %s", input, err)
+			}
+			results = append(results, vm.LastPoppedStackElement())
+		}
+		if !object.Equal(results[0], results[1]) {
+			t.Errorf("%s: folding changed the result. want=%s, got=%s",
+				input, results[0].Inspect(), results[1].Inspect())
+		}
+	}
+}
+
+func TestPopN(t *testing.T) {
+	ins, err := code.Assemble(`
+	OpConstant 0
+	OpConstant 1
+	OpConstant 2
+	OpConstant 3
+	OpPopN 3
+	`)
+	if err != nil {
+		t.Fatalf("assemble error: %s", err)
+	}
+	constants := []object.Object{
+		&object.Integer{Value: 1},
+		&object.Integer{Value: 2},
+		&object.Integer{Value: 3},
+		&object.Integer{Value: 4},
+	}
+	vm := NewVM(&compiler.ByteCode{Instructions: ins, Constants: constants})
+	if err := vm.RunVM(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	if vm.sp != 1 {
+		t.Fatalf("wrong stack pointer. want=1, got=%d", vm.sp)
+	}
+	testExpectedObject(t, 1, vm.stack[0])
+	testExpectedObject(t, 2, vm.LastPoppedStackElement())
+	for i := 2; i < 4; i++ {
+		if vm.stack[i] != nil {
+			t.Errorf("stack slot %d not cleared. got=%+v", i, vm.stack[i])
+		}
+	}
+}
+
 func runVmTests(t *testing.T, tests []vmTestCase) {
 	t.Helper()
 
@@ -605,6 +2684,19 @@ func testExpectedObject(t *testing.T, expected interface{}, actual object.Object
 				t.Errorf("testIntegerObject failed: %s", err)
 			}
 		}
+	case [][]int:
+		array, ok := actual.(*object.Array)
+		if !ok {
+			t.Errorf("object not Array: %T (%+v)", actual, actual)
+			return
+		}
+		if len(array.Elements) != len(expected) {
+			t.Errorf("wrong num of elements. want=%d, got=%d", len(expected), len(array.Elements))
+			return
+		}
+		for i, expectedElm := range expected {
+			testExpectedObject(t, expectedElm, array.Elements[i])
+		}
 	case map[object.HashKey]int64:
 		hash, ok := actual.(*object.Hash)
 		if !ok {
@@ -629,15 +2721,17 @@ func testExpectedObject(t *testing.T, expected interface{}, actual object.Object
 		if actual != Null {
 			t.Errorf("object is not Null: %T (%+v)", actual, actual)
 		}
-		// case *object.Error:
-		// 	errObj, ok := actual.(*object.Error)
-		// 	if !ok {
-		// 		t.Errorf("object is not Error: %T (%+v)", actual, actual)
-		// 		return
-		// 	}
-		// 	if errObj.Message != expected.Message {
-		// 		t.Errorf("wrong error message. expected=%q, got=%q", expected.Message, errObj.Message)
-		// 	}
+	case *object.Error:
+		errObj, ok := actual.(*object.Error)
+		if !ok {
+			t.Errorf("object is not Error: %T (%+v)", actual, actual)
+			return
+		}
+		if errObj.Message != expected.Message {
+			t.Errorf("wrong error message. expected=%q, got=%q", expected.Message, errObj.Message)
+		}
+	default:
+		t.Errorf("type of expected value not handled: %T (%+v)", expected, expected)
 	}
 }
 